@@ -0,0 +1,300 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"time"
+
+	"go.astrophena.name/base/cli"
+	"go.astrophena.name/tools/cmd/starlet/internal/bot"
+	"go.astrophena.name/tools/cmd/starlet/internal/source"
+	"go.astrophena.name/tools/internal/starlark/kvcache"
+	starlarkllm "go.astrophena.name/tools/internal/starlark/llm"
+	"go.astrophena.name/tools/internal/store"
+)
+
+// hostedBot is a bot hosted by the engine, with its own code, stores and LLM
+// usage stats.
+type hostedBot struct {
+	e *engine
+
+	// name identifies the bot in multi-bot mode. It's empty in single-bot
+	// mode.
+	name     string
+	tgToken  string
+	tgSecret string
+	tgOwner  int64
+
+	bot      *bot.Bot
+	logger   *slog.Logger
+	src      source.Source
+	store    store.Store // key-value cache of bot code
+	state    store.Store // state of the update queue and scheduled jobs
+	llmUsage *starlarkllm.Usage
+}
+
+// botConfig is the configuration of a hosted bot.
+type botConfig struct {
+	// Name identifies the bot in webhook and admin interface paths.
+	Name   string `json:"name"`
+	Token  string `json:"token"`
+	Secret string `json:"secret"`
+	Owner  int64  `json:"owner"`
+	// Source is where to load bot code from, in the same format as the
+	// -source flag.
+	Source string `json:"source"`
+	// DatabasePath is the path to the store file. The state of the update
+	// queue and scheduled jobs is kept next to it, in <path>.state.json. If
+	// empty, in-memory stores are used.
+	DatabasePath string `json:"database_path"`
+	// LLMUsagePath is the path to the LLM usage stats file. It defaults to
+	// <name>-llm-usage.json.
+	LLMUsagePath string `json:"llm_usage_path"`
+	// HTTPAllow lists hosts the http module can make requests to, in the
+	// format of HTTP_ALLOW.
+	HTTPAllow []string `json:"http_allow"`
+	// HTTPSecrets lists environment variables with secrets of the http
+	// module, in the format of HTTP_SECRETS.
+	HTTPSecrets []string `json:"http_secrets"`
+}
+
+// botsConfig is the configuration file of multi-bot mode.
+type botsConfig struct {
+	Bots []botConfig `json:"bots"`
+}
+
+var (
+	errConfigConflict = errors.New("SOURCE, GIST_ID, TG_TOKEN, TG_SECRET, TG_OWNER, DATABASE_PATH, LLM_USAGE_PATH, HTTP_ALLOW and HTTP_SECRETS can't be used with a bots config; set them for each bot in it")
+	errNoBots         = errors.New("bots config should list at least one bot")
+
+	botNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// botConfigs returns configurations of hosted bots: of bots listed in the
+// bots config in multi-bot mode, or of a single bot configured by
+// environment variables.
+func (e *engine) botConfigs() ([]botConfig, error) {
+	if e.config == "" {
+		if e.source == "" && e.gistID != "" {
+			e.source = "gist:" + e.gistID
+		}
+		if e.source == "" {
+			return nil, errNoSource
+		}
+		return []botConfig{{
+			Token:        e.tgToken,
+			Secret:       e.tgSecret,
+			Owner:        e.tgOwner,
+			Source:       e.source,
+			DatabasePath: e.databasePath,
+			LLMUsagePath: cmp.Or(e.llmUsagePath, "llm-usage.json"),
+			HTTPAllow:    splitList(e.httpAllow),
+			HTTPSecrets:  splitList(e.httpSecrets),
+		}}, nil
+	}
+
+	if e.source != "" || e.gistID != "" || e.tgToken != "" || e.tgSecret != "" || e.tgOwner != 0 || e.databasePath != "" || e.llmUsagePath != "" || e.httpAllow != "" || e.httpSecrets != "" {
+		return nil, errConfigConflict
+	}
+	b, err := os.ReadFile(e.config)
+	if err != nil {
+		return nil, err
+	}
+	var cfg botsConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", e.config, err)
+	}
+	if len(cfg.Bots) == 0 {
+		return nil, errNoBots
+	}
+
+	names := make(map[string]bool)
+	paths := make(map[string]string)
+	for i := range cfg.Bots {
+		c := &cfg.Bots[i]
+		if !botNameRe.MatchString(c.Name) {
+			return nil, fmt.Errorf("bots[%d]: name %q should consist of lowercase letters, digits, - and _", i, c.Name)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("bot %s: duplicate name", c.Name)
+		}
+		names[c.Name] = true
+		if c.Token == "" {
+			return nil, fmt.Errorf("bot %s: token is required", c.Name)
+		}
+		if c.Secret == "" && !e.poll {
+			return nil, fmt.Errorf("bot %s: secret is required", c.Name)
+		}
+		if c.Source == "" {
+			return nil, fmt.Errorf("bot %s: source is required", c.Name)
+		}
+		c.LLMUsagePath = cmp.Or(c.LLMUsagePath, c.Name+"-llm-usage.json")
+		files := []string{c.DatabasePath, c.LLMUsagePath}
+		if c.DatabasePath != "" {
+			files = append(files, statePath(c.DatabasePath))
+		}
+		for _, path := range files {
+			if path == "" {
+				continue
+			}
+			if other, ok := paths[path]; ok {
+				return nil, fmt.Errorf("bot %s: file %s is already used by bot %s", c.Name, path, other)
+			}
+			paths[path] = c.Name
+		}
+	}
+	return cfg.Bots, nil
+}
+
+// statePath returns the path of the file that keeps the update queue and
+// scheduled jobs of a bot whose database is at dbPath.
+func statePath(dbPath string) string {
+	return dbPath + ".state.json"
+}
+
+// initBot initializes a hosted bot: loads its code and sets up receiving of
+// updates. opts has options shared by all bots.
+func (e *engine) initBot(ctx context.Context, cfg botConfig, opts bot.Opts, llmConfig starlarkllm.Config) (_ *hostedBot, err error) {
+	hb := &hostedBot{
+		e:        e,
+		name:     cfg.Name,
+		tgToken:  cfg.Token,
+		tgSecret: cfg.Secret,
+		tgOwner:  cfg.Owner,
+		logger:   e.logger,
+	}
+	if hb.name != "" {
+		hb.logger = hb.logger.With("bot", hb.name)
+	}
+
+	hb.src, err = source.Parse(cfg.Source, e.gistc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The state is kept apart from the key-value cache, so bot code can't
+	// reach it, and never expires, so it survives long downtimes.
+	const kvCacheTTL = 24 * time.Hour
+	if cfg.DatabasePath != "" {
+		s, err := store.NewJSONFile(ctx, cfg.DatabasePath, kvCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		hb.store = s
+		state, err := store.NewJSONFile(ctx, statePath(cfg.DatabasePath), 0)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		hb.state = state
+	} else {
+		hb.store = store.NewMemStore(ctx, kvCacheTTL)
+		hb.state = store.NewMemStore(ctx, 0)
+	}
+	defer func() {
+		if err != nil {
+			hb.close()
+		}
+	}()
+
+	hb.llmUsage, err = starlarkllm.OpenUsage(cfg.LLMUsagePath, llmConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	me, err := hb.getMe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Token = cfg.Token
+	opts.HTTPAllow = cfg.HTTPAllow
+	opts.HTTPSecrets, opts.HTTPSecretHosts = parseSecrets(cfg.HTTPSecrets, cli.GetEnv(ctx).Getenv)
+	opts.Secret = cfg.Secret
+	opts.Owner = cfg.Owner
+	opts.BotID = me.Result.ID
+	opts.BotUsername = me.Result.Username
+	opts.KVCache = kvcache.Module(ctx, hb.store)
+	opts.Store = hb.state
+	opts.Logger = hb.logger.WithGroup("bot")
+	opts.LLMUsage = hb.llmUsage
+	hb.bot = bot.New(opts)
+
+	if err := hb.loadCode(ctx); err != nil {
+		return nil, err
+	}
+	if e.poll {
+		if err := hb.deleteWebhook(ctx); err != nil {
+			return nil, err
+		}
+	} else if err := hb.setWebhook(ctx); err != nil {
+		return nil, err
+	}
+	return hb, nil
+}
+
+// run processes queued updates, runs scheduled jobs, reloads bot code when it
+// changes, if the code source supports watching, and receives updates with
+// long polling if the -poll flag is set. It returns when ctx is canceled and
+// queued updates being processed are finished.
+func (hb *hostedBot) run(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		hb.bot.RunQueue(ctx)
+		close(done)
+	}()
+	go hb.bot.RunScheduler(ctx)
+	if w, ok := hb.src.(source.Watcher); ok {
+		go w.Watch(ctx, func() {
+			hb.logger.Info("bot code changed, reloading", "source", hb.src.String())
+			if err := hb.loadCode(ctx); err != nil {
+				hb.logger.Error("reloading bot code failed", "source", hb.src.String(), "err", err)
+			}
+		})
+	}
+	if hb.e.poll {
+		hb.pollUpdates(ctx)
+	}
+	<-done
+}
+
+// close closes the stores of the bot.
+func (hb *hostedBot) close() error {
+	return errors.Join(hb.store.Close(), hb.state.Close())
+}
+
+// loadCode loads bot code from the code source.
+func (hb *hostedBot) loadCode(ctx context.Context) error {
+	files, err := hb.src.Load(ctx)
+	if err != nil {
+		return err
+	}
+	return hb.bot.Load(ctx, files)
+}
+
+// label returns the label of an admin interface item of the bot, prefixed
+// with its name in multi-bot mode.
+func (hb *hostedBot) label(s string) string {
+	if hb.name == "" {
+		return s
+	}
+	return hb.name + ": " + s
+}
+
+// debugSlug returns the path of a debug page of the bot relative to /debug/.
+func (hb *hostedBot) debugSlug(slug string) string {
+	if hb.name == "" {
+		return slug
+	}
+	return "bots/" + hb.name + "/" + slug
+}
@@ -5,8 +5,8 @@
 /*
 Starlet is a Telegram bot runner powered by Starlark.
 
-It fetches bot logic written in Starlark from a specified GitHub Gist,
-executes it within a Starlark interpreter, and handles incoming Telegram updates
+It loads bot logic written in Starlark from a GitHub Gist, a local directory
+or a Git repository, executes it within a Starlark interpreter, and handles incoming Telegram updates
 via webhooks. Starlet provides a sandboxed environment with pre-defined modules
 for interacting with Telegram, LLM, key-value caching, and more.
 
@@ -15,19 +15,114 @@ into a Starlark dictionary, and invokes the handle function defined in the
 user's bot.star script. Errors during execution are caught and reported back
 to the bot owner via Telegram, using a customizable error template.
 
+# Update Queue
+
+Received updates are put in a queue before they are handled. Updates from the
+same chat are handled one at a time, in the order they arrived, while updates
+from different chats are handled in parallel. With DATABASE_PATH set, the
+queue is kept in <DATABASE_PATH>.state.json, apart from the key-value cache and
+without its expiration, so updates that weren't handled before Starlet stopped
+are handled after it starts again. Updates that Telegram delivers again are
+handled once: an update is dropped if one with the same update_id is still in
+the queue or was among the last 1000 handled.
+
+If handle fails with a transient error, such as a Telegram rate limit (HTTP
+429), a Telegram server error or a network error, the update is handled again
+after a growing delay, up to five times in total. Note that handle runs from
+the start on each attempt. Other errors, and errors that persist, are reported
+as usual.
+
 # Usage
 
 	$ starlet [flags...]
 
 Run starlet -help to see all available flags.
 
+To run tests of bot code in a directory (see Testing below):
+
+	$ starlet test [-run regexp] [-v] dir
+
+The test command must be the first argument. Starlet refuses to start if it
+comes after flags, as in starlet -poll test dir.
+
+# Long Polling
+
+By default, Starlet receives updates with a webhook, which requires a public
+host. To run a bot without one, for example on a laptop during development,
+pass the -poll flag:
+
+	$ starlet -poll
+
+In this mode, Starlet deletes the webhook and receives updates with the
+getUpdates method instead. Updates are handled exactly like webhook requests,
+so the same bot.star works in both modes. HOST and TG_SECRET aren't needed,
+and the public endpoint doesn't serve /telegram. As Telegram only delivers
+updates one way at a time, run the bot without -poll again to restore the
+webhook.
+
 # Starlark Environment
 
 See https://bot.astrophena.name/env.
 
-# GitHub Gist Structure
-
-The bot's code and configuration reside in a GitHub Gist, which must contain:
+# Code Sources
+
+The -source flag (or the SOURCE environment variable) selects where the bot's
+code is loaded from:
+
+  - gist:ID: files of a GitHub Gist. If no source is set, GIST_ID is used.
+  - dir:/path: files of a local directory, including subdirectories. Hidden
+    files and directories are skipped. Starlet watches the directory and
+    reloads the code when a file changes.
+  - git:/path/to/repo@ref: files committed to a local Git repository at ref,
+    which can be a branch, a tag or a commit and defaults to HEAD. To load a
+    subdirectory, use Git tree syntax, for example
+    git:/srv/monorepo@main:bots/echo. Uncommitted changes are ignored, so a
+    new version is picked up after a reload.
+
+The /debug/reload endpoint reloads the code from any source.
+
+# Multiple Bots
+
+One Starlet process can host several bots. List them in a JSON file passed
+with the -config flag (or the CONFIG environment variable):
+
+	{
+	  "bots": [
+	    {
+	      "name": "echo",
+	      "token": "123456:ABC-DEF...",
+	      "secret": "...",
+	      "owner": 123456789,
+	      "source": "git:/srv/bots@main:echo",
+	      "database_path": "echo.db",
+	      "http_allow": ["api.example.com"],
+	      "http_secrets": ["ECHO_API_KEY@api.example.com"]
+	    },
+	    {
+	      "name": "digest",
+	      ...
+	    }
+	  ]
+	}
+
+Each bot has its own code, interpreter, key-value cache and update queue, and
+is configured by the fields of its entry, which replace the corresponding
+environment variables: token (TG_TOKEN), secret (TG_SECRET), owner
+(TG_OWNER), source (SOURCE), database_path (DATABASE_PATH), llm_usage_path
+(LLM_USAGE_PATH, defaulting to <name>-llm-usage.json), and the lists
+http_allow (HTTP_ALLOW) and http_secrets (HTTP_SECRETS), so a bot can only
+reach its own hosts and use its own secrets. Setting any of these environment
+variables together with a config is an error. Names may contain lowercase
+letters, digits, - and _. Bots can't share files.
+
+The webhook of each bot is served at /telegram/<name>. Other settings, such as
+HOST, the LLM gateway and LLM_CONFIG, are shared by all bots. Note that
+budgets are enforced separately for each bot, as each has its own usage
+stats.
+
+# Bot Code Structure
+
+The bot's code and configuration must contain:
 
   - bot.star: The main Starlark script containing the bot's logic. Must define the handle function.
   - error.tmpl (optional): A Go template string used for formatting error messages sent to the owner.
@@ -49,12 +144,75 @@ The bot.star script *must* define a function named handle that accepts a single
 Optionally, you can define an on_load function:
 
 	def on_load():
-	    # Code here runs every time the bot code is loaded from the Gist,
+	    # Code here runs every time the bot code is loaded from its source,
 	    # including the initial startup and after a reload via the debug interface.
 	    # Useful for setup tasks like setting bot commands.
 	    pass
 
-Starlet calls handle for each incoming Telegram update webhook. It calls on_load after successfully loading or reloading the code from the Gist.
+Starlet calls handle for each incoming Telegram update webhook. It calls on_load after successfully loading or reloading the code.
+
+Each call of handle, on_load or a scheduled job is limited in the number of
+computation steps and in time (see MAX_STEPS and TIMEOUT below), so a buggy
+loop can't hang the bot. Calls exceeding a limit are stopped and reported to
+the bot owner with a Starlark backtrace. When Starlet shuts down, running
+calls are canceled. The /debug/ page counts calls and limit violations.
+
+# Scheduled Jobs
+
+on_load can register jobs that run periodically with the schedule function:
+
+	def on_load():
+	    schedule("digest", "0 9 * * *", send_digest)
+	    schedule("poll", "15m", poll_api)
+
+A schedule is either an interval or a cron expression. Jobs run in the
+background, each in its own thread, and their errors are reported to the bot
+owner. The state of jobs is kept next to the update queue, so with
+DATABASE_PATH set, runs missed while Starlet was stopped happen once on
+startup. The /debug/ page shows the status of each job.
+
+# Testing
+
+The test command runs tests of bot code without deploying it:
+
+	$ starlet test ./mybot
+
+Tests are functions named test_* in files named test_*.star, which live
+alongside bot.star and can load it. Each test gets a fresh bot with an
+in-memory key-value cache, talking to a fake Telegram Bot API that records
+calls and to a fake LLM API that returns canned replies. on_load runs before
+each test. A test is passed an object t with these members:
+
+  - t.message(text, chat_id=config.owner_id, from_id=chat_id): passes an
+    update with a text message to handle.
+  - t.update(update): passes an arbitrary update to handle.
+  - t.calls(method=None): returns Telegram API calls made so far, optionally
+    only of a method, as structs with method and args fields.
+  - t.respond(method, result=True, error=""): sets the result of calls of a
+    method. By default, methods that send or edit messages return a message,
+    and others return True. If error is set, calls fail with it.
+  - t.llm_reply(text): adds a canned reply of llm.generate or llm.stream,
+    which receives it word by word. Replies are used in order, and calls
+    fail if there are none left.
+  - t.llm_requests(): returns requests made to the LLM API so far.
+  - t.reset(): forgets recorded Telegram and LLM API calls.
+  - t.eq(got, want, msg=""), t.true(cond, msg=""): report a failure if the
+    values differ or the condition is false, and continue the test.
+  - t.error(msg), t.fatal(msg): report a failure and continue or stop the
+    test.
+
+Errors in handle and other errors fail the test with a backtrace. For example:
+
+	def test_echo(t):
+	    t.message("hi")
+	    calls = t.calls("sendMessage")
+	    t.eq(len(calls), 1)
+	    t.eq(calls[0].args["text"], "hi")
+
+Results are printed like go test does, and the command fails if any test
+fails. Pass -v to print all tests and their logs, including output of print,
+and -run to run only tests with names, in the form file/function, matching a
+regular expression.
 
 # Environment Variables
 
@@ -62,31 +220,97 @@ Starlet is configured using environment variables:
 
 Required:
 
-  - GIST_ID: The ID of the GitHub Gist containing the bot.star file.
+  - SOURCE or GIST_ID: Where to load bot code from (see Code Sources above).
+    GIST_ID is the ID of a GitHub Gist containing the bot.star file.
   - HOST: The publicly accessible domain name for the bot (e.g., mybot.example.com). Used for setting the Telegram webhook.
+    Not needed with -poll.
   - TG_OWNER: The numeric Telegram User ID of the bot's owner (receives error reports).
   - TG_SECRET: A secret token passed to Telegram when setting the webhook (X-Telegram-Bot-Api-Secret-Token). Telegram includes this token in the header of webhook requests, and Starlet verifies it.
+    Not needed with -poll.
   - TG_TOKEN: The token for your Telegram Bot API.
 
+In multi-bot mode, SOURCE, GIST_ID, TG_OWNER, TG_SECRET and TG_TOKEN are set
+for each bot in the config instead (see Multiple Bots above).
+
 Optional:
 
+  - CONFIG: Path to a JSON file listing hosted bots (see Multiple Bots above).
   - DATABASE_PATH: Path to a SQLite database file. If not provided, an in-memory store is used.
   - LLM_API_KEY: API key for an OpenAI-compatible gateway (required to use llm).
   - LLM_API_URL: API root URL for an OpenAI-compatible gateway, for example
     https://api.openai.com/v1 (required to use llm).
   - LLM_USAGE_PATH: Path to persistent JSON file with per-key token usage stats
     for llm module. Defaults to llm-usage.json in current directory.
+  - LLM_CONFIG: Path to a JSON file with model prices and budgets of the llm
+    module (see LLM Budgets below).
+  - MAX_STEPS: Maximum number of Starlark computation steps a single call of
+    handle, on_load or a scheduled job can take. Defaults to 100000000.
+  - TIMEOUT: Maximum time a single call of handle, on_load or a scheduled job
+    can take, for example 30s. Defaults to 2m.
+  - HTTP_ALLOW: Comma-separated list of hosts the http module can make requests
+    to, for example api.example.com,*.example.org. A host starting with "*."
+    also matches its subdomains. If empty, the http module can't make any
+    requests.
+  - HTTP_SECRETS: Comma-separated list of environment variables with secrets,
+    such as API keys, that bot code can reference with {secret:NAME} in
+    requests made by the http module. Their values are never visible to bot
+    code and are scrubbed from responses. A secret written as NAME@host, for
+    example WEATHER_KEY@api.example.com, can only be sent to that host; list
+    it again to allow more hosts. Host patterns are the same as in HTTP_ALLOW.
   - GH_TOKEN: A GitHub Personal Access Token (PAT) with gist scope. Recommended for higher rate limits.
 
+# LLM Budgets
+
+Usage of the llm module can be limited by budgets configured in the file
+passed with LLM_CONFIG. For example:
+
+	{
+	  "prices": {
+	    "gpt-4.1-mini": {"input": 0.4, "output": 1.6}
+	  },
+	  "budgets": [
+	    {"key": "chat:*", "daily_tokens": 200000},
+	    {"key": "*", "shared": true, "monthly_cost": 20}
+	  ]
+	}
+
+Prices are in US dollars per million input and output tokens, and are used to
+calculate the cost of each request when it's made. Models without a price
+don't count towards cost budgets.
+
+A budget applies to usage keys matching its key pattern, with * matching any
+characters except /. A pattern of just * matches all keys. It limits tokens or cost per UTC day (daily_tokens,
+daily_cost) or month (monthly_tokens, monthly_cost), separately for each
+matching key, or in total for all of them if shared is true. Before each
+request, llm.generate and llm.stream check budgets of the usage key, which
+must not be empty, and fail if any is exhausted. To handle this in bot code, pass a function as the
+on_budget_exceeded argument; its result is returned instead.
+
 # Admin Interface
 
 Starlet provides a debug and admin interface, served on the address specified by the -admin-addr flag. Access control is expected to be handled at the network level (e.g., a Unix socket with restricted permissions or a firewall).
 
 The interface includes:
 
-  - /debug/: Shows basic bot info, loaded Starlark modules, and links to other debug pages.
+  - /debug/: Shows basic bot info, loaded Starlark modules, the update queue,
+    scheduled jobs, and links to other debug pages.
   - /debug/logs: Streams the last 300 lines of logs in real-time.
-  - /debug/reload: Triggers an immediate reload of the bot code from the GitHub Gist.
+  - /debug/reload: Triggers an immediate reload of the bot code from its source.
+  - /debug/llm: Shows usage of the llm module by usage key, model and day,
+    and the state of budgets.
+  - /debug/updates: Shows the last 100 handled updates, scrubbed of secrets,
+    with their outcome and the Starlark backtrace of errors. Any of them can
+    be replayed against the currently loaded code, for example after fixing
+    a bug and reloading the code. A dry replay captures Telegram Bot API calls
+    made with telegram.call and shows them instead of sending them. Other
+    side effects are disabled: http.post, llm.generate and llm.stream fail,
+    and kvcache.set discards values. Reads, like http.get, kvcache.get and
+    telegram.get_file, still happen. Errors of replays are shown on the page and aren't reported to
+    chats. Updates are kept only in memory.
+
+In multi-bot mode, /debug/ shows the info of each bot prefixed with its name,
+and the reload, llm and updates pages of a bot are served under
+/debug/bots/<name>/, for example /debug/bots/echo/updates.
 
 [Starlark]: https://starlark-lang.org/
 */
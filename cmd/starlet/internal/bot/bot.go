@@ -8,6 +8,7 @@
 package bot
 
 import (
+	"cmp"
 	"context"
 	"embed"
 	"encoding/json"
@@ -18,6 +19,7 @@ import (
 	"net/http"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"go.astrophena.name/base/request"
 	"go.astrophena.name/base/version"
@@ -25,6 +27,8 @@ import (
 	"go.astrophena.name/tools/internal/api/llm"
 	"go.astrophena.name/tools/internal/starlark/go2star"
 	"go.astrophena.name/tools/internal/starlark/interpreter"
+	starlarkllm "go.astrophena.name/tools/internal/starlark/llm"
+	"go.astrophena.name/tools/internal/store"
 	"go.astrophena.name/tools/internal/tgmarkup"
 
 	"go.starlark.net/starlark"
@@ -64,14 +68,27 @@ type Bot struct {
 	tgBotID       int64
 	tgBotUsername string
 
-	httpc        *http.Client
-	llmc         *llm.Client
-	llmUsagePath string
-	kvCache      *starlarkstruct.Module
-	scrubber     *strings.Replacer
-	logger       *slog.Logger
+	httpc           *http.Client
+	httpAllow       []string
+	httpSecrets     map[string]string
+	httpSecretHosts map[string][]string
+	llmc            *llm.Client
+	llmUsage        *starlarkllm.Usage
+	kvCache         *starlarkstruct.Module
+	store           store.Store
+	scrubber        *strings.Replacer
+	logger          *slog.Logger
+	maxSteps        uint64
+	timeout         time.Duration
+	maxAttempts     int
+	retryWait       time.Duration
+	maxRecorded     int
 
 	instance atomic.Pointer[instance]
+	sched    scheduler
+	stats    execStats
+	queue    queue
+	recorder recorder
 }
 
 // instance holds the state that can be hot-reloaded.
@@ -95,33 +112,74 @@ type Opts struct {
 	BotUsername string
 	// HTTPClient is the HTTP client to use for making requests.
 	HTTPClient *http.Client
+	// HTTPAllow is the list of hosts the http module can make requests to.
+	HTTPAllow []string
+	// HTTPSecrets maps names of secrets that bot code can reference in requests
+	// made by the http module to their values.
+	HTTPSecrets map[string]string
+	// HTTPSecretHosts optionally binds secrets, by name, to hosts they can be
+	// sent to. Secrets without an entry can be sent to any allowed host.
+	HTTPSecretHosts map[string][]string
 	// LLMClient is the client for interacting with an OpenAI-compatible LLM API.
 	LLMClient *llm.Client
-	// LLMUsagePath is path to persistent usage stats JSON for llm module.
-	LLMUsagePath string
+	// LLMUsage tracks token usage of the llm module and enforces budgets. If
+	// nil, usage isn't tracked.
+	LLMUsage *starlarkllm.Usage
 	// KVCache is the key-value cache for Starlark.
 	KVCache *starlarkstruct.Module
+	// Store persists the state of scheduled jobs and queued updates across
+	// restarts. If nil, they are kept only in memory. It must not be the store
+	// of KVCache, so bot code can't read or overwrite the state, and it
+	// shouldn't expire entries.
+	Store store.Store
 	// Scrubber is used to scrub sensitive information from logs.
 	Scrubber *strings.Replacer
 	// Logger is a slog.Logger used for logging.
 	Logger *slog.Logger
+	// MaxSteps is the maximum number of Starlark computation steps an
+	// invocation of bot code can take. It defaults to DefaultMaxSteps.
+	MaxSteps uint64
+	// Timeout is the maximum time an invocation of bot code can take. It
+	// defaults to DefaultTimeout.
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts to handle an update that fails
+	// with a transient error, like a Telegram rate limit. It defaults to
+	// DefaultMaxAttempts.
+	MaxAttempts int
+	// RetryWait is the wait before the first retry of an update. It defaults
+	// to DefaultRetryWait.
+	RetryWait time.Duration
+	// RecordedUpdates is the number of last handled updates that are kept for
+	// inspection and replay. It defaults to DefaultRecordedUpdates.
+	RecordedUpdates int
 }
 
 // New creates a new Bot instance.
 func New(opts Opts) *Bot {
-	return &Bot{
-		tgToken:       opts.Token,
-		tgSecret:      opts.Secret,
-		tgOwner:       opts.Owner,
-		tgBotID:       opts.BotID,
-		tgBotUsername: opts.BotUsername,
-		httpc:         opts.HTTPClient,
-		llmc:          opts.LLMClient,
-		llmUsagePath:  opts.LLMUsagePath,
-		kvCache:       opts.KVCache,
-		scrubber:      opts.Scrubber,
-		logger:        opts.Logger,
+	b := &Bot{
+		tgToken:         opts.Token,
+		tgSecret:        opts.Secret,
+		tgOwner:         opts.Owner,
+		tgBotID:         opts.BotID,
+		tgBotUsername:   opts.BotUsername,
+		httpc:           opts.HTTPClient,
+		httpAllow:       opts.HTTPAllow,
+		httpSecrets:     opts.HTTPSecrets,
+		httpSecretHosts: opts.HTTPSecretHosts,
+		llmc:            opts.LLMClient,
+		llmUsage:        opts.LLMUsage,
+		kvCache:         opts.KVCache,
+		store:           opts.Store,
+		scrubber:        opts.Scrubber,
+		logger:          opts.Logger,
+		maxSteps:        cmp.Or(opts.MaxSteps, DefaultMaxSteps),
+		timeout:         cmp.Or(opts.Timeout, DefaultTimeout),
+		maxAttempts:     cmp.Or(opts.MaxAttempts, DefaultMaxAttempts),
+		retryWait:       cmp.Or(opts.RetryWait, DefaultRetryWait),
+		maxRecorded:     cmp.Or(opts.RecordedUpdates, DefaultRecordedUpdates),
 	}
+	b.sched.wake = make(chan struct{}, 1)
+	return b
 }
 
 // Documentation generates and returns Markdown-formatted documentation for the
@@ -152,6 +210,10 @@ func (b *Bot) Load(ctx context.Context, files map[string]string) error {
 		Logger: func(file string, line int, message string) {
 			starlarkLogger.Info(message, "file", file, "line", line)
 		},
+		// Limits top-level code of modules too.
+		ThreadModifier: func(th *starlark.Thread) {
+			th.SetMaxExecutionSteps(b.maxSteps)
+		},
 		Packages: map[string]interpreter.Loader{
 			interpreter.MainPkg: interpreter.MemoryLoader(files),
 			"starlet":           interpreter.FSLoader(libFS),
@@ -165,12 +227,16 @@ func (b *Bot) Load(ctx context.Context, files map[string]string) error {
 	if err != nil {
 		return err
 	}
+	var jobs []*job
 	if hook, ok := mod["on_load"]; ok {
-		_, err = starlark.Call(intr.Thread(ctx), hook, starlark.Tuple{}, nil)
+		_, err = b.call(ctx, intr, "on_load", hook, starlark.Tuple{}, map[string]any{jobsLocalKey: &jobs})
 		if err != nil {
 			return err
 		}
 	}
+	for _, j := range jobs {
+		j.intr = intr
+	}
 
 	newInst := &instance{
 		files: files,
@@ -182,11 +248,13 @@ func (b *Bot) Load(ctx context.Context, files map[string]string) error {
 		newInst.errorTemplate = defaultErrorTemplate
 	}
 	b.instance.Store(newInst)
+	b.sched.setJobs(jobs)
 
 	return nil
 }
 
-// HandleTelegramWebhook handles a Telegram webhook request.
+// HandleTelegramWebhook handles a Telegram webhook request by adding the
+// update to the queue.
 func (b *Bot) HandleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("X-Telegram-Bot-Api-Secret-Token") != b.tgSecret {
 		web.RespondJSONError(w, r, web.ErrNotFound)
@@ -198,33 +266,60 @@ func (b *Bot) HandleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
 		web.RespondJSONError(w, r, err)
 		return
 	}
-	update, err := go2star.To(rawUpdate)
-	if err != nil {
+	if err := b.Enqueue(r.Context(), rawUpdate); err != nil {
+		// Telegram retries the update later.
 		web.RespondJSONError(w, r, err)
 		return
 	}
 
-	var (
-		chatID = b.lookupChatID(rawUpdate)
-		inst   = b.instance.Load()
-	)
-	mod, err := inst.intr.LoadModule(r.Context(), interpreter.MainPkg, mainFile)
+	web.RespondJSON(w, ok)
+}
+
+// HandleUpdate passes a decoded Telegram update to the handle function of the
+// loaded bot code right away, bypassing the queue. Errors in bot code are
+// reported to the chat the update came from and aren't returned; HandleUpdate
+// only fails if the update can't be converted to a Starlark value.
+func (b *Bot) HandleUpdate(ctx context.Context, rawUpdate map[string]any) error {
+	update, err := go2star.To(rawUpdate)
 	if err != nil {
-		b.reportError(r.Context(), chatID, w, err)
-		return
+		return err
+	}
+	start := time.Now()
+	b.report(ctx, rawUpdate, start, b.handle(ctx, update, nil))
+	return nil
+}
+
+// handle calls the handle function of the loaded bot code, setting thread
+// locals from locals.
+func (b *Bot) handle(ctx context.Context, update starlark.Value, locals map[string]any) error {
+	inst := b.instance.Load()
+	mod, err := inst.intr.LoadModule(ctx, interpreter.MainPkg, mainFile)
+	if err != nil {
+		return err
 	}
 	f, ok := mod["handle"]
 	if !ok {
-		b.reportError(r.Context(), chatID, w, errNoHandleFunc)
-		return
-	}
-	_, err = starlark.Call(inst.intr.Thread(r.Context()), f, starlark.Tuple{update}, nil)
-	if err != nil {
-		b.reportError(r.Context(), chatID, w, err)
-		return
+		return errNoHandleFunc
 	}
+	_, err = b.call(ctx, inst.intr, "handle", f, starlark.Tuple{update}, locals)
+	return err
+}
 
-	web.RespondJSON(w, ok)
+// report records the outcome of handling an update that started at start, and
+// reports an error, if any.
+func (b *Bot) report(ctx context.Context, rawUpdate map[string]any, start time.Time, err error) {
+	b.record(rawUpdate, start, err)
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		// Nobody is waiting for the result anymore.
+		b.logger.Warn("handling update canceled", "err", err)
+	case errors.As(err, new(*limitError)):
+		// Limit violations are bugs in bot code, so they go to the owner.
+		b.reportError(ctx, b.tgOwner, err)
+	default:
+		b.reportError(ctx, b.lookupChatID(rawUpdate), err)
+	}
 }
 
 var ok = map[string]string{
@@ -265,14 +360,8 @@ type message struct {
 	LinkPreviewOptions linkPreviewOptions `json:"link_preview_options"`
 }
 
-func (b *Bot) reportError(ctx context.Context, chatID int64, w http.ResponseWriter, err error) {
-	errMsg := err.Error()
-	if evalErr, ok := err.(*starlark.EvalError); ok {
-		errMsg = evalErr.Backtrace()
-	}
-	if b.scrubber != nil {
-		errMsg = b.scrubber.Replace(errMsg)
-	}
+func (b *Bot) reportError(ctx context.Context, chatID int64, err error) {
+	errMsg := b.errorText(err)
 
 	msg := message{
 		ChatID: chatID,
@@ -300,6 +389,4 @@ func (b *Bot) reportError(ctx context.Context, chatID int64, w http.ResponseWrit
 	if sendErr != nil {
 		b.logger.Error("reporting an error failed", "err", err, "bot_owner", b.tgOwner, "send_err", sendErr)
 	}
-
-	web.RespondJSON(w, ok)
 }
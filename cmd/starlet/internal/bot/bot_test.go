@@ -5,6 +5,7 @@
 package bot_test
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"io"
@@ -66,6 +67,9 @@ func TestHandleTelegramWebhook(t *testing.T) {
 
 		tm := testMux(t, nil)
 		bot := testBot(t, tm, files)
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		go bot.RunQueue(ctx)
 
 		mux := http.NewServeMux()
 		mux.HandleFunc("/telegram", bot.HandleTelegramWebhook)
@@ -82,7 +86,10 @@ func TestHandleTelegramWebhook(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		waitQueue(t, bot)
 
+		tm.mu.Lock()
+		defer tm.mu.Unlock()
 		calls, err := json.MarshalIndent(tm.telegramCalls, "", "  ")
 		if err != nil {
 			t.Fatal(err)
@@ -109,6 +116,18 @@ func testBot(t *testing.T, m *mux, files map[string]string) *bot.Bot {
 	return b
 }
 
+// waitQueue waits until the bot processes all queued updates.
+func waitQueue(t *testing.T, b *bot.Bot) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for b.QueueStats().Pending > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("queued updates weren't processed in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 type mux struct {
 	mux           *http.ServeMux
 	mu            sync.Mutex
@@ -12,6 +12,7 @@ import (
 
 	"go.astrophena.name/base/version"
 	"go.astrophena.name/tools/internal/starlark/go2star"
+	starlarkhttp "go.astrophena.name/tools/internal/starlark/http"
 	"go.astrophena.name/tools/internal/starlark/kvcache"
 	"go.astrophena.name/tools/internal/starlark/llm"
 	"go.astrophena.name/tools/internal/starlark/telegram"
@@ -162,10 +163,21 @@ func (b *Bot) environment() Environment {
 				},
 			},
 		},
+		{
+			Name: "http",
+			Doc:  starlarkhttp.Documentation(),
+			Value: starlarkhttp.Module(starlarkhttp.Config{
+				HTTPClient:  b.httpc,
+				Allow:       b.httpAllow,
+				Secrets:     b.httpSecrets,
+				SecretHosts: b.httpSecretHosts,
+				Scrubber:    b.scrubber,
+			}),
+		},
 		{
 			Name:  "llm",
 			Doc:   llm.Documentation(),
-			Value: llm.Module(b.llmc, b.llmUsagePath),
+			Value: llm.Module(b.llmc, b.llmUsage),
 		},
 		{
 			Name:  "kvcache",
@@ -190,6 +202,34 @@ func (b *Bot) environment() Environment {
 			Doc:   "Instantiates a module struct with the name from the specified keyword arguments.",
 			Value: starlark.NewBuiltin("module", starlarkstruct.MakeModule),
 		},
+		{
+			Name: "schedule",
+			Args: []string{"id: str", "schedule: str", "fn: callable"},
+			Doc: `Schedules fn to be called without arguments. It can only be called from
+on_load, and the jobs are replaced each time the bot code is reloaded.
+
+id identifies the job across reloads and restarts. schedule is either an
+interval like "30m" or "24h", or a cron expression with five fields (minute,
+hour, day of month, month and day of week) like "0 9 * * mon-fri", evaluated
+in the server's local time. The shortcuts @hourly, @daily, @weekly, @monthly
+and @yearly are also accepted.
+
+Each run gets its own thread. A run is skipped if the previous one hasn't
+finished yet. If a run was missed because Starlet wasn't running, the job runs
+once as soon as it starts again. Errors are reported to the bot owner.
+
+For example:
+
+	def remind():
+	    telegram.call(
+	        method="sendMessage",
+	        args={"chat_id": config.owner_id, "text": "Drink some water!"},
+	    )
+
+	def on_load():
+	    schedule("water", "0 10-18/2 * * *", remind)`,
+			Value: starlark.NewBuiltin("schedule", starlarkSchedule),
+		},
 		{
 			Name:  "struct",
 			Args:  []string{"**fields"},
@@ -0,0 +1,636 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.astrophena.name/tools/internal/api/llm"
+	"go.astrophena.name/tools/internal/starlark/go2star"
+	"go.astrophena.name/tools/internal/starlark/interpreter"
+	"go.astrophena.name/tools/internal/starlark/kvcache"
+	"go.astrophena.name/tools/internal/store"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Configuration of bots under test.
+const (
+	testToken       = "123456:TEST"
+	testOwner       = 123456789
+	testBotID       = 987654321
+	testBotUsername = "testbot"
+	testLLMURL      = "https://llm.test/v1"
+)
+
+// TestOpts configures RunTests.
+type TestOpts struct {
+	// Output receives test results.
+	Output io.Writer
+	// Run, if not nil, selects tests to run by their names in the form
+	// file/function.
+	Run *regexp.Regexp
+	// Verbose enables printing all tests and their logs, not only failed ones.
+	Verbose bool
+}
+
+// RunTests runs tests of bot code in files. Tests are functions with names
+// starting with test_ in files with names starting with test_ and ending with
+// .star. Each test gets a fresh bot that talks to a fake Telegram Bot API and
+// a fake LLM API, and is passed an object to send updates, inspect API calls
+// and make assertions with.
+//
+// Results are printed to opts.Output in the format of go test. RunTests
+// reports whether all tests passed.
+func RunTests(ctx context.Context, files map[string]string, opts TestOpts) bool {
+	var testFiles []string
+	for name := range files {
+		base := path.Base(name)
+		if strings.HasPrefix(base, "test_") && strings.HasSuffix(base, ".star") {
+			testFiles = append(testFiles, name)
+		}
+	}
+	slices.Sort(testFiles)
+	if len(testFiles) == 0 {
+		fmt.Fprintln(opts.Output, "testing: no test files")
+		return true
+	}
+
+	passed := true
+	for _, file := range testFiles {
+		funcs, err := testFuncs(ctx, files, file)
+		if err != nil {
+			res := &testResult{name: file, failures: []string{errorMessage(err)}}
+			res.print(opts.Output, opts.Verbose)
+			passed = false
+			continue
+		}
+		for _, fn := range funcs {
+			name := file + "/" + fn
+			if opts.Run != nil && !opts.Run.MatchString(name) {
+				continue
+			}
+			if opts.Verbose {
+				fmt.Fprintf(opts.Output, "=== RUN   %s\n", name)
+			}
+			res := runTest(ctx, files, file, fn)
+			res.name = name
+			res.print(opts.Output, opts.Verbose)
+			if res.failed() {
+				passed = false
+			}
+		}
+	}
+	if passed {
+		fmt.Fprintln(opts.Output, "PASS")
+	} else {
+		fmt.Fprintln(opts.Output, "FAIL")
+	}
+	return passed
+}
+
+// testFuncs returns names of test functions defined in a test file, in the
+// order they are defined.
+func testFuncs(ctx context.Context, files map[string]string, file string) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	b, _ := newTestBot(ctx, io.Discard)
+	if err := b.Load(ctx, files); err != nil {
+		return nil, err
+	}
+	mod, err := b.instance.Load().intr.LoadModule(ctx, interpreter.MainPkg, file)
+	if err != nil {
+		return nil, err
+	}
+	var funcs []*starlark.Function
+	for name, v := range mod {
+		if fn, ok := v.(*starlark.Function); ok && strings.HasPrefix(name, "test_") {
+			funcs = append(funcs, fn)
+		}
+	}
+	slices.SortFunc(funcs, func(a, b *starlark.Function) int {
+		return cmp.Compare(a.Position().Line, b.Position().Line)
+	})
+	names := make([]string, len(funcs))
+	for i, fn := range funcs {
+		names[i] = fn.Name()
+	}
+	return names, nil
+}
+
+// testResult is the result of a test.
+type testResult struct {
+	name     string
+	duration time.Duration
+	failures []string
+	log      bytes.Buffer
+}
+
+func (r *testResult) failed() bool { return len(r.failures) > 0 }
+
+func (r *testResult) print(w io.Writer, verbose bool) {
+	if !r.failed() && !verbose {
+		return
+	}
+	status := "PASS"
+	if r.failed() {
+		status = "FAIL"
+	}
+	fmt.Fprintf(w, "--- %s: %s (%.2fs)\n", status, r.name, r.duration.Seconds())
+	for _, f := range r.failures {
+		fmt.Fprintln(w, indent(strings.TrimSpace(f)))
+	}
+	if r.log.Len() > 0 {
+		fmt.Fprintln(w, indent(strings.TrimSuffix(r.log.String(), "\n")))
+	}
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(s, "\n", "\n    ")
+}
+
+// errorMessage returns the message of err with a Starlark backtrace, if it has
+// one.
+func errorMessage(err error) string {
+	if evalErr, ok := errors.AsType[*starlark.EvalError](err); ok {
+		return evalErr.Backtrace()
+	}
+	return err.Error()
+}
+
+// errFatal stops a test after t.fatal was called.
+var errFatal = errors.New("test failed")
+
+func runTest(ctx context.Context, files map[string]string, file, fn string) *testResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	res := new(testResult)
+	start := time.Now()
+	defer func() { res.duration = time.Since(start) }()
+
+	b, api := newTestBot(ctx, &res.log)
+	if err := b.Load(ctx, files); err != nil {
+		res.failures = append(res.failures, "loading bot code: "+errorMessage(err))
+		return res
+	}
+	intr := b.instance.Load().intr
+	mod, err := intr.LoadModule(ctx, interpreter.MainPkg, file)
+	if err != nil {
+		res.failures = append(res.failures, errorMessage(err))
+		return res
+	}
+
+	tc := &testCase{bot: b, api: api, res: res}
+	if _, err := b.call(ctx, intr, fn, mod[fn], starlark.Tuple{tc.value()}, nil); err != nil && !errors.Is(err, errFatal) {
+		res.failures = append(res.failures, errorMessage(err))
+	}
+	return res
+}
+
+func newTestBot(ctx context.Context, log io.Writer) (*Bot, *fakeAPI) {
+	api := newFakeAPI()
+	httpc := &http.Client{Transport: api}
+	logger := slog.New(&testLogHandler{mu: new(sync.Mutex), w: log})
+	b := New(Opts{
+		Token:       testToken,
+		Owner:       testOwner,
+		BotID:       testBotID,
+		BotUsername: testBotUsername,
+		HTTPClient:  httpc,
+		LLMClient: &llm.Client{
+			APIURL:     testLLMURL,
+			APIKey:     "test",
+			HTTPClient: httpc,
+		},
+		KVCache: kvcache.Module(ctx, store.NewMemStore(ctx, time.Hour)),
+		Logger:  logger,
+	})
+	return b, api
+}
+
+// testLogHandler is a [slog.Handler] that writes logs of a test in the format
+// of the testing package, prefixing output of print with its position.
+type testLogHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	attrs []slog.Attr
+}
+
+func (h *testLogHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *testLogHandler) Handle(_ context.Context, r slog.Record) error {
+	var (
+		prefix string
+		file   string
+		line   int64
+		attrs  strings.Builder
+	)
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "file":
+			file = strings.TrimPrefix(a.Value.String(), "//")
+		case "line":
+			line = a.Value.Int64()
+		default:
+			fmt.Fprintf(&attrs, " %s=%v", a.Key, a.Value)
+		}
+		return true
+	})
+	for _, a := range h.attrs {
+		fmt.Fprintf(&attrs, " %s=%v", a.Key, a.Value)
+	}
+	if file != "" {
+		prefix = fmt.Sprintf("%s:%d: ", file, line)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := fmt.Fprintf(h.w, "%s%s%s\n", prefix, r.Message, attrs.String())
+	return err
+}
+
+func (h *testLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &testLogHandler{mu: h.mu, w: h.w, attrs: append(slices.Clip(h.attrs), attrs...)}
+}
+
+func (h *testLogHandler) WithGroup(string) slog.Handler { return h }
+
+// fakeAPI is a fake Telegram Bot API and LLM API that records requests.
+type fakeAPI struct {
+	mux *http.ServeMux
+
+	mu          sync.Mutex
+	calls       []fakeCall
+	results     map[string]fakeResult // by Telegram method
+	messageID   int64
+	llmReplies  []string
+	llmRequests []json.RawMessage
+}
+
+type fakeCall struct {
+	method string
+	args   json.RawMessage
+}
+
+type fakeResult struct {
+	result      json.RawMessage
+	description string // error if not empty
+}
+
+func newFakeAPI() *fakeAPI {
+	api := &fakeAPI{
+		mux:     http.NewServeMux(),
+		results: make(map[string]fakeResult),
+	}
+	api.mux.HandleFunc("POST api.telegram.org/{token}/{method}", api.telegramCall)
+	api.mux.HandleFunc("POST llm.test/v1/responses", api.llmResponse)
+	return api
+}
+
+func (api *fakeAPI) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	api.mux.ServeHTTP(w, r)
+	return w.Result(), nil
+}
+
+func (api *fakeAPI) telegramCall(w http.ResponseWriter, r *http.Request) {
+	args, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := r.PathValue("method")
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.calls = append(api.calls, fakeCall{method: method, args: args})
+
+	w.Header().Set("Content-Type", "application/json")
+	res, ok := api.results[method]
+	if ok && res.description != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"ok":          false,
+			"error_code":  http.StatusBadRequest,
+			"description": res.description,
+		})
+		return
+	}
+	result := res.result
+	if !ok {
+		result = fakeTelegramResult(method, args, testBotID, testBotUsername, func() int64 {
+			api.messageID++
+			return api.messageID
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+func (api *fakeAPI) llmResponse(w http.ResponseWriter, r *http.Request) {
+	req, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.llmRequests = append(api.llmRequests, req)
+	if len(api.llmReplies) == 0 {
+		http.Error(w, "no canned LLM responses left; add them with t.llm_reply", http.StatusInternalServerError)
+		return
+	}
+	reply := api.llmReplies[0]
+	api.llmReplies = api.llmReplies[1:]
+
+	var params struct {
+		Stream bool `json:"stream"`
+	}
+	json.Unmarshal(req, &params)
+	if !params.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"output_text": reply})
+		return
+	}
+
+	// Stream the reply word by word, as llm.stream expects.
+	w.Header().Set("Content-Type", "text/event-stream")
+	for word := range strings.SplitAfterSeq(reply, " ") {
+		writeEvent(w, map[string]any{"type": "response.output_text.delta", "delta": word})
+	}
+	writeEvent(w, map[string]any{"type": "response.completed", "response": map[string]any{"output_text": reply}})
+}
+
+func writeEvent(w io.Writer, data any) {
+	b, _ := json.Marshal(data)
+	fmt.Fprintf(w, "data: %s\n\n", b)
+}
+
+// testCase is the state of a running test, exposed to it as the t argument.
+type testCase struct {
+	bot      *Bot
+	api      *fakeAPI
+	res      *testResult
+	updateID int64
+}
+
+func (tc *testCase) value() starlark.Value {
+	members := starlark.StringDict{}
+	for name, fn := range map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+		"update":       tc.update,
+		"message":      tc.message,
+		"calls":        tc.calls,
+		"reset":        tc.reset,
+		"respond":      tc.respond,
+		"llm_reply":    tc.llmReply,
+		"llm_requests": tc.llmRequests,
+		"eq":           tc.eq,
+		"true":         tc.true,
+		"error":        tc.error,
+		"fatal":        tc.fatal,
+	} {
+		members[name] = starlark.NewBuiltin("t."+name, fn)
+	}
+	return starlarkstruct.FromStringDict(starlark.String("t"), members)
+}
+
+// fail records a failure at the position of the caller of the builtin.
+func (tc *testCase) fail(thread *starlark.Thread, msg string) {
+	pos := thread.CallFrame(1).Pos
+	tc.res.failures = append(tc.res.failures, fmt.Sprintf("%s:%d: %s", path.Base(pos.Filename()), pos.Line, msg))
+}
+
+func (tc *testCase) update(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var update *starlark.Dict
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "update", &update); err != nil {
+		return nil, err
+	}
+	return starlark.None, tc.handle(thread, update)
+}
+
+func (tc *testCase) message(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		text   string
+		chatID int64 = testOwner
+		fromID int64
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "text", &text, "chat_id?", &chatID, "from_id?", &fromID); err != nil {
+		return nil, err
+	}
+	fromID = cmp.Or(fromID, chatID)
+	chatType := "private"
+	if chatID < 0 {
+		chatType = "group"
+	}
+	tc.api.mu.Lock()
+	tc.api.messageID++
+	msgID := tc.api.messageID
+	tc.api.mu.Unlock()
+	update, err := go2star.To(map[string]any{
+		"message": map[string]any{
+			"message_id": msgID,
+			"date":       time.Now().Unix(),
+			"text":       text,
+			"from":       map[string]any{"id": fromID, "is_bot": false, "first_name": "Test"},
+			"chat":       map[string]any{"id": chatID, "type": chatType},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return starlark.None, tc.handle(thread, update)
+}
+
+// handle passes an update to the handle function of the bot. The update goes
+// through JSON, like updates received from Telegram.
+func (tc *testCase) handle(thread *starlark.Thread, update starlark.Value) error {
+	raw, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{update}, nil)
+	if err != nil {
+		return err
+	}
+	var rawUpdate map[string]any
+	if err := json.Unmarshal([]byte(raw.(starlark.String)), &rawUpdate); err != nil {
+		return err
+	}
+	if _, ok := rawUpdate["update_id"]; !ok {
+		tc.updateID++
+		rawUpdate["update_id"] = tc.updateID
+	}
+	v, err := go2star.To(rawUpdate)
+	if err != nil {
+		return err
+	}
+	if err := tc.bot.handle(interpreter.Context(thread), v, nil); err != nil {
+		return fmt.Errorf("handle failed: %s", errorMessage(err))
+	}
+	return nil
+}
+
+func (tc *testCase) calls(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var method string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "method?", &method); err != nil {
+		return nil, err
+	}
+	tc.api.mu.Lock()
+	calls := slices.Clone(tc.api.calls)
+	tc.api.mu.Unlock()
+
+	var list []starlark.Value
+	for _, c := range calls {
+		if method != "" && c.method != method {
+			continue
+		}
+		args, err := decodeJSON(thread, c.args)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, starlarkstruct.FromStringDict(starlark.String("call"), starlark.StringDict{
+			"method": starlark.String(c.method),
+			"args":   args,
+		}))
+	}
+	return starlark.NewList(list), nil
+}
+
+func (tc *testCase) reset(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	tc.api.mu.Lock()
+	defer tc.api.mu.Unlock()
+	tc.api.calls = nil
+	tc.api.llmRequests = nil
+	return starlark.None, nil
+}
+
+func (tc *testCase) respond(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		method string
+		result starlark.Value = starlark.True
+		errMsg string
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "method", &method, "result?", &result, "error?", &errMsg); err != nil {
+		return nil, err
+	}
+	raw, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{result}, nil)
+	if err != nil {
+		return nil, err
+	}
+	tc.api.mu.Lock()
+	defer tc.api.mu.Unlock()
+	tc.api.results[method] = fakeResult{
+		result:      json.RawMessage(raw.(starlark.String)),
+		description: errMsg,
+	}
+	return starlark.None, nil
+}
+
+func (tc *testCase) llmReply(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var text string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "text", &text); err != nil {
+		return nil, err
+	}
+	tc.api.mu.Lock()
+	defer tc.api.mu.Unlock()
+	tc.api.llmReplies = append(tc.api.llmReplies, text)
+	return starlark.None, nil
+}
+
+func (tc *testCase) llmRequests(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	tc.api.mu.Lock()
+	reqs := slices.Clone(tc.api.llmRequests)
+	tc.api.mu.Unlock()
+
+	list := make([]starlark.Value, len(reqs))
+	for i, req := range reqs {
+		v, err := decodeJSON(thread, req)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return starlark.NewList(list), nil
+}
+
+func decodeJSON(thread *starlark.Thread, data []byte) (starlark.Value, error) {
+	return starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(data)}, nil)
+}
+
+func (tc *testCase) eq(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		got, want starlark.Value
+		msg       string
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "got", &got, "want", &want, "msg?", &msg); err != nil {
+		return nil, err
+	}
+	ok, err := starlark.Equal(got, want)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		tc.fail(thread, failureMessage(msg, fmt.Sprintf("got %s, want %s", got, want)))
+	}
+	return starlark.Bool(ok), nil
+}
+
+func (tc *testCase) true(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		cond starlark.Value
+		msg  string
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "cond", &cond, "msg?", &msg); err != nil {
+		return nil, err
+	}
+	if !cond.Truth() {
+		tc.fail(thread, failureMessage(msg, fmt.Sprintf("%s is not true", cond)))
+	}
+	return cond.Truth(), nil
+}
+
+func (tc *testCase) error(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "msg", &msg); err != nil {
+		return nil, err
+	}
+	tc.fail(thread, msg)
+	return starlark.None, nil
+}
+
+func (tc *testCase) fatal(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "msg", &msg); err != nil {
+		return nil, err
+	}
+	tc.fail(thread, msg)
+	return nil, errFatal
+}
+
+func failureMessage(msg, detail string) string {
+	if msg == "" {
+		return detail
+	}
+	return msg + ": " + detail
+}
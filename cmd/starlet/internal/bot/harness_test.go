@@ -0,0 +1,70 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/base/txtar"
+	"go.astrophena.name/tools/cmd/starlet/internal/bot"
+)
+
+var durationRe = regexp.MustCompile(`\(\d+\.\d+s\)`)
+
+func TestRunTests(t *testing.T) {
+	t.Parallel()
+
+	testutil.RunGolden(t, "testdata/harness/*.txtar", func(t *testing.T, match string) []byte {
+		t.Parallel()
+
+		ar, err := txtar.ParseFile(match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string, len(ar.Files))
+		for _, f := range ar.Files {
+			files[f.Name] = string(f.Data)
+		}
+
+		var buf bytes.Buffer
+		passed := bot.RunTests(t.Context(), files, bot.TestOpts{
+			Output:  &buf,
+			Verbose: strings.TrimSpace(string(ar.Comment)) == "verbose",
+		})
+		out := durationRe.ReplaceAllString(buf.String(), "(0.00s)")
+		return fmt.Appendf(nil, "passed: %v\n\n%s", passed, out)
+	}, *update)
+}
+
+func TestRunTestsFilter(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"bot.star": echoBot,
+		"test_bot.star": `
+def test_one(t):
+    pass
+
+def test_two(t):
+    t.fatal("shouldn't run")
+`,
+	}
+	var buf bytes.Buffer
+	passed := bot.RunTests(t.Context(), files, bot.TestOpts{
+		Output:  &buf,
+		Run:     regexp.MustCompile("one$"),
+		Verbose: true,
+	})
+	testutil.AssertEqual(t, passed, true)
+	testutil.AssertEqual(t, durationRe.ReplaceAllString(buf.String(), "(0.00s)"), `=== RUN   test_bot.star/test_one
+--- PASS: test_bot.star/test_one (0.00s)
+PASS
+`)
+}
@@ -0,0 +1,120 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.astrophena.name/tools/internal/starlark/interpreter"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	// DefaultMaxSteps is the default limit of Starlark computation steps per
+	// invocation of bot code.
+	DefaultMaxSteps = 100_000_000
+	// DefaultTimeout is the default wall-clock limit of an invocation of bot
+	// code.
+	DefaultTimeout = 2 * time.Minute
+)
+
+// limitError is returned when an invocation of bot code exceeds a limit.
+type limitError struct {
+	reason string
+	err    error
+}
+
+func (e *limitError) Error() string { return e.reason + ": " + e.err.Error() }
+func (e *limitError) Unwrap() error { return e.err }
+
+// ExecStats are counters of invocations of bot code.
+type ExecStats struct {
+	// Calls is the number of invocations of handle, on_load and scheduled
+	// jobs.
+	Calls uint64
+	// Failed is the number of invocations that returned an error, including
+	// those below.
+	Failed uint64
+	// StepsExceeded is the number of invocations stopped because they
+	// exceeded the maximum number of steps.
+	StepsExceeded uint64
+	// TimedOut is the number of invocations stopped because they exceeded
+	// the timeout.
+	TimedOut uint64
+	// Canceled is the number of invocations stopped because their context
+	// ended, for example because Telegram closed the webhook request.
+	Canceled uint64
+	// MaxSteps and Timeout are the configured limits.
+	MaxSteps uint64
+	Timeout  time.Duration
+}
+
+type execStats struct {
+	calls, failed, stepsExceeded, timedOut, canceled atomic.Uint64
+}
+
+// ExecStats returns counters of invocations of bot code.
+func (b *Bot) ExecStats() ExecStats {
+	return ExecStats{
+		Calls:         b.stats.calls.Load(),
+		Failed:        b.stats.failed.Load(),
+		StepsExceeded: b.stats.stepsExceeded.Load(),
+		TimedOut:      b.stats.timedOut.Load(),
+		Canceled:      b.stats.canceled.Load(),
+		MaxSteps:      b.maxSteps,
+		Timeout:       b.timeout,
+	}
+}
+
+// call calls fn in a new thread of intr, limiting the number of steps and the
+// time it takes. The thread is canceled when ctx ends. Limit violations are
+// returned as *limitError.
+func (b *Bot) call(ctx context.Context, intr *interpreter.Interpreter, name string, fn starlark.Value, args starlark.Tuple, locals map[string]any) (starlark.Value, error) {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	thread := intr.Thread(ctx)
+	thread.Name = name
+	for k, v := range locals {
+		thread.SetLocal(k, v)
+	}
+	var stepsExceeded atomic.Bool
+	thread.OnMaxSteps = func(thread *starlark.Thread) {
+		stepsExceeded.Store(true)
+		thread.Cancel(fmt.Sprintf("exceeded the limit of %d steps", b.maxSteps))
+	}
+	stop := context.AfterFunc(ctx, func() {
+		if parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			thread.Cancel(fmt.Sprintf("exceeded the timeout of %s", b.timeout))
+			return
+		}
+		thread.Cancel(ctx.Err().Error())
+	})
+	defer stop()
+
+	b.stats.calls.Add(1)
+	v, err := starlark.Call(thread, fn, args, nil)
+	if err == nil {
+		return v, nil
+	}
+	b.stats.failed.Add(1)
+	switch {
+	case stepsExceeded.Load():
+		b.stats.stepsExceeded.Add(1)
+		return nil, &limitError{reason: fmt.Sprintf("%s exceeded the limit of %d steps", name, b.maxSteps), err: err}
+	case parent.Err() != nil:
+		b.stats.canceled.Add(1)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		b.stats.timedOut.Add(1)
+		return nil, &limitError{reason: fmt.Sprintf("%s exceeded the timeout of %s", name, b.timeout), err: err}
+	}
+	return nil, err
+}
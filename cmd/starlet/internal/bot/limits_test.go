@@ -0,0 +1,108 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/starlet/internal/bot"
+)
+
+const spinningBot = `
+def spin():
+    for i in range(1000000000):
+        pass
+
+def handle(update):
+    spin()
+`
+
+func limitsTestBot(t *testing.T, m *mux, opts bot.Opts) *bot.Bot {
+	t.Helper()
+	opts.Token = tgToken
+	opts.Owner = 123456789
+	opts.HTTPClient = testutil.MockHTTPClient(m.mux)
+	opts.Logger = slog.New(slog.NewTextHandler(t.Output(), nil))
+	b := bot.New(opts)
+	if err := b.Load(t.Context(), map[string]string{"bot.star": spinningBot}); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		opts       bot.Opts
+		wantReport string
+		wantStats  func(bot.ExecStats) uint64
+	}{
+		"steps": {
+			opts:       bot.Opts{MaxSteps: 1000},
+			wantReport: "handle exceeded the limit of 1000 steps",
+			wantStats:  func(s bot.ExecStats) uint64 { return s.StepsExceeded },
+		},
+		"timeout": {
+			opts:       bot.Opts{Timeout: 50 * time.Millisecond},
+			wantReport: "handle exceeded the timeout of 50ms",
+			wantStats:  func(s bot.ExecStats) uint64 { return s.TimedOut },
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m := testMux(t, nil)
+			b := limitsTestBot(t, m, tc.opts)
+			// The update comes from another chat, but the owner gets the report.
+			if err := b.HandleUpdate(t.Context(), map[string]any{
+				"message": map[string]any{"chat": map[string]any{"id": 42}},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			testutil.AssertEqual(t, len(m.telegramCalls), 1)
+			report := m.telegramCalls[0]
+			testutil.AssertEqual(t, report.Args["chat_id"], float64(123456789))
+			text, _ := report.Args["text"].(string)
+			for _, want := range []string{tc.wantReport, "Traceback", "in spin"} {
+				if !strings.Contains(text, want) {
+					t.Errorf("report %q doesn't contain %q", text, want)
+				}
+			}
+
+			stats := b.ExecStats()
+			testutil.AssertEqual(t, stats.Calls, uint64(1))
+			testutil.AssertEqual(t, stats.Failed, uint64(1))
+			testutil.AssertEqual(t, tc.wantStats(stats), uint64(1))
+		})
+	}
+}
+
+func TestLimitsCanceled(t *testing.T) {
+	t.Parallel()
+
+	m := testMux(t, nil)
+	b := limitsTestBot(t, m, bot.Opts{})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := b.HandleUpdate(ctx, map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancellation isn't reported, as it isn't a bug in bot code.
+	testutil.AssertEqual(t, len(m.telegramCalls), 0)
+	stats := b.ExecStats()
+	testutil.AssertEqual(t, stats.Canceled, uint64(1))
+	testutil.AssertEqual(t, stats.MaxSteps, uint64(bot.DefaultMaxSteps))
+	testutil.AssertEqual(t, stats.Timeout, bot.DefaultTimeout)
+}
@@ -0,0 +1,385 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/tools/internal/starlark/go2star"
+)
+
+const (
+	// queueKey is the store key of updates that haven't been processed yet.
+	queueKey = "starlet:queue"
+
+	// DefaultMaxAttempts is the default number of attempts to handle an
+	// update that fails with a transient error.
+	DefaultMaxAttempts = 5
+	// DefaultRetryWait is the default wait before the first retry. It doubles
+	// with each retry.
+	DefaultRetryWait = time.Second
+	// maxRetryWait caps the wait between retries.
+	maxRetryWait = time.Minute
+	// maxRecentUpdates is how many IDs of processed updates are remembered to
+	// drop updates that Telegram delivers again.
+	maxRecentUpdates = 1000
+)
+
+// queuedUpdate is an update waiting to be processed.
+type queuedUpdate struct {
+	ID     uint64         `json:"id"`
+	Chat   int64          `json:"chat"`
+	Update map[string]any `json:"update"`
+}
+
+// queue holds updates until they are processed. Updates from the same chat are
+// processed one at a time in the order they arrived, and updates from
+// different chats are processed in parallel.
+type queue struct {
+	saveMu sync.Mutex // serializes loads and saves, acquired before mu
+	loaded bool       // updates saved before the last restart have been loaded
+
+	mu      sync.Mutex
+	ctx     context.Context // nil until the queue runs
+	nextID  uint64
+	pending []*queuedUpdate
+	active  map[int64]bool // chats with a running worker
+	recent  []int64        // IDs of recently processed updates, oldest first
+	wg      sync.WaitGroup
+
+	processed, retried, failed atomic.Uint64
+}
+
+// QueueStats describes the update queue.
+type QueueStats struct {
+	// Pending is the number of updates that haven't been processed yet.
+	Pending int
+	// Chats is the number of chats with pending updates.
+	Chats int
+	// Processed is the number of processed updates, including failed ones.
+	Processed uint64
+	// Retried is the number of retries after transient errors.
+	Retried uint64
+	// Failed is the number of updates whose errors were reported.
+	Failed uint64
+}
+
+// QueueStats returns the state of the update queue.
+func (b *Bot) QueueStats() QueueStats {
+	q := &b.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	chats := make(map[int64]bool)
+	for _, u := range q.pending {
+		chats[u.Chat] = true
+	}
+	return QueueStats{
+		Pending:   len(q.pending),
+		Chats:     len(chats),
+		Processed: q.processed.Load(),
+		Retried:   q.retried.Load(),
+		Failed:    q.failed.Load(),
+	}
+}
+
+// Enqueue adds a decoded Telegram update to the queue. The update is saved to
+// the store before Enqueue returns, so it isn't lost if Starlet stops before
+// processing it. An update with the same update_id as one that is pending or
+// was recently processed is dropped, since Telegram delivers an update again
+// if it didn't get a response in time.
+func (b *Bot) Enqueue(ctx context.Context, rawUpdate map[string]any) error {
+	q := &b.queue
+	q.saveMu.Lock()
+	// Updates saved before the last restart must be known to drop duplicates.
+	b.loadQueue(ctx)
+	q.saveMu.Unlock()
+
+	q.mu.Lock()
+	if id, ok := updateID(rawUpdate); ok && q.seen(id) {
+		q.mu.Unlock()
+		b.logger.Debug("dropping duplicate update", "update_id", id)
+		return nil
+	}
+	q.nextID++
+	u := &queuedUpdate{ID: q.nextID, Chat: updateChat(rawUpdate), Update: rawUpdate}
+	q.pending = append(q.pending, u)
+	q.mu.Unlock()
+
+	if err := b.saveQueue(ctx); err != nil {
+		q.mu.Lock()
+		q.pending = slices.DeleteFunc(q.pending, func(p *queuedUpdate) bool { return p == u })
+		q.mu.Unlock()
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	b.startWorker(u.Chat)
+	return nil
+}
+
+// RunQueue processes queued updates until ctx is canceled, starting with
+// updates saved before the last restart. Updates being processed when ctx is
+// canceled stay in the store and are processed again on the next start.
+func (b *Bot) RunQueue(ctx context.Context) {
+	q := &b.queue
+	q.saveMu.Lock()
+	b.loadQueue(ctx)
+	q.saveMu.Unlock()
+
+	q.mu.Lock()
+	q.ctx = ctx
+	for _, u := range q.pending {
+		b.startWorker(u.Chat)
+	}
+	q.mu.Unlock()
+
+	<-ctx.Done()
+	q.mu.Lock()
+	q.ctx = nil
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// startWorker starts processing updates of a chat if the queue is running and
+// there's no worker for the chat yet. q.mu must be held.
+func (b *Bot) startWorker(chat int64) {
+	q := &b.queue
+	if q.ctx == nil || q.active[chat] {
+		return
+	}
+	if q.active == nil {
+		q.active = make(map[int64]bool)
+	}
+	q.active[chat] = true
+	ctx := q.ctx
+	q.wg.Go(func() { b.work(ctx, chat) })
+}
+
+func (b *Bot) work(ctx context.Context, chat int64) {
+	q := &b.queue
+	for {
+		q.mu.Lock()
+		i := slices.IndexFunc(q.pending, func(u *queuedUpdate) bool { return u.Chat == chat })
+		if i < 0 || ctx.Err() != nil {
+			delete(q.active, chat)
+			q.mu.Unlock()
+			return
+		}
+		u := q.pending[i]
+		q.mu.Unlock()
+
+		if !b.process(ctx, u) {
+			// Stopped before the update was processed. Keep it for the next
+			// start.
+			continue
+		}
+
+		q.mu.Lock()
+		q.pending = slices.DeleteFunc(q.pending, func(p *queuedUpdate) bool { return p == u })
+		if id, ok := updateID(u.Update); ok {
+			q.recent = append(q.recent, id)
+			if len(q.recent) > maxRecentUpdates {
+				q.recent = slices.Delete(q.recent, 0, len(q.recent)-maxRecentUpdates)
+			}
+		}
+		q.mu.Unlock()
+		q.processed.Add(1)
+		if err := b.saveQueue(ctx); err != nil && ctx.Err() == nil {
+			b.logger.Error("saving queued updates failed", "err", err)
+		}
+	}
+}
+
+// process handles an update, retrying transient errors. It reports whether the
+// update was processed, successfully or not.
+func (b *Bot) process(ctx context.Context, u *queuedUpdate) bool {
+	update, err := go2star.To(u.Update)
+	if err != nil {
+		b.logger.Error("dropping update that can't be converted to Starlark", "id", u.ID, "err", err)
+		return true
+	}
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := b.handle(ctx, update, nil)
+		if err == nil {
+			b.report(ctx, u.Update, start, nil)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		wait, ok := retryWait(err, attempt, b.retryWait)
+		if !ok || attempt >= b.maxAttempts {
+			b.queue.failed.Add(1)
+			b.report(ctx, u.Update, start, err)
+			return true
+		}
+		b.queue.retried.Add(1)
+		b.logger.Warn("handling update failed, retrying", "chat", u.Chat, "attempt", attempt, "wait", wait, "err", err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// loadQueue puts updates saved before the last restart in front of the queue,
+// once. q.saveMu must be held.
+func (b *Bot) loadQueue(ctx context.Context) {
+	q := &b.queue
+	if q.loaded || b.store == nil {
+		return
+	}
+	q.loaded = true
+
+	var saved []*queuedUpdate
+	data, err := b.store.Get(ctx, queueKey)
+	if err == nil && data != nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		b.logger.Error("loading queued updates failed", "err", err)
+		return
+	}
+	if len(saved) == 0 {
+		return
+	}
+	b.logger.Info("processing updates queued before restart", "count", len(saved))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, u := range saved {
+		q.nextID = max(q.nextID, u.ID)
+	}
+	for _, u := range q.pending {
+		q.nextID++
+		u.ID = q.nextID
+	}
+	q.pending = append(saved, q.pending...)
+}
+
+func (b *Bot) saveQueue(ctx context.Context) error {
+	if b.store == nil {
+		return nil
+	}
+	q := &b.queue
+	q.saveMu.Lock()
+	defer q.saveMu.Unlock()
+	// Don't overwrite updates saved before the last restart.
+	b.loadQueue(ctx)
+	q.mu.Lock()
+	data, err := json.Marshal(q.pending)
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return b.store.Set(ctx, queueKey, data)
+}
+
+// retryWait returns how long to wait before retrying after err, and false if
+// err isn't transient. Transient errors are Telegram rate limits, server errors
+// and network errors.
+func retryWait(err error, attempt int, initial time.Duration) (time.Duration, bool) {
+	if errors.As(err, new(*limitError)) {
+		return 0, false
+	}
+	wait := initial << min(attempt-1, 16)
+	if statusErr, ok := errors.AsType[*request.StatusError](err); ok {
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			// Telegram tells how long to wait.
+			var resp struct {
+				Parameters struct {
+					RetryAfter int `json:"retry_after"`
+				} `json:"parameters"`
+			}
+			if json.Unmarshal(statusErr.Body, &resp) == nil && resp.Parameters.RetryAfter > 0 {
+				wait = time.Duration(resp.Parameters.RetryAfter) * time.Second
+			}
+		case statusErr.StatusCode >= 500:
+		default:
+			return 0, false
+		}
+	} else if _, ok := errors.AsType[net.Error](err); !ok {
+		return 0, false
+	}
+	return min(wait, maxRetryWait), true
+}
+
+// seen reports whether an update with the given update_id is pending or was
+// recently processed. q.mu must be held.
+func (q *queue) seen(id int64) bool {
+	if slices.Contains(q.recent, id) {
+		return true
+	}
+	return slices.ContainsFunc(q.pending, func(u *queuedUpdate) bool {
+		pid, ok := updateID(u.Update)
+		return ok && pid == id
+	})
+}
+
+// updateID returns the update_id of an update.
+func updateID(update map[string]any) (int64, bool) {
+	return number(update["update_id"])
+}
+
+// updateChat returns the ID of the chat an update belongs to, or zero if it
+// doesn't belong to any.
+func updateChat(update map[string]any) int64 {
+	for k, v := range update {
+		if k == "update_id" {
+			continue
+		}
+		obj, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		if id, ok := objectID(obj["chat"]); ok {
+			return id
+		}
+		// Callback queries carry the message they came from.
+		if msg, ok := obj["message"].(map[string]any); ok {
+			if id, ok := objectID(msg["chat"]); ok {
+				return id
+			}
+		}
+		if id, ok := objectID(obj["from"]); ok {
+			return id
+		}
+	}
+	return 0
+}
+
+func objectID(v any) (int64, bool) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return 0, false
+	}
+	return number(obj["id"])
+}
+
+// number converts an integer decoded from JSON or passed by tests to int64.
+func number(v any) (int64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	}
+	return 0, false
+}
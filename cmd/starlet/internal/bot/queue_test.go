@@ -0,0 +1,235 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/starlet/internal/bot"
+	"go.astrophena.name/tools/internal/store"
+)
+
+const echoBot = `
+def handle(update):
+    msg = update["message"]
+    telegram.call(method = "sendMessage", args = {"chat_id": msg["chat"]["id"], "text": msg["text"]})
+`
+
+func queueTestBot(t *testing.T, m *mux, s store.Store) *bot.Bot {
+	t.Helper()
+	b := bot.New(bot.Opts{
+		Token:      tgToken,
+		Owner:      123456789,
+		HTTPClient: testutil.MockHTTPClient(m.mux),
+		Store:      s,
+		Logger:     slog.New(slog.NewTextHandler(t.Output(), nil)),
+		RetryWait:  10 * time.Millisecond,
+	})
+	if err := b.Load(t.Context(), map[string]string{"bot.star": echoBot}); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func chatMessage(chat int64, text string) map[string]any {
+	return map[string]any{
+		"message": map[string]any{
+			"chat": map[string]any{"id": float64(chat)},
+			"text": text,
+		},
+	}
+}
+
+// sentTexts returns texts of sent messages by chat.
+func sentTexts(m *mux) map[float64][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	texts := make(map[float64][]string)
+	for _, c := range m.telegramCalls {
+		chat, _ := c.Args["chat_id"].(float64)
+		text, _ := c.Args["text"].(string)
+		texts[chat] = append(texts[chat], text)
+	}
+	return texts
+}
+
+func TestQueueOrderAndRetries(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		rateLimited bool
+	)
+	var m *mux
+	m = testMux(t, map[string]http.HandlerFunc{
+		postTelegram: func(w http.ResponseWriter, r *http.Request) {
+			args := testutil.UnmarshalJSON[map[string]any](t, read(t, r.Body))
+			mu.Lock()
+			// The first message to chat 1 hits the rate limit once.
+			if args["text"] == "1a" && !rateLimited {
+				rateLimited = true
+				mu.Unlock()
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests"}`))
+				return
+			}
+			mu.Unlock()
+			m.mu.Lock()
+			m.telegramCalls = append(m.telegramCalls, call{Method: r.PathValue("method"), Args: args})
+			m.mu.Unlock()
+			jsonOK(w)
+		},
+	})
+	b := queueTestBot(t, m, store.NewMemStore(t.Context(), time.Hour))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go b.RunQueue(ctx)
+
+	for _, u := range []map[string]any{
+		chatMessage(1, "1a"),
+		chatMessage(2, "2a"),
+		chatMessage(1, "1b"),
+		chatMessage(2, "2b"),
+		chatMessage(1, "1c"),
+	} {
+		if err := b.Enqueue(t.Context(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitQueue(t, b)
+
+	testutil.AssertEqual(t, sentTexts(m), map[float64][]string{
+		1: {"1a", "1b", "1c"},
+		2: {"2a", "2b"},
+	})
+	stats := b.QueueStats()
+	testutil.AssertEqual(t, stats.Processed, uint64(5))
+	testutil.AssertEqual(t, stats.Retried, uint64(1))
+	testutil.AssertEqual(t, stats.Failed, uint64(0))
+}
+
+func TestQueuePermanentError(t *testing.T) {
+	t.Parallel()
+
+	var m *mux
+	m = testMux(t, map[string]http.HandlerFunc{
+		postTelegram: func(w http.ResponseWriter, r *http.Request) {
+			args := testutil.UnmarshalJSON[map[string]any](t, read(t, r.Body))
+			if args["text"] == "bad" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+				return
+			}
+			m.mu.Lock()
+			m.telegramCalls = append(m.telegramCalls, call{Method: r.PathValue("method"), Args: args})
+			m.mu.Unlock()
+			jsonOK(w)
+		},
+	})
+	b := queueTestBot(t, m, nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go b.RunQueue(ctx)
+
+	if err := b.Enqueue(t.Context(), chatMessage(1, "bad")); err != nil {
+		t.Fatal(err)
+	}
+	waitQueue(t, b)
+
+	// The error is reported without retries.
+	sent := sentTexts(m)[1]
+	testutil.AssertEqual(t, len(sent), 1)
+	if !strings.Contains(sent[0], "chat not found") {
+		t.Errorf("error report %q doesn't mention the error", sent[0])
+	}
+	stats := b.QueueStats()
+	testutil.AssertEqual(t, stats.Retried, uint64(0))
+	testutil.AssertEqual(t, stats.Failed, uint64(1))
+}
+
+func TestQueuePersistence(t *testing.T) {
+	t.Parallel()
+
+	s := store.NewMemStore(t.Context(), time.Hour)
+
+	// The first bot stops before processing its update.
+	m1 := testMux(t, nil)
+	b1 := queueTestBot(t, m1, s)
+	if err := b1.Enqueue(t.Context(), chatMessage(1, "before restart")); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, len(m1.telegramCalls), 0)
+
+	// The second bot receives an update before its queue runs, and processes
+	// the saved one first.
+	m2 := testMux(t, nil)
+	b2 := queueTestBot(t, m2, s)
+	if err := b2.Enqueue(t.Context(), chatMessage(1, "after restart")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go b2.RunQueue(ctx)
+	waitQueue(t, b2)
+
+	testutil.AssertEqual(t, sentTexts(m2), map[float64][]string{
+		1: {"before restart", "after restart"},
+	})
+	data, err := s.Get(t.Context(), "starlet:queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, string(data), "[]")
+}
+
+func TestQueueDropsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	withID := func(id int, text string) map[string]any {
+		u := chatMessage(1, text)
+		u["update_id"] = float64(id)
+		return u
+	}
+
+	s := store.NewMemStore(t.Context(), 0)
+
+	// The first bot stops before processing its update.
+	b1 := queueTestBot(t, testMux(t, nil), s)
+	if err := b1.Enqueue(t.Context(), withID(1, "first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Telegram delivers it again after the restart, while it's pending.
+	m := testMux(t, nil)
+	b2 := queueTestBot(t, m, s)
+	if err := b2.Enqueue(t.Context(), withID(1, "first (pending)")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go b2.RunQueue(ctx)
+	waitQueue(t, b2)
+
+	// And once more after it was processed.
+	for _, u := range []map[string]any{withID(1, "first (processed)"), withID(2, "second")} {
+		if err := b2.Enqueue(t.Context(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitQueue(t, b2)
+
+	testutil.AssertEqual(t, sentTexts(m), map[float64][]string{
+		1: {"first", "second"},
+	})
+}
@@ -0,0 +1,231 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.astrophena.name/tools/internal/starlark/go2star"
+	starlarkhttp "go.astrophena.name/tools/internal/starlark/http"
+	"go.astrophena.name/tools/internal/starlark/kvcache"
+	starlarkllm "go.astrophena.name/tools/internal/starlark/llm"
+	"go.astrophena.name/tools/internal/starlark/telegram"
+
+	"go.starlark.net/starlark"
+)
+
+// DefaultRecordedUpdates is the default number of last handled updates that
+// are kept for inspection and replay.
+const DefaultRecordedUpdates = 100
+
+// ErrUpdateNotFound is returned by Replay when there's no recorded update with
+// the requested ID.
+var ErrUpdateNotFound = errors.New("update not found; it may have been dropped to make room for newer ones")
+
+// RecordedUpdate is an update handled by bot code, with the outcome.
+type RecordedUpdate struct {
+	// ID identifies the update among recorded ones.
+	ID uint64
+	// Time is when handling the update started.
+	Time time.Time
+	// Duration is how long handling the update took, including retries.
+	Duration time.Duration
+	// Chat is the ID of the chat the update belongs to, or zero.
+	Chat int64
+	// Update is the update as JSON, scrubbed of secrets.
+	Update string
+	// Error is the error returned by bot code with a Starlark backtrace, if
+	// any, scrubbed of secrets.
+	Error string
+	// ReplayOf is the ID of the replayed update, or zero if this isn't a
+	// replay.
+	ReplayOf uint64
+	// Dry reports whether this is a replay with Telegram Bot API calls
+	// captured instead of sent.
+	Dry bool
+	// Calls are the Telegram Bot API calls captured during a dry replay.
+	Calls []TelegramCall
+}
+
+// TelegramCall is a captured Telegram Bot API call.
+type TelegramCall struct {
+	// Method is the name of the called method.
+	Method string
+	// Args are the arguments as JSON, scrubbed of secrets.
+	Args string
+}
+
+// recorder keeps last handled updates.
+type recorder struct {
+	mu      sync.Mutex
+	nextID  uint64
+	updates []RecordedUpdate // oldest first
+}
+
+// RecordedUpdates returns the last handled updates, newest first.
+func (b *Bot) RecordedUpdates() []RecordedUpdate {
+	b.recorder.mu.Lock()
+	defer b.recorder.mu.Unlock()
+	updates := slices.Clone(b.recorder.updates)
+	slices.Reverse(updates)
+	return updates
+}
+
+func (b *Bot) recordUpdate(u RecordedUpdate) RecordedUpdate {
+	r := &b.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	u.ID = r.nextID
+	r.updates = append(r.updates, u)
+	if over := len(r.updates) - b.maxRecorded; over > 0 {
+		r.updates = slices.Delete(r.updates, 0, over)
+	}
+	return u
+}
+
+// record records the outcome of handling an update.
+func (b *Bot) record(rawUpdate map[string]any, start time.Time, err error) RecordedUpdate {
+	u := RecordedUpdate{
+		Time:     start,
+		Duration: time.Since(start),
+		Chat:     updateChat(rawUpdate),
+	}
+	if data, err := json.Marshal(rawUpdate); err == nil {
+		u.Update = b.scrub(string(data))
+	}
+	if err != nil {
+		u.Error = b.errorText(err)
+	}
+	return b.recordUpdate(u)
+}
+
+// Replay passes a recorded update to the handle function of the currently
+// loaded bot code and records the outcome as a new update. Errors in bot code
+// aren't reported to chats, but are returned in the Error field of the result.
+//
+// If dry is true, Telegram Bot API calls made with telegram.call are captured
+// instead of sent, and return a fake successful result. Other side effects are
+// disabled too: http.post, llm.generate and llm.stream fail, and kvcache.set
+// discards values.
+func (b *Bot) Replay(ctx context.Context, id uint64, dry bool) (RecordedUpdate, error) {
+	b.recorder.mu.Lock()
+	i := slices.IndexFunc(b.recorder.updates, func(u RecordedUpdate) bool { return u.ID == id })
+	var orig RecordedUpdate
+	if i >= 0 {
+		orig = b.recorder.updates[i]
+	}
+	b.recorder.mu.Unlock()
+	if i < 0 {
+		return RecordedUpdate{}, ErrUpdateNotFound
+	}
+
+	var rawUpdate map[string]any
+	if err := json.Unmarshal([]byte(orig.Update), &rawUpdate); err != nil {
+		return RecordedUpdate{}, err
+	}
+	update, err := go2star.To(rawUpdate)
+	if err != nil {
+		return RecordedUpdate{}, err
+	}
+
+	var (
+		mu     sync.Mutex
+		calls  []TelegramCall
+		lastID int64
+		locals map[string]any
+	)
+	if dry {
+		locals = map[string]any{
+			telegram.InterceptLocal: telegram.Interceptor(func(method string, args json.RawMessage) (json.RawMessage, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls = append(calls, TelegramCall{Method: method, Args: b.scrub(string(args))})
+				result := fakeTelegramResult(method, args, b.tgBotID, b.tgBotUsername, func() int64 {
+					lastID++
+					return lastID
+				})
+				return json.Marshal(map[string]any{"ok": true, "result": result})
+			}),
+			starlarkhttp.DryRunLocal: true,
+			starlarkllm.DryRunLocal:  true,
+			kvcache.DryRunLocal:      true,
+		}
+	}
+
+	start := time.Now()
+	u := RecordedUpdate{
+		Time:     start,
+		Chat:     orig.Chat,
+		Update:   orig.Update,
+		ReplayOf: orig.ID,
+		Dry:      dry,
+	}
+	if err := b.handle(ctx, update, locals); err != nil {
+		u.Error = b.errorText(err)
+	}
+	u.Duration = time.Since(start)
+	mu.Lock()
+	u.Calls = calls
+	mu.Unlock()
+	return b.recordUpdate(u), nil
+}
+
+// errorText returns the text of an error in bot code with a Starlark
+// backtrace, scrubbed of secrets.
+func (b *Bot) errorText(err error) string {
+	errMsg := err.Error()
+	if evalErr, ok := errors.AsType[*starlark.EvalError](err); ok {
+		errMsg = evalErr.Backtrace()
+	}
+	if limitErr, ok := errors.AsType[*limitError](err); ok {
+		errMsg = limitErr.reason + "\n\n" + errMsg
+	}
+	return b.scrub(errMsg)
+}
+
+func (b *Bot) scrub(s string) string {
+	if b.scrubber == nil {
+		return s
+	}
+	return b.scrubber.Replace(s)
+}
+
+// fakeTelegramResult returns a plausible result of a Telegram Bot API method
+// that wasn't really called: a message for methods that send or edit messages,
+// and true for others. newID returns the ID of a new message.
+func fakeTelegramResult(method string, rawArgs []byte, botID int64, botUsername string, newID func() int64) json.RawMessage {
+	if !strings.HasPrefix(method, "send") && !strings.HasPrefix(method, "edit") {
+		return json.RawMessage("true")
+	}
+	var args map[string]any
+	json.Unmarshal(rawArgs, &args)
+	msgID, ok := args["message_id"]
+	if !ok {
+		msgID = newID()
+	}
+	msg := map[string]any{
+		"message_id": msgID,
+		"date":       time.Now().Unix(),
+		"chat":       map[string]any{"id": args["chat_id"]},
+		"from": map[string]any{
+			"id":         botID,
+			"is_bot":     true,
+			"first_name": botUsername,
+			"username":   botUsername,
+		},
+	}
+	if text, ok := args["text"]; ok {
+		msg["text"] = text
+	}
+	b, _ := json.Marshal(msg)
+	return b
+}
@@ -0,0 +1,172 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot_test
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/starlet/internal/bot"
+	"go.astrophena.name/tools/internal/starlark/kvcache"
+	"go.astrophena.name/tools/internal/store"
+)
+
+const pickyBot = `
+def handle(update):
+    msg = update["message"]
+    if msg["text"] == "odd":
+        fail("can't handle odd updates")
+    telegram.call(method = "sendMessage", args = {"chat_id": msg["chat"]["id"], "text": msg["text"]})
+`
+
+const fixedBot = `
+def handle(update):
+    msg = update["message"]
+    sent = telegram.call(method = "sendMessage", args = {"chat_id": msg["chat"]["id"], "text": "handled " + msg["text"]})
+    telegram.call(method = "pinChatMessage", args = {"chat_id": msg["chat"]["id"], "message_id": sent["result"]["message_id"]})
+`
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	var m *mux
+	m = testMux(t, map[string]http.HandlerFunc{
+		postTelegram: func(w http.ResponseWriter, r *http.Request) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.telegramCalls = append(m.telegramCalls, call{
+				Method: r.PathValue("method"),
+				Args:   testutil.UnmarshalJSON[map[string]any](t, read(t, r.Body)),
+			})
+			w.Write([]byte(`{"ok":true,"result":{"message_id":100}}`))
+		},
+	})
+	b := bot.New(bot.Opts{
+		Token:           tgToken,
+		Owner:           123456789,
+		HTTPClient:      testutil.MockHTTPClient(m.mux),
+		Scrubber:        strings.NewReplacer("s3cr3t", "[EXPUNGED]"),
+		Logger:          slog.New(slog.NewTextHandler(t.Output(), nil)),
+		RecordedUpdates: 3,
+	})
+	if err := b.Load(t.Context(), map[string]string{"bot.star": pickyBot}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"dropped", "ok", "odd", "s3cr3t"} {
+		if err := b.HandleUpdate(t.Context(), chatMessage(1, text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the last three updates are kept, newest first.
+	updates := b.RecordedUpdates()
+	testutil.AssertEqual(t, len(updates), 3)
+	testutil.AssertEqual(t, updates[0].ID, uint64(4))
+	testutil.AssertEqual(t, updates[0].Chat, int64(1))
+	testutil.AssertEqual(t, updates[0].Error, "")
+	if strings.Contains(updates[0].Update, "s3cr3t") {
+		t.Errorf("recorded update %q isn't scrubbed", updates[0].Update)
+	}
+	odd := updates[1]
+	for _, want := range []string{"can't handle odd updates", "Traceback", "in handle"} {
+		if !strings.Contains(odd.Error, want) {
+			t.Errorf("recorded error %q doesn't contain %q", odd.Error, want)
+		}
+	}
+
+	// Replay the failed update against fixed code.
+	if err := b.Load(t.Context(), map[string]string{"bot.star": fixedBot}); err != nil {
+		t.Fatal(err)
+	}
+	m.telegramCalls = nil
+
+	dry, err := b.Replay(t.Context(), odd.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, dry.Error, "")
+	testutil.AssertEqual(t, dry.ReplayOf, odd.ID)
+	testutil.AssertEqual(t, dry.Dry, true)
+	testutil.AssertEqual(t, dry.Calls, []bot.TelegramCall{
+		{Method: "sendMessage", Args: `{"chat_id":1,"text":"handled odd"}`},
+		{Method: "pinChatMessage", Args: `{"chat_id":1,"message_id":1}`},
+	})
+	testutil.AssertEqual(t, len(m.telegramCalls), 0)
+
+	replay, err := b.Replay(t.Context(), odd.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, replay.Error, "")
+	testutil.AssertEqual(t, len(replay.Calls), 0)
+	testutil.AssertEqual(t, sentTexts(m)[1], []string{"handled odd", ""})
+
+	// Replays are recorded too.
+	testutil.AssertEqual(t, b.RecordedUpdates()[0].ID, replay.ID)
+
+	if _, err := b.Replay(t.Context(), 1, false); !errors.Is(err, bot.ErrUpdateNotFound) {
+		t.Errorf("replaying a dropped update: got error %v, want %v", err, bot.ErrUpdateNotFound)
+	}
+}
+
+func TestDryReplayDisablesSideEffects(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		posts int
+	)
+	m := testMux(t, map[string]http.HandlerFunc{
+		"POST api.example.com/hook": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			posts++
+			mu.Unlock()
+		},
+	})
+	s := store.NewMemStore(t.Context(), time.Hour)
+	b := bot.New(bot.Opts{
+		Token:      tgToken,
+		Owner:      123456789,
+		HTTPClient: testutil.MockHTTPClient(m.mux),
+		HTTPAllow:  []string{"api.example.com"},
+		KVCache:    kvcache.Module(t.Context(), s),
+		Logger:     slog.New(slog.NewTextHandler(t.Output(), nil)),
+	})
+	if err := b.Load(t.Context(), map[string]string{"bot.star": `
+def handle(update):
+    kvcache.set("seen", True)
+    http.post("https://api.example.com/hook", json = update)
+`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.HandleUpdate(t.Context(), chatMessage(1, "hello")); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, posts, 1)
+	if err := s.Set(t.Context(), "seen", []byte("false")); err != nil {
+		t.Fatal(err)
+	}
+
+	dry, err := b.Replay(t.Context(), b.RecordedUpdates()[0].ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dry.Error, "can't make requests in a dry run") {
+		t.Errorf("dry replay error %q doesn't mention the disabled request", dry.Error)
+	}
+	testutil.AssertEqual(t, posts, 1)
+	seen, err := s.Get(t.Context(), "seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, string(seen), "false")
+}
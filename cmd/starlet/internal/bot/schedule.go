@@ -0,0 +1,311 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.astrophena.name/tools/cmd/starlet/internal/cron"
+	"go.astrophena.name/tools/internal/starlark/interpreter"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	// scheduleStateKey is the store key of the persisted state of scheduled
+	// jobs.
+	scheduleStateKey = "starlet:schedule"
+	// jobsLocalKey is the thread local that collects jobs registered by
+	// on_load.
+	jobsLocalKey = "starlet.jobs"
+)
+
+var errScheduleOutsideOnLoad = errors.New("schedule can only be called from on_load")
+
+// job is a scheduled job registered by bot code.
+type job struct {
+	id    string
+	spec  string
+	sched cron.Schedule
+	fn    starlark.Callable
+	intr  *interpreter.Interpreter
+}
+
+// jobState is the state of a job, persisted in the store.
+type jobState struct {
+	Spec    string    `json:"spec"`
+	LastRun time.Time `json:"last_run,omitzero"`
+	NextRun time.Time `json:"next_run,omitzero"`
+}
+
+// jobStatus tracks a job and its state.
+type jobStatus struct {
+	job *job
+	jobState
+	runs    int
+	lastErr string
+	running bool
+}
+
+// Job describes a scheduled job.
+type Job struct {
+	ID        string
+	Schedule  string
+	LastRun   time.Time
+	NextRun   time.Time
+	Runs      int
+	LastError string
+	Running   bool
+}
+
+// scheduler runs jobs registered by the loaded bot code.
+type scheduler struct {
+	mu        sync.Mutex
+	jobs      map[string]*jobStatus
+	persisted map[string]jobState // nil until loaded from the store
+	wake      chan struct{}
+}
+
+// setJobs replaces the scheduled jobs after bot code has been loaded. Jobs that
+// keep their ID and schedule keep their state.
+func (s *scheduler) setJobs(jobs []*job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.jobs
+	s.jobs = make(map[string]*jobStatus, len(jobs))
+	for _, j := range jobs {
+		st := &jobStatus{job: j, jobState: jobState{Spec: j.spec}}
+		if prev, ok := old[j.id]; ok {
+			st.LastRun, st.runs, st.lastErr, st.running = prev.LastRun, prev.runs, prev.lastErr, prev.running
+			if prev.Spec == j.spec {
+				st.NextRun = prev.NextRun
+			}
+		}
+		s.jobs[j.id] = st
+	}
+	s.notify()
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Jobs returns the status of scheduled jobs, sorted by ID.
+func (b *Bot) Jobs() []Job {
+	s := &b.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for id, st := range s.jobs {
+		jobs = append(jobs, Job{
+			ID:        id,
+			Schedule:  st.Spec,
+			LastRun:   st.LastRun,
+			NextRun:   st.NextRun,
+			Runs:      st.runs,
+			LastError: st.lastErr,
+			Running:   st.running,
+		})
+	}
+	slices.SortFunc(jobs, func(a, b Job) int { return strings.Compare(a.ID, b.ID) })
+	return jobs
+}
+
+// RunScheduler runs scheduled jobs until ctx is canceled.
+//
+// Jobs that should have run while the scheduler wasn't running, for example
+// because the process was restarted, run once as soon as the scheduler starts.
+func (b *Bot) RunScheduler(ctx context.Context) {
+	s := &b.sched
+	persisted, err := b.loadJobState(ctx)
+	if err != nil {
+		b.logger.Error("loading state of scheduled jobs failed", "err", err)
+	}
+	s.mu.Lock()
+	s.persisted = persisted
+	s.mu.Unlock()
+
+	for {
+		now := time.Now()
+		due, next := s.plan(now)
+		for _, st := range due {
+			go b.runJob(ctx, st, now)
+		}
+		b.saveJobState(ctx)
+
+		// Without jobs, sleep until bot code is reloaded.
+		var timerC <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			timer = time.NewTimer(next.Sub(now))
+			timerC = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-timerC:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// plan returns the jobs that are due at now, marking them as running, and the
+// time the next job is due.
+func (s *scheduler) plan(now time.Time) (due []*jobStatus, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range s.jobs {
+		if st.NextRun.IsZero() {
+			// A new job. If it was scheduled before and missed its run, it
+			// runs now.
+			if prev, ok := s.persisted[st.job.id]; ok && prev.Spec == st.Spec && !prev.NextRun.IsZero() {
+				st.LastRun = later(st.LastRun, prev.LastRun)
+				st.NextRun = prev.NextRun
+			} else {
+				st.NextRun = st.job.sched.Next(now)
+			}
+		}
+		if !st.NextRun.IsZero() && !st.NextRun.After(now) {
+			if st.running {
+				// The previous run is still going, skip this one.
+				st.NextRun = st.job.sched.Next(now)
+			} else {
+				st.running = true
+				st.NextRun = st.job.sched.Next(now)
+				due = append(due, st)
+			}
+		}
+		if !st.NextRun.IsZero() && (next.IsZero() || st.NextRun.Before(next)) {
+			next = st.NextRun
+		}
+	}
+	return due, next
+}
+
+// later returns the later of two times.
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (b *Bot) runJob(ctx context.Context, st *jobStatus, start time.Time) {
+	j := st.job
+	b.logger.Info("running scheduled job", "job", j.id)
+	_, err := b.call(ctx, j.intr, fmt.Sprintf("job %q", j.id), j.fn, nil, nil)
+
+	s := &b.sched
+	s.mu.Lock()
+	// The job may have been replaced by reloading bot code while it ran.
+	if cur, ok := s.jobs[j.id]; ok {
+		st = cur
+	}
+	st.running = false
+	st.LastRun = start
+	st.runs++
+	st.lastErr = ""
+	if err != nil {
+		st.lastErr = err.Error()
+		if b.scrubber != nil {
+			st.lastErr = b.scrubber.Replace(st.lastErr)
+		}
+	}
+	s.mu.Unlock()
+	b.saveJobState(ctx)
+
+	if err != nil && ctx.Err() == nil {
+		b.logger.Error("scheduled job failed", "job", j.id, "err", err)
+		b.reportError(ctx, b.tgOwner, err)
+	}
+}
+
+func (b *Bot) loadJobState(ctx context.Context) (map[string]jobState, error) {
+	state := make(map[string]jobState)
+	if b.store == nil {
+		return state, nil
+	}
+	data, err := b.store.Get(ctx, scheduleStateKey)
+	if err != nil || data == nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return make(map[string]jobState), err
+	}
+	return state, nil
+}
+
+func (b *Bot) saveJobState(ctx context.Context) {
+	if b.store == nil {
+		return
+	}
+	s := &b.sched
+	s.mu.Lock()
+	if s.persisted == nil {
+		// Don't overwrite the state before it has been loaded.
+		s.mu.Unlock()
+		return
+	}
+	for id, st := range s.jobs {
+		s.persisted[id] = st.jobState
+	}
+	for id := range s.persisted {
+		if _, ok := s.jobs[id]; !ok {
+			delete(s.persisted, id)
+		}
+	}
+	data, err := json.Marshal(s.persisted)
+	s.mu.Unlock()
+	if err == nil {
+		err = b.store.Set(ctx, scheduleStateKey, data)
+	}
+	if err != nil && ctx.Err() == nil {
+		b.logger.Error("saving state of scheduled jobs failed", "err", err)
+	}
+}
+
+func starlarkSchedule(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		id   string
+		spec string
+		fn   starlark.Callable
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "id", &id, "schedule", &spec, "fn", &fn); err != nil {
+		return nil, err
+	}
+	jobs, ok := thread.Local(jobsLocalKey).(*[]*job)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", b.Name(), errScheduleOutsideOnLoad)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("%s: id should not be empty", b.Name())
+	}
+	if slices.ContainsFunc(*jobs, func(j *job) bool { return j.id == id }) {
+		return nil, fmt.Errorf("%s: job %q is already scheduled", b.Name(), id)
+	}
+	sched, err := cron.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	// The function is called from other threads.
+	fn.Freeze()
+	*jobs = append(*jobs, &job{id: id, spec: spec, sched: sched, fn: fn})
+	return starlark.None, nil
+}
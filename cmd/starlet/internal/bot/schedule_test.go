@@ -0,0 +1,211 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package bot_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/starlet/internal/bot"
+	"go.astrophena.name/tools/internal/starlark/kvcache"
+	"go.astrophena.name/tools/internal/store"
+)
+
+const scheduleBot = `
+def tick():
+    telegram.call(method = "sendMessage", args = {"chat_id": 1, "text": "tick"})
+
+def broken():
+    fail("oops")
+
+def on_load():
+    schedule("tick", "1h", tick)
+    schedule("broken", "@daily", broken)
+
+def handle(update):
+    pass
+`
+
+func scheduleTestBot(t *testing.T, m *mux, s store.Store, code string) *bot.Bot {
+	t.Helper()
+	b := bot.New(bot.Opts{
+		Token:      tgToken,
+		Owner:      123456789,
+		HTTPClient: testutil.MockHTTPClient(m.mux),
+		KVCache:    kvcache.Module(t.Context(), s),
+		Store:      s,
+		Logger:     slog.New(slog.NewTextHandler(t.Output(), nil)),
+	})
+	if err := b.Load(t.Context(), map[string]string{"bot.star": code}); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// waitCalls waits until the bot makes n Telegram API calls.
+func waitCalls(t *testing.T, m *mux, n int) []call {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		calls := append([]call(nil), m.telegramCalls...)
+		m.mu.Unlock()
+		if len(calls) >= n {
+			return calls
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("bot didn't make %d Telegram API calls in time", n)
+	return nil
+}
+
+func TestScheduleMissedRuns(t *testing.T) {
+	t.Parallel()
+
+	s := store.NewMemStore(t.Context(), time.Hour)
+	// Both jobs should have run an hour ago, but the daily one changed its
+	// schedule since.
+	hourAgo := time.Now().Add(-time.Hour)
+	state, err := json.Marshal(map[string]any{
+		"tick":    map[string]any{"spec": "1h", "next_run": hourAgo},
+		"broken":  map[string]any{"spec": "@hourly", "next_run": hourAgo},
+		"removed": map[string]any{"spec": "1h", "next_run": hourAgo},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(t.Context(), "starlet:schedule", state); err != nil {
+		t.Fatal(err)
+	}
+
+	m := testMux(t, nil)
+	b := scheduleTestBot(t, m, s, scheduleBot)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go b.RunScheduler(ctx)
+
+	calls := waitCalls(t, m, 1)
+	testutil.AssertEqual(t, calls[0].Args["text"], "tick")
+
+	jobs := b.Jobs()
+	testutil.AssertEqual(t, len(jobs), 2)
+	broken, tick := jobs[0], jobs[1]
+	testutil.AssertEqual(t, broken.ID, "broken")
+	testutil.AssertEqual(t, broken.Runs, 0)
+	if !broken.NextRun.After(time.Now()) {
+		t.Errorf("broken job should run in the future, got next run at %v", broken.NextRun)
+	}
+	testutil.AssertEqual(t, tick.ID, "tick")
+	if !tick.NextRun.After(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("tick job should run in an hour, got next run at %v", tick.NextRun)
+	}
+
+	// The state is saved without the removed job.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := s.Get(t.Context(), "starlet:schedule")
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := testutil.UnmarshalJSON[map[string]map[string]any](t, data)
+		if _, ok := saved["removed"]; !ok && saved["tick"]["last_run"] != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state wasn't saved: %s", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduleReportsErrors(t *testing.T) {
+	t.Parallel()
+
+	m := testMux(t, nil)
+	b := scheduleTestBot(t, m, store.NewMemStore(t.Context(), time.Hour), `
+def broken():
+    fail("oops")
+
+def on_load():
+    schedule("broken", "1s", broken)
+
+def handle(update):
+    pass
+`)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go b.RunScheduler(ctx)
+
+	calls := waitCalls(t, m, 1)
+	testutil.AssertEqual(t, calls[0].Method, "sendMessage")
+	testutil.AssertEqual(t, calls[0].Args["chat_id"], float64(123456789))
+	if text, _ := calls[0].Args["text"].(string); !strings.Contains(text, "oops") {
+		t.Errorf("error report %q doesn't mention the error", text)
+	}
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jobs := b.Jobs()
+		if jobs[0].Runs > 0 && !jobs[0].Running {
+			if !strings.Contains(jobs[0].LastError, "oops") {
+				t.Errorf("LastError = %q, want the error", jobs[0].LastError)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job status wasn't updated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		code    string
+		wantErr string
+	}{
+		"outside on_load": {
+			code:    `schedule("tick", "1h", lambda: None)`,
+			wantErr: "schedule can only be called from on_load",
+		},
+		"invalid schedule": {
+			code: `
+def on_load():
+    schedule("tick", "every day", lambda: None)
+`,
+			wantErr: `invalid schedule "every day"`,
+		},
+		"duplicate": {
+			code: `
+def on_load():
+    schedule("tick", "1h", lambda: None)
+    schedule("tick", "2h", lambda: None)
+`,
+			wantErr: `job "tick" is already scheduled`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			b := bot.New(bot.Opts{
+				Token:  tgToken,
+				Logger: slog.New(slog.NewTextHandler(t.Output(), nil)),
+			})
+			err := b.Load(t.Context(), map[string]string{"bot.star": tc.code + "\ndef handle(update):\n    pass\n"})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Load() error = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package cron parses schedules of jobs: cron expressions and fixed intervals.
+//
+// A schedule is one of:
+//
+//   - A duration accepted by [time.ParseDuration], for example "90s" or "1h",
+//     that runs a job at a fixed interval.
+//   - A standard cron expression with five space-separated fields: minute
+//     (0-59), hour (0-23), day of month (1-31), month (1-12 or jan-dec) and
+//     day of week (0-7 or sun-sat, where both 0 and 7 are Sunday). Each field
+//     is "*", a value, a range like "1-5" or a comma-separated list of them,
+//     optionally followed by a step like "*/15" or "8-18/2". As in cron, if
+//     both day of month and day of week are restricted, a day matches when
+//     either field does.
+//   - One of the shortcuts "@hourly", "@daily" (or "@midnight"), "@weekly",
+//     "@monthly" and "@yearly" (or "@annually").
+//
+// Cron expressions are evaluated in the location of the time passed to
+// [Schedule.Next].
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule describes when a job runs.
+type Schedule interface {
+	// Next returns the first time the job runs strictly after t, or the zero
+	// time if it never runs again.
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a schedule.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("empty schedule")
+	}
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval should be at least one second", spec)
+		}
+		return Every(d), nil
+	}
+	if expr, ok := shortcuts[spec]; ok {
+		spec = expr
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: want an interval like 1h or a cron expression with 5 fields", spec)
+	}
+	var (
+		e   expr
+		err error
+	)
+	for i, f := range []struct {
+		dst   *uint64
+		field field
+	}{
+		{&e.minute, minuteField},
+		{&e.hour, hourField},
+		{&e.dom, domField},
+		{&e.month, monthField},
+		{&e.dow, dowField},
+	} {
+		*f.dst, err = f.field.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %s: %w", spec, f.field.name, err)
+		}
+	}
+	// Sunday is both 0 and 7.
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+	e.domStar = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	e.dowStar = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+	return &e, nil
+}
+
+var shortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Every returns a schedule that runs a job every d.
+func Every(d time.Duration) Schedule { return every(d) }
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+// expr is a parsed cron expression. Each field is a bit set of matching
+// values.
+type expr struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// searchYears limits how far Next looks for a matching time, so expressions
+// that never match, like "0 0 30 2 *", don't loop forever.
+const searchYears = 5
+
+func (e *expr) Next(t time.Time) time.Time {
+	// Truncate in the location of t, not in UTC as time.Truncate does, so
+	// that zones with offsets that aren't whole hours work.
+	loc := t.Location()
+	t = t.Add(-time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond())).Add(time.Minute)
+	limit := t.Year() + searchYears
+	for t.Year() <= limit {
+		if e.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !e.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if e.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if e.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (e *expr) dayMatches(t time.Time) bool {
+	dom := e.dom&(1<<uint(t.Day())) != 0
+	dow := e.dow&(1<<uint(t.Weekday())) != 0
+	if e.domStar || e.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string // names of values starting from min
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+func (f field) parse(s string) (uint64, error) {
+	var set uint64
+	for part := range strings.SplitSeq(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rng == "*":
+			lo, hi = f.min, f.max
+		case strings.Contains(rng, "-"):
+			loStr, hiStr, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loStr); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(hiStr); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			hi = lo
+			// As in cron, "5/10" means "5-max/10".
+			if hasStep {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q, want %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
@@ -0,0 +1,123 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+)
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	// Wednesday.
+	from := time.Date(2026, time.January, 14, 10, 30, 15, 0, time.UTC)
+
+	cases := map[string]struct {
+		spec string
+		want time.Time
+	}{
+		"interval":              {spec: "90m", want: from.Add(90 * time.Minute)},
+		"every minute":          {spec: "* * * * *", want: time.Date(2026, time.January, 14, 10, 31, 0, 0, time.UTC)},
+		"step":                  {spec: "*/20 * * * *", want: time.Date(2026, time.January, 14, 10, 40, 0, 0, time.UTC)},
+		"hourly":                {spec: "@hourly", want: time.Date(2026, time.January, 14, 11, 0, 0, 0, time.UTC)},
+		"daily":                 {spec: "@daily", want: time.Date(2026, time.January, 15, 0, 0, 0, 0, time.UTC)},
+		"later today":           {spec: "0 18 * * *", want: time.Date(2026, time.January, 14, 18, 0, 0, 0, time.UTC)},
+		"list":                  {spec: "0 9,12 * * *", want: time.Date(2026, time.January, 14, 12, 0, 0, 0, time.UTC)},
+		"weekdays":              {spec: "0 9 * * mon-fri", want: time.Date(2026, time.January, 15, 9, 0, 0, 0, time.UTC)},
+		"sunday as 7":           {spec: "0 9 * * 7", want: time.Date(2026, time.January, 18, 9, 0, 0, 0, time.UTC)},
+		"month name":            {spec: "0 0 1 mar *", want: time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		"range with step":       {spec: "0 8-18/4 * * *", want: time.Date(2026, time.January, 14, 12, 0, 0, 0, time.UTC)},
+		"dom or dow":            {spec: "0 0 1 * fri", want: time.Date(2026, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		"leap day":              {spec: "0 0 29 2 *", want: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		"never":                 {spec: "0 0 30 2 *", want: time.Time{}},
+		"start value with step": {spec: "5/25 * * * *", want: time.Date(2026, time.January, 14, 10, 55, 0, 0, time.UTC)},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, err := Parse(tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, s.Next(from), tc.want)
+		})
+	}
+}
+
+func TestNextInLocation(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	s, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, time.January, 14, 10, 0, 0, 0, loc)
+	testutil.AssertEqual(t, s.Next(from), time.Date(2026, time.January, 15, 9, 0, 0, 0, loc))
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{
+		"",
+		"0s",
+		"-1h",
+		"100ms",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"@reboot",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestNextInNonWholeHourLocation(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		loc        *time.Location
+		expr       string
+		wantMinute int
+	}{
+		"half hour offset": {
+			loc:  time.FixedZone("IST", 5*60*60+30*60),
+			expr: "0 11 * * *",
+		},
+		"quarter hour offset": {
+			loc:  time.FixedZone("NPT", 5*60*60+45*60),
+			expr: "0 11 * * *",
+		},
+		"negative half hour offset": {
+			loc:        time.FixedZone("NST", -(3*60*60 + 30*60)),
+			expr:       "30 11 * * *",
+			wantMinute: 30,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := time.Date(2026, time.January, 14, 10, 15, 30, 0, tc.loc)
+			want := time.Date(2026, time.January, 14, 11, tc.wantMinute, 0, 0, tc.loc)
+			testutil.AssertEqual(t, s.Next(from), want)
+		})
+	}
+}
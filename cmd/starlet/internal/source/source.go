@@ -0,0 +1,252 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package source loads bot code and assets from a GitHub Gist, a local
+// directory or a Git repository.
+//
+// A source is described by a string of the form kind:location:
+//
+//   - gist:ID loads files of the Gist with the given ID.
+//   - dir:/path loads files of a local directory.
+//   - git:/path/to/repo@ref loads files of a Git repository at ref, which
+//     defaults to HEAD. To load a subdirectory of the repository, use Git
+//     tree syntax, for example git:/path/to/repo@main:bots/echo.
+package source
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.astrophena.name/tools/internal/api/gist"
+)
+
+// maxFileSize is the maximum size of a file loaded from a local directory or
+// a Git repository.
+const maxFileSize = 10 << 20 // 10 MiB
+
+// Source loads bot code and assets.
+type Source interface {
+	// Load returns the files of the bot, keyed by slash-separated paths.
+	Load(ctx context.Context) (map[string]string, error)
+	// String returns the description of the source that was parsed.
+	String() string
+}
+
+// Watcher is implemented by sources that can detect changes to bot code.
+type Watcher interface {
+	// Watch calls onChange after bot code changes, until ctx is canceled.
+	Watch(ctx context.Context, onChange func())
+}
+
+// Parse parses a source description. The gist client is used for Gist
+// sources.
+func Parse(s string, gistc *gist.Client) (Source, error) {
+	kind, loc, ok := strings.Cut(s, ":")
+	if !ok || loc == "" {
+		return nil, fmt.Errorf("invalid source %q: want gist:ID, dir:/path or git:/path/to/repo@ref", s)
+	}
+	switch kind {
+	case "gist":
+		return &Gist{ID: loc, Client: gistc}, nil
+	case "dir":
+		return &Dir{Path: loc}, nil
+	case "git":
+		repo, ref := loc, "HEAD"
+		if i := strings.LastIndex(loc, "@"); i > 0 {
+			repo, ref = loc[:i], loc[i+1:]
+		}
+		if ref == "" || strings.HasPrefix(ref, "-") {
+			return nil, fmt.Errorf("invalid source %q: invalid Git ref %q", s, ref)
+		}
+		return &Git{Repo: repo, Ref: ref}, nil
+	}
+	return nil, fmt.Errorf("invalid source %q: unknown kind %q", s, kind)
+}
+
+// Gist loads bot code from a GitHub Gist.
+type Gist struct {
+	ID     string
+	Client *gist.Client
+}
+
+// Load implements [Source].
+func (g *Gist) Load(ctx context.Context) (map[string]string, error) {
+	resp, err := g.Client.Get(ctx, g.ID)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string, len(resp.Files))
+	for name, file := range resp.Files {
+		files[name] = file.Content
+	}
+	return files, nil
+}
+
+func (g *Gist) String() string { return "gist:" + g.ID }
+
+// Dir loads bot code from a local directory. Hidden files and directories are
+// skipped.
+type Dir struct {
+	Path string
+	// PollInterval is how often Watch checks for changes. It defaults to one
+	// second.
+	PollInterval time.Duration
+}
+
+// Load implements [Source].
+func (d *Dir) Load(ctx context.Context) (map[string]string, error) {
+	files := make(map[string]string)
+	err := d.walk(func(name, path string, fi fs.FileInfo) error {
+		if fi.Size() > maxFileSize {
+			return fmt.Errorf("%s: file is too large", name)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[name] = string(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (d *Dir) String() string { return "dir:" + d.Path }
+
+// Watch implements [Watcher]. It polls the modification times and sizes of
+// files, so it works the same on every file system.
+func (d *Dir) Watch(ctx context.Context, onChange func()) {
+	interval := d.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := d.snapshot()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur := d.snapshot()
+		if cur != last {
+			last = cur
+			onChange()
+		}
+	}
+}
+
+// snapshot returns a string that changes when a file of d is added, removed
+// or modified.
+func (d *Dir) snapshot() string {
+	var sb strings.Builder
+	err := d.walk(func(name, _ string, fi fs.FileInfo) error {
+		fmt.Fprintf(&sb, "%s %d %d\n", name, fi.Size(), fi.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		// Report the error as a change, so the reload reports it.
+		fmt.Fprintf(&sb, "error: %v\n", err)
+	}
+	return sb.String()
+}
+
+func (d *Dir) walk(fn func(name, path string, fi fs.FileInfo) error) error {
+	return filepath.WalkDir(d.Path, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == d.Path {
+			return nil
+		}
+		if strings.HasPrefix(de.Name(), ".") {
+			if de.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Path, path)
+		if err != nil {
+			return err
+		}
+		fi, err := de.Info()
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), path, fi)
+	})
+}
+
+// Git loads bot code from a commit of a local Git repository. It needs the git
+// command.
+type Git struct {
+	Repo string
+	Ref  string
+}
+
+// Load implements [Source].
+func (g *Git) Load(ctx context.Context) (map[string]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "-C", g.Repo, "archive", "--format=tar", g.Ref)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git archive %s: %w: %s", g.Ref, err, strings.TrimSpace(stderr.String()))
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(&stdout)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || hidden(hdr.Name) {
+			continue
+		}
+		if hdr.Size > maxFileSize {
+			return nil, fmt.Errorf("%s: file is too large", hdr.Name)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(hdr.Name)] = string(b)
+	}
+	return files, nil
+}
+
+func (g *Git) String() string { return "git:" + g.Repo + "@" + g.Ref }
+
+// hidden reports whether any element of a slash-separated path starts with a
+// dot.
+func hidden(name string) bool {
+	for elem := range strings.SplitSeq(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package source
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/internal/api/gist"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		"gist":             {in: "gist:abc", want: "gist:abc"},
+		"dir":              {in: "dir:/srv/bot", want: "dir:/srv/bot"},
+		"git":              {in: "git:/srv/repo@main", want: "git:/srv/repo@main"},
+		"git without ref":  {in: "git:/srv/repo", want: "git:/srv/repo@HEAD"},
+		"git with at path": {in: "git:/srv/a@b/repo@v1", want: "git:/srv/a@b/repo@v1"},
+		"git empty ref":    {in: "git:/srv/repo@", wantErr: true},
+		"git option ref":   {in: "git:/srv/repo@--output=x", wantErr: true},
+		"no kind":          {in: "/srv/bot", wantErr: true},
+		"no location":      {in: "dir:", wantErr: true},
+		"unknown kind":     {in: "s3:bucket", wantErr: true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			src, err := Parse(tc.in, nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %v, want error", tc.in, src)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, src.String(), tc.want)
+		})
+	}
+}
+
+func TestGist(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET api.github.com/gists/abc", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"files":{"bot.star":{"content":"def handle(update): pass"}}}`))
+	})
+	src, err := Parse("gist:abc", &gist.Client{HTTPClient: testutil.MockHTTPClient(mux)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := src.Load(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, files, map[string]string{"bot.star": "def handle(update): pass"})
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"bot.star":         "def handle(update): pass",
+		"lib/util.star":    "x = 1",
+		".hidden":          "secret",
+		".git/config":      "[core]",
+		"data/prompt.txt":  "Hello",
+		"data/.draft.txt":  "draft",
+		"error.tmpl":       "Error: %v",
+		"lib/.cache/x.bin": "cached",
+	})
+
+	src := &Dir{Path: dir, PollInterval: 10 * time.Millisecond}
+	files, err := src.Load(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, files, map[string]string{
+		"bot.star":        "def handle(update): pass",
+		"lib/util.star":   "x = 1",
+		"data/prompt.txt": "Hello",
+		"error.tmpl":      "Error: %v",
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go src.Watch(ctx, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	// Changes to hidden files are ignored.
+	time.Sleep(50 * time.Millisecond)
+	writeFiles(t, dir, map[string]string{".hidden": "changed"})
+	select {
+	case <-changed:
+		t.Fatal("Watch reported a change to a hidden file")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	writeFiles(t, dir, map[string]string{"lib/new.star": "y = 2"})
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch didn't report a new file")
+	}
+}
+
+func TestGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	writeFiles(t, repo, map[string]string{
+		"bot/bot.star":   "v = 1",
+		".gitattributes": "* text",
+	})
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	git("tag", "v1")
+	writeFiles(t, repo, map[string]string{"bot/bot.star": "v = 2"})
+	git("commit", "-q", "-am", "second")
+	// Uncommitted changes aren't loaded.
+	writeFiles(t, repo, map[string]string{"bot/bot.star": "v = 3"})
+
+	for ref, want := range map[string]map[string]string{
+		"v1":       {"bot/bot.star": "v = 1"},
+		"main":     {"bot/bot.star": "v = 2"},
+		"HEAD":     {"bot/bot.star": "v = 2"},
+		"main:bot": {"bot.star": "v = 2"},
+	} {
+		src, err := Parse("git:"+repo+"@"+ref, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := src.Load(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.AssertEqual(t, files, want)
+	}
+
+	src := &Git{Repo: repo, Ref: "missing"}
+	if _, err := src.Load(t.Context()); err == nil {
+		t.Fatal("Load succeeded for a missing ref")
+	}
+}
@@ -8,10 +8,16 @@ import (
 	"cmp"
 	"context"
 	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.astrophena.name/base/cli"
@@ -24,41 +30,82 @@ import (
 	"go.astrophena.name/tools/cmd/starlet/internal/bot"
 	"go.astrophena.name/tools/internal/api/gist"
 	"go.astrophena.name/tools/internal/api/llm"
-	"go.astrophena.name/tools/internal/starlark/kvcache"
-	"go.astrophena.name/tools/internal/store"
+	starlarkllm "go.astrophena.name/tools/internal/starlark/llm"
 )
 
 const tgAPI = "https://api.telegram.org"
 
-func main() { service.Run(new(engine)) }
+func main() {
+	// The test command runs tests of bot code instead of the service. It must
+	// be the first argument, since flags after it belong to the test command.
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Args = slices.Delete(os.Args, 1, 2)
+		cli.Main(new(tester))
+		return
+	}
+	service.Run(new(engine))
+}
 
 type engine struct {
 	init syncx.Lazy[error] // main initialization
 
 	// initialized by doInit
-	bot      *bot.Bot
-	cspMux   *web.CSPMux
-	gistc    *gist.Client
-	logger   *slog.Logger
-	mux      *http.ServeMux
-	adminMux *http.ServeMux
-	scrubber *strings.Replacer
-	store    store.Store
+	bots       []*hostedBot
+	botsByName map[string]*hostedBot // in multi-bot mode
+	cspMux     *web.CSPMux
+	gistc      *gist.Client
+	logger     *slog.Logger
+	mux        *http.ServeMux
+	adminMux   *http.ServeMux
+	scrubber   *strings.Replacer
 
 	// configuration, read-only after initialization
+	config       string
 	databasePath string
 	llmAPIKey    string
 	llmAPIURL    string
+	llmConfig    string
 	llmUsagePath string
+	maxSteps     uint64
+	timeout      time.Duration
 	ghToken      string
 	gistID       string
 	host         string
+	httpAllow    string
+	httpSecrets  string
 	httpc        *http.Client
+	poll         bool
+	source       string
 	tgOwner      int64
 	tgSecret     string
 	tgToken      string
 }
 
+func (e *engine) Flags(fs *flag.FlagSet) {
+	fs.BoolVar(&e.poll, "poll", false, "Receive updates with long polling instead of a webhook, for running without a public host.")
+	fs.StringVar(&e.source, "source", "", "Load bot code from `source`: gist:ID, dir:/path or git:/path/to/repo@ref.")
+	fs.StringVar(&e.config, "config", "", "Host several bots listed in the JSON config `file`.")
+}
+
+// Run processes queued updates, runs scheduled jobs, reloads bot code when it
+// changes, if the code source supports watching, and receives updates with
+// long polling if the -poll flag is set, for each hosted bot. Otherwise,
+// updates are received by the webhook on the public endpoint.
+func (e *engine) Run(ctx context.Context) error {
+	if err := e.init.Get(func() error {
+		return e.doInit(ctx)
+	}); err != nil {
+		return err
+	}
+	// Wait for updates being processed to finish before stores are closed.
+	var wg sync.WaitGroup
+	for _, hb := range e.bots {
+		wg.Go(func() { hb.run(ctx) })
+	}
+	wg.Wait()
+	return nil
+}
+
 func (e *engine) PublicEndpoint(ctx context.Context) (*service.EndpointConfig, error) {
 	return e.endpointConfig(ctx, false)
 }
@@ -84,22 +131,56 @@ func (e *engine) endpointConfig(ctx context.Context, admin bool) (*service.Endpo
 	return ec, nil
 }
 
-func (e *engine) Shutdown(ctx context.Context) error { return e.store.Close() }
+func (e *engine) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, hb := range e.bots {
+		errs = append(errs, hb.close())
+	}
+	return errors.Join(errs...)
+}
 
 func (e *engine) doInit(ctx context.Context) error {
 	env := cli.GetEnv(ctx)
 
+	// The service takes no arguments. Don't start it if the test command was
+	// meant, but written after flags.
+	if len(env.Args) > 0 {
+		if env.Args[0] == "test" {
+			return fmt.Errorf("%w: test must be the first argument, as in starlet test [-run regexp] [-v] dir", cli.ErrInvalidArgs)
+		}
+		return fmt.Errorf("%w: unexpected arguments %q", cli.ErrInvalidArgs, env.Args)
+	}
+
 	// Load configuration from environment variables.
+	e.config = cmp.Or(e.config, env.Getenv("CONFIG"))
 	e.databasePath = cmp.Or(e.databasePath, env.Getenv("DATABASE_PATH"))
 	e.llmAPIKey = cmp.Or(e.llmAPIKey, env.Getenv("LLM_API_KEY"))
 	e.llmAPIURL = cmp.Or(e.llmAPIURL, env.Getenv("LLM_API_URL"))
+	e.llmConfig = cmp.Or(e.llmConfig, env.Getenv("LLM_CONFIG"))
 	e.llmUsagePath = cmp.Or(e.llmUsagePath, env.Getenv("LLM_USAGE_PATH"))
 	e.ghToken = cmp.Or(e.ghToken, env.Getenv("GH_TOKEN"))
 	e.gistID = cmp.Or(e.gistID, env.Getenv("GIST_ID"))
+	e.source = cmp.Or(e.source, env.Getenv("SOURCE"))
 	e.host = cmp.Or(e.host, env.Getenv("HOST"))
+	e.httpAllow = cmp.Or(e.httpAllow, env.Getenv("HTTP_ALLOW"))
+	e.httpSecrets = cmp.Or(e.httpSecrets, env.Getenv("HTTP_SECRETS"))
 	e.tgOwner = cmp.Or(e.tgOwner, parseInt(env.Getenv("TG_OWNER")))
 	e.tgSecret = cmp.Or(e.tgSecret, env.Getenv("TG_SECRET"))
 	e.tgToken = cmp.Or(e.tgToken, env.Getenv("TG_TOKEN"))
+	if s := env.Getenv("MAX_STEPS"); e.maxSteps == 0 && s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_STEPS: %w", err)
+		}
+		e.maxSteps = n
+	}
+	if s := env.Getenv("TIMEOUT"); e.timeout == 0 && s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid TIMEOUT: %w", err)
+		}
+		e.timeout = d
+	}
 
 	logger := logger.Get(ctx)
 	e.logger = logger.Logger
@@ -111,18 +192,34 @@ func (e *engine) doInit(ctx context.Context) error {
 		}
 	}
 
+	configs, err := e.botConfigs()
+	if err != nil {
+		return err
+	}
+
 	scrubPairs := make([]string, 0, 10)
 	for _, val := range []string{
 		e.ghToken,
 		e.gistID,
-		e.tgSecret,
-		e.tgToken,
 		e.llmAPIKey,
 	} {
 		if val != "" {
 			scrubPairs = append(scrubPairs, val, "[EXPUNGED]")
 		}
 	}
+	for _, cfg := range configs {
+		for _, val := range []string{cfg.Token, cfg.Secret} {
+			if val != "" {
+				scrubPairs = append(scrubPairs, val, "[EXPUNGED]")
+			}
+		}
+		httpSecrets, _ := parseSecrets(cfg.HTTPSecrets, env.Getenv)
+		for _, val := range httpSecrets {
+			if val != "" {
+				scrubPairs = append(scrubPairs, val, "[EXPUNGED]")
+			}
+		}
+	}
 	if len(scrubPairs) > 0 {
 		e.scrubber = strings.NewReplacer(scrubPairs...)
 	}
@@ -133,32 +230,21 @@ func (e *engine) doInit(ctx context.Context) error {
 		Scrubber:   e.scrubber,
 	}
 
-	const kvCacheTTL = 24 * time.Hour
-	if e.databasePath != "" {
-		s, err := store.NewJSONFile(ctx, e.databasePath, kvCacheTTL)
+	var llmConfig starlarkllm.Config
+	if e.llmConfig != "" {
+		llmConfig, err = starlarkllm.LoadConfig(e.llmConfig)
 		if err != nil {
 			return err
 		}
-		e.store = s
-	} else {
-		e.store = store.NewMemStore(ctx, kvCacheTTL)
-	}
-
-	if e.llmUsagePath == "" {
-		e.llmUsagePath = "llm-usage.json"
 	}
 
+	// Options shared by all bots.
 	opts := bot.Opts{
-		Token:        e.tgToken,
-		Secret:       e.tgSecret,
-		Owner:        e.tgOwner,
-		HTTPClient:   e.httpc,
-		KVCache:      kvcache.Module(ctx, e.store),
-		Scrubber:     e.scrubber,
-		Logger:       e.logger.WithGroup("bot"),
-		LLMUsagePath: e.llmUsagePath,
+		HTTPClient: e.httpc,
+		Scrubber:   e.scrubber,
+		MaxSteps:   e.maxSteps,
+		Timeout:    e.timeout,
 	}
-
 	if e.llmAPIKey != "" && e.llmAPIURL != "" {
 		opts.LLMClient = &llm.Client{
 			APIKey:     e.llmAPIKey,
@@ -168,20 +254,25 @@ func (e *engine) doInit(ctx context.Context) error {
 		}
 	}
 
-	me, err := e.getMe(ctx)
-	if err != nil {
-		return err
-	}
-	opts.BotID = me.Result.ID
-	opts.BotUsername = me.Result.Username
-
-	e.bot = bot.New(opts)
-
-	if err := e.loadFromGist(ctx); err != nil {
-		return err
+	for _, cfg := range configs {
+		hb, err := e.initBot(ctx, cfg, opts, llmConfig)
+		if err != nil {
+			for _, hb := range e.bots {
+				hb.close()
+			}
+			e.bots = nil
+			if cfg.Name != "" {
+				err = fmt.Errorf("bot %s: %w", cfg.Name, err)
+			}
+			return err
+		}
+		e.bots = append(e.bots, hb)
 	}
-	if err := e.setWebhook(ctx); err != nil {
-		return err
+	if e.config != "" {
+		e.botsByName = make(map[string]*hostedBot, len(e.bots))
+		for _, hb := range e.bots {
+			e.botsByName[hb.name] = hb
+		}
 	}
 
 	e.cspMux = web.NewCSPMux()
@@ -190,6 +281,35 @@ func (e *engine) doInit(ctx context.Context) error {
 	return nil
 }
 
+// splitList splits a comma-separated list, dropping empty elements.
+func splitList(s string) []string {
+	var list []string
+	for elem := range strings.SplitSeq(s, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+	return list
+}
+
+// parseSecrets reads secrets of the http module from environment variables
+// named in list, each optionally bound to a host as NAME@host. A secret can be
+// bound to several hosts by listing it for each of them.
+func parseSecrets(list []string, getenv func(string) string) (secrets map[string]string, hosts map[string][]string) {
+	secrets = make(map[string]string)
+	for _, elem := range list {
+		name, host, bound := strings.Cut(elem, "@")
+		secrets[name] = getenv(name)
+		if bound {
+			if hosts == nil {
+				hosts = make(map[string][]string)
+			}
+			hosts[name] = append(hosts[name], host)
+		}
+	}
+	return secrets, hosts
+}
+
 func parseInt(s string) int64 {
 	i, err := strconv.ParseInt(s, 10, 64)
 	if err == nil {
@@ -198,15 +318,15 @@ func parseInt(s string) int64 {
 	return 0
 }
 
-func (e *engine) getMe(ctx context.Context) (getMeResponse, error) {
+func (hb *hostedBot) getMe(ctx context.Context) (getMeResponse, error) {
 	return request.Make[getMeResponse](ctx, request.Params{
 		Method:     http.MethodGet,
-		URL:        tgAPI + "/bot" + e.tgToken + "/getMe",
-		HTTPClient: e.httpc,
+		URL:        tgAPI + "/bot" + hb.tgToken + "/getMe",
+		HTTPClient: hb.e.httpc,
 		Headers: map[string]string{
 			"User-Agent": version.UserAgent(),
 		},
-		Scrubber: e.scrubber,
+		Scrubber: hb.e.scrubber,
 	})
 }
 
@@ -225,15 +345,4 @@ type getMeResponse struct {
 	} `json:"result"`
 }
 
-func (e *engine) loadFromGist(ctx context.Context) error {
-	g, err := e.gistc.Get(ctx, e.gistID)
-	if err != nil {
-		return err
-	}
-	files := make(map[string]string, len(g.Files))
-	for name, file := range g.Files {
-		files[name] = file.Content
-	}
-
-	return e.bot.Load(ctx, files)
-}
+var errNoSource = errors.New("bot code source hasn't set; pass it with -source flag or SOURCE environment variable, or set GIST_ID")
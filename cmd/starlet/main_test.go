@@ -0,0 +1,784 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/cli"
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/base/web"
+)
+
+// Typical Telegram Bot API token, copied from docs.
+const tgToken = "123456:ABC-DEF1234ghIkl-zyx57W2v1u123ew11"
+
+// otherTgToken is a token of another bot in multi-bot mode.
+const otherTgToken = "654321:ABC-DEF1234ghIkl-zyx57W2v1u123ew22"
+
+const echoBot = `
+def handle(update):
+    msg = update["message"]
+    telegram.call(
+        method = "sendMessage",
+        args = {"chat_id": msg["chat"]["id"], "text": msg["text"]},
+    )
+`
+
+// fakeTelegram is a fake Telegram Bot API and GitHub Gist API.
+type fakeTelegram struct {
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	calls    []string // called Telegram methods
+	sent     []string // texts of sent messages
+	webhooks []string // URLs passed to setWebhook
+	offsets  []int64  // offsets of getUpdates requests
+	updates  [][]map[string]any
+	onUpdate func() // called when all updates have been delivered
+}
+
+func newFakeTelegram(t *testing.T, files map[string]string) *fakeTelegram {
+	ft := &fakeTelegram{mux: http.NewServeMux()}
+	ft.mux.HandleFunc("GET api.github.com/gists/test", func(w http.ResponseWriter, r *http.Request) {
+		gist := map[string]map[string]map[string]string{"files": {}}
+		for name, content := range files {
+			gist["files"][name] = map[string]string{"content": content}
+		}
+		web.RespondJSON(w, gist)
+	})
+	ft.mux.HandleFunc("GET api.telegram.org/{token}/getMe", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"result":{"id":987654321,"is_bot":true,"username":"testbot"}}`))
+	})
+	ft.mux.HandleFunc("POST api.telegram.org/{token}/{method}", func(w http.ResponseWriter, r *http.Request) {
+		if token := strings.TrimPrefix(r.PathValue("token"), "bot"); token != tgToken && token != otherTgToken {
+			t.Errorf("unexpected token %q", token)
+		}
+		var b []byte
+		if r.Body != nil {
+			var err error
+			if b, err = io.ReadAll(r.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		method := r.PathValue("method")
+		ft.calls = append(ft.calls, method)
+		switch method {
+		case "getUpdates":
+			args := testutil.UnmarshalJSON[struct {
+				Offset  int64 `json:"offset"`
+				Timeout int64 `json:"timeout"`
+			}](t, b)
+			testutil.AssertEqual(t, args.Timeout, int64(pollTimeout.Seconds()))
+			ft.offsets = append(ft.offsets, args.Offset)
+			var result []map[string]any
+			if len(ft.updates) > 0 {
+				result, ft.updates = ft.updates[0], ft.updates[1:]
+			} else if ft.onUpdate != nil {
+				ft.onUpdate()
+				ft.onUpdate = nil
+			}
+			web.RespondJSON(w, map[string]any{"ok": true, "result": result})
+			return
+		case "sendMessage":
+			args := testutil.UnmarshalJSON[map[string]any](t, b)
+			ft.sent = append(ft.sent, args["text"].(string))
+		case "setWebhook":
+			args := testutil.UnmarshalJSON[map[string]any](t, b)
+			ft.webhooks = append(ft.webhooks, args["url"].(string))
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	})
+	return ft
+}
+
+func message(updateID int64, text string) map[string]any {
+	return map[string]any{
+		"update_id": updateID,
+		"message": map[string]any{
+			"message_id": updateID,
+			"chat":       map[string]any{"id": 123, "type": "private"},
+			"from":       map[string]any{"id": 123, "first_name": "Test"},
+			"text":       text,
+		},
+	}
+}
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTelegram(t, map[string]string{"bot.star": echoBot})
+	ft.updates = [][]map[string]any{
+		{message(10, "first"), message(11, "second")},
+		{message(12, "third")},
+	}
+
+	ctx, cancel := context.WithCancel(cli.WithEnv(t.Context(), &cli.Env{
+		Getenv: func(string) string { return "" },
+	}))
+	defer cancel()
+
+	e := &engine{
+		httpc:        testutil.MockHTTPClient(ft.mux),
+		gistID:       "test",
+		llmUsagePath: filepath.Join(t.TempDir(), "llm-usage.json"),
+		poll:         true,
+		tgOwner:      123,
+		tgToken:      tgToken,
+	}
+	// Polling mode doesn't need the host and the secret.
+	if _, err := e.PublicEndpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Stop after all updates have been received and processed.
+	ft.onUpdate = func() {
+		go func() {
+			for e.bots[0].bot.QueueStats().Pending > 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+		}()
+	}
+	if err := e.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	testutil.AssertEqual(t, ft.calls[0], "deleteWebhook")
+	// The fake API doesn't hold empty getUpdates requests, so the last offset
+	// may repeat while the queue drains.
+	testutil.AssertEqual(t, slices.Compact(ft.offsets), []int64{0, 12, 13})
+	testutil.AssertEqual(t, ft.sent, []string{"first", "second", "third"})
+
+	// The webhook isn't served in polling mode.
+	req, err := http.NewRequest(http.MethodPost, "/telegram", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	e.mux.ServeHTTP(w, req)
+	testutil.AssertEqual(t, w.Code, http.StatusNotFound)
+}
+
+func TestWebhookRequiresHost(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTelegram(t, map[string]string{"bot.star": echoBot})
+	ctx := cli.WithEnv(t.Context(), &cli.Env{
+		Getenv: func(string) string { return "" },
+	})
+	e := &engine{
+		httpc:        testutil.MockHTTPClient(ft.mux),
+		gistID:       "test",
+		llmUsagePath: filepath.Join(t.TempDir(), "llm-usage.json"),
+		tgToken:      tgToken,
+	}
+	_, err := e.PublicEndpoint(ctx)
+	testutil.AssertEqual(t, err, errNoHost)
+}
+
+func TestDirSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeBot := func(reply string) {
+		t.Helper()
+		code := fmt.Sprintf(`
+def handle(update):
+    telegram.call(method = "sendMessage", args = {"chat_id": 123, "text": %q})
+`, reply)
+		if err := os.WriteFile(filepath.Join(dir, "bot.star"), []byte(code), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeBot("v1")
+
+	ft := newFakeTelegram(t, nil)
+	ctx := cli.WithEnv(t.Context(), &cli.Env{
+		Getenv: func(string) string { return "" },
+	})
+	e := &engine{
+		httpc:        testutil.MockHTTPClient(ft.mux),
+		llmUsagePath: filepath.Join(t.TempDir(), "llm-usage.json"),
+		poll:         true,
+		source:       "dir:" + dir,
+		tgToken:      tgToken,
+	}
+	if _, err := e.AdminEndpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.bots[0].bot.HandleUpdate(ctx, message(1, "hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	writeBot("v2")
+	req := httptest.NewRequest(http.MethodGet, "/debug/reload", nil)
+	w := httptest.NewRecorder()
+	e.adminMux.ServeHTTP(w, req)
+	testutil.AssertEqual(t, w.Code, http.StatusFound)
+	if err := e.bots[0].bot.HandleUpdate(ctx, message(2, "hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	testutil.AssertEqual(t, ft.sent, []string{"v1", "v2"})
+}
+
+func TestNoSource(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTelegram(t, nil)
+	ctx := cli.WithEnv(t.Context(), &cli.Env{
+		Getenv: func(string) string { return "" },
+	})
+	e := &engine{
+		httpc:   testutil.MockHTTPClient(ft.mux),
+		poll:    true,
+		tgToken: tgToken,
+	}
+	_, err := e.PublicEndpoint(ctx)
+	testutil.AssertEqual(t, err, errNoSource)
+}
+
+func TestTestAfterFlags(t *testing.T) {
+	t.Parallel()
+
+	ctx := cli.WithEnv(t.Context(), &cli.Env{
+		Args:   []string{"test", "./mybot"},
+		Getenv: func(string) string { return "" },
+	})
+	e := &engine{poll: true, tgToken: tgToken}
+	_, err := e.PublicEndpoint(ctx)
+	if !errors.Is(err, cli.ErrInvalidArgs) || !strings.Contains(err.Error(), "first argument") {
+		t.Fatalf("got error %v, want one about the test command", err)
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"bot.star": echoBot,
+		"test_bot.star": `
+def test_echo(t):
+    t.message("hi")
+    t.eq(t.calls("sendMessage")[0].args["text"], "hi")
+
+def test_wrong(t):
+    t.message("hi")
+    t.eq(t.calls("sendMessage")[0].args["text"], "bye")
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]struct {
+		args    []string
+		wantErr error
+		want    []string
+	}{
+		"all": {
+			args:    []string{dir},
+			wantErr: errTestsFailed,
+			want:    []string{"--- FAIL: test_bot.star/test_wrong", `test_bot.star:8: got "hi", want "bye"`, "FAIL"},
+		},
+		"run": {
+			args: []string{"-run", "echo", "-v", dir},
+			want: []string{"=== RUN   test_bot.star/test_echo", "--- PASS: test_bot.star/test_echo", "PASS"},
+		},
+		"no directory": {
+			args:    []string{},
+			wantErr: cli.ErrInvalidArgs,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout strings.Builder
+			ctx := cli.WithEnv(t.Context(), &cli.Env{
+				Args:   tc.args,
+				Getenv: func(string) string { return "" },
+				Stdout: &stdout,
+				Stderr: io.Discard,
+			})
+			err := cli.Run(ctx, new(tester))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output %q doesn't contain %q", stdout.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdatesPage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bot.star"), []byte(echoBot), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ft := newFakeTelegram(t, nil)
+	ctx := cli.WithEnv(t.Context(), &cli.Env{
+		Getenv: func(string) string { return "" },
+	})
+	e := &engine{
+		httpc:        testutil.MockHTTPClient(ft.mux),
+		llmUsagePath: filepath.Join(t.TempDir(), "llm-usage.json"),
+		poll:         true,
+		source:       "dir:" + dir,
+		tgToken:      tgToken,
+	}
+	if _, err := e.AdminEndpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.bots[0].bot.HandleUpdate(ctx, message(1, "hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := serveAdmin(t, e)
+	serve := func(req *http.Request) string {
+		t.Helper()
+		resp, err := admin.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body := read(t, resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d: %s", resp.StatusCode, body)
+		}
+		return string(body)
+	}
+	replay := func(form string) string {
+		req := must(http.NewRequest(http.MethodPost, "http://admin/debug/updates", strings.NewReader(form)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(req)
+	}
+
+	page := serve(must(http.NewRequest(http.MethodGet, "http://admin/debug/updates", nil)))
+	for _, want := range []string{"#1", "Succeeded", "&#34;text&#34;: &#34;hi&#34;"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("updates page doesn't contain %q", want)
+		}
+	}
+
+	page = replay("id=1&dry=1")
+	for _, want := range []string{"Dry replay of update #1", "<code>sendMessage</code>", "#2 (replay of #1)"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("dry replay page doesn't contain %q", want)
+		}
+	}
+	page = replay("id=1")
+	if !strings.Contains(page, "Replay of update #1") {
+		t.Errorf("replay page doesn't contain the result")
+	}
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	testutil.AssertEqual(t, ft.sent, []string{"hi", "hi"})
+}
+
+func TestLLMPage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bot.star"), []byte(`
+def over_budget(err):
+    return err.message
+
+def handle(update):
+    msg = update["message"]
+    reply = llm.generate(
+        model = "test-model",
+        contents = [("user", msg["text"])],
+        usage_key = "chat:%d" % msg["chat"]["id"],
+        on_budget_exceeded = over_budget,
+    )
+    telegram.call(method = "sendMessage", args = {"chat_id": msg["chat"]["id"], "text": reply})
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(t.TempDir(), "llm.json")
+	if err := os.WriteFile(config, []byte(`{
+		"prices": {"test-model": {"input": 1000, "output": 2000}},
+		"budgets": [{"key": "chat:*", "daily_tokens": 30}]
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ft := newFakeTelegram(t, nil)
+	ft.mux.HandleFunc("POST llm.example/v1/responses", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"output_text": "hello", "usage": {"input_tokens": 20, "output_tokens": 10}}`))
+	})
+	ctx := cli.WithEnv(t.Context(), &cli.Env{
+		Getenv: func(string) string { return "" },
+	})
+	e := &engine{
+		httpc:        testutil.MockHTTPClient(ft.mux),
+		llmAPIKey:    "test",
+		llmAPIURL:    "https://llm.example/v1",
+		llmConfig:    config,
+		llmUsagePath: filepath.Join(t.TempDir(), "llm-usage.json"),
+		poll:         true,
+		source:       "dir:" + dir,
+		tgToken:      tgToken,
+	}
+	if _, err := e.AdminEndpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for id := range int64(2) {
+		if err := e.bots[0].bot.HandleUpdate(ctx, message(id+1, "hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ft.mu.Lock()
+	testutil.AssertEqual(t, len(ft.sent), 2)
+	testutil.AssertEqual(t, ft.sent[0], "hello")
+	if !strings.HasPrefix(ft.sent[1], `daily budget of tokens for "chat:*" is exhausted: used 30 of 30`) {
+		t.Errorf("unexpected reply to a request over budget: %q", ft.sent[1])
+	}
+	ft.mu.Unlock()
+
+	resp, err := serveAdmin(t, e).Get("http://admin/debug/llm?days=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	page := string(read(t, resp.Body))
+	testutil.AssertEqual(t, resp.StatusCode, http.StatusOK)
+	for _, want := range []string{
+		"Last 7 days",
+		"<code>chat:123</code>",
+		"<code>test-model</code>",
+		"<code>" + time.Now().UTC().Format(time.DateOnly) + "</code>",
+		"30 (exhausted)",
+		"$0.04",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("LLM usage page doesn't contain %q", want)
+		}
+	}
+}
+
+func TestMultipleBots(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var bots []map[string]any
+	for _, b := range []struct {
+		name, token string
+	}{
+		{"alpha", tgToken},
+		{"beta", otherTgToken},
+	} {
+		src := filepath.Join(dir, b.name)
+		if err := os.Mkdir(src, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		// Only alpha can use the API and its key.
+		code := fmt.Sprintf(`
+def handle(update):
+    resp = http.get("https://api.example.com/", headers = {"X-Key": "{secret:ALPHA_KEY}"})
+    telegram.call(method = "sendMessage", args = {"chat_id": 123, "text": %q + " " + resp.body})
+`, b.name)
+		if err := os.WriteFile(filepath.Join(src, "bot.star"), []byte(code), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		bots = append(bots, map[string]any{
+			"name":           b.name,
+			"token":          b.token,
+			"secret":         b.name + "-secret",
+			"owner":          123,
+			"source":         "dir:" + src,
+			"database_path":  filepath.Join(dir, b.name+".db"),
+			"llm_usage_path": filepath.Join(dir, b.name+"-llm-usage.json"),
+		})
+	}
+	bots[0]["http_allow"] = []string{"api.example.com"}
+	bots[0]["http_secrets"] = []string{"ALPHA_KEY@api.example.com"}
+	config := filepath.Join(dir, "bots.json")
+	if err := os.WriteFile(config, must(json.Marshal(map[string]any{"bots": bots})), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ft := newFakeTelegram(t, nil)
+	ft.mux.HandleFunc("GET api.example.com/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Key") != "alpha-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+	ctx, cancel := context.WithCancel(cli.WithEnv(t.Context(), &cli.Env{
+		Getenv: func(name string) string {
+			if name == "ALPHA_KEY" {
+				return "alpha-key"
+			}
+			return ""
+		},
+	}))
+	defer cancel()
+	e := &engine{
+		httpc:  testutil.MockHTTPClient(ft.mux),
+		config: config,
+		host:   "starlet.example.com",
+	}
+	if _, err := e.PublicEndpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- e.Run(ctx) }()
+
+	webhook := func(bot, secret string, id int64) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/telegram/"+bot, bytes.NewReader(must(json.Marshal(message(id, "hi")))))
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+		w := httptest.NewRecorder()
+		e.mux.ServeHTTP(w, req)
+		return w.Code
+	}
+	testutil.AssertEqual(t, webhook("alpha", "alpha-secret", 1), http.StatusOK)
+	testutil.AssertEqual(t, webhook("beta", "beta-secret", 1), http.StatusOK)
+	// Secrets aren't shared between bots.
+	testutil.AssertEqual(t, webhook("beta", "alpha-secret", 2), http.StatusNotFound)
+	testutil.AssertEqual(t, webhook("gamma", "alpha-secret", 1), http.StatusNotFound)
+	testutil.AssertEqual(t, webhook("", "alpha-secret", 1), http.StatusNotFound)
+
+	for _, hb := range e.bots {
+		for hb.bot.QueueStats().Processed == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	ft.mu.Lock()
+	slices.Sort(ft.sent)
+	testutil.AssertEqual(t, len(ft.sent), 2)
+	testutil.AssertEqual(t, ft.sent[0], "alpha ok")
+	// beta's request fails, and the error is reported to the owner.
+	if !strings.Contains(ft.sent[1], `host "api.example.com" is not allowed`) {
+		t.Errorf("beta sent %q, want an error about the host", ft.sent[1])
+	}
+	testutil.AssertEqual(t, ft.webhooks, []string{
+		"https://starlet.example.com/telegram/alpha",
+		"https://starlet.example.com/telegram/beta",
+	})
+	ft.mu.Unlock()
+
+	admin := serveAdmin(t, e)
+	for path, wants := range map[string][]string{
+		"/debug/": {
+			"alpha: Code source",
+			"beta: Code source",
+			`href="/debug/bots/beta/updates"`,
+		},
+		"/debug/bots/beta/updates": {
+			"<h1>beta: Recent updates</h1>",
+			`action="/debug/bots/beta/updates"`,
+		},
+		"/debug/bots/alpha/llm": {
+			"<h1>alpha: LLM usage</h1>",
+			`href="/debug/bots/alpha/llm?days=7"`,
+		},
+	} {
+		resp, err := admin.Get("http://admin" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(read(t, resp.Body))
+		resp.Body.Close()
+		testutil.AssertEqual(t, resp.StatusCode, http.StatusOK)
+		for _, want := range wants {
+			if !strings.Contains(page, want) {
+				t.Errorf("%s doesn't contain %q", path, want)
+			}
+		}
+	}
+}
+
+func TestBotsConfig(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		config    string
+		poll      bool
+		tgToken   string // set in the environment
+		httpAllow string // set in the environment
+		wantErr   string
+	}{
+		"valid": {
+			config: `{"bots": [{"name": "a", "token": "t1", "secret": "s1", "source": "dir:/a"}, {"name": "b", "token": "t2", "secret": "s2", "source": "dir:/b"}]}`,
+		},
+		"no secret in polling mode": {
+			config: `{"bots": [{"name": "a", "token": "t", "source": "dir:/a"}]}`,
+			poll:   true,
+		},
+		"no bots": {
+			config:  `{"bots": []}`,
+			wantErr: errNoBots.Error(),
+		},
+		"invalid name": {
+			config:  `{"bots": [{"name": "A/B", "token": "t", "secret": "s", "source": "dir:/a"}]}`,
+			wantErr: `bots[0]: name "A/B" should consist of`,
+		},
+		"duplicate name": {
+			config:  `{"bots": [{"name": "a", "token": "t1", "secret": "s1", "source": "dir:/a"}, {"name": "a", "token": "t2", "secret": "s2", "source": "dir:/b"}]}`,
+			wantErr: "bot a: duplicate name",
+		},
+		"no secret": {
+			config:  `{"bots": [{"name": "a", "token": "t", "source": "dir:/a"}]}`,
+			wantErr: "bot a: secret is required",
+		},
+		"no source": {
+			config:  `{"bots": [{"name": "a", "token": "t", "secret": "s"}]}`,
+			wantErr: "bot a: source is required",
+		},
+		"shared database": {
+			config:  `{"bots": [{"name": "a", "token": "t1", "secret": "s1", "source": "dir:/a", "database_path": "db"}, {"name": "b", "token": "t2", "secret": "s2", "source": "dir:/b", "database_path": "db"}]}`,
+			wantErr: "bot b: file db is already used by bot a",
+		},
+		"database taken by state file": {
+			config:  `{"bots": [{"name": "a", "token": "t1", "secret": "s1", "source": "dir:/a", "database_path": "db"}, {"name": "b", "token": "t2", "secret": "s2", "source": "dir:/b", "database_path": "db.state.json"}]}`,
+			wantErr: "bot b: file db.state.json is already used by bot a",
+		},
+		"default LLM usage path taken": {
+			config:  `{"bots": [{"name": "a", "token": "t1", "secret": "s1", "source": "dir:/a", "llm_usage_path": "b-llm-usage.json"}, {"name": "b", "token": "t2", "secret": "s2", "source": "dir:/b"}]}`,
+			wantErr: "bot b: file b-llm-usage.json is already used by bot a",
+		},
+		"single-bot settings": {
+			config:  `{"bots": [{"name": "a", "token": "t", "secret": "s", "source": "dir:/a"}]}`,
+			tgToken: "t",
+			wantErr: errConfigConflict.Error(),
+		},
+		"shared http settings": {
+			config:    `{"bots": [{"name": "a", "token": "t", "secret": "s", "source": "dir:/a"}]}`,
+			httpAllow: "api.example.com",
+			wantErr:   errConfigConflict.Error(),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			e := &engine{
+				config:    filepath.Join(t.TempDir(), "bots.json"),
+				poll:      tc.poll,
+				tgToken:   tc.tgToken,
+				httpAllow: tc.httpAllow,
+			}
+			if err := os.WriteFile(e.config, []byte(tc.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := e.botConfigs()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("got error %v, want to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// serveAdmin serves the admin endpoint of e on a Unix socket and returns a
+// client for it. Pages that link static files can only be rendered by a
+// running server.
+func serveAdmin(t *testing.T, e *engine) *http.Client {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "admin.sock")
+	ready := make(chan struct{})
+	srv := &web.Server{
+		Mux:      e.adminMux,
+		Addr:     sock,
+		StaticFS: staticFS,
+		CSP:      e.cspMux,
+		Ready:    func() { close(ready) },
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatal(err)
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return new(net.Dialer).DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func read(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseSecrets(t *testing.T) {
+	t.Parallel()
+
+	getenv := func(name string) string { return "value of " + name }
+	secrets, hosts := parseSecrets(splitList("KEY, TOKEN@api.example.com,TOKEN@*.example.org"), getenv)
+	testutil.AssertEqual(t, secrets, map[string]string{
+		"KEY":   "value of KEY",
+		"TOKEN": "value of TOKEN",
+	})
+	testutil.AssertEqual(t, hosts, map[string][]string{
+		"TOKEN": {"api.example.com", "*.example.org"},
+	})
+}
@@ -0,0 +1,116 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/base/version"
+)
+
+const (
+	// pollTimeout is how long Telegram holds a getUpdates request open when
+	// there are no updates. It must be shorter than the HTTP client timeout.
+	pollTimeout = 30 * time.Second
+	// pollRetryDelay is how long to wait after a failed getUpdates request or
+	// a failure to queue an update.
+	pollRetryDelay = 5 * time.Second
+)
+
+// pollUpdates receives updates with getUpdates until ctx is canceled, adding
+// them to the bot's queue the same way as the webhook does.
+func (hb *hostedBot) pollUpdates(ctx context.Context) {
+	hb.logger.Info("receiving updates with long polling")
+
+	// Telegram forgets updates with IDs below the offset of the last request,
+	// so updates that weren't queued before a restart are received again.
+	var offset int64
+	for {
+		updates, err := hb.getUpdates(ctx, offset)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			hb.logger.Error("getting updates failed", "err", err)
+			if !waitRetry(ctx) {
+				return
+			}
+			continue
+		}
+		for _, upd := range updates {
+			if err := hb.bot.Enqueue(ctx, upd.raw); err != nil {
+				// Receive the update again with the next request. Telegram
+				// answers it right away, so wait first.
+				hb.logger.Error("queueing update failed", "update_id", upd.id, "err", err)
+				if !waitRetry(ctx) {
+					return
+				}
+				break
+			}
+			offset = max(offset, upd.id+1)
+		}
+	}
+}
+
+// waitRetry waits for pollRetryDelay, and reports false if ctx was canceled
+// before it passed.
+func waitRetry(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(pollRetryDelay):
+		return true
+	}
+}
+
+type polledUpdate struct {
+	id  int64
+	raw map[string]any
+}
+
+func (hb *hostedBot) getUpdates(ctx context.Context, offset int64) ([]polledUpdate, error) {
+	resp, err := request.Make[getUpdatesResponse](ctx, request.Params{
+		Method: http.MethodPost,
+		URL:    tgAPI + "/bot" + hb.tgToken + "/getUpdates",
+		Body: map[string]int64{
+			"offset":  offset,
+			"timeout": int64(pollTimeout / time.Second),
+		},
+		Headers: map[string]string{
+			"User-Agent": version.UserAgent(),
+		},
+		HTTPClient: hb.e.httpc,
+		Scrubber:   hb.e.scrubber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]polledUpdate, 0, len(resp.Result))
+	for _, b := range resp.Result {
+		var upd polledUpdate
+		if err := json.Unmarshal(b, &upd.raw); err != nil {
+			return nil, err
+		}
+		var header struct {
+			UpdateID int64 `json:"update_id"`
+		}
+		if err := json.Unmarshal(b, &header); err != nil {
+			return nil, err
+		}
+		upd.id = header.UpdateID
+		updates = append(updates, upd)
+	}
+	return updates, nil
+}
+
+type getUpdatesResponse struct {
+	OK     bool              `json:"ok"`
+	Result []json.RawMessage `json:"result"`
+}
@@ -6,16 +6,24 @@ package main
 
 import (
 	"bytes"
+	"cmp"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"html/template"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"go.astrophena.name/base/syncx"
 	"go.astrophena.name/base/web"
+	"go.astrophena.name/tools/cmd/starlet/internal/bot"
+	starlarkllm "go.astrophena.name/tools/internal/starlark/llm"
 	"go.astrophena.name/tools/internal/store"
 
 	"github.com/arl/statsviz"
@@ -29,7 +37,10 @@ var (
 	staticFS embed.FS
 
 	templates = sync.OnceValue(func() *template.Template {
-		return template.Must(template.New("").ParseFS(templatesFS, "static/templates/*.tmpl"))
+		return template.Must(template.New("").Funcs(template.FuncMap{
+			"indentJSON": indentJSON,
+			"amount":     formatAmount,
+		}).ParseFS(templatesFS, "static/templates/*.tmpl"))
 	})
 )
 
@@ -51,7 +62,14 @@ func (e *engine) initRoutes() {
 	e.adminMux = http.NewServeMux()
 
 	e.mux.HandleFunc("/", e.handlePublicRoot)
-	e.mux.HandleFunc("POST /telegram", e.bot.HandleTelegramWebhook)
+	// In polling mode there's no secret to check webhook requests against.
+	if !e.poll {
+		if e.botsByName == nil {
+			e.mux.HandleFunc("POST /telegram", e.bots[0].bot.HandleTelegramWebhook)
+		} else {
+			e.mux.HandleFunc("POST /telegram/{bot}", e.handleTelegramWebhook)
+		}
+	}
 
 	// Starlark environment documentation.
 	e.mux.HandleFunc("GET /env", func(w http.ResponseWriter, r *http.Request) {
@@ -67,7 +85,8 @@ func (e *engine) initRoutes() {
 				SmartDash:          true,
 				SmartQuote:         true,
 			}
-			doc := parser.Parse(e.bot.Documentation())
+			// The environment is the same for all bots.
+			doc := parser.Parse(e.bots[0].bot.Documentation())
 			return template.HTML(markdown.ToHTML(doc))
 		})
 
@@ -91,11 +110,63 @@ func (e *engine) initRoutes() {
 	// Debug routes.
 	dbg := web.Debugger(e.adminMux)
 	dbg.MenuFunc(e.debugMenu)
-	dbg.KVFunc("Loaded Starlark modules", func() any {
-		return fmt.Sprintf("%+v", e.bot.Visited())
+	for _, hb := range e.bots {
+		hb.initDebug(dbg)
+	}
+	// Runtime metrics.
+	statsviz.Register(e.adminMux)
+	e.cspMux.Handle("/debug/statsviz/", statsvizCSP)
+	dbg.Link("/debug/statsviz", "Metrics")
+}
+
+// initDebug adds items and pages of the bot to the debug page.
+func (hb *hostedBot) initDebug(dbg *web.DebugHandler) {
+	dbg.KV(hb.label("Code source"), hb.src.String())
+	dbg.KVFunc(hb.label("Loaded Starlark modules"), func() any {
+		return fmt.Sprintf("%+v", hb.bot.Visited())
+	})
+	dbg.KVFunc(hb.label("Starlark execution"), func() any {
+		stats := hb.bot.ExecStats()
+		return fmt.Sprintf(
+			"max_steps=%d\ntimeout=%s\ncalls=%d\nfailed=%d\nsteps_exceeded=%d\ntimed_out=%d\ncanceled=%d",
+			stats.MaxSteps,
+			stats.Timeout,
+			stats.Calls,
+			stats.Failed,
+			stats.StepsExceeded,
+			stats.TimedOut,
+			stats.Canceled,
+		)
 	})
-	if s, ok := e.store.(*store.JSONFile); ok {
-		dbg.KVFunc("KV cache store", func() any {
+	dbg.KVFunc(hb.label("Update queue"), func() any {
+		stats := hb.bot.QueueStats()
+		return fmt.Sprintf(
+			"pending=%d\nchats=%d\nprocessed=%d\nretried=%d\nfailed=%d",
+			stats.Pending,
+			stats.Chats,
+			stats.Processed,
+			stats.Retried,
+			stats.Failed,
+		)
+	})
+	dbg.KVFunc(hb.label("Scheduled jobs"), func() any {
+		jobs := hb.bot.Jobs()
+		if len(jobs) == 0 {
+			return "none"
+		}
+		var sb strings.Builder
+		for _, j := range jobs {
+			fmt.Fprintf(&sb, "%s: schedule=%q runs=%d running=%t last_run=%s next_run=%s",
+				j.ID, j.Schedule, j.Runs, j.Running, formatTime(j.LastRun), formatTime(j.NextRun))
+			if j.LastError != "" {
+				fmt.Fprintf(&sb, " last_error=%q", j.LastError)
+			}
+			sb.WriteString("\n")
+		}
+		return sb.String()
+	})
+	if s, ok := hb.store.(*store.JSONFile); ok {
+		dbg.KVFunc(hb.label("KV cache store"), func() any {
 			stats := s.Stats()
 			return fmt.Sprintf(
 				"path=%s\nmetrics=%s\nttl=%s\nsession_gets=%d\nsession_sets=%d\nsession_rewrites=%d\nsession_rewrite_bytes=%s (%d)\ntotal_gets=%d\ntotal_sets=%d\ntotal_rewrites=%d\ntotal_rewrite_bytes=%s (%d)\ncurrent_size=%s (%d)\nexpired=%d\ncleanup_deletes=%d",
@@ -119,13 +190,11 @@ func (e *engine) initRoutes() {
 			)
 		})
 	}
-	// Runtime metrics.
-	statsviz.Register(e.adminMux)
-	e.cspMux.Handle("/debug/statsviz/", statsvizCSP)
-	dbg.Link("/debug/statsviz", "Metrics")
 
-	dbg.HandleFunc("reload", "Reload", func(w http.ResponseWriter, r *http.Request) {
-		if err := e.loadFromGist(r.Context()); err != nil {
+	dbg.HandleFunc(hb.debugSlug("llm"), hb.label("LLM usage"), hb.handleLLM)
+	dbg.HandleFunc(hb.debugSlug("updates"), hb.label("Recent updates"), hb.handleUpdates)
+	dbg.HandleFunc(hb.debugSlug("reload"), hb.label("Reload"), func(w http.ResponseWriter, r *http.Request) {
+		if err := hb.loadCode(r.Context()); err != nil {
 			web.RespondError(w, r, err)
 			return
 		}
@@ -133,6 +202,185 @@ func (e *engine) initRoutes() {
 	})
 }
 
+// handleTelegramWebhook routes a webhook request to the bot named in its path
+// in multi-bot mode.
+func (e *engine) handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
+	hb, ok := e.botsByName[r.PathValue("bot")]
+	if !ok {
+		web.RespondError(w, r, web.ErrNotFound)
+		return
+	}
+	hb.bot.HandleTelegramWebhook(w, r)
+}
+
+// handleUpdates shows recently handled updates, and replays one of them on POST
+// requests.
+func (hb *hostedBot) handleUpdates(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		MainCSS string
+		Bot     string
+		Path    string
+		Replay  *bot.RecordedUpdate
+		Updates []bot.RecordedUpdate
+	}{
+		MainCSS: web.StaticHashName(r.Context(), "static/css/main.css"),
+		Bot:     hb.name,
+		Path:    "/debug/" + hb.debugSlug(""),
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+		if err != nil {
+			web.RespondError(w, r, fmt.Errorf("%w: invalid update ID", web.ErrBadRequest))
+			return
+		}
+		replay, err := hb.bot.Replay(r.Context(), id, r.FormValue("dry") != "")
+		if errors.Is(err, bot.ErrUpdateNotFound) {
+			web.RespondError(w, r, fmt.Errorf("%w: %v", web.ErrNotFound, err))
+			return
+		}
+		if err != nil {
+			web.RespondError(w, r, err)
+			return
+		}
+		data.Replay = &replay
+	default:
+		web.RespondError(w, r, web.ErrMethodNotAllowed)
+		return
+	}
+	data.Updates = hb.bot.RecordedUpdates()
+
+	var buf bytes.Buffer
+	if err := templates().ExecuteTemplate(&buf, "updates.tmpl", data); err != nil {
+		web.RespondError(w, r, err)
+		return
+	}
+	buf.WriteTo(w)
+}
+
+// defaultLLMUsageDays is the default number of last days shown on the LLM usage
+// page.
+const defaultLLMUsageDays = 30
+
+// handleLLM shows usage of the llm module by usage key, model and day, and
+// the state of budgets.
+func (hb *hostedBot) handleLLM(w http.ResponseWriter, r *http.Request) {
+	days := defaultLLMUsageDays
+	if s := r.FormValue("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			web.RespondError(w, r, fmt.Errorf("%w: days must be a positive number", web.ErrBadRequest))
+			return
+		}
+		days = n
+	}
+	today := time.Now().UTC()
+	since := today.AddDate(0, 0, -(days - 1)).Format(time.DateOnly)
+
+	byDay := make(map[string]*usageRow)
+	byKey := make(map[string]*usageRow)
+	byModel := make(map[string]*usageRow)
+	// Show days without usage too, so the chart doesn't skip them.
+	for i := range days {
+		day := today.AddDate(0, 0, -i).Format(time.DateOnly)
+		byDay[day] = &usageRow{Name: day}
+	}
+	for _, rec := range hb.llmUsage.Records(since) {
+		addUsage(byDay, rec.Day, rec)
+		addUsage(byKey, rec.Key, rec)
+		addUsage(byModel, cmp.Or(rec.Model, "(unknown)"), rec)
+	}
+
+	data := struct {
+		MainCSS string
+		Bot     string
+		Path    string
+		Days    int
+		Budgets []starlarkllm.BudgetStatus
+		ByDay   usageTable
+		ByKey   usageTable
+		ByModel usageTable
+	}{
+		MainCSS: web.StaticHashName(r.Context(), "static/css/main.css"),
+		Bot:     hb.name,
+		Path:    "/debug/" + hb.debugSlug(""),
+		Days:    days,
+		Budgets: hb.llmUsage.Budgets(),
+		ByDay: newUsageTable("By day (UTC)", byDay, func(a, b *usageRow) int {
+			return cmp.Compare(a.Name, b.Name)
+		}),
+		ByKey:   newUsageTable("By key", byKey, byTokens),
+		ByModel: newUsageTable("By model", byModel, byTokens),
+	}
+
+	var buf bytes.Buffer
+	if err := templates().ExecuteTemplate(&buf, "llm.tmpl", data); err != nil {
+		web.RespondError(w, r, err)
+		return
+	}
+	buf.WriteTo(w)
+}
+
+// usageRow is LLM usage of a day, key or model.
+type usageRow struct {
+	Name         string
+	InputTokens  int64
+	OutputTokens int64
+	Cost         float64
+}
+
+func addUsage(rows map[string]*usageRow, name string, rec starlarkllm.UsageRecord) {
+	row, ok := rows[name]
+	if !ok {
+		row = &usageRow{Name: name}
+		rows[name] = row
+	}
+	row.InputTokens += rec.InputTokens
+	row.OutputTokens += rec.OutputTokens
+	row.Cost += rec.Cost
+}
+
+func (r *usageRow) TotalTokens() int64 { return r.InputTokens + r.OutputTokens }
+
+// usageTable is a table of LLM usage. Max is the largest number of tokens
+// in it, used to scale bars.
+type usageTable struct {
+	Title string
+	Rows  []*usageRow
+	Max   int64
+	Cost  float64
+}
+
+func newUsageTable(title string, rows map[string]*usageRow, compare func(a, b *usageRow) int) usageTable {
+	t := usageTable{Title: title}
+	for _, row := range rows {
+		t.Rows = append(t.Rows, row)
+		t.Max = max(t.Max, row.TotalTokens())
+		t.Cost += row.Cost
+	}
+	slices.SortFunc(t.Rows, compare)
+	return t
+}
+
+func byTokens(a, b *usageRow) int {
+	return cmp.Or(
+		cmp.Compare(b.TotalTokens(), a.TotalTokens()),
+		cmp.Compare(a.Name, b.Name),
+	)
+}
+
+// indentJSON indents a JSON document for display, returning it unchanged if
+// it isn't valid.
+func indentJSON(s string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(s), "", "  "); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
 func (e *engine) handlePublicRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		web.RespondError(w, r, web.ErrNotFound)
@@ -186,6 +434,22 @@ func (hi headerItem) ToHTML() template.HTML {
 	return template.HTML(sb.String())
 }
 
+// formatAmount formats an amount of a resource of an LLM budget: "tokens" or
+// "cost".
+func formatAmount(resource string, v float64) string {
+	if resource == "cost" {
+		return fmt.Sprintf("$%.2f", v)
+	}
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.DateTime)
+}
+
 func humanBytes(n uint64) string {
 	const unit = 1024
 	if n < unit {
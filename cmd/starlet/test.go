@@ -0,0 +1,58 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+
+	"go.astrophena.name/base/cli"
+	"go.astrophena.name/tools/cmd/starlet/internal/bot"
+	"go.astrophena.name/tools/cmd/starlet/internal/source"
+)
+
+// tester implements the test command, which runs tests of bot code in a
+// directory.
+type tester struct {
+	run     string
+	verbose bool
+}
+
+func (t *tester) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&t.run, "run", "", "Run only tests with names, in the form file/function, matching `regexp`.")
+	fs.BoolVar(&t.verbose, "v", false, "Print all tests and their logs, not only failed ones.")
+}
+
+var errTestsFailed = errors.New("tests failed")
+
+func (t *tester) Run(ctx context.Context) error {
+	env := cli.GetEnv(ctx)
+	if len(env.Args) != 1 {
+		return fmt.Errorf("%w: pass a directory with bot code", cli.ErrInvalidArgs)
+	}
+	opts := bot.TestOpts{
+		Output:  env.Stdout,
+		Verbose: t.verbose,
+	}
+	if t.run != "" {
+		re, err := regexp.Compile(t.run)
+		if err != nil {
+			return fmt.Errorf("%w: invalid -run: %v", cli.ErrInvalidArgs, err)
+		}
+		opts.Run = re
+	}
+
+	files, err := (&source.Dir{Path: env.Args[0]}).Load(ctx)
+	if err != nil {
+		return err
+	}
+	if !bot.RunTests(ctx, files, opts) {
+		return errTestsFailed
+	}
+	return nil
+}
@@ -16,27 +16,45 @@ import (
 
 var errNoHost = errors.New("host hasn't set; pass it with -host flag or HOST environment variable")
 
-func (e *engine) setWebhook(ctx context.Context) error {
-	if e.host == "" {
+func (hb *hostedBot) setWebhook(ctx context.Context) error {
+	if hb.e.host == "" {
 		return errNoHost
 	}
 	u := &url.URL{
 		Scheme: "https",
-		Host:   e.host,
+		Host:   hb.e.host,
 		Path:   "/telegram",
 	}
+	if hb.name != "" {
+		u.Path += "/" + hb.name
+	}
 	_, err := request.Make[request.IgnoreResponse](ctx, request.Params{
 		Method: http.MethodPost,
-		URL:    tgAPI + "/bot" + e.tgToken + "/setWebhook",
+		URL:    tgAPI + "/bot" + hb.tgToken + "/setWebhook",
 		Body: map[string]string{
 			"url":          u.String(),
-			"secret_token": e.tgSecret,
+			"secret_token": hb.tgSecret,
 		},
 		Headers: map[string]string{
 			"User-Agent": version.UserAgent(),
 		},
-		HTTPClient: e.httpc,
-		Scrubber:   e.scrubber,
+		HTTPClient: hb.e.httpc,
+		Scrubber:   hb.e.scrubber,
+	})
+	return err
+}
+
+// deleteWebhook removes the webhook, so updates can be received with
+// getUpdates.
+func (hb *hostedBot) deleteWebhook(ctx context.Context) error {
+	_, err := request.Make[request.IgnoreResponse](ctx, request.Params{
+		Method: http.MethodPost,
+		URL:    tgAPI + "/bot" + hb.tgToken + "/deleteWebhook",
+		Headers: map[string]string{
+			"User-Agent": version.UserAgent(),
+		},
+		HTTPClient: hb.e.httpc,
+		Scrubber:   hb.e.scrubber,
 	})
 	return err
 }
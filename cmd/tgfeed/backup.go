@@ -0,0 +1,80 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.astrophena.name/tools/cmd/tgfeed/internal/backup"
+	"go.astrophena.name/tools/internal/filelock"
+)
+
+// backup writes an archive of the state directory to w.
+func (f *fetcher) backup(ctx context.Context, w io.Writer) error {
+	if f.remoteURL != "" {
+		b, err := f.store.LoadBackup(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	return f.withRunLock(func() error {
+		return backup.Create(ctx, w, f.stateDir, time.Now())
+	})
+}
+
+// backupToFile writes an archive of the state directory to the file at path,
+// or to w if path is "-".
+func (f *fetcher) backupToFile(ctx context.Context, w io.Writer, path string) error {
+	if path == "-" {
+		return f.backup(ctx, w)
+	}
+	// Create the archive in memory, so a failed backup doesn't leave a
+	// truncated file behind.
+	var buf bytes.Buffer
+	if err := f.backup(ctx, &buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o600)
+}
+
+// restore validates the archive read from r and replaces the state directory
+// with it.
+func (f *fetcher) restore(ctx context.Context, r io.Reader) error {
+	if f.remoteURL != "" {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return f.store.RestoreBackup(ctx, b)
+	}
+	return f.withRunLock(func() error {
+		manifest, err := backup.Restore(ctx, r, f.stateDir, f.validateConfig)
+		if err != nil {
+			return err
+		}
+		f.logf("Restored backup created at %s.", manifest.Created.Format(time.DateTime))
+		return nil
+	})
+}
+
+func (f *fetcher) withRunLock(fn func() error) error {
+	lock, err := f.lockRun()
+	if errors.Is(err, filelock.ErrAlreadyLocked) {
+		return fmt.Errorf("%w: try again after the run finishes", errAlreadyRunning)
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	return fn()
+}
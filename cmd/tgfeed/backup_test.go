@@ -0,0 +1,148 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/admin"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+)
+
+func TestBackupRestore(t *testing.T) {
+	t.Parallel()
+
+	src := newTestEnv(t, stateArchive(t, []byte(`feed(url = "https://example.com/feed.xml")`), map[string]*state.Feed{
+		atomFeedURL: {FetchCount: 3},
+	}), nil)
+	srcFetcher := newTestFetcher(t, src)
+	store := stats.OpenWriter(src.stateDir)
+	if err := store.Bootstrap(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "tgfeed.tar.gz")
+	if err := srcFetcher.backupToFile(t.Context(), nil, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// A backup can't be taken while a run is in progress.
+	if err := srcFetcher.acquireRunLock(); err != nil {
+		t.Fatal(err)
+	}
+	err := srcFetcher.backup(t.Context(), new(bytes.Buffer))
+	if !errors.Is(err, errAlreadyRunning) {
+		t.Fatalf("backup() during run = %v, want %v", err, errAlreadyRunning)
+	}
+	if err := srcFetcher.releaseRunLock(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestEnv(t, stateArchive(t, []byte(`feed(url = "https://example.com/old.xml")`), nil), nil)
+	dstFetcher := newTestFetcher(t, dst)
+	b, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dstFetcher.restore(t.Context(), bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, string(readFile(t, filepath.Join(dst.stateDir, "config.star"))), `feed(url = "https://example.com/feed.xml")`)
+	testutil.AssertEqual(t, dst.state(t)[atomFeedURL].FetchCount, int64(3))
+	if _, err := os.Stat(filepath.Join(dst.stateDir, "stats.sqlite3")); err != nil {
+		t.Fatalf("stats database wasn't restored: %v", err)
+	}
+}
+
+func TestRestoreInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	src := newTestEnv(t, stateArchive(t, []byte(`feed(url = "https://example.com/feed.xml", unknown = True)`), nil), nil)
+	var buf bytes.Buffer
+	if err := newTestFetcher(t, src).backup(t.Context(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	const config = `feed(url = "https://example.com/feed.xml")`
+	dst := newTestEnv(t, stateArchive(t, []byte(config), nil), nil)
+	err := newTestFetcher(t, dst).restore(t.Context(), &buf)
+	if err == nil || !strings.Contains(err.Error(), "invalid backup") {
+		t.Fatalf("restore() = %v, want invalid backup error", err)
+	}
+	testutil.AssertEqual(t, string(readFile(t, filepath.Join(dst.stateDir, "config.star"))), config)
+}
+
+func TestBackupRestoreRemote(t *testing.T) {
+	t.Parallel()
+
+	newServer := func(t *testing.T, env *testEnv) *httptest.Server {
+		f := newTestFetcher(t, env)
+		h, err := admin.Handler(admin.Config{
+			StateDir:       env.stateDir,
+			Store:          state.NewStore(state.Options{StateDir: env.stateDir}),
+			IsRunLocked:    f.isRunLocked,
+			LockRun:        f.lockRun,
+			ValidateBackup: f.validateConfig,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(h)
+		t.Cleanup(server.Close)
+		return server
+	}
+	remoteFetcher := func(t *testing.T, server *httptest.Server) *fetcher {
+		f := newTestFetcher(t, newTestEnv(t, nil, nil))
+		f.remoteURL = server.URL
+		f.store = state.NewStore(state.Options{RemoteURL: server.URL, HTTPClient: server.Client()})
+		return f
+	}
+
+	src := newTestEnv(t, stateArchive(t, []byte(`feed(url = "https://example.com/feed.xml")`), map[string]*state.Feed{
+		atomFeedURL: {FetchCount: 3},
+	}), nil)
+	var buf bytes.Buffer
+	if err := remoteFetcher(t, newServer(t, src)).backup(t.Context(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestEnv(t, stateArchive(t, []byte(`feed(url = "https://example.com/old.xml")`), nil), nil)
+	dstServer := newServer(t, dst)
+	if err := remoteFetcher(t, dstServer).restore(t.Context(), bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, dst.state(t)[atomFeedURL].FetchCount, int64(3))
+
+	// Garbage is rejected with the reason.
+	err := remoteFetcher(t, dstServer).restore(t.Context(), strings.NewReader("not a backup"))
+	if err == nil || !strings.Contains(err.Error(), "invalid backup") {
+		t.Fatalf("restore() = %v, want invalid backup error", err)
+	}
+
+	// The admin server refuses to back up while a run is in progress.
+	f := newTestFetcher(t, dst)
+	if err := f.acquireRunLock(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.releaseRunLock() })
+	resp, err := dstServer.Client().Get(dstServer.URL + "/api/backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	testutil.AssertEqual(t, resp.StatusCode, http.StatusConflict)
+}
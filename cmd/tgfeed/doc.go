@@ -16,6 +16,13 @@ Where <command> is one of the following commands:
   - edit: Open the config.star configuration file in your $EDITOR for editing.
   - feeds: List all configured feeds and their status.
   - reenable: Re-enable a previously disabled feed by its URL.
+  - stats: Print recent run stats or hourly and daily rollups.
+  - doctor: Check the configuration, Telegram access and state directory for
+    problems (see Diagnostics below).
+  - backup: Write an archive of the state directory to a file, or to standard
+    output if no file is given (see Backups below).
+  - restore: Validate an archive created by backup and replace the state
+    directory with it.
   - admin: Start the admin API server for remote management and statistics download.
 
 # Flags
@@ -34,21 +41,44 @@ Required:
 
   - CHAT_ID: Telegram chat ID where the program sends new articles.
   - STATE_DIRECTORY: Directory where tgfeed stores its state files (config.star,
-    state.json, error.tmpl). Defaults to $XDG_STATE_HOME/tgfeed directory if not
+    state.json, topics.json, error.tmpl, templates). Defaults to $XDG_STATE_HOME/tgfeed directory if not
     set (~/.local/state/tgfeed).
   - TELEGRAM_TOKEN: Telegram bot token for accessing the Telegram Bot API.
 
-Required for GitHub notifications special feed:
+Required for special feeds (see below):
 
   - GITHUB_TOKEN: GitHub personal access token for accessing the GitHub API.
+    Optional for GitHub releases, where it only raises API rate limits, but
+    required to watch tags.
+  - GITLAB_TOKEN: GitLab personal access token with the read_api scope (api
+    scope to mark to-do items as done).
+  - GITLAB_URL: GitLab instance URL. Defaults to https://gitlab.com.
+  - GITEA_TOKEN, GITEA_URL: Gitea access token and instance URL. GITEA_URL
+    defaults to https://gitea.com.
+  - FORGEJO_TOKEN, FORGEJO_URL: Forgejo access token and instance URL.
+    FORGEJO_URL defaults to https://codeberg.org.
 
 Optional:
 
+  - ARCHIVE_RETENTION_DAYS: Number of days to keep delivered items in the
+    archive. Defaults to 365, and 0 keeps them forever.
   - ADMIN_ADDR: Address for the admin API server. Can be a TCP address like
     "localhost:8080" or a Unix socket path like "/run/tgfeed/admin-socket".
     Defaults to "/run/tgfeed/admin-socket".
   - ERROR_THREAD_ID: Telegram message thread ID where the program sends error
     notifications. This is applicable only for supergroups with topics enabled.
+  - ERROR_TOPIC: Name of the forum topic where the program sends error
+    notifications. The topic is created if it doesn't exist. Takes precedence
+    over ERROR_THREAD_ID.
+  - LLM_API_URL, LLM_API_KEY: Root URL and key of an OpenAI Responses API
+    compatible gateway, used to translate items (see Translation below).
+  - LLM_MODEL: Model used for translation. Defaults to gpt-4.1-mini.
+  - STATS_RAW_RETENTION_DAYS: Number of days to keep per-run stats before
+    rolling them up into hourly buckets. Defaults to 30, and 0 keeps them
+    forever.
+  - STATS_HOURLY_RETENTION_DAYS: Number of days to keep hourly rollups before
+    rolling them up into daily buckets. Defaults to 180, and 0 keeps them
+    forever.
 
 # Configuration
 
@@ -70,6 +100,19 @@ Optionally, message_thread_id can be specified to send updates from this
 feed to a specific message thread (topic) within the chat. This is applicable
 only for supergroups with topics enabled.
 
+Instead of looking up thread IDs, a topic can be referenced by name:
+
+	feed(
+	    url="https://github.com/golang/go/releases.atom",
+	    topic="Releases",
+	)
+
+tgfeed creates the topic with the createForumTopic method the first time it's
+needed and remembers its thread ID in topics.json. If the topic is deleted
+later, it is created again on the next delivery. The bot must be an
+administrator of the chat allowed to manage topics. The topic and
+message_thread_id arguments are mutually exclusive.
+
 If always_send_new_items is set to true, tgfeed will send items even if they
 have a publication date in the past. This is useful for feeds that add items
 retrospectively, like CourtListener docket feeds. To avoid duplicates, tgfeed
@@ -87,6 +130,36 @@ it is used as the message text. The format function can also return a tuple of
 (text, keyboard) to attach an inline keyboard to the message, or a 3-element tuple
 (text, keyboard, media_list) to send the output as native Telegram media.
 
+Instead of a format function, a message template written in Go template syntax
+(see https://pkg.go.dev/text/template) can be used by setting template to the
+name of a file in the templates directory of STATE_DIRECTORY:
+
+	feed(
+	    url="https://github.com/golang/go/releases.atom",
+	    template="release.tmpl",
+	)
+
+With templates/release.tmpl containing:
+
+	*{{.Feed.Title}}*: [{{.Item.Title}}]({{.Item.Link}}) · {{domain .Item.Link}}
+	{{.Item.Content | stripHTML | truncate 200}}
+
+Templates are executed with .Feed (URL, Title and Digest), .Item (the first
+item) and .Items (all items, useful in digest mode), where items have the
+fields of gofeed.Item, such as Title, Link, Content, Description and
+PublishedParsed. All files in the templates directory are parsed together, so
+templates can include each other with the template action. The following
+helper functions are available:
+
+  - truncate n s: shortens s to at most n characters.
+  - stripHTML s: removes HTML tags from s.
+  - domain url: returns the host name of url without the "www." prefix.
+  - relativeTime t: formats a time relative to now, like "3 hours ago".
+  - language item: returns the language code of item, like "en".
+
+Templates are checked with a sample item when the config is loaded or edited.
+The format and template arguments are mutually exclusive.
+
 Block and keep rules are Starlark functions that take a feed item as an argument
 and return a boolean value. If a block rule returns true, the item is not sent
 to Telegram. If a keep rule returns true, the item is sent to Telegram;
@@ -101,6 +174,106 @@ keys:
   - content: The content of the item.
   - categories: A list of categories the item belongs to.
   - enclosures: A list of media enclosures (each with a url, type, and length).
+  - language: The ISO 639-1 code of the item's language, like "en", or an
+    empty string if it's unknown. It is taken from the item's or the feed's
+    language metadata, or guessed from the item's text.
+
+For example, to only keep items written in German or English:
+
+	feed(
+	    url="https://example.com/feed.xml",
+	    keep_rule=lambda item: item.language in ("de", "en"),
+	)
+
+# Translation
+
+Items of a feed can be translated before they're formatted by setting
+translate_to to a language code:
+
+	feed(
+	    url="https://example.com/feed.xml",
+	    translate_to="en",
+	)
+
+tgfeed sends the title and summary (the description, or the content if there
+is none) of each item that is not already in that language to the LLM
+configured with LLM_API_URL and LLM_API_KEY, and formats the message with the
+translated title and summary, which replaces both the description and the
+content of the item. Rules see the original item, and the archive
+keeps it. Translations are cached in stats.sqlite3 by item GUID for
+ARCHIVE_RETENTION_DAYS, so an item is translated only once. If translation
+fails, the original item is sent. Token usage and translation counts are
+recorded in run stats.
+
+# HTTP Settings
+
+Feeds that need credentials or are only reachable through a proxy accept
+additional arguments:
+
+	feed(
+	    url="https://www.patreon.com/rss/example",
+	    headers={"Cookie": "session=${PATREON_SESSION}"},
+	    auth=("user", "${PODCAST_PASSWORD}"), # Or a raw Authorization header: "Bearer ${TOKEN}".
+	    proxy="socks5://localhost:1080", # http, https, socks5 and socks5h are supported.
+	    timeout="30s", # Instead of the default 60 seconds.
+	)
+
+Values of headers, auth and proxy can reference environment variables as
+${NAME}, so that secrets don't have to be written into config.star. They are
+expanded for every request, and a feed referencing an unset variable fails to
+fetch. Values of referenced variables are replaced with [EXPUNGED] in errors
+recorded in state, logs and error notifications. The whole proxy URL can come
+from a variable, as in proxy="${PROXY_URL}"; its scheme is then checked when
+the feed is fetched. Custom headers and auth aren't sent to another host
+when a feed redirects there.
+
+# Retry Policies
+
+Failed fetches are retried on transient errors: server errors (5xx), network
+timeouts, responses with a short Retry-After header, and known rate limiting
+responses of some hosts. By default, a feed is retried up to 3 times, waiting
+5 seconds between attempts, and a fetch fails if the server asks to wait
+longer than 5 minutes.
+
+The retry_policy function in config.star overrides these defaults for a
+single host:
+
+	retry_policy(
+	    host="tg.i-c-a.su",
+	    max_retries=5,
+	    backoff="exponential", # Or "constant" (default) and "linear".
+	    initial_wait="10s",
+	    max_wait="10m",
+	    wait_pattern=r"FLOOD_WAIT_(\d+)", # Extract the wait time from the body.
+	    transient_status=[429, 502, 503], # Replaces the default of all 5xx.
+	)
+
+The first capture group of wait_pattern is parsed either as a number of
+seconds or as a duration like "1m30s". Built-in handlers for known hosts take
+precedence over wait_pattern. Every retry decision, including giving up, is
+recorded in run stats.
+
+# Host Limits
+
+To avoid hammering sites that host many feeds, tgfeed fetches at most 2 feeds
+from the same host at once. While one host is busy, fetch workers move on to
+feeds from other hosts, so a run takes about as long as its slowest host
+needs.
+
+The host_limits function in config.star changes this for a single host:
+
+	host_limits(
+	    host="example.com",
+	    max_concurrency=1, # 0 removes the limit.
+	    min_delay="2s", # Minimum time between requests to this host.
+	    robots_txt=True, # Honor Crawl-delay from robots.txt.
+	)
+
+With robots_txt set, tgfeed fetches the robots.txt of the host once per run
+and waits for the longer of min_delay and its Crawl-delay between requests.
+Crawl delays over a minute are capped. The limits apply to retries as well.
+robots.txt is requested with the scheme, proxy and timeout of the first feed
+from the host.
 
 # Media Support
 
@@ -117,6 +290,15 @@ for example:
 If the list contains multiple media items, tgfeed automatically bundles them into a
 Telegram media album (media group), respecting Telegram's limits by batching when necessary.
 
+Telegram fetches media by URL itself, which fails for hosts that block it and
+for files over its URL size limits. In that case tgfeed downloads the media
+and uploads it instead. The upload method is chosen by the actual file type:
+JPEG, PNG and WebP images up to 10 MB are sent as photos, MP4 files as videos,
+and everything else as documents. Files over 50 MB can't be uploaded.
+Media is downloaded through the proxy of its feed, with its custom headers and
+credentials if it's on the same host as the feed, and is kept in temporary
+files until uploaded.
+
 # Special Feeds
 
 tgfeed supports special feed URLs for integrating with services other than
@@ -127,6 +309,30 @@ receive your GitHub notifications via Telegram and mark them as read on GitHub.
 This requires a GitHub personal access token with the notifications scope, which
 should be provided via the GITHUB_TOKEN environment variable.
 
+The following special feeds are also available:
+
+  - tgfeed://gitlab-todos: pending GitLab to-do items, marked as done after
+    delivery. Uses GITLAB_TOKEN and GITLAB_URL.
+  - tgfeed://gitea-notifications and tgfeed://forgejo-notifications: unread
+    Gitea or Forgejo notifications, marked as read after delivery. Use
+    GITEA_TOKEN and GITEA_URL, or FORGEJO_TOKEN and FORGEJO_URL.
+  - tgfeed://github-releases: releases of a list of GitHub repositories,
+    passed as repo query parameters. Pre-releases are skipped unless
+    prereleases=true is set. With tags=true, tags are watched instead of
+    releases, for repositories that don't publish GitHub releases. Tags of
+    all repositories of a feed are fetched with a single GraphQL API request,
+    which requires GITHUB_TOKEN.
+
+For example, to watch releases of two repositories including pre-releases:
+
+	feed(
+	    url="tgfeed://github-releases?repo=golang/go,astrophena/tools&prereleases=true",
+	    title="Releases",
+	)
+
+Items that are filtered out by rules are acknowledged at the source as well,
+so they don't pile up in your GitLab to-do list or notification inbox.
+
 # State
 
 tgfeed stores its state in local files within STATE_DIRECTORY.
@@ -142,8 +348,11 @@ The following files and directories are used:
 
   - config.star: Feed configuration written in Starlark.
   - state.json: Feed state information (last fetch times, errors, etc.).
+  - topics.json: Thread IDs of forum topics referenced by name.
+  - templates: Directory with message templates.
   - error.tmpl: Optional custom error notification template.
-  - stats.sqlite3: SQLite database containing runtime statistics for each run.
+  - stats.sqlite3: SQLite database containing runtime statistics for each run,
+    the archive of delivered items and cached translations.
 
 # Stats Collection
 
@@ -162,12 +371,118 @@ Stats include:
   - Number of parsed RSS items
   - Total fetch time for all successful feeds
   - Average fetch time per successful feed
+  - Number of translated items and LLM tokens used
   - Memory usage at the end of the run
 
 These stats can be fetched in bulk as JSON from the admin server's
 /api/stats endpoint. This is useful for custom dashboards and for analyzing
 feed performance over time.
 
+To keep the database small, runs older than STATS_RAW_RETENTION_DAYS are
+rolled up into hourly buckets, and hourly buckets older than
+STATS_HOURLY_RETENTION_DAYS into daily ones. Rollups keep run counts, totals
+and maximums, so long-term trends survive pruning.
+
+The stats command prints recent runs or rollups as a table:
+
+	$ tgfeed stats          # Last 20 runs.
+	$ tgfeed stats day 30   # Last 30 daily rollups.
+
+The admin server exports the same data from /api/stats/export as CSV or
+newline-delimited JSON, for example
+/api/stats/export?format=csv&period=hour&limit=500.
+
+# Archive
+
+Every delivered item is archived in stats.sqlite3 with its feed, title, link,
+content, publication and delivery times, and the ID of the Telegram message it
+was sent in. Items are kept for ARCHIVE_RETENTION_DAYS.
+
+The archive is indexed for full-text search and can be searched on the
+Archive page of the admin server, or with its /api/items endpoint:
+
+	$ curl 'http://localhost:8080/api/items?q=iterators'
+
+Search terms are matched as whole words, regardless of case and diacritics,
+and a term ending with * matches as a prefix. The feed query parameter limits
+results to a single feed by URL. Without q, the latest items are returned.
+
+The admin server also republishes delivered items as feeds, so the filtered
+stream can be followed in a feed reader:
+
+  - /feeds/atom: Atom feed of recently delivered items.
+  - /feeds/json: the same as a JSON Feed.
+
+Both accept feed (URL of a single source feed) and thread (message thread ID,
+0 for the main chat) query parameters, and limit, which defaults to 50 items.
+Entries contain the message text as it was sent to Telegram. Responses carry
+an ETag, so readers only download feeds that have changed.
+
+# Diagnostics
+
+The doctor command checks for common problems and prints a report:
+
+	$ tgfeed doctor
+	OK    TELEGRAM_TOKEN: set
+	OK    CHAT_ID: set
+	OK    config: 42 feeds
+	WARN  feed https://example.com/feed.xml: disabled after 12 failed fetches, ...
+	OK    bot: @feeds_bot (ID 123456)
+	OK    chat: "News" (supergroup, forum)
+	OK    chat: bot can post
+	FAIL  thread 7: used by https://example.com/other.xml: ... message thread not found ...
+	OK    state directory: /var/lib/tgfeed
+	OK    run lock: free
+	OK    stats database: schema version 6
+
+It validates environment variables and the configuration, reports disabled,
+failing and stale feeds, and checks that the bot can post to CHAT_ID and to
+every message thread and forum topic in use. To check posting without sending
+messages, the bot briefly shows the "typing" status in the chat. Finally, it
+checks the permissions of the state directory, the run lock and the schema of
+the stats database, without applying pending migrations.
+
+With -remote, the state directory checks are done by the admin server (see
+its /api/doctor endpoint), while Telegram access is checked with the local
+environment. The command fails if any check fails.
+
+# Backups
+
+The backup command writes a gzip-compressed tar archive with config.star,
+state.json, error.tmpl, topics.json, message templates and the stats
+database:
+
+	$ tgfeed backup tgfeed.tar.gz
+
+The stats database is copied with VACUUM INTO, which, like SQLite's online
+backup API, makes a consistent snapshot even if the admin server has it open,
+without blocking its writers. The command holds the run lock while the
+archive is written, and fails if a run is in progress.
+
+The restore command validates an archive and replaces the state directory
+with it:
+
+	$ tgfeed restore tgfeed.tar.gz
+
+The configuration and message templates must be valid, the state files must
+parse, and the stats database must pass an integrity check and have a schema
+this version of tgfeed supports. An older stats database is migrated to the
+current schema. Nothing is changed if the archive is invalid or restoring it
+fails halfway.
+Files that are missing from the archive, such as topics.json, are removed
+from the state directory. Use - as the file name to read the archive from
+standard input.
+
+Both commands work with -remote, which makes it possible to migrate a
+sandboxed instance to a new host:
+
+	$ tgfeed -remote=/run/tgfeed/admin-socket backup tgfeed.tar.gz
+	$ scp tgfeed.tar.gz newhost:
+	$ ssh newhost tgfeed -remote=/run/tgfeed/admin-socket restore tgfeed.tar.gz
+
+The admin server serves archives at GET /api/backup and restores them from
+PUT /api/backup, which accepts archives of up to 1 GiB.
+
 # Administration
 
 To edit the config.star file, you can use the edit command. This will open the
@@ -200,7 +515,10 @@ To start the admin API server:
 The server listens on the address specified by ADMIN_ADDR (defaults to
 /run/tgfeed/admin-socket). It provides a simple web interface for viewing and
 editing the configuration and state, and for reading run statistics via
-/api/stats.
+/api/stats. Message templates can be listed with /api/templates and edited
+with PUT and DELETE requests to /api/templates/{name}, for example:
+
+	$ curl -X PUT --data-binary @release.tmpl http://localhost:8080/api/templates/release.tmpl
 
 To manage tgfeed remotely, use the -remote flag with any command:
 
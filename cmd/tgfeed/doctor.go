@@ -0,0 +1,232 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.astrophena.name/tools/cmd/tgfeed/internal/doctor"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/telegram"
+)
+
+// staleFeedAge is how long a feed can go without a successful fetch before
+// doctor reports it.
+const staleFeedAge = 7 * 24 * time.Hour
+
+// diagnose checks for common configuration problems and prints a report to
+// w. It returns an error if any check fails.
+func (f *fetcher) diagnose(ctx context.Context, w io.Writer) error {
+	checks := f.envChecks()
+
+	configOK := true
+	if err := f.loadState(ctx); err != nil {
+		configOK = false
+		checks = append(checks, doctor.Failf("config", "%v", err))
+	} else {
+		checks = append(checks, doctor.Okf("config", "%d feeds", len(f.feeds)))
+		checks = append(checks, f.feedChecks(time.Now())...)
+	}
+
+	if f.tgToken != "" && f.chatID != "" {
+		if tg, ok := f.sender.(*telegram.Sender); ok {
+			checks = append(checks, f.telegramChecks(ctx, tg, configOK)...)
+		}
+	}
+
+	if f.remoteURL == "" {
+		checks = append(checks, doctor.HostChecks(ctx, f.stateDir, f.isRunLocked)...)
+	} else if host, err := f.store.LoadHostChecks(ctx); err != nil {
+		checks = append(checks, doctor.Failf("admin API", "%v", err))
+	} else {
+		checks = append(checks, host...)
+	}
+
+	if failed := doctor.Print(w, checks); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+func (f *fetcher) envChecks() []doctor.Check {
+	required := func(name, value string) doctor.Check {
+		if value == "" {
+			return doctor.Failf(name, "not set")
+		}
+		return doctor.Okf(name, "set")
+	}
+	checks := []doctor.Check{
+		required("TELEGRAM_TOKEN", f.tgToken),
+		required("CHAT_ID", f.chatID),
+	}
+	if raw := f.getenv("ERROR_THREAD_ID"); raw != "" {
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			checks = append(checks, doctor.Failf("ERROR_THREAD_ID", "%q is not a number", raw))
+		} else if f.errorTopic != "" {
+			checks = append(checks, doctor.Warnf("ERROR_THREAD_ID", "ignored, as ERROR_TOPIC is set"))
+		}
+	}
+	if err := validateTopic(f.errorTopic); err != nil {
+		checks = append(checks, doctor.Failf("ERROR_TOPIC", "%v", err))
+	}
+	if _, err := f.loadRetention(); err != nil {
+		checks = append(checks, doctor.Failf("retention", "%v", err))
+	}
+	return checks
+}
+
+// feedChecks reports feeds that are disabled, failing or stale, and feeds
+// that need settings missing from the environment.
+func (f *fetcher) feedChecks(now time.Time) []doctor.Check {
+	var checks []doctor.Check
+	for _, fd := range f.feeds {
+		name := "feed " + fd.url
+		if missing := f.missingFeedEnv(fd); len(missing) > 0 {
+			checks = append(checks, doctor.Failf(name, "needs %s", strings.Join(missing, " and ")))
+		}
+
+		st, ok := f.getFeedState(fd.url)
+		switch {
+		case !ok:
+			// Not fetched yet.
+		case st.Disabled:
+			checks = append(checks, doctor.Warnf(name, "disabled after %d failed fetches, last error was %q, run 'tgfeed reenable %s'", st.ErrorCount, st.LastError, fd.url))
+		case st.ErrorCount > 0:
+			checks = append(checks, doctor.Warnf(name, "failed %s in a row, last error was %q", pluralize(int64(st.ErrorCount)), st.LastError))
+		case !st.LastUpdated.IsZero() && now.Sub(st.LastUpdated) > staleFeedAge:
+			checks = append(checks, doctor.Warnf(name, "not fetched successfully since %s", st.LastUpdated.Format(time.DateTime)))
+		}
+	}
+	return checks
+}
+
+// missingFeedEnv returns environment variables fd needs that are not set.
+func (f *fetcher) missingFeedEnv(fd *feed) []string {
+	var missing []string
+	if fd.translateTo != "" && f.llm == nil {
+		missing = append(missing, "LLM_API_URL", "LLM_API_KEY")
+	}
+	if !isSpecialFeed(fd.url) {
+		return missing
+	}
+	u, err := url.Parse(fd.url)
+	if err != nil {
+		return missing
+	}
+	switch u.Host {
+	case "github-notifications":
+		if f.ghToken == "" {
+			missing = append(missing, "GITHUB_TOKEN")
+		}
+	case "github-releases":
+		// Tags are fetched with the GraphQL API, which requires a token.
+		if tags, _ := strconv.ParseBool(u.Query().Get("tags")); tags && f.ghToken == "" {
+			missing = append(missing, "GITHUB_TOKEN")
+		}
+	case "gitlab-todos":
+		if f.gitlabToken == "" {
+			missing = append(missing, "GITLAB_TOKEN")
+		}
+	case "gitea-notifications":
+		if f.giteaToken == "" {
+			missing = append(missing, "GITEA_TOKEN")
+		}
+	case "forgejo-notifications":
+		if f.forgejoToken == "" {
+			missing = append(missing, "FORGEJO_TOKEN")
+		}
+	}
+	return missing
+}
+
+// telegramChecks verifies that the bot can post to the chat and to every
+// message thread and forum topic it's configured to use.
+func (f *fetcher) telegramChecks(ctx context.Context, tg *telegram.Sender, configOK bool) []doctor.Check {
+	bot, err := tg.GetMe(ctx)
+	if err != nil {
+		return []doctor.Check{doctor.Failf("bot", "%v", err)}
+	}
+	checks := []doctor.Check{doctor.Okf("bot", "@%s (ID %d)", bot.Username, bot.ID)}
+
+	chat, err := tg.GetChat(ctx)
+	if err != nil {
+		return append(checks, doctor.Failf("chat", "%v", err))
+	}
+	desc := chat.Type
+	if chat.IsForum {
+		desc += ", forum"
+	}
+	checks = append(checks, doctor.Okf("chat", "%q (%s)", chatName(chat), desc))
+
+	if err := tg.Probe(ctx, 0); err != nil {
+		return append(checks, doctor.Failf("chat", "%v", err))
+	}
+	checks = append(checks, doctor.Okf("chat", "bot can post"))
+
+	// Collect who uses each thread and topic, to name them in reports.
+	threads := make(map[int64][]string)
+	topics := make(map[string][]string)
+	if f.errorTopic != "" {
+		topics[f.errorTopic] = append(topics[f.errorTopic], "ERROR_TOPIC")
+	} else if f.errorThreadID != 0 {
+		threads[f.errorThreadID] = append(threads[f.errorThreadID], "ERROR_THREAD_ID")
+	}
+	if configOK {
+		for _, fd := range f.feeds {
+			switch {
+			case fd.topic != "":
+				topics[fd.topic] = append(topics[fd.topic], fd.url)
+			case fd.messageThreadID != 0:
+				threads[fd.messageThreadID] = append(threads[fd.messageThreadID], fd.url)
+			}
+		}
+	}
+	if (len(threads) > 0 || len(topics) > 0) && !chat.IsForum {
+		return append(checks, doctor.Failf("chat", "not a forum, but message threads or topics are configured"))
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(threads)) {
+		name := fmt.Sprintf("thread %d", id)
+		if err := tg.Probe(ctx, id); err != nil {
+			checks = append(checks, doctor.Failf(name, "used by %s: %v", strings.Join(threads[id], ", "), err))
+			continue
+		}
+		checks = append(checks, doctor.Okf(name, "bot can post"))
+	}
+	for _, topic := range slices.Sorted(maps.Keys(topics)) {
+		name := fmt.Sprintf("topic %q", topic)
+		id, ok := f.topics[topic]
+		if !ok {
+			checks = append(checks, doctor.Okf(name, "will be created on first delivery"))
+			continue
+		}
+		err := tg.Probe(ctx, id)
+		switch {
+		case errors.Is(err, sender.ErrThreadNotFound):
+			checks = append(checks, doctor.Warnf(name, "thread %d was deleted, the topic will be created again", id))
+		case err != nil:
+			checks = append(checks, doctor.Failf(name, "used by %s: %v", strings.Join(topics[topic], ", "), err))
+		default:
+			checks = append(checks, doctor.Okf(name, "thread %d, bot can post", id))
+		}
+	}
+	return checks
+}
+
+func chatName(chat telegram.Chat) string {
+	if chat.Title != "" {
+		return chat.Title
+	}
+	return "@" + chat.Username
+}
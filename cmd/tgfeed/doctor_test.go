@@ -0,0 +1,149 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/base/txtar"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/doctor"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
+)
+
+// doctorTelegramHandlers mock a forum chat where threads 7 and 9 don't exist.
+func doctorTelegramHandlers(t *testing.T) map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"POST api.telegram.org/{token}/getMe": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"ok":true,"result":{"id":42,"is_bot":true,"first_name":"Feeds","username":"feeds_bot"}}`))
+		},
+		"POST api.telegram.org/{token}/getChat": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"ok":true,"result":{"id":-100123,"type":"supergroup","title":"News","is_forum":true}}`))
+		},
+		"POST api.telegram.org/{token}/sendChatAction": func(w http.ResponseWriter, r *http.Request) {
+			req := testutil.UnmarshalJSON[map[string]any](t, read(t, r.Body))
+			if thread, _ := req["message_thread_id"].(float64); thread == 7 || thread == 9 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message thread not found"}`))
+				return
+			}
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		},
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	t.Parallel()
+
+	testutil.RunGolden(t, "testdata/doctor/*.txtar", func(t *testing.T, tc string) []byte {
+		t.Parallel()
+
+		env := newTestEnv(t, txtarToFS(txtar.Parse(readFile(t, tc))), doctorTelegramHandlers(t))
+		if err := os.Chmod(env.stateDir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		f := newTestFetcher(t, env)
+		f.getenv = func(string) string { return "" }
+
+		var buf bytes.Buffer
+		err := f.diagnose(t.Context(), &buf)
+		if err == nil {
+			t.Fatal("diagnose() succeeded, want failed checks")
+		}
+		buf.WriteString("\n" + err.Error() + "\n")
+
+		return []byte(strings.ReplaceAll(buf.String(), env.stateDir, "$STATE_DIRECTORY"))
+	}, *updateGolden)
+}
+
+func TestDoctorRemote(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`feed(url="https://example.com/feed.xml")`))
+	})
+	for _, path := range []string{"/api/state", "/api/topics", "/api/templates"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{}`))
+		})
+	}
+	mux.HandleFunc("/api/error-template", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test"))
+	})
+	mux.HandleFunc("/api/doctor", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"run lock","status":"ok","detail":"held, a run is in progress"}]`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	env := newTestEnv(t, nil, doctorTelegramHandlers(t))
+	f := newTestFetcher(t, env)
+	f.getenv = func(string) string { return "" }
+	f.remoteURL = server.URL
+	f.store = state.NewStore(state.Options{RemoteURL: server.URL, HTTPClient: server.Client()})
+
+	var buf bytes.Buffer
+	if err := f.diagnose(t.Context(), &buf); err != nil {
+		t.Fatalf("diagnose() = %v, output:\n%s", err, buf.String())
+	}
+	if !strings.Contains(buf.String(), "OK    run lock: held, a run is in progress\n") {
+		t.Fatalf("output doesn't contain remote host checks:\n%s", buf.String())
+	}
+}
+
+func TestDoctorBadRetention(t *testing.T) {
+	t.Parallel()
+
+	f := &fetcher{
+		tgToken: tgToken,
+		chatID:  "test",
+		getenv:  testGetenv(map[string]string{"ARCHIVE_RETENTION_DAYS": "week"}),
+	}
+	want := doctor.Failf("retention", `ARCHIVE_RETENTION_DAYS should be a non-negative number of days, got "week"`)
+	if checks := f.envChecks(); !slices.Contains(checks, want) {
+		t.Fatalf("envChecks() = %+v, want it to contain %+v", checks, want)
+	}
+
+	if _, err := f.loadRetention(); err == nil {
+		t.Fatal("loadRetention() succeeded, want error")
+	}
+}
+
+func TestMissingFeedEnv(t *testing.T) {
+	cases := map[string]struct {
+		url     string
+		ghToken string
+		want    []string
+	}{
+		"releases without token": {
+			url: "tgfeed://github-releases?repo=golang/go",
+		},
+		"tags without token": {
+			url:  "tgfeed://github-releases?repo=golang/go&tags=true",
+			want: []string{"GITHUB_TOKEN"},
+		},
+		"tags with token": {
+			url:     "tgfeed://github-releases?repo=golang/go&tags=true",
+			ghToken: "token",
+		},
+		"gitea with default URL": {
+			url:  "tgfeed://gitea-notifications",
+			want: []string{"GITEA_TOKEN"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &fetcher{ghToken: tc.ghToken}
+			testutil.AssertEqual(t, f.missingFeedEnv(&feed{url: tc.url}), tc.want)
+		})
+	}
+}
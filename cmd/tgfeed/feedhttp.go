@@ -0,0 +1,321 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// Per-feed HTTP settings.
+//
+// Values of headers, auth and proxy may reference environment variables as
+// ${NAME}, so that secrets never have to be written into config.star. They
+// are expanded for each request and scrubbed from errors recorded for the
+// feed.
+
+// feedAuth holds the credentials sent with feed requests.
+type feedAuth struct {
+	username, password string // HTTP basic auth, if username is set
+	header             string // verbatim Authorization header otherwise
+}
+
+// maxRedirects is how many redirects feed requests follow, as net/http does
+// by default.
+const maxRedirects = 10
+
+var envRefRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references in s with values of environment
+// variables, failing if any of them is unset.
+func expandEnv(s string, getenv func(string) string) (string, error) {
+	var missing []string
+	expanded := envRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRefRe.FindStringSubmatch(ref)[1]
+		v := getenv(name)
+		if v == "" {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	switch len(missing) {
+	case 0:
+		return expanded, nil
+	case 1:
+		return "", fmt.Errorf("environment variable %s is not set", missing[0])
+	default:
+		return "", fmt.Errorf("environment variables %s are not set", strings.Join(missing, ", "))
+	}
+}
+
+// envRefs returns values of environment variables referenced in s that are
+// set.
+func envRefs(s string, getenv func(string) string) []string {
+	var values []string
+	for _, m := range envRefRe.FindAllStringSubmatch(s, -1) {
+		if v := getenv(m[1]); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func unpackHeaders(v *starlark.Dict) (map[string]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	headers := make(map[string]string, v.Len())
+	for _, item := range v.Items() {
+		k, ok := starlark.AsString(item[0])
+		if !ok || k == "" {
+			return nil, fmt.Errorf("headers: keys must be non-empty strings, got %s", item[0])
+		}
+		val, ok := starlark.AsString(item[1])
+		if !ok {
+			return nil, fmt.Errorf("headers: value of %q must be a string, got %s", k, item[1].Type())
+		}
+		headers[http.CanonicalHeaderKey(k)] = val
+	}
+	return headers, nil
+}
+
+func unpackAuth(v starlark.Value) (*feedAuth, error) {
+	switch v := v.(type) {
+	case nil, starlark.NoneType:
+		return nil, nil
+	case starlark.String:
+		return &feedAuth{header: string(v)}, nil
+	case starlark.Tuple:
+		if len(v) != 2 {
+			return nil, fmt.Errorf("auth: want a (username, password) tuple, got %d elements", len(v))
+		}
+		user, ok1 := starlark.AsString(v[0])
+		pass, ok2 := starlark.AsString(v[1])
+		if !ok1 || !ok2 || user == "" {
+			return nil, errors.New("auth: username and password must be strings, and username must not be empty")
+		}
+		return &feedAuth{username: user, password: pass}, nil
+	}
+	return nil, fmt.Errorf("auth: want a string or a (username, password) tuple, got %s", v.Type())
+}
+
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// validateProxy checks the proxy setting of a feed when config.star is
+// loaded. If the scheme comes from an environment variable, as in
+// "${PROXY_URL}", it is checked by proxyTransport once expanded.
+func validateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	scheme, _, ok := strings.Cut(proxy, "://")
+	if envRefRe.MatchString(scheme) {
+		return nil
+	}
+	if !ok || !slices.Contains(proxySchemes, scheme) {
+		return fmt.Errorf("proxy: want a URL with one of %s schemes, got %q", strings.Join(proxySchemes, ", "), proxy)
+	}
+	return nil
+}
+
+func parseTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("timeout: %w", err)
+	}
+	if d <= 0 {
+		return 0, errors.New("timeout: must be positive")
+	}
+	return d, nil
+}
+
+// applyFeedHeaders adds custom headers and credentials of fd to req.
+func (f *fetcher) applyFeedHeaders(req *http.Request, fd *feed) error {
+	for k, v := range fd.headers {
+		v, err := expandEnv(v, f.getenv)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", k, err)
+		}
+		req.Header.Set(k, v)
+	}
+
+	if fd.auth == nil {
+		return nil
+	}
+	if fd.auth.username != "" {
+		user, err := expandEnv(fd.auth.username, f.getenv)
+		if err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+		pass, err := expandEnv(fd.auth.password, f.getenv)
+		if err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+		req.SetBasicAuth(user, pass)
+		return nil
+	}
+	header, err := expandEnv(fd.auth.header, f.getenv)
+	if err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// feedClient returns the HTTP client to fetch fd with. It doesn't send custom
+// headers and credentials of fd to other hosts when following redirects.
+func (f *fetcher) feedClient(fd *feed) (*http.Client, error) {
+	c := *f.httpc
+	checkRedirect := f.httpc.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if checkRedirect != nil {
+			if err := checkRedirect(req, via); err != nil {
+				return err
+			}
+		} else if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		// Headers of the original request are copied to redirects. Go drops
+		// only a few well-known credential headers when the host changes, and
+		// custom headers may hold secrets from the environment.
+		if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+			for k := range fd.headers {
+				req.Header.Del(k)
+			}
+			req.Header.Del("Authorization")
+		}
+		return nil
+	}
+	if fd.timeout > 0 {
+		c.Timeout = fd.timeout
+	}
+	if fd.proxy != "" {
+		rt, err := f.proxyTransport(fd.proxy)
+		if err != nil {
+			return nil, err
+		}
+		c.Transport = rt
+	}
+	return &c, nil
+}
+
+// mediaFetcher returns a function that downloads media of items of fd for
+// uploading to Telegram, through the proxy and with the timeout of fd. Custom
+// headers and credentials of fd are sent only to its own host, so that they
+// don't leak to CDNs serving media.
+func (f *fetcher) mediaFetcher(fd *feed) func(context.Context, string) (*http.Response, error) {
+	return func(ctx context.Context, rawURL string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", ua())
+		if req.URL.Host == feedHost(fd.url) {
+			if err := f.applyFeedHeaders(req, fd); err != nil {
+				return nil, err
+			}
+		}
+		c, err := f.feedClient(fd)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			return nil, f.scrubError(err)
+		}
+		return res, nil
+	}
+}
+
+// proxyTransport returns a transport that sends requests through proxy,
+// reusing it across feeds with the same proxy.
+func (f *fetcher) proxyTransport(proxy string) (http.RoundTripper, error) {
+	expanded, err := expandEnv(proxy, f.getenv)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	u, err := url.Parse(expanded)
+	if err != nil {
+		// url.Error includes the URL, which may contain credentials.
+		return nil, errors.New("proxy: invalid URL")
+	}
+	if !slices.Contains(proxySchemes, u.Scheme) || u.Host == "" {
+		// Don't include the URL, for the same reason.
+		return nil, fmt.Errorf("proxy: want a URL with one of %s schemes", strings.Join(proxySchemes, ", "))
+	}
+
+	f.proxyMu.Lock()
+	defer f.proxyMu.Unlock()
+	if rt, ok := f.proxyTransports[expanded]; ok {
+		return rt, nil
+	}
+
+	base, ok := f.httpc.Transport.(*http.Transport)
+	if f.httpc.Transport == nil {
+		base, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		return nil, fmt.Errorf("proxy: HTTP client transport %T does not support proxies", f.httpc.Transport)
+	}
+	rt := base.Clone()
+	rt.Proxy = http.ProxyURL(u)
+
+	if f.proxyTransports == nil {
+		f.proxyTransports = make(map[string]*http.Transport)
+	}
+	f.proxyTransports[expanded] = rt
+	return rt, nil
+}
+
+// newSecretScrubber returns a replacer that hides values of environment
+// variables referenced by feed settings, or nil if there are none.
+func newSecretScrubber(feeds []*feed, getenv func(string) string) *strings.Replacer {
+	var secrets []string
+	add := func(s string) {
+		for _, v := range envRefs(s, getenv) {
+			secrets = append(secrets, v, "[EXPUNGED]")
+		}
+	}
+	for _, fd := range feeds {
+		for _, v := range fd.headers {
+			add(v)
+		}
+		if fd.auth != nil {
+			add(fd.auth.username)
+			add(fd.auth.password)
+			add(fd.auth.header)
+		}
+		add(fd.proxy)
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+	return strings.NewReplacer(secrets...)
+}
+
+// scrubError hides secrets of feed settings in err, so that it is safe to
+// log, store in state and send in error notifications.
+func (f *fetcher) scrubError(err error) error {
+	if f.secretScrubber == nil || err == nil {
+		return err
+	}
+	msg := err.Error()
+	if scrubbed := f.secretScrubber.Replace(msg); scrubbed != msg {
+		return errors.New(scrubbed)
+	}
+	return err
+}
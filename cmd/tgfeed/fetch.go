@@ -11,21 +11,23 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"go.astrophena.name/base/version"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/format"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/hostlimit"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/retry"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
@@ -39,12 +41,10 @@ import (
 // Fetch flow.
 
 const (
-	errorThreshold        = 12 // failing continuously for N fetches will disable feed and complain loudly
-	fetchConcurrencyLimit = 10 // N fetches that can run at the same time
-	sendConcurrencyLimit  = 2  // N sends that can run at the same time
-	retryLimit            = 3  // N attempts to retry feed fetching
-
-	maxRetryTime = 5 * time.Minute
+	errorThreshold         = 12 // failing continuously for N fetches will disable feed and complain loudly
+	fetchConcurrencyLimit  = 10 // N fetches that can run at the same time
+	sendConcurrencyLimit   = 2  // N sends that can run at the same time
+	defaultHostConcurrency = 2  // N fetches from one host that can run at the same time
 
 	// lookbackPeriod is the period for which new items are processed even if
 	// they have an old publication date, but only if always_send_new_items
@@ -77,7 +77,7 @@ type update struct {
 // A zero value means the caller should continue parsing the feed body.
 type feedStatusResult struct {
 	notModified bool
-	retryIn     time.Duration
+	retry       retry.Decision
 }
 
 // feedItemDecision captures both item processing and seen-state updates.
@@ -109,7 +109,7 @@ type feedItemContext struct {
 //  3. Handle status-specific outcomes (not-modified, rate-limit, failures).
 //  4. Parse feed items, update cache metadata, and enqueue outgoing updates.
 //  5. Mark successful fetch statistics.
-func (f *fetcher) fetch(ctx context.Context, fd *feed, updates chan *update) (retry bool, retryIn time.Duration) {
+func (f *fetcher) fetch(ctx context.Context, fd *feed, updates chan *update) retry.Decision {
 	startTime := time.Now()
 
 	fdState, exists := f.feedState(fd.url)
@@ -124,24 +124,31 @@ func (f *fetcher) fetch(ctx context.Context, fd *feed, updates chan *update) (re
 
 	if disabled {
 		f.slog.Debug("skipping, feed is disabled", "feed", fd.url)
-		return false, 0
+		return retry.Decision{}
+	}
+
+	release, err := f.hostLimiter.Acquire(ctx, feedHost(fd.url))
+	if err != nil {
+		// The run is being canceled, which is not the feed's fault.
+		return retry.Decision{}
 	}
+	defer release()
 
 	t := &timings{start: time.Now()}
 	req, err := f.newFeedRequest(ctx, fd, etag, lastModified, t)
 	if err != nil {
 		f.handleFetchFailure(ctx, fd.url, err)
-		return false, 0
+		return retry.Decision{}
 	}
 
-	res, err := f.makeFeedRequest(req)
+	res, err := f.makeFeedRequest(fd, req)
 	if err != nil {
 		if isTransientError(err) {
-			f.slog.Warn("transient network error, retrying", "feed", fd.url, "error", err)
-			return true, 5 * time.Second
+			f.slog.Warn("transient network error, retrying", "feed", fd.url, "error", f.scrubError(err))
+			return retry.Decision{Retry: true, Reason: retry.ReasonNetwork}
 		}
 		f.handleFetchFailure(ctx, fd.url, err)
-		return false, 0
+		return retry.Decision{}
 	}
 	res.Body = &timingReadCloser{ReadCloser: res.Body, timings: t}
 	defer func() {
@@ -153,14 +160,14 @@ func (f *fetcher) fetch(ctx context.Context, fd *feed, updates chan *update) (re
 	status, err := f.handleFeedStatus(req, res, fd)
 	if err != nil {
 		f.handleFetchFailure(ctx, fd.url, err)
-		return false, 0
+		return retry.Decision{}
 	}
 	if status.notModified {
 		fdState.MarkNotModified(time.Now())
-		return false, 0
+		return retry.Decision{}
 	}
-	if status.retryIn > 0 {
-		return true, status.retryIn
+	if status.retry.Retry {
+		return status.retry
 	}
 
 	parsedFeed, err := f.fp.Parse(res.Body)
@@ -169,15 +176,18 @@ func (f *fetcher) fetch(ctx context.Context, fd *feed, updates chan *update) (re
 			s.ParseErrorCount += 1
 		})
 		f.handleFetchFailure(ctx, fd.url, err)
-		return false, 0
+		return retry.Decision{}
 	}
 
 	f.updateFeedStateFromHeaders(fdState, res)
+	for _, item := range parsedFeed.Items {
+		format.AnnotateLanguage(item, parsedFeed.Language)
+	}
 	f.enqueueFeedItems(fd, fdState, exists, parsedFeed.Items, updates)
 	fdState.MarkFetchSuccess(time.Now())
 	f.markFetchSuccess(fd.url, len(parsedFeed.Items), startTime)
 
-	return false, 0
+	return retry.Decision{}
 }
 
 // Request construction and response handling.
@@ -220,15 +230,22 @@ func (f *fetcher) newFeedRequest(ctx context.Context, fd *feed, etag string, las
 	if lastModified != "" {
 		req.Header.Set("If-Modified-Since", lastModified)
 	}
+	if err := f.applyFeedHeaders(req, fd); err != nil {
+		return nil, err
+	}
 
 	return req, nil
 }
 
-func (f *fetcher) makeFeedRequest(req *http.Request) (*http.Response, error) {
+func (f *fetcher) makeFeedRequest(fd *feed, req *http.Request) (*http.Response, error) {
 	if isSpecialFeed(req.URL.String()) {
 		return f.handleSpecialFeed(req)
 	}
-	return f.httpc.Do(req)
+	c, err := f.feedClient(fd)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
 }
 
 func (f *fetcher) recordRequestTimings(t *timings) {
@@ -292,40 +309,81 @@ func (f *fetcher) handleFeedStatus(req *http.Request, res *http.Response, fd *fe
 	})
 
 	body, hasBody := readFeedErrorBody(res.Body)
+	if !hasBody {
+		body = nil
+	}
 
-	// Handle custom rate limiting.
-	if hasBody {
-		if t, found := retry.Retryable(req.URL.Host, body); found {
-			f.slog.Warn("rate-limited", "host", req.URL.Host, "feed", fd.url, "retry_in", t.String())
-			return feedStatusResult{
-				retryIn: t,
-			}, nil
-		}
+	host := req.URL.Host
+	if d := f.retryPolicy(host).Decide(host, res.StatusCode, res.Header, body); d.Retry {
+		f.slog.Warn("retryable feed error",
+			"feed", fd.url,
+			"host", host,
+			"status", res.StatusCode,
+			"reason", d.Reason,
+			"retry_in", d.Wait.String(),
+		)
+		return feedStatusResult{retry: d}, nil
 	}
 
-	switch res.StatusCode {
-	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
-		if t, found := retry.RetryAfter(res.Header.Get("Retry-After")); found {
-			// Limit backoff to a reasonable maximum (context deadline or 5 minutes),
-			// as Retry-After could be hours or days which would block the goroutine.
-			const maxRetryAfter = 5 * time.Minute
-			if t <= maxRetryAfter {
-				f.slog.Warn("rate-limited (Retry-After)", "feed", fd.url, "retry_in", t.String())
-				return feedStatusResult{
-					retryIn: t,
-				}, nil
-			}
-			f.slog.Warn("rate-limited (Retry-After), but wait time is too long", "feed", fd.url, "retry_in", t.String(), "max_retry_in", maxRetryAfter.String())
-		}
+	return feedStatusResult{}, fmt.Errorf("want 200, got %d: %s", res.StatusCode, body)
+}
+
+// defaultRetryPolicy applies to hosts without a retry_policy in config.star.
+var defaultRetryPolicy = retry.DefaultPolicy()
+
+func (f *fetcher) retryPolicy(host string) *retry.Policy {
+	if p, ok := f.retryPolicies[host]; ok {
+		return p
 	}
+	return defaultRetryPolicy
+}
 
-	if res.StatusCode >= 500 && res.StatusCode < 600 {
-		return feedStatusResult{
-			retryIn: 5 * time.Second,
-		}, nil
+// feedHost returns the host that retry policies and concurrency limits of the
+// feed are keyed by.
+func feedHost(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return ""
 	}
+	return u.Host
+}
 
-	return feedStatusResult{}, fmt.Errorf("want 200, got %d: %s", res.StatusCode, body)
+// robotsCrawlDelay returns the Crawl-delay that robots.txt of the host of fd
+// sets for tgfeed, or zero if it can't be fetched or doesn't set one.
+// robots.txt is fetched with the same scheme, proxy and timeout as fd.
+func (f *fetcher) robotsCrawlDelay(ctx context.Context, fd *feed) time.Duration {
+	u, err := url.Parse(fd.url)
+	if err != nil {
+		return 0
+	}
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("User-Agent", ua())
+
+	c, err := f.feedClient(fd)
+	if err != nil {
+		f.slog.Debug("fetching robots.txt failed", "host", u.Host, "error", f.scrubError(err))
+		return 0
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		f.slog.Debug("fetching robots.txt failed", "host", u.Host, "error", f.scrubError(err))
+		return 0
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0
+	}
+
+	const readLimit = 512 << 10 // Google stops at 500 KiB as well
+	delay, ok := hostlimit.ParseCrawlDelay(io.LimitReader(res.Body, readLimit), "tgfeed")
+	if ok {
+		f.slog.Debug("using robots.txt crawl delay", "host", u.Host, "delay", delay.String())
+	}
+	return delay
 }
 
 func isTransientError(err error) bool {
@@ -707,7 +765,14 @@ func (f *fetcher) sendUpdate(ctx context.Context, u *update) error {
 		return nil
 	}
 
-	rendered, err := f.buildUpdateMessage(u)
+	// Only the message is rendered from translated items, the archive keeps
+	// the originals.
+	msgUpdate := u
+	if u.feed.translateTo != "" {
+		msgUpdate = new(*u)
+		msgUpdate.items = f.translateItems(ctx, u.feed, u.items)
+	}
+	rendered, err := f.buildUpdateMessage(msgUpdate)
 	if err != nil {
 		f.stats.WriteAccess(func(s *stats.Run) {
 			s.MessagesFormattingFailed += 1
@@ -726,17 +791,16 @@ func (f *fetcher) sendUpdate(ctx context.Context, u *update) error {
 
 	start := time.Now()
 
-	if err := f.sender.Send(ctx, sender.Message{
+	receipt, threadID, err := f.sendToThread(ctx, u.feed.topic, u.feed.messageThreadID, sender.Message{
 		Body: strings.TrimSpace(rendered.Body),
-		Target: sender.Target{
-			Thread: strconv.FormatInt(u.feed.messageThreadID, 10),
-		},
 		Options: sender.Options{
 			SuppressLinkPreview: rendered.DisablePreview,
 		},
-		Actions: rendered.Actions,
-		Media:   rendered.Media,
-	}); err != nil {
+		Actions:    rendered.Actions,
+		Media:      rendered.Media,
+		FetchMedia: f.mediaFetcher(u.feed),
+	})
+	if err != nil {
 		f.stats.WriteAccess(func(s *stats.Run) {
 			s.MessagesFailed += 1
 			s.SendLatencySamples = append(s.SendLatencySamples, time.Since(start))
@@ -749,6 +813,7 @@ func (f *fetcher) sendUpdate(ctx context.Context, u *update) error {
 		s.MessagesSent += 1
 		s.SendLatencySamples = append(s.SendLatencySamples, time.Since(start))
 	})
+	f.archiveUpdate(ctx, u, rendered, receipt, threadID)
 
 	if u.acknowledge != nil {
 		if err := u.acknowledge(ctx, u.dedupeKeys); err != nil {
@@ -759,12 +824,60 @@ func (f *fetcher) sendUpdate(ctx context.Context, u *update) error {
 	return nil
 }
 
+// archiveUpdate records delivered items in the searchable archive. Failures
+// are only logged, as the items have already been delivered.
+func (f *fetcher) archiveUpdate(ctx context.Context, u *update, rendered format.Rendered, receipt sender.Receipt, threadID int64) {
+	if f.statsStore == nil {
+		return
+	}
+	var messageID string
+	if len(receipt.MessageIDs) > 0 {
+		messageID = receipt.MessageIDs[0]
+	}
+	now := time.Now()
+	items := make([]stats.Item, 0, len(u.items))
+	for _, feedItem := range u.items {
+		guid := cmp.Or(feedItem.GUID, feedItem.Link)
+		if guid == "" {
+			continue
+		}
+		item := stats.Item{
+			FeedURL:   u.feed.url,
+			FeedTitle: u.feed.title,
+			GUID:      guid,
+			Title:     feedItem.Title,
+			Link:      feedItem.Link,
+			Content:   html.UnescapeString(bmStripper.Sanitize(cmp.Or(feedItem.Content, feedItem.Description))),
+			Delivered: now,
+			MessageID: messageID,
+			ThreadID:  threadID,
+			Rendered:  strings.TrimSpace(rendered.Body),
+		}
+		if published := feedItemPublishedTime(feedItem); published != nil {
+			item.Published = *published
+		}
+		items = append(items, item)
+	}
+	if err := f.statsStore.ArchiveItems(ctx, items); err != nil {
+		f.slog.Warn("failed to archive delivered items", "feed", u.feed.url, "error", err)
+	}
+}
+
 func (f *fetcher) buildUpdateMessage(u *update) (format.Rendered, error) {
 	fmtUpdate := format.Update{
 		Feed:  format.Feed{URL: u.feed.url, Title: u.feed.title, Digest: u.feed.digest},
 		Items: u.items,
 	}
 
+	if u.feed.template != "" {
+		rendered, err := f.templates.Render(u.feed.template, fmtUpdate)
+		if err != nil {
+			f.slog.Warn("template failed", "feed", u.feed.url, "template", u.feed.template, "error", err)
+			return format.Rendered{}, fmt.Errorf("formatting update for feed %q: %w", u.feed.url, err)
+		}
+		return rendered, nil
+	}
+
 	items, defaultTitle := format.BuildFormatInput(fmtUpdate)
 
 	if u.feed.format != nil {
@@ -799,15 +912,13 @@ func (f *fetcher) errNotify(ctx context.Context, err error) error {
 	if tmpl == "" {
 		tmpl = defaultErrorTemplate
 	}
-	return f.sender.Send(ctx, sender.Message{
+	_, _, sendErr := f.sendToThread(ctx, f.errorTopic, f.errorThreadID, sender.Message{
 		Body: fmt.Sprintf(tmpl, err),
-		Target: sender.Target{
-			Thread: strconv.FormatInt(f.errorThreadID, 10),
-		},
 		Options: sender.Options{
 			SuppressLinkPreview: true,
 		},
 	})
+	return sendErr
 }
 
 // Failure handling.
@@ -818,6 +929,7 @@ func (f *fetcher) handleFetchFailure(ctx context.Context, url string, err error)
 		s.ClassifyFailure(url, err)
 		s.FeedStats(url).Failures += 1
 	})
+	err = f.scrubError(err)
 
 	var (
 		disabled   bool
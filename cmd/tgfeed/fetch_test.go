@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,6 +25,8 @@ import (
 	"go.astrophena.name/base/cli"
 	"go.astrophena.name/base/syncx"
 	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/base/txtar"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/retry"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
 	tgstats "go.astrophena.name/tools/cmd/tgfeed/internal/stats"
@@ -71,10 +74,10 @@ func TestRetryExhaustionCountsAsFailure(t *testing.T) {
 
 		state := env.state(t)
 
-		testutil.AssertEqual(t, attempts.Load(), int32(retryLimit+1))
+		testutil.AssertEqual(t, attempts.Load(), int32(retry.DefaultMaxRetries+1))
 		testutil.AssertEqual(t, state[atomFeedURL].ErrorCount, 1)
 		testutil.AssertEqual(t, state[atomFeedURL].FetchFailCount, int64(1))
-		if !strings.Contains(state[atomFeedURL].LastError, fmt.Sprintf("retry limit exceeded after %d retries", retryLimit)) {
+		if !strings.Contains(state[atomFeedURL].LastError, fmt.Sprintf("retry limit exceeded after %d retries", retry.DefaultMaxRetries)) {
 			t.Fatalf("unexpected last error: %q", state[atomFeedURL].LastError)
 		}
 
@@ -82,13 +85,192 @@ func TestRetryExhaustionCountsAsFailure(t *testing.T) {
 			testutil.AssertEqual(t, s.FailedFeeds, 1)
 			testutil.AssertEqual(t, s.SuccessFeeds, 0)
 			testutil.AssertEqual(t, s.NotModifiedFeeds, 0)
-			testutil.AssertEqual(t, s.FetchRetriesTotal, retryLimit)
+			testutil.AssertEqual(t, s.FetchRetriesTotal, retry.DefaultMaxRetries)
 			testutil.AssertEqual(t, s.FeedsRetriedCount, 1)
-			testutil.AssertEqual(t, s.HTTP5xxCount, retryLimit+1)
+			testutil.AssertEqual(t, s.HTTP5xxCount, retry.DefaultMaxRetries+1)
 		})
 	})
 }
 
+func TestRetryPolicyFromConfig(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		config := []byte(`
+feed(url = "https://example.com/feed.xml")
+
+retry_policy(
+    host = "example.com",
+    max_retries = 2,
+    backoff = "exponential",
+    initial_wait = "10s",
+    wait_pattern = r"try again in (\d+) seconds",
+    transient_status = [429],
+)
+`)
+		var attempts atomic.Int32
+		env := newTestEnv(t, stateArchive(t, config, nil), map[string]http.HandlerFunc{
+			atomFeedRoute: func(w http.ResponseWriter, r *http.Request) {
+				switch attempts.Add(1) {
+				case 1:
+					http.Error(w, "slow down, try again in 42 seconds", http.StatusBadRequest)
+				default:
+					http.Error(w, "too many requests", http.StatusTooManyRequests)
+				}
+			},
+		})
+		f := newTestFetcher(t, env)
+		if err := f.run(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.statsStore.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		testutil.AssertEqual(t, attempts.Load(), int32(3))
+		if !strings.Contains(env.state(t)[atomFeedURL].LastError, "retry limit exceeded after 2 retries") {
+			t.Fatalf("unexpected last error: %q", env.state(t)[atomFeedURL].LastError)
+		}
+
+		want := []tgstats.RetryDecision{
+			{URL: atomFeedURL, Host: "example.com", Attempt: 1, Reason: "wait_pattern", Wait: 42 * time.Second, Outcome: tgstats.RetryOutcomeRetried},
+			{URL: atomFeedURL, Host: "example.com", Attempt: 2, Reason: "status", Wait: 20 * time.Second, Outcome: tgstats.RetryOutcomeRetried},
+			{URL: atomFeedURL, Host: "example.com", Attempt: 3, Reason: "status", Wait: 40 * time.Second, Outcome: tgstats.RetryOutcomeRetryLimit},
+		}
+		f.stats.ReadAccess(func(s *tgstats.Run) {
+			testutil.AssertEqual(t, s.FeedStats(atomFeedURL).RetryDecisions, want)
+			testutil.AssertEqual(t, s.BackoffSleepTotal, 62*time.Second)
+			testutil.AssertEqual(t, s.FetchRetriesTotal, 2)
+			testutil.AssertEqual(t, s.SpecialRateLimitRetries, 1)
+		})
+	})
+}
+
+func TestHostLimits(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		config := []byte(`
+feed(url = "https://example.com/feed.xml")
+feed(url = "https://example.com/other.xml")
+feed(url = "https://example.org/feed.xml")
+
+host_limits(
+    host = "example.com",
+    max_concurrency = 1,
+    min_delay = "2s",
+    robots_txt = True,
+)
+`)
+		var (
+			mu     sync.Mutex
+			starts = make(map[string][]time.Time)
+		)
+		serve := func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			starts[r.Host] = append(starts[r.Host], time.Now())
+			mu.Unlock()
+			w.Write(atomFeed)
+		}
+		var robotsRequests atomic.Int32
+		env := newTestEnv(t, stateArchive(t, config, nil), map[string]http.HandlerFunc{
+			"GET example.com/robots.txt": func(w http.ResponseWriter, r *http.Request) {
+				robotsRequests.Add(1)
+				w.Write([]byte("User-agent: *\nCrawl-delay: 10\n"))
+			},
+			atomFeedRoute:               serve,
+			"GET example.com/other.xml": serve,
+			"GET example.org/feed.xml":  serve,
+		})
+		f := newTestFetcher(t, env)
+		if err := f.run(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.statsStore.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		testutil.AssertEqual(t, robotsRequests.Load(), int32(1))
+		testutil.AssertEqual(t, len(starts["example.com"]), 2)
+		testutil.AssertEqual(t, len(starts["example.org"]), 1)
+		if gap := starts["example.com"][1].Sub(starts["example.com"][0]); gap.Abs() < 10*time.Second {
+			t.Fatalf("requests to example.com were %s apart, want at least the 10s crawl delay", gap.Abs())
+		}
+		if starts["example.org"][0].Sub(starts["example.com"][0]).Abs() >= 10*time.Second {
+			t.Fatal("example.org waited for the crawl delay of example.com")
+		}
+	})
+}
+
+func TestRobotsCrawlDelayUsesFeedScheme(t *testing.T) {
+	t.Parallel()
+
+	var scheme string
+	env := newTestEnv(t, nil, map[string]http.HandlerFunc{
+		"GET example.com/robots.txt": func(w http.ResponseWriter, r *http.Request) {
+			scheme = r.URL.Scheme
+			w.Write([]byte("User-agent: *\nCrawl-delay: 3\n"))
+		},
+	})
+	f := newTestFetcher(t, env)
+
+	delay := f.robotsCrawlDelay(t.Context(), &feed{url: "http://example.com/feed.xml"})
+	testutil.AssertEqual(t, delay, 3*time.Second)
+	testutil.AssertEqual(t, scheme, "http")
+}
+
+func TestRetryPolicyConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		config  string
+		wantErr string
+	}{
+		"unknown backoff": {
+			config:  `retry_policy(host = "example.com", backoff = "random")`,
+			wantErr: "unknown backoff curve",
+		},
+		"duplicate host": {
+			config:  "retry_policy(host = \"example.com\")\nretry_policy(host = \"example.com\")",
+			wantErr: "duplicate policy",
+		},
+		"pattern without group": {
+			config:  `retry_policy(host = "example.com", wait_pattern = "FLOOD")`,
+			wantErr: "must have a capture group",
+		},
+		"invalid duration": {
+			config:  `retry_policy(host = "example.com", max_wait = "forever")`,
+			wantErr: "invalid max_wait",
+		},
+		"invalid status": {
+			config:  `retry_policy(host = "example.com", transient_status = [1000])`,
+			wantErr: "invalid HTTP status 1000",
+		},
+		"duplicate host limits": {
+			config:  "host_limits(host = \"example.com\")\nhost_limits(host = \"example.com\")",
+			wantErr: "duplicate limits",
+		},
+		"negative max_concurrency": {
+			config:  `host_limits(host = "example.com", max_concurrency = -1)`,
+			wantErr: "max_concurrency must not be negative",
+		},
+		"invalid min_delay": {
+			config:  `host_limits(host = "example.com", min_delay = "-1s")`,
+			wantErr: "min_delay must not be negative",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newTestFetcher(t, newTestEnv(t, nil, nil))
+			_, err := f.parseConfig(t.Context(), tc.config)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("parseConfig() error = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
 func TestDisablingAndReenablingFailingFeed(t *testing.T) {
 	t.Parallel()
 
@@ -236,6 +418,72 @@ func TestDigestAndFormat(t *testing.T) {
 	}, *updateGolden)
 }
 
+func TestFeedTemplates(t *testing.T) {
+	t.Parallel()
+
+	testutil.RunGolden(t, "testdata/templates/*.txtar", func(t *testing.T, match string) []byte {
+		t.Parallel()
+
+		ar := txtar.Parse(readFile(t, match))
+		ar.Files = append(ar.Files, txtar.File{
+			Name: "state.json",
+			Data: toJSON(t, map[string]*state.Feed{atomFeedURL: {}}),
+		})
+		env := newTestEnv(t, txtarToFS(ar), map[string]http.HandlerFunc{
+			atomFeedRoute: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(atomFeed)
+			},
+		})
+
+		f := newTestFetcher(t, env)
+		if err := f.run(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+
+		return env.sortedSentMessagesJSON(t)
+	}, *updateGolden)
+}
+
+func TestFeedTemplateConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		config    string
+		templates map[string]string
+		wantErr   string
+	}{
+		"undefined template": {
+			config:  `feed(url = "https://example.com/feed.xml", template = "missing.tmpl")`,
+			wantErr: `template "missing.tmpl" of feed "https://example.com/feed.xml" is not defined`,
+		},
+		"template and format": {
+			config:    `feed(url = "https://example.com/feed.xml", template = "item.tmpl", format = lambda item: item.title)`,
+			templates: map[string]string{"item.tmpl": "{{.Item.Title}}"},
+			wantErr:   "mutually exclusive",
+		},
+		"failing template": {
+			config:    `feed(url = "https://example.com/feed.xml", template = "item.tmpl")`,
+			templates: map[string]string{"item.tmpl": "{{.Item.Author.Name}}"},
+			wantErr:   `template "item.tmpl" for feed "https://example.com/feed.xml" failed`,
+		},
+		"broken template": {
+			config:    `feed(url = "https://example.com/feed.xml")`,
+			templates: map[string]string{"item.tmpl": "{{.Item.Title"},
+			wantErr:   "parsing templates",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newTestFetcher(t, newTestEnv(t, nil, nil))
+			err := f.validateConfig(t.Context(), tc.config, tc.templates)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("validateConfig() error = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
 func TestAlwaysSendNewItems(t *testing.T) {
 	t.Parallel()
 
@@ -650,6 +898,7 @@ func TestHandleFeedStatus(t *testing.T) {
 		body                 string
 		initialState         state.Feed
 		wantNotModified      bool
+		wantRetry            bool
 		wantRetryIn          time.Duration
 		wantErrContains      string
 		wantNotModifiedFeeds int
@@ -676,8 +925,16 @@ func TestHandleFeedStatus(t *testing.T) {
 			statusCode:      http.StatusTooManyRequests,
 			body:            `{"errors":["FLOOD_WAIT_15"]}`,
 			wantNotModified: false,
+			wantRetry:       true,
 			wantRetryIn:     15 * time.Second,
 		},
+		"5xx retries with backoff": {
+			reqURL:      "https://example.com/feed.xml",
+			statusCode:  http.StatusBadGateway,
+			body:        "bad gateway",
+			wantRetry:   true,
+			wantRetryIn: 0,
+		},
 		"non-200 returns error": {
 			reqURL:          "https://example.com/feed.xml",
 			statusCode:      http.StatusTeapot,
@@ -723,7 +980,8 @@ func TestHandleFeedStatus(t *testing.T) {
 			}
 
 			testutil.AssertEqual(t, result.notModified, tc.wantNotModified)
-			testutil.AssertEqual(t, result.retryIn, tc.wantRetryIn)
+			testutil.AssertEqual(t, result.retry.Wait, tc.wantRetryIn)
+			testutil.AssertEqual(t, result.retry.Retry, tc.wantRetry)
 			testutil.AssertEqual(t, st, tc.initialState)
 
 			f.stats.ReadAccess(func(s *tgstats.Run) {
@@ -740,12 +998,15 @@ type captureSender struct {
 	ctxErrs  []error
 }
 
-func (s *captureSender) Send(ctx context.Context, msg sender.Message) error {
+func (s *captureSender) Send(ctx context.Context, msg sender.Message) (sender.Receipt, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.ctxErrs = append(s.ctxErrs, ctx.Err())
 	s.messages = append(s.messages, msg)
-	return s.err
+	if s.err != nil {
+		return sender.Receipt{}, s.err
+	}
+	return sender.Receipt{MessageIDs: []string{strconv.Itoa(len(s.messages))}}, nil
 }
 
 func TestRunCommandPreservesDeliveryError(t *testing.T) {
@@ -795,6 +1056,46 @@ func TestSendUpdateUsesInjectedSender(t *testing.T) {
 	}
 }
 
+func TestArchiveDeliveredItems(t *testing.T) {
+	t.Parallel()
+
+	env := newDefaultTestEnv(t, map[string]http.HandlerFunc{
+		atomFeedRoute: func(w http.ResponseWriter, r *http.Request) {
+			w.Write(atomFeed)
+		},
+	})
+	f := newTestFetcher(t, env)
+	if err := f.run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := f.statsStore.SearchItems(t.Context(), tgstats.ItemQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) == 0 {
+		t.Fatal("no items were archived")
+	}
+	testutil.AssertEqual(t, len(items), len(env.sentMessages))
+	for _, item := range items {
+		testutil.AssertEqual(t, item.FeedURL, atomFeedURL)
+		if item.MessageID == "" {
+			t.Errorf("item %q has no message ID", item.GUID)
+		}
+		if !strings.Contains(item.Rendered, item.Title) {
+			t.Errorf("rendered message of item %q = %q, want to contain its title", item.GUID, item.Rendered)
+		}
+	}
+
+	found, err := f.statsStore.SearchItems(t.Context(), tgstats.ItemQuery{Query: items[0].Title})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) == 0 || found[0].GUID != items[0].GUID {
+		t.Fatalf("searching for %q: got %+v", items[0].Title, found)
+	}
+}
+
 func TestDeliverUpdatesCommitsOnlyAfterSuccess(t *testing.T) {
 	t.Parallel()
 
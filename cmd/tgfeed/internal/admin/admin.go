@@ -10,24 +10,34 @@
 package admin
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"database/sql"
 	"embed"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"go.astrophena.name/base/web"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/backup"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/doctor"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/republish"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+	"go.astrophena.name/tools/internal/filelock"
 )
 
 var (
 	errConflict      = web.StatusErr(http.StatusConflict)
+	errTooLarge      = web.StatusErr(http.StatusRequestEntityTooLarge)
 	errInvalidConfig = errors.New("invalid config")
 )
 
@@ -39,12 +49,22 @@ type Store interface {
 	LoadState(ctx context.Context) (map[string]*state.Feed, error)
 	// LoadErrorTemplate loads the current error template.
 	LoadErrorTemplate(ctx context.Context) (string, error)
+	// LoadTopics loads the cached forum topic name to thread ID mapping.
+	LoadTopics(ctx context.Context) (map[string]int64, error)
+	// LoadTemplates loads message templates keyed by name.
+	LoadTemplates(ctx context.Context) (map[string]string, error)
 	// SaveConfig persists tgfeed Starlark configuration.
 	SaveConfig(ctx context.Context, config string) error
 	// SaveStateJSON persists pre-encoded feed runtime state.
 	SaveStateJSON(ctx context.Context, content []byte) error
 	// SaveErrorTemplate persists the error template.
 	SaveErrorTemplate(ctx context.Context, content string) error
+	// SaveTopics persists the forum topic name to thread ID mapping.
+	SaveTopics(ctx context.Context, topics map[string]int64) error
+	// SaveTemplate persists a message template.
+	SaveTemplate(ctx context.Context, name, content string) error
+	// DeleteTemplate removes a message template.
+	DeleteTemplate(ctx context.Context, name string) error
 }
 
 // Config configures the tgfeed admin HTTP API.
@@ -57,8 +77,21 @@ type Config struct {
 	Store Store
 	// ValidateConfig validates a Starlark config before persisting it.
 	ValidateConfig func(ctx context.Context, content string) error
+	// ValidateTemplates validates the full set of message templates, keyed
+	// by name, before persisting a change to it.
+	ValidateTemplates func(ctx context.Context, templates map[string]string) error
 	// IsRunLocked reports whether tgfeed run lock is currently held.
 	IsRunLocked func() bool
+	// LockRun acquires tgfeed run lock, so that a run can't start while the
+	// state directory is backed up or restored. It defaults to failing if
+	// IsRunLocked reports the lock as held, without acquiring it.
+	LockRun func() (filelock.Lock, error)
+	// ValidateBackup validates the config and message templates of a backup
+	// before restoring it.
+	ValidateBackup backup.Validator
+	// MaxBackupSize limits the size of archives uploaded for restore. It
+	// defaults to 1 GiB.
+	MaxBackupSize int64
 	// StatsStore reads persisted tgfeed run stats.
 	StatsStore *stats.Store
 	// StaticHashName returns a cache-busting static asset name. It defaults to
@@ -80,6 +113,7 @@ func Handler(cfg Config) (*http.ServeMux, error) {
 	mux.HandleFunc("GET /{$}", ui.handleStats)
 	mux.HandleFunc("GET /stats", ui.handleStats)
 	mux.HandleFunc("GET /config", ui.handleConfiguration)
+	mux.HandleFunc("GET /search", ui.handleSearch)
 	mux.HandleFunc("POST /config", ui.handleSaveAll)
 	mux.HandleFunc("POST /config/config", ui.handleSaveConfig)
 	mux.HandleFunc("POST /config/error-template", ui.handleSaveErrorTemplate)
@@ -90,15 +124,35 @@ func Handler(cfg Config) (*http.ServeMux, error) {
 	mux.HandleFunc("PUT /api/state", api.handlePutState)
 	mux.HandleFunc("GET /api/error-template", api.handleGetErrorTemplate)
 	mux.HandleFunc("PUT /api/error-template", api.handlePutErrorTemplate)
+	mux.HandleFunc("GET /api/topics", api.handleGetTopics)
+	mux.HandleFunc("PUT /api/topics", api.handlePutTopics)
+	mux.HandleFunc("GET /api/templates", api.handleGetTemplates)
+	mux.HandleFunc("GET /api/templates/{name}", api.handleGetTemplate)
+	mux.HandleFunc("PUT /api/templates/{name}", api.handlePutTemplate)
+	mux.HandleFunc("DELETE /api/templates/{name}", api.handleDeleteTemplate)
 	mux.HandleFunc("GET /api/stats", api.handleGetStats)
 	mux.HandleFunc("GET /api/stats/run", api.handleGetStatsRun)
+	mux.HandleFunc("GET /api/stats/export", api.handleExportStats)
+	mux.HandleFunc("GET /api/items", api.handleGetItems)
+	mux.HandleFunc("GET /api/doctor", api.handleDoctor)
+	mux.HandleFunc("GET /api/backup", api.handleGetBackup)
+	mux.HandleFunc("PUT /api/backup", api.handlePutBackup)
+	mux.HandleFunc("GET /feeds/atom", api.handleRepublishedFeed)
+	mux.HandleFunc("GET /feeds/json", api.handleRepublishedFeed)
 
 	dbg := web.Debugger(mux)
 	dbg.Link("/api/config", "Config")
 	dbg.Link("/api/state", "State")
 	dbg.Link("/api/error-template", "Error template")
+	dbg.Link("/api/topics", "Topics")
+	dbg.Link("/api/templates", "Message templates")
 	dbg.Link("/api/stats", "Stats")
 	dbg.Link("/api/stats/run", "Stats run")
+	dbg.Link("/api/stats/export?format=csv&period=day", "Daily stats (CSV)")
+	dbg.Link("/api/items", "Delivered items")
+	dbg.Link("/api/doctor", "Host checks")
+	dbg.Link("/api/backup", "Backup")
+	dbg.Link("/feeds/atom", "Delivered items (Atom)")
 
 	return mux, nil
 }
@@ -153,9 +207,21 @@ func normalizeConfig(cfg Config) (Config, error) {
 	if cfg.ValidateConfig == nil {
 		cfg.ValidateConfig = func(context.Context, string) error { return nil }
 	}
+	if cfg.ValidateTemplates == nil {
+		cfg.ValidateTemplates = func(context.Context, map[string]string) error { return nil }
+	}
 	if cfg.IsRunLocked == nil {
 		cfg.IsRunLocked = func() bool { return false }
 	}
+	if cfg.LockRun == nil {
+		isRunLocked := cfg.IsRunLocked
+		cfg.LockRun = func() (filelock.Lock, error) {
+			if isRunLocked() {
+				return nil, filelock.ErrAlreadyLocked
+			}
+			return noopLock{}, nil
+		}
+	}
 	if cfg.StatsStore == nil {
 		cfg.StatsStore = stats.OpenReader(cfg.StateDir)
 		if err := cfg.StatsStore.Bootstrap(context.Background()); err != nil {
@@ -169,18 +235,32 @@ func normalizeConfig(cfg Config) (Config, error) {
 }
 
 type api struct {
-	store            Store
-	validateConfigFn func(context.Context, string) error
-	isRunLocked      func() bool
-	statsStore       *stats.Store
+	stateDir            string
+	store               Store
+	validateConfigFn    func(context.Context, string) error
+	validateTemplatesFn func(context.Context, map[string]string) error
+	isRunLocked         func() bool
+	lockRun             func() (filelock.Lock, error)
+	validateBackupFn    backup.Validator
+	maxBackupSize       int64
+	statsStore          *stats.Store
 }
 
+type noopLock struct{}
+
+func (noopLock) Release() error { return nil }
+
 func newAPI(cfg Config) *api {
 	return &api{
-		store:            cfg.Store,
-		validateConfigFn: cfg.ValidateConfig,
-		isRunLocked:      cfg.IsRunLocked,
-		statsStore:       cfg.StatsStore,
+		stateDir:            cfg.StateDir,
+		store:               cfg.Store,
+		validateConfigFn:    cfg.ValidateConfig,
+		validateTemplatesFn: cfg.ValidateTemplates,
+		isRunLocked:         cfg.IsRunLocked,
+		lockRun:             cfg.LockRun,
+		validateBackupFn:    cfg.ValidateBackup,
+		maxBackupSize:       cmp.Or(cfg.MaxBackupSize, defaultMaxBackupSize),
+		statsStore:          cfg.StatsStore,
 	}
 }
 
@@ -272,6 +352,220 @@ func (a *api) handlePutErrorTemplate(w http.ResponseWriter, r *http.Request) {
 	writeNoContent(w)
 }
 
+func (a *api) handleDoctor(w http.ResponseWriter, r *http.Request) {
+	checks := doctor.HostChecks(r.Context(), a.stateDir, a.isRunLocked)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(checks); err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("encoding host checks response: %w", err))
+	}
+}
+
+func (a *api) handleGetBackup(w http.ResponseWriter, r *http.Request) {
+	// Write the archive to a temporary file first, so the run lock is held no
+	// longer than needed and errors can still be reported.
+	tmp, err := os.CreateTemp("", "tgfeed-backup-*.tar.gz")
+	if err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("failed to create backup: %v", err))
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := a.withRunLock(func() error {
+		return backup.Create(r.Context(), tmp, a.stateDir, time.Now())
+	}); err != nil {
+		web.RespondJSONError(w, r, err)
+		return
+	}
+
+	fi, err := tmp.Stat()
+	if err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("failed to create backup: %v", err))
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("failed to create backup: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, backupFileName(time.Now())))
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	io.Copy(w, tmp)
+}
+
+const defaultMaxBackupSize = 1 << 30 // 1 GiB
+
+func (a *api) handlePutBackup(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, a.maxBackupSize)
+	if err := a.withRunLock(func() error {
+		// Close the stats database, so it's reopened from the restored
+		// file on next use. Restore migrates it to the current schema.
+		if a.statsStore != nil {
+			if err := a.statsStore.Close(); err != nil {
+				return err
+			}
+		}
+		_, err := backup.Restore(r.Context(), body, a.stateDir, a.validateBackupFn)
+		if _, ok := errors.AsType[*http.MaxBytesError](err); ok {
+			return fmt.Errorf("%w: %v", errTooLarge, err)
+		}
+		if errors.Is(err, backup.ErrInvalid) {
+			return fmt.Errorf("%w: %v", web.ErrBadRequest, err)
+		}
+		return err
+	}); err != nil {
+		web.RespondJSONError(w, r, err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// withRunLock calls fn with the run lock held. It fails with a conflict error
+// if a run is in progress.
+func (a *api) withRunLock(fn func() error) error {
+	lock, err := a.lockRun()
+	if errors.Is(err, filelock.ErrAlreadyLocked) {
+		return fmt.Errorf("%w: run is in progress", errConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire run lock: %v", err)
+	}
+	defer lock.Release()
+	return fn()
+}
+
+// backupFileName returns the suggested file name of a backup created at t.
+func backupFileName(t time.Time) string {
+	return "tgfeed-" + t.UTC().Format("20060102-150405") + ".tar.gz"
+}
+
+func (a *api) handleGetTopics(w http.ResponseWriter, r *http.Request) {
+	topics, err := a.store.LoadTopics(r.Context())
+	if err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("failed to read topics: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(topics); err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("encoding topics response: %w", err))
+	}
+}
+
+func (a *api) handlePutTopics(w http.ResponseWriter, r *http.Request) {
+	if !a.guardRunUnlocked(w, r) {
+		return
+	}
+
+	content, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	topics, err := validateTopics(content)
+	if err != nil {
+		web.RespondJSONError(w, r, err)
+		return
+	}
+
+	if err := a.store.SaveTopics(r.Context(), topics); err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("failed to write topics: %v", err))
+		return
+	}
+
+	writeNoContent(w)
+}
+
+func (a *api) handleGetTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := a.store.LoadTemplates(r.Context())
+	if err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("failed to read templates: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(templates); err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("encoding templates response: %w", err))
+	}
+}
+
+func (a *api) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	templates, err := a.store.LoadTemplates(r.Context())
+	if err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("failed to read templates: %v", err))
+		return
+	}
+	name := r.PathValue("name")
+	content, ok := templates[name]
+	if !ok {
+		web.RespondJSONError(w, r, fmt.Errorf("template %q %w", name, web.ErrNotFound))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(content))
+}
+
+func (a *api) handlePutTemplate(w http.ResponseWriter, r *http.Request) {
+	content, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if err := a.changeTemplates(r.Context(), name, func(templates map[string]string) error {
+		templates[name] = string(content)
+		return nil
+	}); err != nil {
+		web.RespondJSONError(w, r, err)
+		return
+	}
+	writeNoContent(w)
+}
+
+func (a *api) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := a.changeTemplates(r.Context(), name, func(templates map[string]string) error {
+		if _, ok := templates[name]; !ok {
+			return fmt.Errorf("template %q %w", name, web.ErrNotFound)
+		}
+		delete(templates, name)
+		return nil
+	}); err != nil {
+		web.RespondJSONError(w, r, err)
+		return
+	}
+	writeNoContent(w)
+}
+
+// changeTemplates applies change to the current set of message templates,
+// validates the result and persists the template name.
+func (a *api) changeTemplates(ctx context.Context, name string, change func(map[string]string) error) error {
+	if a.isRunLocked() {
+		return fmt.Errorf("%w: cannot modify templates: run is in progress", errConflict)
+	}
+	if err := state.ValidateTemplateName(name); err != nil {
+		return fmt.Errorf("%w: %v", web.ErrBadRequest, err)
+	}
+	templates, err := a.store.LoadTemplates(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read templates: %v", err)
+	}
+	if err := change(templates); err != nil {
+		return err
+	}
+	if err := a.validateTemplatesFn(ctx, templates); err != nil {
+		return fmt.Errorf("%w: invalid templates: %v", web.ErrBadRequest, err)
+	}
+
+	if content, ok := templates[name]; ok {
+		err = a.store.SaveTemplate(ctx, name, content)
+	} else {
+		err = a.store.DeleteTemplate(ctx, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write template: %v", err)
+	}
+	return nil
+}
+
 func (a *api) guardRunUnlocked(w http.ResponseWriter, r *http.Request) bool {
 	if !a.isRunLocked() {
 		return true
@@ -334,6 +628,22 @@ func validateState(content []byte) error {
 	return nil
 }
 
+func validateTopics(content []byte) (map[string]int64, error) {
+	topics, err := state.UnmarshalTopics(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON: %v", web.ErrBadRequest, err)
+	}
+	for name, threadID := range topics {
+		if name == "" {
+			return nil, fmt.Errorf("%w: topic name must not be empty", web.ErrBadRequest)
+		}
+		if threadID <= 0 {
+			return nil, fmt.Errorf("%w: topic %q must have a positive thread ID", web.ErrBadRequest, name)
+		}
+	}
+	return topics, nil
+}
+
 func (a *api) handleGetStats(w http.ResponseWriter, r *http.Request) {
 	if a.statsStore == nil {
 		web.RespondJSONError(w, r, errors.New("stats store is not configured"))
@@ -431,6 +741,222 @@ func (a *api) handleGetStatsRun(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleExportStats exports run summaries or rollups as CSV or NDJSON.
+//
+// Query parameters:
+//   - format: csv or ndjson (default).
+//   - period: run (default) for individual runs, or hour and day for rollups.
+//   - limit: maximum number of rows, newest first.
+func (a *api) handleExportStats(w http.ResponseWriter, r *http.Request) {
+	if a.statsStore == nil {
+		web.RespondJSONError(w, r, errors.New("stats store is not configured"))
+		return
+	}
+
+	format := cmp.Or(r.URL.Query().Get("format"), "ndjson")
+	if format != "csv" && format != "ndjson" {
+		web.RespondJSONError(w, r, fmt.Errorf("%w: \"format\" must be csv or ndjson", web.ErrBadRequest))
+		return
+	}
+	limit, err := queryInt(r, "limit", 1000)
+	if err != nil {
+		web.RespondJSONError(w, r, err)
+		return
+	}
+
+	var (
+		rows  []any
+		table stats.Table
+	)
+	switch period := cmp.Or(r.URL.Query().Get("period"), "run"); period {
+	case "run":
+		runs, err := a.statsStore.ListRunSummaries(r.Context(), limit, nil)
+		if err != nil {
+			web.RespondJSONError(w, r, fmt.Errorf("reading stats from SQLite: %w", err))
+			return
+		}
+		for _, run := range runs {
+			rows = append(rows, run)
+		}
+		table = stats.RunSummaryTable(runs)
+	default:
+		p, err := stats.ParsePeriod(period)
+		if err != nil {
+			web.RespondJSONError(w, r, fmt.Errorf("%w: %v", web.ErrBadRequest, err))
+			return
+		}
+		rollups, err := a.statsStore.ListRollups(r.Context(), p, limit, nil)
+		if err != nil {
+			web.RespondJSONError(w, r, fmt.Errorf("reading stats from SQLite: %w", err))
+			return
+		}
+		for _, rollup := range rollups {
+			rows = append(rows, rollup)
+		}
+		table = stats.RollupTable(rollups)
+	}
+
+	if format == "csv" {
+		// Encode into a buffer first, so that an encoding error can still be
+		// reported with a proper status.
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		if err := cw.Write(table.Header); err != nil {
+			web.RespondJSONError(w, r, fmt.Errorf("encoding CSV: %w", err))
+			return
+		}
+		if err := cw.WriteAll(table.Rows); err != nil {
+			web.RespondJSONError(w, r, fmt.Errorf("encoding CSV: %w", err))
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Write(buf.Bytes())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return
+		}
+	}
+}
+
+// handleGetItems searches the archive of delivered items.
+//
+// Query parameters:
+//   - q: full-text search query. Without it, the latest items are returned.
+//   - feed: URL of a feed to limit results to.
+//   - before: Unix time to return items delivered before.
+//   - limit: maximum number of items.
+func (a *api) handleGetItems(w http.ResponseWriter, r *http.Request) {
+	if a.statsStore == nil {
+		web.RespondJSONError(w, r, errors.New("stats store is not configured"))
+		return
+	}
+
+	query, err := parseItemQuery(r)
+	if err != nil {
+		web.RespondJSONError(w, r, err)
+		return
+	}
+	items, err := a.statsStore.SearchItems(r.Context(), query)
+	if err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("searching items in SQLite: %w", err))
+		return
+	}
+	if items == nil {
+		items = []stats.Item{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("encoding items response: %w", err))
+	}
+}
+
+// handleRepublishedFeed serves recently delivered items as an Atom feed at
+// /feeds/atom, or as a JSON Feed at /feeds/json.
+//
+// Query parameters:
+//   - feed: URL of a feed to limit items to.
+//   - thread: message thread ID to limit items to, 0 for the main chat.
+//   - limit: maximum number of items (default 50).
+func (a *api) handleRepublishedFeed(w http.ResponseWriter, r *http.Request) {
+	if a.statsStore == nil {
+		web.RespondError(w, r, errors.New("stats store is not configured"))
+		return
+	}
+
+	limit, err := queryInt(r, "limit", 50)
+	if err != nil {
+		web.RespondError(w, r, err)
+		return
+	}
+	thread, err := queryInt64Optional(r, "thread")
+	if err != nil {
+		web.RespondError(w, r, err)
+		return
+	}
+	query := stats.ItemQuery{
+		FeedURL:  r.URL.Query().Get("feed"),
+		ThreadID: thread,
+		Limit:    limit,
+	}
+	items, err := a.statsStore.SearchItems(r.Context(), query)
+	if err != nil {
+		web.RespondError(w, r, fmt.Errorf("reading items from SQLite: %w", err))
+		return
+	}
+
+	feed := republish.Feed{
+		Title: "tgfeed",
+		URL:   requestURL(r),
+		Items: items,
+	}
+	switch {
+	case query.FeedURL != "":
+		title := query.FeedURL
+		if len(items) > 0 && items[0].FeedTitle != "" {
+			title = items[0].FeedTitle
+		}
+		feed.Title += ": " + title
+	case thread != nil:
+		feed.Title += ": thread " + strconv.FormatInt(*thread, 10)
+	}
+
+	var (
+		body        []byte
+		contentType string
+	)
+	if r.URL.Path == "/feeds/json" {
+		body, err = republish.JSON(feed)
+		contentType = "application/feed+json; charset=utf-8"
+	} else {
+		body, err = republish.Atom(feed)
+		contentType = "application/atom+xml; charset=utf-8"
+	}
+	if err != nil {
+		web.RespondError(w, r, fmt.Errorf("rendering feed: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", republish.ETag(body))
+	// ServeContent handles If-None-Match and If-Modified-Since.
+	http.ServeContent(w, r, "", feed.Updated(), bytes.NewReader(body))
+}
+
+// requestURL reconstructs the absolute URL of r.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+func parseItemQuery(r *http.Request) (stats.ItemQuery, error) {
+	limit, err := queryInt(r, "limit", 50)
+	if err != nil {
+		return stats.ItemQuery{}, err
+	}
+	before, err := queryInt64Optional(r, "before")
+	if err != nil {
+		return stats.ItemQuery{}, err
+	}
+	query := stats.ItemQuery{
+		Query:   r.URL.Query().Get("q"),
+		FeedURL: r.URL.Query().Get("feed"),
+		Limit:   limit,
+	}
+	if before != nil {
+		query.Before = *before
+	}
+	return query, nil
+}
+
 func queryInt(r *http.Request, key string, fallback int) (int, error) {
 	value := r.URL.Query().Get(key)
 	if value == "" {
@@ -5,7 +5,10 @@
 package admin
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"io/fs"
@@ -20,6 +23,7 @@ import (
 	"time"
 
 	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/jsonfeed"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
 	"go.astrophena.name/tools/internal/filelock"
@@ -63,6 +67,12 @@ func TestAdmin(t *testing.T) {
 			}); err != nil {
 				t.Fatalf("saving second stats run: %v", err)
 			}
+			if err := statsStore.ArchiveItems(t.Context(), []stats.Item{
+				{FeedURL: "https://example.com", GUID: "1", Title: "Hello, world", Link: "https://example.com/1", Content: "First post.", Delivered: time.Date(2023, time.January, 1, 12, 0, 0, 0, time.UTC)},
+				{FeedURL: "https://example.com", GUID: "2", Title: "Second", Link: "javascript:alert(1)", Content: "Another post about <b>tags</b>.", Delivered: time.Date(2023, time.January, 2, 12, 0, 0, 0, time.UTC), ThreadID: 7, Rendered: "Second, as sent"},
+			}); err != nil {
+				t.Fatalf("archiving items: %v", err)
+			}
 		}
 
 		return Config{
@@ -162,6 +172,133 @@ func TestAdmin(t *testing.T) {
 		runTest(t, cfg, req, http.StatusBadRequest, "invalid JSON")
 	})
 
+	t.Run("get topics", func(t *testing.T) {
+		cfg := setup(t, fstest.MapFS{"topics.json": {Data: []byte(`{"Releases":42}`)}})
+		req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+		runTest(t, cfg, req, http.StatusOK, `{"Releases":42}`)
+	})
+	t.Run("put topics", func(t *testing.T) {
+		cfg := setup(t, nil)
+		req := httptest.NewRequest(http.MethodPut, "/api/topics", strings.NewReader(`{"Releases":43}`))
+		runTest(t, cfg, req, http.StatusNoContent, "")
+		topics, err := cfg.Store.LoadTopics(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.AssertEqual(t, topics, map[string]int64{"Releases": 43})
+	})
+	t.Run("put topics (invalid thread ID)", func(t *testing.T) {
+		cfg := setup(t, nil)
+		req := httptest.NewRequest(http.MethodPut, "/api/topics", strings.NewReader(`{"Releases":0}`))
+		runTest(t, cfg, req, http.StatusBadRequest, "positive thread ID")
+	})
+
+	t.Run("doctor", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/doctor", nil)
+		runTest(t, cfg, req, http.StatusOK, `{"name":"run lock","status":"ok","detail":"free"}`)
+	})
+
+	t.Run("get backup", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/backup", nil)
+		runTest(t, cfg, req, http.StatusOK, "")
+	})
+	t.Run("get backup (run in progress)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		lock, err := filelock.Acquire(filepath.Join(cfg.StateDir, ".run.lock"), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { lock.Release() })
+		req := httptest.NewRequest(http.MethodGet, "/api/backup", nil)
+		runTest(t, cfg, req, http.StatusConflict, "run is in progress")
+	})
+	t.Run("put backup (invalid)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodPut, "/api/backup", strings.NewReader("not a backup archive"))
+		runTest(t, cfg, req, http.StatusBadRequest, "invalid backup")
+		config, err := cfg.Store.LoadConfig(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.AssertEqual(t, config, `feed(url="https://example.com")`)
+	})
+
+	t.Run("put backup (too large)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		cfg.MaxBackupSize = 100
+		var archive bytes.Buffer
+		gw := gzip.NewWriter(&archive)
+		gw.Write([]byte(rand.Text() + rand.Text() + rand.Text() + rand.Text() + rand.Text()))
+		gw.Close()
+		req := httptest.NewRequest(http.MethodPut, "/api/backup", &archive)
+		runTest(t, cfg, req, http.StatusRequestEntityTooLarge, "request body too large")
+	})
+
+	templatesFS := fstest.MapFS{
+		"templates/release.tmpl": {Data: []byte(`{{.Item.Title}}`)},
+	}
+	t.Run("get templates", func(t *testing.T) {
+		cfg := setup(t, templatesFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/templates", nil)
+		runTest(t, cfg, req, http.StatusOK, `{"release.tmpl":"{{.Item.Title}}"}`)
+	})
+	t.Run("get template", func(t *testing.T) {
+		cfg := setup(t, templatesFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/templates/release.tmpl", nil)
+		runTest(t, cfg, req, http.StatusOK, `{{.Item.Title}}`)
+	})
+	t.Run("get template (not found)", func(t *testing.T) {
+		cfg := setup(t, templatesFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/templates/missing.tmpl", nil)
+		runTest(t, cfg, req, http.StatusNotFound, "")
+	})
+	t.Run("put template", func(t *testing.T) {
+		cfg := setup(t, templatesFS)
+		var validated map[string]string
+		cfg.ValidateTemplates = func(_ context.Context, templates map[string]string) error {
+			validated = templates
+			return nil
+		}
+		req := httptest.NewRequest(http.MethodPut, "/api/templates/digest.tmpl", strings.NewReader(`{{len .Items}} items`))
+		runTest(t, cfg, req, http.StatusNoContent, "")
+		testutil.AssertEqual(t, validated, map[string]string{
+			"release.tmpl": "{{.Item.Title}}",
+			"digest.tmpl":  "{{len .Items}} items",
+		})
+		content, _ := os.ReadFile(filepath.Join(cfg.StateDir, "templates", "digest.tmpl"))
+		testutil.AssertEqual(t, string(content), "{{len .Items}} items")
+	})
+	t.Run("put template (invalid)", func(t *testing.T) {
+		cfg := setup(t, templatesFS)
+		cfg.ValidateTemplates = func(context.Context, map[string]string) error {
+			return errors.New("template: release.tmpl:1: unclosed action")
+		}
+		req := httptest.NewRequest(http.MethodPut, "/api/templates/release.tmpl", strings.NewReader(`{{.Item.Title`))
+		runTest(t, cfg, req, http.StatusBadRequest, "unclosed action")
+		content, _ := os.ReadFile(filepath.Join(cfg.StateDir, "templates", "release.tmpl"))
+		testutil.AssertEqual(t, string(content), "{{.Item.Title}}")
+	})
+	t.Run("put template (invalid name)", func(t *testing.T) {
+		cfg := setup(t, nil)
+		req := httptest.NewRequest(http.MethodPut, "/api/templates/config.star", strings.NewReader(`x`))
+		runTest(t, cfg, req, http.StatusBadRequest, "invalid template name")
+	})
+	t.Run("delete template", func(t *testing.T) {
+		cfg := setup(t, templatesFS)
+		req := httptest.NewRequest(http.MethodDelete, "/api/templates/release.tmpl", nil)
+		runTest(t, cfg, req, http.StatusNoContent, "")
+		if _, err := os.Stat(filepath.Join(cfg.StateDir, "templates", "release.tmpl")); !os.IsNotExist(err) {
+			t.Fatalf("template was not deleted: %v", err)
+		}
+	})
+	t.Run("delete template (not found)", func(t *testing.T) {
+		cfg := setup(t, templatesFS)
+		req := httptest.NewRequest(http.MethodDelete, "/api/templates/missing.tmpl", nil)
+		runTest(t, cfg, req, http.StatusNotFound, "")
+	})
+
 	t.Run("get error template", func(t *testing.T) {
 		cfg := setup(t, initialFS)
 		req := httptest.NewRequest(http.MethodGet, "/api/error-template", nil)
@@ -206,6 +343,60 @@ func TestAdmin(t *testing.T) {
 		testutil.AssertEqual(t, got[0].StartTime.Format("2006-01-02T15:04:05Z07:00"), "2023-01-02T12:00:00Z")
 		testutil.AssertEqual(t, got[1].StartTime.Format("2006-01-02T15:04:05Z07:00"), "2023-01-01T12:00:00Z")
 	})
+	t.Run("export stats (NDJSON)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/stats/export", nil)
+		h, err := Handler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		testutil.AssertEqual(t, w.Code, http.StatusOK)
+		testutil.AssertEqual(t, w.Header().Get("Content-Type"), "application/x-ndjson")
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		testutil.AssertEqual(t, len(lines), 2)
+		var first statsView
+		if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+			t.Fatal(err)
+		}
+		testutil.AssertEqual(t, first.StartTime, time.Date(2023, time.January, 2, 12, 0, 0, 0, time.UTC))
+	})
+	t.Run("export stats (CSV rollups)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		if _, err := cfg.StatsStore.ApplyRetention(t.Context(), stats.Retention{Raw: time.Hour}, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/stats/export?format=csv&period=hour", nil)
+		h, err := Handler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		testutil.AssertEqual(t, w.Code, http.StatusOK)
+		testutil.AssertEqual(t, w.Header().Get("Content-Type"), "text/csv; charset=utf-8")
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		testutil.AssertEqual(t, len(lines), 3)
+		if !strings.HasPrefix(lines[0], "bucket_start,period,run_count,") {
+			t.Fatalf("unexpected CSV header: %q", lines[0])
+		}
+		if !strings.HasPrefix(lines[1], "2023-01-02T12:00:00Z,hour,1,") {
+			t.Fatalf("unexpected CSV row: %q", lines[1])
+		}
+	})
+	t.Run("export stats (bad format)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/stats/export?format=xml", nil)
+		runTest(t, cfg, req, http.StatusBadRequest, "format")
+	})
+	t.Run("export stats (bad period)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/stats/export?period=week", nil)
+		runTest(t, cfg, req, http.StatusBadRequest, "unknown stats period")
+	})
 	t.Run("get stats JSON (no stats)", func(t *testing.T) {
 		cfg := setup(t, nil)
 		req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
@@ -285,6 +476,130 @@ func TestAdmin(t *testing.T) {
 		req.Header.Set("HX-Target", "unknown")
 		runTest(t, cfg, req, http.StatusBadRequest, "Your request is invalid")
 	})
+	t.Run("get items", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/items?limit=1", nil)
+		runTest(t, cfg, req, http.StatusOK, `"title":"Second"`)
+	})
+	t.Run("search items", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/items?q=first", nil)
+		h, err := Handler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		testutil.AssertEqual(t, w.Code, http.StatusOK)
+		items := testutil.UnmarshalJSON[[]stats.Item](t, w.Body.Bytes())
+		testutil.AssertEqual(t, len(items), 1)
+		testutil.AssertEqual(t, items[0].GUID, "1")
+		testutil.AssertEqual(t, items[0].Snippet, "**First** post.")
+	})
+	t.Run("search items (no results)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/items?q=missing", nil)
+		runTest(t, cfg, req, http.StatusOK, "[]")
+	})
+	t.Run("search items (bad limit)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/api/items?limit=zero", nil)
+		runTest(t, cfg, req, http.StatusBadRequest, "invalid")
+	})
+	t.Run("search page", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/search?q=tags", nil)
+		h, err := Handler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		testutil.AssertEqual(t, w.Code, http.StatusOK)
+		body := w.Body.String()
+		for _, want := range []string{`value="tags"`, "Second", "&lt;b&gt;**tags**&lt;/b&gt;"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("search page does not contain %q: %s", want, body)
+			}
+		}
+		if strings.Contains(body, "javascript:") {
+			t.Errorf("search page contains unsafe link: %s", body)
+		}
+	})
+	t.Run("search fragment", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/search?q=missing", nil)
+		req.Header.Set("HX-Target", "search-results")
+		h, err := Handler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		testutil.AssertEqual(t, w.Code, http.StatusOK)
+		body := w.Body.String()
+		if !strings.Contains(body, "Nothing found.") {
+			t.Fatalf("unexpected search fragment: %s", body)
+		}
+		if strings.Contains(body, "<!DOCTYPE html>") {
+			t.Fatalf("fragment contains page layout: %s", body)
+		}
+	})
+	t.Run("republished Atom feed", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		h, err := Handler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/feeds/atom", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		testutil.AssertEqual(t, w.Code, http.StatusOK)
+		testutil.AssertEqual(t, w.Header().Get("Content-Type"), "application/atom+xml; charset=utf-8")
+		body := w.Body.String()
+		for _, want := range []string{"<title>tgfeed</title>", "Hello, world", "Second, as sent", "<updated>2023-01-02T12:00:00Z</updated>"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("feed does not contain %q: %s", want, body)
+			}
+		}
+
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("no ETag")
+		}
+		req = httptest.NewRequest(http.MethodGet, "/feeds/atom", nil)
+		req.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		testutil.AssertEqual(t, w.Code, http.StatusNotModified)
+	})
+	t.Run("republished JSON feed for thread", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/feeds/json?thread=0", nil)
+		h, err := Handler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		testutil.AssertEqual(t, w.Code, http.StatusOK)
+		testutil.AssertEqual(t, w.Header().Get("Content-Type"), "application/feed+json; charset=utf-8")
+		feed := testutil.UnmarshalJSON[jsonfeed.Feed](t, w.Body.Bytes())
+		testutil.AssertEqual(t, feed.Title, "tgfeed: thread 0")
+		testutil.AssertEqual(t, feed.FeedURL, "http://example.com/feeds/json?thread=0")
+		testutil.AssertEqual(t, len(feed.Items), 1)
+		testutil.AssertEqual(t, feed.Items[0].Title, "Hello, world")
+	})
+	t.Run("republished feed for feed", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/feeds/json?feed="+url.QueryEscape("https://example.com"), nil)
+		runTest(t, cfg, req, http.StatusOK, `"title": "tgfeed: https://example.com"`)
+	})
+	t.Run("republished feed (bad thread)", func(t *testing.T) {
+		cfg := setup(t, initialFS)
+		req := httptest.NewRequest(http.MethodGet, "/feeds/atom?thread=general", nil)
+		runTest(t, cfg, req, http.StatusBadRequest, "")
+	})
 	t.Run("configuration page", func(t *testing.T) {
 		cfg := setup(t, initialFS)
 		req := httptest.NewRequest(http.MethodGet, "/config", nil)
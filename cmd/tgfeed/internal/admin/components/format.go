@@ -5,11 +5,13 @@
 package components
 
 import (
+	"cmp"
 	"fmt"
 	"math"
 	"time"
 
 	"go.astrophena.name/base/humanfmt"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
 )
 
 func formatDateTime(t time.Time) string {
@@ -70,3 +72,11 @@ func formatPercent(v float64, valid bool) string {
 	}
 	return fmt.Sprintf("%.1f%%", v)
 }
+
+func itemTitle(item stats.Item) string {
+	return cmp.Or(item.Title, item.Link, item.GUID)
+}
+
+func itemFeed(item stats.Item) string {
+	return cmp.Or(item.FeedTitle, item.FeedURL)
+}
@@ -21,6 +21,8 @@ const (
 	FragmentConfigPanel = "config-panel"
 	// FragmentErrorPanel identifies the error-template editor response.
 	FragmentErrorPanel = "error-template-panel"
+	// FragmentSearchResults identifies the archive search results.
+	FragmentSearchResults = "search-results"
 )
 
 // Route identifies a dashboard section.
@@ -31,6 +33,8 @@ const (
 	RouteStats Route = "stats"
 	// RouteConfiguration identifies the configuration editor.
 	RouteConfiguration Route = "configuration"
+	// RouteSearch identifies the archive of delivered items.
+	RouteSearch Route = "search"
 )
 
 // PageProps contains the shared application page state.
@@ -53,6 +57,8 @@ type PageProps struct {
 	Stats *StatsProps
 	// Configuration contains the editor model when Route is [RouteConfiguration].
 	Configuration *ConfigurationProps
+	// Search contains the archive search model when Route is [RouteSearch].
+	Search *SearchProps
 }
 
 // StatsProps contains data rendered by the statistics dashboard.
@@ -81,6 +87,16 @@ type ConfigurationProps struct {
 	ErrorTemplate EditorProps
 }
 
+// SearchProps contains archive search results.
+type SearchProps struct {
+	// Query is the submitted full-text search query.
+	Query string
+	// Items contains matching items, or the latest items without a query.
+	Items []stats.Item
+	// Error contains a user-visible search error.
+	Error string
+}
+
 // EditorProps describes one CodeMirror-enhanced text resource.
 type EditorProps struct {
 	// ID identifies the textarea enhanced by CodeMirror.
@@ -113,8 +129,11 @@ func pageTitle(title string) string {
 }
 
 func routeURL(route Route) string {
-	if route == RouteConfiguration {
+	switch route {
+	case RouteConfiguration:
 		return "/config"
+	case RouteSearch:
+		return "/search"
 	}
 	return "/stats"
 }
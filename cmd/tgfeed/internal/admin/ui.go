@@ -118,6 +118,19 @@ func (u *ui) loadStats(ctx context.Context, query statsQuery) *components.StatsP
 	return props
 }
 
+func (u *ui) handleSearch(w http.ResponseWriter, r *http.Request) {
+	p := u.page("Archive", components.RouteSearch)
+	p.Search = &components.SearchProps{Query: r.URL.Query().Get("q")}
+	query, err := parseItemQuery(r)
+	if err == nil {
+		p.Search.Items, err = u.api.statsStore.SearchItems(r.Context(), query)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		p.Search.Error = fmt.Sprintf("failed to search items: %v", err)
+	}
+	u.render(w, r, p, components.FragmentDashboardContent, components.FragmentSearchResults)
+}
+
 func (u *ui) handleConfiguration(w http.ResponseWriter, r *http.Request) {
 	u.render(w, r, u.configurationPage(r, ""),
 		components.FragmentDashboardContent,
@@ -0,0 +1,436 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package backup creates and restores archives of the tgfeed state directory.
+//
+// An archive is a gzip-compressed tar file with a backup.json manifest
+// followed by config.star, state.json, error.tmpl, topics.json, message
+// templates in templates, and a snapshot of the stats database. Files missing
+// from the state directory are missing from the archive.
+//
+// Callers must hold the run lock while calling [Create] and [Restore], so a
+// run doesn't change the state directory halfway through.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+)
+
+// Format is the version of the archive format written by [Create].
+const Format = 1
+
+const (
+	manifestName  = "backup.json"
+	configName    = "config.star"
+	templatesDir  = "templates"
+	maxFileSize   = 1 << 30 // 1 GiB
+	restoreDirPat = ".restore-*"
+	// restoreOldDirPat names directories the current state files are moved
+	// to while a backup is installed.
+	restoreOldDirPat = ".restore-old-*"
+)
+
+// stateFiles are the files of the state directory archived as is, in
+// archive order.
+var stateFiles = []string{configName, "state.json", "error.tmpl", "topics.json"}
+
+// Manifest describes an archive.
+type Manifest struct {
+	Format  int       `json:"format"`
+	Created time.Time `json:"created"`
+}
+
+// Validator checks the config and message templates of an archive before
+// they're installed.
+type Validator func(ctx context.Context, config string, templates map[string]string) error
+
+// Create writes an archive of stateDir to w.
+func Create(ctx context.Context, w io.Writer, stateDir string, now time.Time) error {
+	tmpDir, err := os.MkdirTemp("", "tgfeed-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	manifest, err := json.MarshalIndent(Manifest{Format: Format, Created: now.UTC()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(tw, manifestName, manifest, now); err != nil {
+		return err
+	}
+
+	for _, name := range stateFiles {
+		if err := addFile(tw, name, filepath.Join(stateDir, name)); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(stateDir, templatesDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || state.ValidateTemplateName(entry.Name()) != nil {
+			continue
+		}
+		if err := addFile(tw, path.Join(templatesDir, entry.Name()), filepath.Join(stateDir, templatesDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	// The stats database can't be copied as is while it's open, as recent
+	// writes may still be in the write-ahead log.
+	store := stats.OpenReader(stateDir)
+	defer store.Close()
+	dbName := filepath.Base(store.Path())
+	if _, err := os.Stat(store.Path()); err == nil {
+		snapshot := filepath.Join(tmpDir, dbName)
+		if err := store.Backup(ctx, snapshot); err != nil {
+			return err
+		}
+		if err := addFile(tw, dbName, snapshot); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func addFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func writeFile(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// ErrInvalid is returned by [Restore] when the archive is damaged or fails
+// validation, as opposed to failures of the local file system.
+var ErrInvalid = errors.New("invalid backup")
+
+// Restore validates the archive read from r and replaces the contents of
+// stateDir with it. Files that are missing from the archive are removed from
+// stateDir. The stats database is migrated to the current schema before it's
+// installed. If anything fails, stateDir is left untouched.
+func Restore(ctx context.Context, r io.Reader, stateDir string, validate Validator) (*Manifest, error) {
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return nil, err
+	}
+	// Extract next to the state directory, so files can be renamed into
+	// place.
+	tmpDir, err := os.MkdirTemp(stateDir, restoreDirPat)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	a, err := extract(r, tmpDir)
+	if err != nil {
+		return nil, invalidErr(err)
+	}
+	if err := a.validate(ctx, tmpDir, validate); err != nil {
+		return nil, invalidErr(err)
+	}
+	if err := a.migrate(ctx, tmpDir); err != nil {
+		return nil, fmt.Errorf("migrating stats database: %w", err)
+	}
+	if err := a.install(tmpDir, stateDir); err != nil {
+		return nil, fmt.Errorf("installing backup: %w", err)
+	}
+	return a.manifest, nil
+}
+
+// invalidErr wraps err, a failure to extract or validate an archive, with
+// ErrInvalid, unless it's a failure of the local file system.
+func invalidErr(err error) error {
+	if _, ok := errors.AsType[*fs.PathError](err); ok {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrInvalid, err)
+}
+
+// archive describes an extracted archive.
+type archive struct {
+	manifest  *Manifest
+	files     map[string]bool // names of extracted files
+	templates map[string]string
+}
+
+func extract(r io.Reader, dir string) (*archive, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	dbName := filepath.Base(stats.OpenReader(dir).Path())
+	a := &archive{
+		files:     make(map[string]bool),
+		templates: make(map[string]string),
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s: not a regular file", hdr.Name)
+		}
+		if a.files[hdr.Name] {
+			return nil, fmt.Errorf("%s: duplicate file", hdr.Name)
+		}
+		if hdr.Size > maxFileSize {
+			return nil, fmt.Errorf("%s: file is too large", hdr.Name)
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		switch parent, name := path.Split(hdr.Name); {
+		case hdr.Name == manifestName, hdr.Name == dbName, slices.Contains(stateFiles, hdr.Name):
+		case parent == templatesDir+"/" && state.ValidateTemplateName(name) == nil:
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s: unexpected file", hdr.Name)
+		}
+
+		if err := extractFile(tr, dst); err != nil {
+			return nil, err
+		}
+		a.files[hdr.Name] = true
+
+		if hdr.Name == manifestName {
+			b, err := os.ReadFile(dst)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(b, &a.manifest); err != nil {
+				return nil, fmt.Errorf("%s: %w", manifestName, err)
+			}
+		}
+	}
+
+	switch {
+	case a.manifest == nil:
+		return nil, fmt.Errorf("%s is missing", manifestName)
+	case a.manifest.Format != Format:
+		return nil, fmt.Errorf("unsupported format %d, want %d", a.manifest.Format, Format)
+	case !a.files[configName]:
+		return nil, fmt.Errorf("%s is missing", configName)
+	}
+	return a, nil
+}
+
+func extractFile(r io.Reader, dst string) error {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (a *archive) validate(ctx context.Context, dir string, validate Validator) error {
+	read := func(name string) ([]byte, error) {
+		if !a.files[name] {
+			return nil, nil
+		}
+		return os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+
+	b, err := read("state.json")
+	if err != nil {
+		return err
+	}
+	if _, err := state.UnmarshalStateMap(b); err != nil {
+		return fmt.Errorf("state.json: %w", err)
+	}
+	if b, err = read("topics.json"); err != nil {
+		return err
+	}
+	if _, err := state.UnmarshalTopics(b); err != nil {
+		return fmt.Errorf("topics.json: %w", err)
+	}
+
+	for name := range a.files {
+		tmpl, ok := strings.CutPrefix(name, templatesDir+"/")
+		if !ok {
+			continue
+		}
+		b, err := read(name)
+		if err != nil {
+			return err
+		}
+		a.templates[tmpl] = string(b)
+	}
+	config, err := read(configName)
+	if err != nil {
+		return err
+	}
+	if validate != nil {
+		if err := validate(ctx, string(config), a.templates); err != nil {
+			return err
+		}
+	}
+
+	store := stats.OpenReader(dir)
+	defer store.Close()
+	if !a.files[filepath.Base(store.Path())] {
+		return nil
+	}
+	status, err := store.CheckSchema(ctx)
+	switch {
+	case err != nil:
+		return fmt.Errorf("stats database: %w", err)
+	case status.Integrity != "ok":
+		return fmt.Errorf("stats database: integrity check failed: %s", status.Integrity)
+	case status.Version > status.Supported:
+		return fmt.Errorf("stats database: schema version %d is newer than supported version %d", status.Version, status.Supported)
+	}
+	return nil
+}
+
+// migrate applies pending migrations to the extracted stats database, so
+// that it's usable by readers, like the admin server, right after it's
+// installed.
+func (a *archive) migrate(ctx context.Context, dir string) error {
+	store := stats.OpenWriter(dir)
+	if !a.files[filepath.Base(store.Path())] {
+		return nil
+	}
+	if err := store.Bootstrap(ctx); err != nil {
+		store.Close()
+		return err
+	}
+	return store.Close()
+}
+
+// rename is os.Rename, replaced in tests to simulate failures.
+var rename = os.Rename
+
+// install moves the extracted files from dir into stateDir, removing the
+// files that the archive doesn't have.
+//
+// The state directory itself can't be swapped with a single rename: it holds
+// the run lock and files unrelated to tgfeed, and may be managed by systemd.
+// Instead, the current files are first moved aside into a sibling directory,
+// and on any error the installed files are removed and the previous ones moved
+// back, so stateDir never ends up with a mix of old and new files.
+func (a *archive) install(dir, stateDir string) (err error) {
+	dbName := filepath.Base(stats.OpenReader(stateDir).Path())
+	// Stale write-ahead log and shared memory files of the old database would
+	// corrupt the new one, so they're replaced too. Archives never have them.
+	names := append(slices.Clone(stateFiles), dbName, dbName+"-wal", dbName+"-shm", templatesDir)
+
+	oldDir, err := os.MkdirTemp(stateDir, restoreOldDirPat)
+	if err != nil {
+		return err
+	}
+	var moved, installed []string
+	defer func() {
+		if err == nil {
+			os.RemoveAll(oldDir)
+			return
+		}
+		var rbErrs []error
+		for _, name := range installed {
+			rbErrs = append(rbErrs, os.RemoveAll(filepath.Join(stateDir, name)))
+		}
+		for _, name := range moved {
+			rbErrs = append(rbErrs, rename(filepath.Join(oldDir, name), filepath.Join(stateDir, name)))
+		}
+		if rbErr := errors.Join(rbErrs...); rbErr != nil {
+			err = fmt.Errorf("%w; rolling back failed, previous files are kept in %s: %v", err, oldDir, rbErr)
+			return
+		}
+		os.RemoveAll(oldDir)
+	}()
+
+	for _, name := range names {
+		err := rename(filepath.Join(stateDir, name), filepath.Join(oldDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		moved = append(moved, name)
+	}
+	for _, name := range names {
+		err := rename(filepath.Join(dir, name), filepath.Join(stateDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		installed = append(installed, name)
+	}
+	return nil
+}
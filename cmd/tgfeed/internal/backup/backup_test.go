@@ -0,0 +1,277 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+)
+
+var testTime = time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func writeStateDir(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readStateDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if filepath.Base(path) == "stats.sqlite3" {
+			files[filepath.ToSlash(rel)] = ""
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	writeStateDir(t, src, map[string]string{
+		"config.star":             `feed(url = "https://example.com/feed.xml")`,
+		"state.json":              `{"https://example.com/feed.xml": {"fetch_count": 3}}`,
+		"error.tmpl":              "Error: {{ .Message }}",
+		"templates/short.tmpl":    "{{ .Title }}",
+		"templates/not-a-tmpl.md": "ignored",
+	})
+	store := stats.OpenWriter(src)
+	if err := store.Bootstrap(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveRun(t.Context(), &stats.Run{StartTime: testTime}); err != nil {
+		t.Fatal(err)
+	}
+	// Keep the store open, so the run is still in the write-ahead log.
+	t.Cleanup(func() { store.Close() })
+
+	var buf bytes.Buffer
+	if err := Create(t.Context(), &buf, src, testTime); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	writeStateDir(t, dst, map[string]string{
+		"config.star":        "old",
+		"topics.json":        `{"Old": 1}`,
+		"templates/old.tmpl": "old",
+		"stats.sqlite3-wal":  "stale",
+		"unrelated-file.txt": "kept",
+	})
+	var gotConfig string
+	var gotTemplates map[string]string
+	manifest, err := Restore(t.Context(), bytes.NewReader(buf.Bytes()), dst, func(ctx context.Context, config string, templates map[string]string) error {
+		gotConfig, gotTemplates = config, templates
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, *manifest, Manifest{Format: Format, Created: testTime})
+	testutil.AssertEqual(t, gotConfig, `feed(url = "https://example.com/feed.xml")`)
+	testutil.AssertEqual(t, gotTemplates, map[string]string{"short.tmpl": "{{ .Title }}"})
+	testutil.AssertEqual(t, readStateDir(t, dst), map[string]string{
+		"config.star":          `feed(url = "https://example.com/feed.xml")`,
+		"state.json":           `{"https://example.com/feed.xml": {"fetch_count": 3}}`,
+		"error.tmpl":           "Error: {{ .Message }}",
+		"templates/short.tmpl": "{{ .Title }}",
+		"stats.sqlite3":        "",
+		"unrelated-file.txt":   "kept",
+	})
+
+	restored := stats.OpenReader(dst)
+	t.Cleanup(func() { restored.Close() })
+	runs, err := restored.ListRuns(t.Context(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, len(runs), 1)
+}
+
+func TestRestoreMigratesStats(t *testing.T) {
+	t.Parallel()
+
+	// An empty file is a valid SQLite database with no schema at all.
+	archive := makeArchive(t,
+		[2]string{manifestName, `{"format": 1}`},
+		[2]string{configName, "config"},
+		[2]string{"stats.sqlite3", ""},
+	)
+	dst := t.TempDir()
+	if _, err := Restore(t.Context(), bytes.NewReader(archive), dst, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	store := stats.OpenReader(dst)
+	t.Cleanup(func() { store.Close() })
+	status, err := store.CheckSchema(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, status.Version, status.Supported)
+	testutil.AssertEqual(t, len(status.Pending), 0)
+}
+
+// Not parallel, as it replaces rename.
+func TestRestoreRollsBack(t *testing.T) {
+	dst := t.TempDir()
+	old := map[string]string{
+		"config.star":        "old",
+		"topics.json":        `{"Old": 1}`,
+		"templates/old.tmpl": "old",
+		"unrelated-file.txt": "kept",
+	}
+	writeStateDir(t, dst, old)
+
+	wantErr := errors.New("disk on fire")
+	t.Cleanup(func() { rename = os.Rename })
+	rename = func(oldpath, newpath string) error {
+		// Fail after config.star is installed.
+		if newpath == filepath.Join(dst, "state.json") {
+			return wantErr
+		}
+		return os.Rename(oldpath, newpath)
+	}
+
+	archive := makeArchive(t,
+		[2]string{manifestName, `{"format": 1}`},
+		[2]string{configName, "new"},
+		[2]string{"state.json", "{}"},
+	)
+	_, err := Restore(t.Context(), bytes.NewReader(archive), dst, nil)
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("Restore() error = %v, want %v", err, wantErr)
+	}
+	testutil.AssertEqual(t, readStateDir(t, dst), old)
+}
+
+func makeArchive(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		if err := writeFile(tw, f[0], []byte(f[1]), testTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	t.Parallel()
+
+	manifest := [2]string{manifestName, `{"format": 1}`}
+	config := [2]string{configName, "config"}
+
+	cases := map[string]struct {
+		archive  []byte
+		validate Validator
+		wantErr  string
+	}{
+		"not gzip": {
+			archive: []byte("this is not a backup archive"),
+			wantErr: "gzip: invalid header",
+		},
+		"no manifest": {
+			archive: makeArchive(t, config),
+			wantErr: "backup.json is missing",
+		},
+		"future format": {
+			archive: makeArchive(t, [2]string{manifestName, `{"format": 2}`}, config),
+			wantErr: "unsupported format 2",
+		},
+		"no config": {
+			archive: makeArchive(t, manifest),
+			wantErr: "config.star is missing",
+		},
+		"path traversal": {
+			archive: makeArchive(t, manifest, config, [2]string{"../evil.star", "evil"}),
+			wantErr: "../evil.star: unexpected file",
+		},
+		"bad template name": {
+			archive: makeArchive(t, manifest, config, [2]string{"templates/../config.star", "evil"}),
+			wantErr: "unexpected file",
+		},
+		"duplicate": {
+			archive: makeArchive(t, manifest, config, config),
+			wantErr: "config.star: duplicate file",
+		},
+		"bad state": {
+			archive: makeArchive(t, manifest, config, [2]string{"state.json", "{"}),
+			wantErr: "state.json:",
+		},
+		"bad stats": {
+			archive: makeArchive(t, manifest, config, [2]string{"stats.sqlite3", "not a database"}),
+			wantErr: "stats database:",
+		},
+		"invalid config": {
+			archive: makeArchive(t, manifest, config),
+			validate: func(ctx context.Context, config string, templates map[string]string) error {
+				return errors.New("syntax error")
+			},
+			wantErr: "syntax error",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			orig := map[string]string{"config.star": "original"}
+			writeStateDir(t, dir, orig)
+
+			_, err := Restore(t.Context(), bytes.NewReader(tc.archive), dir, tc.validate)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Restore() error = %v, want containing %q", err, tc.wantErr)
+			}
+			testutil.AssertEqual(t, readStateDir(t, dir), orig)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package doctor implements diagnostic checks of a tgfeed installation.
+//
+// Checks of the host tgfeed runs on, such as state directory permissions and
+// the stats database schema, are done by [HostChecks], so that the admin API
+// can run them on behalf of a remote client.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+// Check outcomes.
+const (
+	OK   Status = "ok"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Check is the result of a single diagnostic check.
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Okf returns a passed check.
+func Okf(name, format string, args ...any) Check {
+	return Check{Name: name, Status: OK, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Warnf returns a check that found something worth a look.
+func Warnf(name, format string, args ...any) Check {
+	return Check{Name: name, Status: Warn, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Failf returns a failed check.
+func Failf(name, format string, args ...any) Check {
+	return Check{Name: name, Status: Fail, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Print writes checks to w, one per line, and returns the number of failed
+// checks.
+func Print(w io.Writer, checks []Check) (failed int) {
+	for _, c := range checks {
+		if c.Status == Fail {
+			failed++
+		}
+		line := fmt.Sprintf("%-4s  %s", strings.ToUpper(string(c.Status)), c.Name)
+		if c.Detail != "" {
+			line += ": " + c.Detail
+		}
+		fmt.Fprintln(w, line)
+	}
+	return failed
+}
+
+// HostChecks checks the state directory stateDir, the run lock and the stats
+// database. isRunLocked reports whether the run lock is held.
+func HostChecks(ctx context.Context, stateDir string, isRunLocked func() bool) []Check {
+	checks := []Check{checkStateDir(stateDir)}
+	if checks[0].Status == Fail {
+		return checks
+	}
+
+	if isRunLocked() {
+		checks = append(checks, Okf("run lock", "held, a run is in progress"))
+	} else {
+		checks = append(checks, Okf("run lock", "free"))
+	}
+
+	return append(checks, checkStats(ctx, stateDir))
+}
+
+func checkStateDir(dir string) Check {
+	const name = "state directory"
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return Failf(name, "%v", err)
+	}
+	if !fi.IsDir() {
+		return Failf(name, "%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return Failf(name, "%s is not writable: %v", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	if perm := fi.Mode().Perm(); perm&0o077 != 0 {
+		return Warnf(name, "%s is accessible by other users (mode %04o), want 0700", dir, perm)
+	}
+	return Okf(name, "%s", dir)
+}
+
+func checkStats(ctx context.Context, stateDir string) Check {
+	const name = "stats database"
+	store := stats.OpenReader(stateDir)
+	defer store.Close()
+	if _, err := os.Stat(store.Path()); errors.Is(err, fs.ErrNotExist) {
+		return Warnf(name, "%s doesn't exist yet, it will be created by the next run", filepath.Base(store.Path()))
+	}
+	status, err := store.CheckSchema(ctx)
+	switch {
+	case err != nil:
+		return Failf(name, "%v", err)
+	case status.Integrity != "ok":
+		return Failf(name, "integrity check failed: %s", status.Integrity)
+	case status.Version > status.Supported:
+		return Failf(name, "schema version %d is newer than supported version %d, upgrade tgfeed", status.Version, status.Supported)
+	case len(status.Pending) > 0:
+		return Warnf(name, "schema version %d, the next run will apply %s", status.Version, strings.Join(status.Pending, ", "))
+	}
+	return Okf(name, "schema version %d", status.Version)
+}
@@ -0,0 +1,69 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+)
+
+func TestHostChecks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	locked := func() bool { return false }
+
+	checks := HostChecks(t.Context(), dir, locked)
+	testutil.AssertEqual(t, checks, []Check{
+		Okf("state directory", "%s", dir),
+		Okf("run lock", "free"),
+		Warnf("stats database", "stats.sqlite3 doesn't exist yet, it will be created by the next run"),
+	})
+
+	store := stats.OpenWriter(dir)
+	if err := store.Bootstrap(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	checks = HostChecks(t.Context(), dir, func() bool { return true })
+	testutil.AssertEqual(t, checks[0].Status, Warn)
+	testutil.AssertEqual(t, checks[1], Okf("run lock", "held, a run is in progress"))
+	testutil.AssertEqual(t, checks[2].Status, OK)
+
+	checks = HostChecks(t.Context(), filepath.Join(dir, "missing"), locked)
+	testutil.AssertEqual(t, len(checks), 1)
+	testutil.AssertEqual(t, checks[0].Status, Fail)
+}
+
+func TestPrint(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	failed := Print(&sb, []Check{
+		Okf("bot", "@feeds_bot"),
+		Warnf("feed https://example.com/feed.xml", "disabled"),
+		Failf("CHAT_ID", "not set"),
+		{Name: "run lock", Status: OK},
+	})
+	testutil.AssertEqual(t, failed, 1)
+	testutil.AssertEqual(t, sb.String(), `OK    bot: @feeds_bot
+WARN  feed https://example.com/feed.xml: disabled
+FAIL  CHAT_ID: not set
+OK    run lock
+`)
+}
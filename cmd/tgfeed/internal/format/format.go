@@ -12,6 +12,9 @@
 //   - fall back to [DefaultUpdateMessage] when custom formatting is missing
 //     or invalid
 //
+// Feeds can also be formatted with Go templates from a [Templates] set
+// instead of a Starlark function.
+//
 // Formatter output accepted by [ParseFormattedMessage] is either:
 //
 //   - a string body
@@ -339,6 +342,7 @@ func ItemToStarlark(item *gofeed.Item) starlark.Value {
 			"extensions":  extensions,
 			"guid":        starlark.String(item.GUID),
 			"published":   starlark.String(item.Published),
+			"language":    starlark.String(ItemLanguage(item)),
 		},
 	)
 }
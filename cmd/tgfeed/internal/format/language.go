@@ -0,0 +1,52 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package format
+
+import (
+	"cmp"
+
+	"go.astrophena.name/tools/cmd/tgfeed/internal/langdetect"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// AnnotateLanguage records the language of item as its Dublin Core language,
+// so that [ItemLanguage] can return it later. The language declared by the
+// item itself wins over feedLanguage, the language declared by the feed,
+// which in turn wins over a guess made from the item's text.
+func AnnotateLanguage(item *gofeed.Item, feedLanguage string) {
+	lang := cmp.Or(declaredLanguage(item), langdetect.Normalize(feedLanguage), detectLanguage(item))
+	if lang == "" {
+		return
+	}
+	if item.DublinCoreExt == nil {
+		item.DublinCoreExt = &ext.DublinCoreExtension{}
+	}
+	item.DublinCoreExt.Language = []string{lang}
+}
+
+// ItemLanguage returns the ISO 639-1 code of the language of item, or an empty
+// string if it's unknown. Items that weren't annotated with
+// [AnnotateLanguage] get a guess made from their text.
+func ItemLanguage(item *gofeed.Item) string {
+	return cmp.Or(declaredLanguage(item), detectLanguage(item))
+}
+
+func declaredLanguage(item *gofeed.Item) string {
+	if item.DublinCoreExt == nil {
+		return ""
+	}
+	for _, lang := range item.DublinCoreExt.Language {
+		if lang := langdetect.Normalize(lang); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+func detectLanguage(item *gofeed.Item) string {
+	return langdetect.Detect(item.Title + "\n" + stripHTML(cmp.Or(item.Description, item.Content)))
+}
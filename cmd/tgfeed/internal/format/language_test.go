@@ -0,0 +1,48 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package format
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"go.astrophena.name/base/testutil"
+)
+
+func TestAnnotateLanguage(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		item         *gofeed.Item
+		feedLanguage string
+		want         string
+	}{
+		"item language": {
+			item:         &gofeed.Item{Title: "Hello", DublinCoreExt: &ext.DublinCoreExtension{Language: []string{"de-AT"}}},
+			feedLanguage: "en-us",
+			want:         "de",
+		},
+		"feed language": {
+			item:         &gofeed.Item{Title: "Вышла новая версия компилятора"},
+			feedLanguage: "en-us",
+			want:         "en",
+		},
+		"detected": {
+			item: &gofeed.Item{Title: "Вышла новая версия", Description: "<p>Подробности в блоге</p>"},
+			want: "ru",
+		},
+		"unknown": {
+			item: &gofeed.Item{Title: "v1.2.3"},
+			want: "",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			AnnotateLanguage(tc.item, tc.feedLanguage)
+			testutil.AssertEqual(t, ItemLanguage(tc.item), tc.want)
+		})
+	}
+}
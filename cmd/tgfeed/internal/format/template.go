@@ -0,0 +1,176 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package format
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	urlpkg "net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/mmcdole/gofeed"
+)
+
+// TemplateData is the data message templates are executed with.
+type TemplateData struct {
+	// Feed holds metadata for the current feed.
+	Feed Feed
+	// Item is the first item of the update. Outside of digest mode, it's
+	// the only one.
+	Item *gofeed.Item
+	// Items are all items of the update.
+	Items []*gofeed.Item
+}
+
+// Templates is a set of message templates written in Go template syntax.
+// Templates in a set can include each other with the template action.
+//
+// Besides the standard functions, templates can use:
+//
+//   - truncate n s: shortens s to at most n characters, ending it with an
+//     ellipsis when truncated
+//   - stripHTML s: removes HTML tags from s and unescapes entities
+//   - domain url: returns the host name of url without the "www." prefix
+//   - relativeTime t: formats t, which is a time.Time, *time.Time or RFC 3339
+//     string, relative to the current time, like "3 hours ago"
+//   - language item: returns the ISO 639-1 code of the language of item, or
+//     an empty string if it's unknown
+type Templates struct {
+	set *template.Template
+	now func() time.Time
+}
+
+// ParseTemplates parses templates keyed by name.
+func ParseTemplates(files map[string]string) (*Templates, error) {
+	t := &Templates{now: time.Now}
+	t.set = template.New("").Option("missingkey=error").Funcs(template.FuncMap{
+		"truncate":     truncate,
+		"stripHTML":    stripHTML,
+		"domain":       domain,
+		"relativeTime": t.relativeTime,
+		"language":     ItemLanguage,
+	})
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if _, err := t.set.New(name).Parse(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Has reports whether the set contains a template named name.
+func (t *Templates) Has(name string) bool {
+	return t != nil && t.set.Lookup(name) != nil
+}
+
+// Render executes the template named name for u.
+//
+// Update.Items must contain at least one item.
+func (t *Templates) Render(name string, u Update) (Rendered, error) {
+	if !t.Has(name) {
+		return Rendered{}, fmt.Errorf("template %q is not defined", name)
+	}
+	var buf strings.Builder
+	if err := t.set.ExecuteTemplate(&buf, name, TemplateData{
+		Feed:  u.Feed,
+		Item:  u.Items[0],
+		Items: u.Items,
+	}); err != nil {
+		return Rendered{}, err
+	}
+	body := strings.TrimSpace(buf.String())
+	if body == "" {
+		return Rendered{}, fmt.Errorf("template %q rendered an empty message", name)
+	}
+	return Rendered{Body: body, DisablePreview: u.Feed.Digest}, nil
+}
+
+func truncate(n int, s string) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+var htmlStripper = bluemonday.StrictPolicy()
+
+func stripHTML(s string) string {
+	return strings.TrimSpace(html.UnescapeString(htmlStripper.Sanitize(s)))
+}
+
+func domain(rawURL string) string {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+func (t *Templates) relativeTime(v any) (string, error) {
+	var ts time.Time
+	switch v := v.(type) {
+	case time.Time:
+		ts = v
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		ts = *v
+	case string:
+		if v == "" {
+			return "", nil
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return "", err
+		}
+		ts = parsed
+	default:
+		return "", errors.New("relativeTime: want a time or an RFC 3339 string")
+	}
+
+	d := t.now().Sub(ts)
+	suffix := "ago"
+	if d < 0 {
+		d, suffix = -d, "from now"
+	}
+	switch {
+	case d < time.Minute:
+		return "just now", nil
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute") + " " + suffix, nil
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour") + " " + suffix, nil
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day") + " " + suffix, nil
+	case d < 365*24*time.Hour:
+		return plural(int(d/(30*24*time.Hour)), "month") + " " + suffix, nil
+	default:
+		return plural(int(d/(365*24*time.Hour)), "year") + " " + suffix, nil
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,133 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package format
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"go.astrophena.name/base/testutil"
+)
+
+func TestTemplatesRender(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	published := now.Add(-3 * time.Hour)
+
+	tmpls, err := ParseTemplates(map[string]string{
+		"item.tmpl":   `{{template "link" .Item}} ({{domain .Item.Link}}, {{relativeTime .Item.PublishedParsed}}): {{.Item.Description | stripHTML | truncate 12}}`,
+		"link.tmpl":   `{{define "link"}}[{{.Title}}]({{.Link}}){{end}}`,
+		"digest.tmpl": `*{{.Feed.Title}}*{{range .Items}}` + "\n" + `• {{.Title}}{{end}}`,
+		"empty.tmpl":  `{{if false}}never{{end}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpls.now = func() time.Time { return now }
+
+	items := []*gofeed.Item{
+		{Title: "First", Link: "https://www.example.com/1", Description: "<p>A long &amp; detailed description.</p>", PublishedParsed: &published},
+		{Title: "Second", Link: "https://example.com/2"},
+	}
+
+	cases := map[string]struct {
+		name     string
+		update   Update
+		want     Rendered
+		wantErr  string
+		wantHave bool
+	}{
+		"single item": {
+			name:   "item.tmpl",
+			update: Update{Items: items[:1]},
+			want:   Rendered{Body: "[First](https://www.example.com/1) (example.com, 3 hours ago): A long & de…"},
+		},
+		"digest": {
+			name:   "digest.tmpl",
+			update: Update{Feed: Feed{Title: "Example", Digest: true}, Items: items},
+			want:   Rendered{Body: "*Example*\n• First\n• Second", DisablePreview: true},
+		},
+		"undefined": {
+			name:    "missing.tmpl",
+			update:  Update{Items: items[:1]},
+			wantErr: `template "missing.tmpl" is not defined`,
+		},
+		"empty output": {
+			name:    "empty.tmpl",
+			update:  Update{Items: items[:1]},
+			wantErr: "rendered an empty message",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := tmpls.Render(tc.name, tc.update)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Render() error = %v, want containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, got, tc.want)
+		})
+	}
+}
+
+func TestParseTemplatesError(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseTemplates(map[string]string{"broken.tmpl": `{{.Item.Title`})
+	if err == nil || !strings.Contains(err.Error(), "broken.tmpl") {
+		t.Fatalf("ParseTemplates() error = %v, want an error mentioning the template", err)
+	}
+	_, err = ParseTemplates(map[string]string{"unknown.tmpl": `{{shout .Item.Title}}`})
+	if err == nil || !strings.Contains(err.Error(), `"shout" not defined`) {
+		t.Fatalf("ParseTemplates() error = %v, want an undefined function error", err)
+	}
+}
+
+func TestTemplatesHasNil(t *testing.T) {
+	t.Parallel()
+
+	var tmpls *Templates
+	testutil.AssertEqual(t, tmpls.Has("item.tmpl"), false)
+}
+
+func TestRelativeTime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tmpls := &Templates{now: func() time.Time { return now }}
+
+	cases := map[string]struct {
+		in   any
+		want string
+	}{
+		"just now":    {in: now.Add(-10 * time.Second), want: "just now"},
+		"one minute":  {in: now.Add(-time.Minute), want: "1 minute ago"},
+		"days":        {in: now.Add(-50 * time.Hour), want: "2 days ago"},
+		"months":      {in: now.Add(-65 * 24 * time.Hour), want: "2 months ago"},
+		"years":       {in: now.Add(-800 * 24 * time.Hour), want: "2 years ago"},
+		"future":      {in: now.Add(2 * time.Hour), want: "2 hours from now"},
+		"string":      {in: "2026-03-01T09:00:00Z", want: "3 hours ago"},
+		"nil pointer": {in: (*time.Time)(nil), want: ""},
+		"empty":       {in: "", want: ""},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := tmpls.relativeTime(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, got, tc.want)
+		})
+	}
+}
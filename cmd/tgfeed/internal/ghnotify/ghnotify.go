@@ -19,6 +19,7 @@ import (
 
 	"go.astrophena.name/base/request"
 	"go.astrophena.name/base/web"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/jsonfeed"
 )
 
 // Handler returns an HTTP handler that serves a JSON Feed of GitHub
@@ -52,23 +53,6 @@ type notification struct {
 	} `json:"repository"`
 }
 
-type jsonFeed struct {
-	Version     string     `json:"version"`
-	Title       string     `json:"title"`
-	HomePageURL string     `json:"home_page_url"`
-	FeedURL     string     `json:"feed_url"`
-	Items       []feedItem `json:"items"`
-}
-
-type feedItem struct {
-	ID            string    `json:"id"`
-	URL           string    `json:"url"`
-	Title         string    `json:"title"`
-	ContentText   string    `json:"content_text"`
-	DatePublished time.Time `json:"date_published"`
-	ExternalURL   string    `json:"external_url"`
-}
-
 const ghAPI = "https://api.github.com"
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -165,7 +149,7 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	)
 
 	var (
-		items      []feedItem
+		items      []jsonfeed.Item
 		ignoredIDs []string
 	)
 	for _, n := range allNotifications {
@@ -210,7 +194,7 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if n.Reason == "ci_activity" {
 			url = n.Repository.HTMLURL + "/actions"
 		}
-		item := feedItem{
+		item := jsonfeed.Item{
 			ID:            n.ID,
 			URL:           url,
 			Title:         fmt.Sprintf("%s: %s", n.Repository.FullName, n.Subject.Title),
@@ -221,8 +205,8 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		items = append(items, item)
 	}
 
-	feed := jsonFeed{
-		Version:     "https://jsonfeed.org/version/1.1",
+	feed := jsonfeed.Feed{
+		Version:     jsonfeed.Version,
 		Title:       "GitHub Notifications",
 		HomePageURL: "https://github.com",
 		Items:       items,
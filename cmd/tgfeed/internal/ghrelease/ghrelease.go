@@ -0,0 +1,330 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package ghrelease implements an HTTP handler that serves a JSON Feed of
+// GitHub releases or tags across a list of repositories.
+//
+// The handler is configured by query parameters of the incoming request:
+//
+//   - repo: repository in owner/name form; can be repeated or contain a
+//     comma-separated list
+//   - prereleases: when true, include pre-releases (and semver pre-release
+//     tags), which are skipped by default
+//   - tags: when true, watch tags instead of published releases, for
+//     repositories that don't create GitHub releases
+//
+// Tags of all repositories are fetched with a single request to the GraphQL
+// API, which requires a token.
+package ghrelease
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/base/web"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/jsonfeed"
+
+	"golang.org/x/mod/semver"
+)
+
+const (
+	ghAPI     = "https://api.github.com"
+	userAgent = "ghrelease (+https://astrophena.name/bleep-bloop)"
+
+	releasesPerRepo = 20
+	tagsPerRepo     = 10
+)
+
+// Handler returns an HTTP handler that serves a JSON Feed of GitHub releases
+// or tags. The token is optional and only raises API rate limits and grants
+// access to private repositories.
+func Handler(token string, logger *slog.Logger, client *http.Client) http.Handler {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	}
+	return &handler{token: token, logger: logger, client: client}
+}
+
+type handler struct {
+	token  string
+	logger *slog.Logger
+	client *http.Client
+}
+
+type release struct {
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	HTMLURL     string    `json:"html_url"`
+	Body        string    `json:"body"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// tagsQuery fetches the latest tags of a repository with dates of tagged
+// commits. Annotated tags point to a tag object that points to the commit.
+const tagsQuery = `%s: repository(owner: $owner%[2]d, name: $name%[2]d) {
+    refs(refPrefix: "refs/tags/", first: %[3]d, orderBy: {field: TAG_COMMIT_DATE, direction: DESC}) {
+      nodes {
+        name
+        target {
+          ... on Commit { committedDate }
+          ... on Tag { target { ... on Commit { committedDate } } }
+        }
+      }
+    }
+  }
+`
+
+type tagsResponse struct {
+	Data   map[string]*tagsRepository `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type tagsRepository struct {
+	Refs struct {
+		Nodes []struct {
+			Name   string `json:"name"`
+			Target struct {
+				CommittedDate time.Time `json:"committedDate"`
+				Target        struct {
+					CommittedDate time.Time `json:"committedDate"`
+				} `json:"target"`
+			} `json:"target"`
+		} `json:"nodes"`
+	} `json:"refs"`
+}
+
+var errNoToken = errors.New("watching tags requires a GitHub token")
+
+type options struct {
+	repos       []string
+	prereleases bool
+	tags        bool
+}
+
+func parseOptions(query url.Values) (options, error) {
+	var opts options
+	for _, value := range query["repo"] {
+		for repo := range strings.SplitSeq(value, ",") {
+			repo = strings.TrimSpace(repo)
+			if repo == "" {
+				continue
+			}
+			if owner, name, ok := strings.Cut(repo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+				return options{}, fmt.Errorf("invalid repository %q, want owner/name", repo)
+			}
+			if !slices.Contains(opts.repos, repo) {
+				opts.repos = append(opts.repos, repo)
+			}
+		}
+	}
+	if len(opts.repos) == 0 {
+		return options{}, errors.New("at least one repo query parameter is required")
+	}
+
+	var err error
+	if opts.prereleases, err = parseBool(query, "prereleases"); err != nil {
+		return options{}, err
+	}
+	if opts.tags, err = parseBool(query, "tags"); err != nil {
+		return options{}, err
+	}
+	return opts, nil
+}
+
+func parseBool(query url.Values, key string) (bool, error) {
+	value := query.Get(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s query parameter %q", key, value)
+	}
+	return b, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseOptions(r.URL.Query())
+	if err != nil {
+		web.RespondJSONError(w, r, fmt.Errorf("%w: %v", web.ErrBadRequest, err))
+		return
+	}
+
+	var items []jsonfeed.Item
+	if opts.tags {
+		items, err = h.tagItems(r.Context(), opts)
+		if err != nil {
+			web.RespondJSONError(w, r, fmt.Errorf("fetching tags: %w", err))
+			return
+		}
+	} else {
+		for _, repo := range opts.repos {
+			repoItems, err := h.releaseItems(r.Context(), repo, opts)
+			if err != nil {
+				web.RespondJSONError(w, r, fmt.Errorf("fetching %s: %w", repo, err))
+				return
+			}
+			h.logger.DebugContext(r.Context(), "fetched repository",
+				slog.String("repo", repo),
+				slog.Int("count", len(repoItems)),
+			)
+			items = append(items, repoItems...)
+		}
+	}
+
+	title := "GitHub Releases"
+	if opts.tags {
+		title = "GitHub Tags"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	web.RespondJSON(w, jsonfeed.Feed{
+		Version:     jsonfeed.Version,
+		Title:       title,
+		HomePageURL: "https://github.com",
+		Items:       items,
+	})
+}
+
+func (h *handler) releaseItems(ctx context.Context, repo string, opts options) ([]jsonfeed.Item, error) {
+	releases, err := get[[]release](ctx, h, fmt.Sprintf("%s/repos/%s/releases?per_page=%d", ghAPI, repo, releasesPerRepo))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []jsonfeed.Item
+	for _, rel := range releases {
+		if rel.Draft || (rel.Prerelease && !opts.prereleases) {
+			continue
+		}
+		name := cmp.Or(rel.Name, rel.TagName)
+		content := name
+		if rel.Prerelease {
+			content += " (pre-release)"
+		}
+		if body := strings.TrimSpace(rel.Body); body != "" {
+			content += "\n\n" + body
+		}
+		items = append(items, jsonfeed.Item{
+			ID:            repo + "@" + rel.TagName,
+			URL:           rel.HTMLURL,
+			Title:         fmt.Sprintf("%s: %s", repo, name),
+			ContentText:   content,
+			DatePublished: rel.PublishedAt,
+			ExternalURL:   "https://github.com/" + repo,
+		})
+	}
+	return items, nil
+}
+
+// tagItems returns items for tags of all repositories, fetched with a single
+// GraphQL request. The REST API has no dates of tags, and looking up each
+// tagged commit would take a request per tag.
+func (h *handler) tagItems(ctx context.Context, opts options) ([]jsonfeed.Item, error) {
+	if h.token == "" {
+		return nil, errNoToken
+	}
+
+	var (
+		params    []string
+		fields    strings.Builder
+		variables = make(map[string]string)
+	)
+	for i, repo := range opts.repos {
+		owner, name, _ := strings.Cut(repo, "/")
+		params = append(params, fmt.Sprintf("$owner%d: String!, $name%d: String!", i, i))
+		fmt.Fprintf(&fields, tagsQuery, "repo"+strconv.Itoa(i), i, tagsPerRepo)
+		variables["owner"+strconv.Itoa(i)] = owner
+		variables["name"+strconv.Itoa(i)] = name
+	}
+	resp, err := request.Make[tagsResponse](ctx, request.Params{
+		Method: http.MethodPost,
+		URL:    ghAPI + "/graphql",
+		Body: map[string]any{
+			"query":     fmt.Sprintf("query(%s) {\n  %s}", strings.Join(params, ", "), fields.String()),
+			"variables": variables,
+		},
+		Headers:    h.headers(),
+		HTTPClient: h.client,
+		Scrubber:   strings.NewReplacer(h.token, "REDACTED"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Errors) > 0 {
+		return nil, errors.New(resp.Errors[0].Message)
+	}
+
+	var items []jsonfeed.Item
+	for i, repo := range opts.repos {
+		r := resp.Data["repo"+strconv.Itoa(i)]
+		if r == nil {
+			return nil, fmt.Errorf("repository %s not found", repo)
+		}
+		var count int
+		for _, t := range r.Refs.Nodes {
+			if !opts.prereleases && semver.Prerelease(t.Name) != "" {
+				continue
+			}
+			date := t.Target.CommittedDate
+			if date.IsZero() {
+				date = t.Target.Target.CommittedDate
+			}
+			items = append(items, jsonfeed.Item{
+				ID:            repo + "@" + t.Name,
+				URL:           fmt.Sprintf("https://github.com/%s/releases/tag/%s", repo, url.PathEscape(t.Name)),
+				Title:         fmt.Sprintf("%s: %s", repo, t.Name),
+				ContentText:   t.Name,
+				DatePublished: date,
+				ExternalURL:   "https://github.com/" + repo,
+			})
+			count++
+		}
+		h.logger.DebugContext(ctx, "fetched repository",
+			slog.String("repo", repo),
+			slog.Int("count", count),
+		)
+	}
+	return items, nil
+}
+
+func (h *handler) headers() map[string]string {
+	headers := map[string]string{
+		"Accept":     "application/vnd.github.v3+json",
+		"User-Agent": userAgent,
+	}
+	if h.token != "" {
+		headers["Authorization"] = "Bearer " + h.token
+	}
+	return headers
+}
+
+func get[Response any](ctx context.Context, h *handler, u string) (Response, error) {
+	var scrubber *strings.Replacer
+	if h.token != "" {
+		scrubber = strings.NewReplacer(h.token, "REDACTED")
+	}
+	return request.Make[Response](ctx, request.Params{
+		Method:     http.MethodGet,
+		URL:        u,
+		Headers:    h.headers(),
+		HTTPClient: h.client,
+		Scrubber:   scrubber,
+	})
+}
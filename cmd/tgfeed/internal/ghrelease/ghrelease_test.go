@@ -0,0 +1,147 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package ghrelease
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.astrophena.name/base/rr"
+	"go.astrophena.name/base/testutil"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// Updating this test:
+//
+//	$ GITHUB_TOKEN="$(gh auth token)" go test -update -httprecord testdata/handler.httprr
+//
+
+func TestHandler(t *testing.T) {
+	rec, err := rr.Open(filepath.Join("testdata", "handler.httprr"), http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	rec.ScrubReq(func(r *http.Request) error {
+		r.Header.Del("Authorization")
+		return nil
+	})
+
+	tok := "example"
+	if rec.Recording() {
+		tok = os.Getenv("GITHUB_TOKEN")
+	}
+
+	h := Handler(tok, nil, rec.Client())
+
+	cases := map[string]string{
+		"releases":    "repo=astrophena/tools,golang/go",
+		"prereleases": "repo=astrophena/tools&prereleases=true",
+		"tags":        "repo=golang/go&tags=true",
+	}
+	for name, query := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+			h.ServeHTTP(w, r)
+
+			testutil.AssertEqual(t, w.Code, http.StatusOK)
+
+			var prettyJSON bytes.Buffer
+			if err := json.Indent(&prettyJSON, w.Body.Bytes(), "", "  "); err != nil {
+				t.Fatal(err)
+			}
+
+			goldenFile := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(goldenFile, prettyJSON.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testutil.AssertEqual(t, prettyJSON.String(), string(want))
+		})
+	}
+}
+
+func TestTagsRequireToken(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/?repo=golang/go&tags=true", nil)
+	Handler("", nil, nil).ServeHTTP(w, r)
+	testutil.AssertEqual(t, w.Code, http.StatusInternalServerError)
+	if !strings.Contains(w.Body.String(), errNoToken.Error()) {
+		t.Fatalf("response doesn't mention the missing token: %s", w.Body)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	cases := map[string]struct {
+		query   string
+		want    options
+		wantErr bool
+	}{
+		"single repo": {
+			query: "repo=golang/go",
+			want:  options{repos: []string{"golang/go"}},
+		},
+		"repeated and comma-separated repos": {
+			query: "repo=golang/go,%20astrophena/tools&repo=golang/go&repo=golang/tools",
+			want:  options{repos: []string{"golang/go", "astrophena/tools", "golang/tools"}},
+		},
+		"flags": {
+			query: "repo=golang/go&prereleases=1&tags=true",
+			want:  options{repos: []string{"golang/go"}, prereleases: true, tags: true},
+		},
+		"no repos": {
+			query:   "prereleases=true",
+			wantErr: true,
+		},
+		"invalid repo": {
+			query:   "repo=golang",
+			wantErr: true,
+		},
+		"nested repo": {
+			query:   "repo=golang/go/issues",
+			wantErr: true,
+		},
+		"invalid flag": {
+			query:   "repo=golang/go&tags=maybe",
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			query, err := url.ParseQuery(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseOptions(query)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, got, tc.want)
+		})
+	}
+}
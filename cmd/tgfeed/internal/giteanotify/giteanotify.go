@@ -0,0 +1,178 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package giteanotify implements an HTTP handler that serves a JSON Feed of
+// unread Gitea or Forgejo notifications.
+//
+// Forgejo keeps the notifications API of Gitea, so the same handler serves
+// both.
+package giteanotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/base/web"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/jsonfeed"
+)
+
+// DefaultURL is the Gitea instance used when no base URL is configured.
+const DefaultURL = "https://gitea.com"
+
+const (
+	userAgent = "giteanotify (+https://astrophena.name/bleep-bloop)"
+
+	pageSize = 50
+	maxPages = 10
+)
+
+// Handler returns an HTTP handler that serves a JSON Feed of unread
+// notifications from the Gitea or Forgejo instance at baseURL.
+func Handler(baseURL, token string, logger *slog.Logger, client *http.Client) http.Handler {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	}
+	return &handler{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, logger: logger, client: client}
+}
+
+type handler struct {
+	baseURL string
+	token   string
+	logger  *slog.Logger
+	client  *http.Client
+}
+
+type notification struct {
+	ID         int64     `json:"id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	Subject struct {
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Type    string `json:"type"`
+		State   string `json:"state"`
+	} `json:"subject"`
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.baseURL == "" {
+		web.RespondJSONError(w, r, errors.New("instance URL is not configured"))
+		return
+	}
+
+	var notifications []notification
+	for page := 1; ; page++ {
+		batch, err := request.Make[[]notification](r.Context(), request.Params{
+			Method:     http.MethodGet,
+			URL:        fmt.Sprintf("%s/api/v1/notifications?status-types=unread&limit=%d&page=%d", h.baseURL, pageSize, page),
+			Headers:    headers(h.token),
+			HTTPClient: h.client,
+			Scrubber:   scrubber(h.token),
+		})
+		if err != nil {
+			web.RespondJSONError(w, r, err)
+			return
+		}
+		h.logger.DebugContext(r.Context(), "fetched notifications page",
+			slog.Int("page", page),
+			slog.Int("count", len(batch)),
+		)
+		notifications = append(notifications, batch...)
+
+		if len(batch) < pageSize {
+			break
+		}
+		// Safety brake to prevent infinite loops. The rest of notifications
+		// is delivered after these are marked as read.
+		if page >= maxPages {
+			h.logger.WarnContext(r.Context(), "too many notifications, delivering only some of them",
+				slog.Int("count", len(notifications)),
+			)
+			break
+		}
+	}
+
+	h.logger.InfoContext(r.Context(), "fetched all notifications",
+		slog.Int("total_count", len(notifications)),
+	)
+
+	items := make([]jsonfeed.Item, 0, len(notifications))
+	for _, n := range notifications {
+		url := n.Subject.HTMLURL
+		if url == "" {
+			url = n.Repository.HTMLURL
+		}
+		content := n.Subject.Title
+		if details := strings.TrimSpace(strings.ToLower(n.Subject.Type) + " " + n.Subject.State); details != "" {
+			content = fmt.Sprintf("%s (%s)", content, details)
+		}
+		items = append(items, jsonfeed.Item{
+			ID:            strconv.FormatInt(n.ID, 10),
+			URL:           url,
+			Title:         fmt.Sprintf("%s: %s", n.Repository.FullName, n.Subject.Title),
+			ContentText:   content,
+			DatePublished: n.UpdatedAt,
+			ExternalURL:   n.Repository.HTMLURL,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	web.RespondJSON(w, jsonfeed.Feed{
+		Version:     jsonfeed.Version,
+		Title:       "Notifications",
+		HomePageURL: h.baseURL + "/notifications",
+		Items:       items,
+	})
+}
+
+// MarkAsRead marks notification threads as read after their downstream
+// delivery has succeeded.
+func MarkAsRead(ctx context.Context, baseURL, token string, client *http.Client, ids []string) error {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	for _, id := range ids {
+		_, err := request.Make[request.IgnoreResponse](ctx, request.Params{
+			Method:         http.MethodPatch,
+			URL:            fmt.Sprintf("%s/api/v1/notifications/threads/%s?to-status=read", baseURL, id),
+			Headers:        headers(token),
+			WantStatusCode: http.StatusResetContent,
+			HTTPClient:     client,
+			Scrubber:       scrubber(token),
+		})
+		// Gitea responds with 205 Reset Content, while some Forgejo versions use
+		// plain 200.
+		if se, ok := errors.AsType[*request.StatusError](err); ok && se.StatusCode == http.StatusOK {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func headers(token string) map[string]string {
+	return map[string]string{
+		"Authorization": "token " + token,
+		"Accept":        "application/json",
+		"User-Agent":    userAgent,
+	}
+}
+
+func scrubber(token string) *strings.Replacer {
+	if token == "" {
+		return nil
+	}
+	return strings.NewReplacer(token, "REDACTED")
+}
@@ -0,0 +1,94 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package giteanotify
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.astrophena.name/base/rr"
+	"go.astrophena.name/base/testutil"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+const testURL = "https://codeberg.org"
+
+// Updating this test:
+//
+//	$ GITEA_TOKEN="..." go test -update -httprecord 'testdata/.*\.httprr'
+//
+
+func openRecorder(t *testing.T, name string) (rec *rr.RecordReplay, token string) {
+	t.Helper()
+	rec, err := rr.Open(filepath.Join("testdata", name), http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rec.Close() })
+	rec.ScrubReq(func(r *http.Request) error {
+		r.Header.Del("Authorization")
+		return nil
+	})
+
+	token = "example"
+	if rec.Recording() {
+		token = os.Getenv("GITEA_TOKEN")
+	}
+	return rec, token
+}
+
+func TestHandler(t *testing.T) {
+	rec, token := openRecorder(t, "handler.httprr")
+	h := Handler(testURL, token, nil, rec.Client())
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	h.ServeHTTP(w, r)
+
+	testutil.AssertEqual(t, w.Code, http.StatusOK)
+
+	var prettyJSON bytes.Buffer
+	if err := json.Indent(&prettyJSON, w.Body.Bytes(), "", "  "); err != nil {
+		t.Fatal(err)
+	}
+
+	goldenFile := filepath.Join("testdata", "handler.golden")
+	if *update {
+		if err := os.WriteFile(goldenFile, prettyJSON.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.AssertEqual(t, prettyJSON.String(), string(want))
+}
+
+func TestMarkAsRead(t *testing.T) {
+	rec, token := openRecorder(t, "mark_as_read.httprr")
+	if err := MarkAsRead(t.Context(), testURL, token, rec.Client(), []string{"42"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnconfigured(t *testing.T) {
+	h := Handler("", "", nil, http.DefaultClient)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	h.ServeHTTP(w, r)
+
+	testutil.AssertEqual(t, w.Code, http.StatusInternalServerError)
+}
@@ -0,0 +1,201 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package gltodo implements an HTTP handler that serves a JSON Feed of pending
+// GitLab to-do items.
+package gltodo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/base/web"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/jsonfeed"
+)
+
+// DefaultURL is the GitLab instance used when no base URL is provided.
+const DefaultURL = "https://gitlab.com"
+
+const (
+	userAgent = "gltodo (+https://astrophena.name/bleep-bloop)"
+
+	pageSize = 100
+	maxPages = 10
+)
+
+// Handler returns an HTTP handler that serves a JSON Feed of pending to-do
+// items from the GitLab instance at baseURL.
+func Handler(baseURL, token string, logger *slog.Logger, client *http.Client) http.Handler {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	}
+	return &handler{baseURL: normalizeURL(baseURL), token: token, logger: logger, client: client}
+}
+
+type handler struct {
+	baseURL string
+	token   string
+	logger  *slog.Logger
+	client  *http.Client
+}
+
+type todo struct {
+	ID         int64     `json:"id"`
+	ActionName string    `json:"action_name"`
+	TargetType string    `json:"target_type"`
+	TargetURL  string    `json:"target_url"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	Author     struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+	Target struct {
+		Title string `json:"title"`
+	} `json:"target"`
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var todos []todo
+	for page := 1; ; page++ {
+		batch, err := request.Make[[]todo](r.Context(), request.Params{
+			Method:     http.MethodGet,
+			URL:        fmt.Sprintf("%s/api/v4/todos?state=pending&per_page=%d&page=%d", h.baseURL, pageSize, page),
+			Headers:    headers(h.token),
+			HTTPClient: h.client,
+			Scrubber:   scrubber(h.token),
+		})
+		if err != nil {
+			web.RespondJSONError(w, r, err)
+			return
+		}
+		h.logger.DebugContext(r.Context(), "fetched to-do page",
+			slog.Int("page", page),
+			slog.Int("count", len(batch)),
+		)
+		todos = append(todos, batch...)
+
+		if len(batch) < pageSize {
+			break
+		}
+		// Safety brake to prevent infinite loops. The rest of to-do items is
+		// delivered after these are marked as done.
+		if page >= maxPages {
+			h.logger.WarnContext(r.Context(), "too many to-do items, delivering only some of them",
+				slog.Int("count", len(todos)),
+			)
+			break
+		}
+	}
+
+	h.logger.InfoContext(r.Context(), "fetched all to-do items",
+		slog.Int("total_count", len(todos)),
+	)
+
+	items := make([]jsonfeed.Item, 0, len(todos))
+	for _, t := range todos {
+		title := t.Target.Title
+		if t.Project.PathWithNamespace != "" {
+			title = fmt.Sprintf("%s: %s", t.Project.PathWithNamespace, title)
+		}
+		content := fmt.Sprintf("%s (%s by @%s)", t.Target.Title, humanizeAction(t.ActionName), t.Author.Username)
+		if t.Body != "" && t.Body != t.Target.Title {
+			content += "\n\n" + t.Body
+		}
+		items = append(items, jsonfeed.Item{
+			ID:            strconv.FormatInt(t.ID, 10),
+			URL:           t.TargetURL,
+			Title:         title,
+			ContentText:   content,
+			DatePublished: t.CreatedAt,
+			ExternalURL:   t.Project.WebURL,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	web.RespondJSON(w, jsonfeed.Feed{
+		Version:     jsonfeed.Version,
+		Title:       "GitLab To-Do List",
+		HomePageURL: h.baseURL + "/dashboard/todos",
+		Items:       items,
+	})
+}
+
+// MarkAsDone marks GitLab to-do items as done after their downstream delivery
+// has succeeded.
+func MarkAsDone(ctx context.Context, baseURL, token string, client *http.Client, ids []string) error {
+	baseURL = normalizeURL(baseURL)
+	for _, id := range ids {
+		_, err := request.Make[request.IgnoreResponse](ctx, request.Params{
+			Method:         http.MethodPost,
+			URL:            fmt.Sprintf("%s/api/v4/todos/%s/mark_as_done", baseURL, id),
+			Headers:        headers(token),
+			WantStatusCode: http.StatusCreated,
+			HTTPClient:     client,
+			Scrubber:       scrubber(token),
+		})
+		// GitLab answers POST endpoints with 201, but older versions used 200
+		// for this one.
+		if se, ok := errors.AsType[*request.StatusError](err); ok && se.StatusCode == http.StatusOK {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func headers(token string) map[string]string {
+	return map[string]string{
+		"PRIVATE-TOKEN": token,
+		"Accept":        "application/json",
+		"User-Agent":    userAgent,
+	}
+}
+
+func scrubber(token string) *strings.Replacer {
+	if token == "" {
+		return nil
+	}
+	return strings.NewReplacer(token, "REDACTED")
+}
+
+func normalizeURL(baseURL string) string {
+	if baseURL == "" {
+		return DefaultURL
+	}
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+func humanizeAction(action string) string {
+	switch action {
+	case "mentioned", "directly_addressed":
+		return "mentioned"
+	case "build_failed":
+		return "pipeline failed"
+	case "marked":
+		return "added to-do"
+	case "approval_required":
+		return "approval required"
+	case "unmergeable":
+		return "cannot be merged"
+	case "review_requested":
+		return "review requested"
+	case "member_access_requested":
+		return "access requested"
+	}
+	return strings.ReplaceAll(action, "_", " ")
+}
@@ -0,0 +1,94 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package gltodo
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.astrophena.name/base/rr"
+	"go.astrophena.name/base/testutil"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// Updating this test:
+//
+//	$ GITLAB_TOKEN="glpat-..." go test -update -httprecord 'testdata/.*\.httprr'
+//
+
+func openRecorder(t *testing.T, name string) (rec *rr.RecordReplay, token string) {
+	t.Helper()
+	rec, err := rr.Open(filepath.Join("testdata", name), http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rec.Close() })
+	rec.ScrubReq(func(r *http.Request) error {
+		r.Header.Del("PRIVATE-TOKEN")
+		return nil
+	})
+
+	token = "example"
+	if rec.Recording() {
+		token = os.Getenv("GITLAB_TOKEN")
+	}
+	return rec, token
+}
+
+func TestHandler(t *testing.T) {
+	rec, token := openRecorder(t, "handler.httprr")
+	h := Handler("", token, nil, rec.Client())
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	h.ServeHTTP(w, r)
+
+	testutil.AssertEqual(t, w.Code, http.StatusOK)
+
+	var prettyJSON bytes.Buffer
+	if err := json.Indent(&prettyJSON, w.Body.Bytes(), "", "  "); err != nil {
+		t.Fatal(err)
+	}
+
+	goldenFile := filepath.Join("testdata", "handler.golden")
+	if *update {
+		if err := os.WriteFile(goldenFile, prettyJSON.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.AssertEqual(t, prettyJSON.String(), string(want))
+}
+
+func TestMarkAsDone(t *testing.T) {
+	rec, token := openRecorder(t, "mark_as_done.httprr")
+	if err := MarkAsDone(t.Context(), "", token, rec.Client(), []string{"102"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHumanizeAction(t *testing.T) {
+	cases := map[string]string{
+		"mentioned":          "mentioned",
+		"directly_addressed": "mentioned",
+		"build_failed":       "pipeline failed",
+		"some_new_action":    "some new action",
+	}
+	for in, want := range cases {
+		testutil.AssertEqual(t, humanizeAction(in), want)
+	}
+}
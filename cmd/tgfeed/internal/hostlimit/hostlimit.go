@@ -0,0 +1,169 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package hostlimit keeps requests polite towards individual hosts.
+//
+// A [Limiter] caps concurrent requests to each host and spaces them by a
+// minimum delay, optionally taken from the host's robots.txt Crawl-delay. Its
+// [Limiter.Run] method schedules work so that hosts that are ready are served
+// first, instead of letting workers block on a busy host.
+package hostlimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MaxCrawlDelay caps delays requested by robots.txt, so that a single host
+// can't stall a run.
+const MaxCrawlDelay = time.Minute
+
+// Limits describe how requests to a host are throttled.
+type Limits struct {
+	// MaxConcurrency is the number of simultaneous requests allowed. Zero
+	// means no limit.
+	MaxConcurrency int
+	// MinDelay is the minimum time between the starts of two requests.
+	MinDelay time.Duration
+	// RobotsTxt makes the Limiter honor the Crawl-delay directive of the
+	// host's robots.txt, if it is longer than MinDelay.
+	RobotsTxt bool
+}
+
+// Config configures a Limiter.
+type Config struct {
+	// Default applies to hosts not present in Hosts.
+	Default Limits
+	// Hosts maps host names to their limits.
+	Hosts map[string]Limits
+	// CrawlDelay returns the robots.txt Crawl-delay of a host. It is called
+	// at most once per host, and only for hosts with RobotsTxt set.
+	CrawlDelay func(ctx context.Context, host string) time.Duration
+}
+
+// Limiter throttles requests per host. A nil *Limiter imposes no limits.
+type Limiter struct {
+	cfg Config
+
+	mu      sync.Mutex
+	hosts   map[string]*hostState
+	changed chan struct{} // closed and replaced when a slot is released
+}
+
+type hostState struct {
+	limits     Limits
+	active     int       // requests in flight
+	next       time.Time // earliest start of the next request
+	robotsOnce sync.Once
+	crawlDelay time.Duration
+}
+
+// New returns a Limiter configured by cfg.
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		hosts:   make(map[string]*hostState),
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire blocks until a request to host may proceed and returns a function
+// that must be called when the request is done. It returns the context error
+// if ctx is done before that.
+func (l *Limiter) Acquire(ctx context.Context, host string) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	st := l.host(host)
+	if st.limits.RobotsTxt && l.cfg.CrawlDelay != nil {
+		st.robotsOnce.Do(func() {
+			d := min(l.cfg.CrawlDelay(ctx, host), MaxCrawlDelay)
+			l.mu.Lock()
+			st.crawlDelay = d
+			l.mu.Unlock()
+		})
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		ready, wait := st.ready(now)
+		if ready {
+			st.active++
+			st.next = now.Add(max(st.limits.MinDelay, st.crawlDelay))
+			l.mu.Unlock()
+			return sync.OnceFunc(func() { l.release(st) }), nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		if err := l.wait(ctx, changed, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (l *Limiter) host(host string) *hostState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.hostLocked(host)
+}
+
+func (l *Limiter) hostLocked(host string) *hostState {
+	st, ok := l.hosts[host]
+	if !ok {
+		limits, ok := l.cfg.Hosts[host]
+		if !ok {
+			limits = l.cfg.Default
+		}
+		st = &hostState{limits: limits}
+		l.hosts[host] = st
+	}
+	return st
+}
+
+// ready reports whether a request may start at now. If not, and the host is
+// only waiting for its delay to pass, wait is the remaining time; otherwise
+// the caller has to wait for a release.
+func (st *hostState) ready(now time.Time) (ok bool, wait time.Duration) {
+	if st.limits.MaxConcurrency > 0 && st.active >= st.limits.MaxConcurrency {
+		return false, 0
+	}
+	if now.Before(st.next) {
+		return false, st.next.Sub(now)
+	}
+	return true, 0
+}
+
+func (l *Limiter) release(st *hostState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st.active--
+	l.broadcastLocked()
+}
+
+func (l *Limiter) broadcastLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// wait blocks until changed is closed, wait elapses (if positive) or ctx is
+// done.
+func (l *Limiter) wait(ctx context.Context, changed <-chan struct{}, wait time.Duration) error {
+	var timeout <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-changed:
+	case <-timeout:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package hostlimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+)
+
+func TestLimiterConcurrency(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		l := New(Config{Hosts: map[string]Limits{"slow.example.com": {MaxConcurrency: 2}}})
+
+		var (
+			running, peak atomic.Int32
+			wg            sync.WaitGroup
+		)
+		for range 10 {
+			wg.Go(func() {
+				release, err := l.Acquire(t.Context(), "slow.example.com")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer release()
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Second)
+				running.Add(-1)
+			})
+		}
+		wg.Wait()
+
+		testutil.AssertEqual(t, peak.Load(), int32(2))
+	})
+}
+
+func TestLimiterMinDelay(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		l := New(Config{Default: Limits{MinDelay: 3 * time.Second}})
+
+		start := time.Now()
+		var starts []time.Duration
+		for range 3 {
+			release, err := l.Acquire(t.Context(), "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			starts = append(starts, time.Since(start))
+			release()
+		}
+
+		testutil.AssertEqual(t, starts, []time.Duration{0, 3 * time.Second, 6 * time.Second})
+
+		// Other hosts have their own delay.
+		before := time.Now()
+		if _, err := l.Acquire(t.Context(), "other.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		testutil.AssertEqual(t, time.Since(before), time.Duration(0))
+	})
+}
+
+func TestLimiterCrawlDelay(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		var calls atomic.Int32
+		l := New(Config{
+			Hosts: map[string]Limits{
+				"robots.example.com": {MinDelay: time.Second, RobotsTxt: true},
+			},
+			CrawlDelay: func(_ context.Context, host string) time.Duration {
+				calls.Add(1)
+				if host == "robots.example.com" {
+					return 10 * time.Second
+				}
+				return time.Hour
+			},
+		})
+
+		start := time.Now()
+		for range 2 {
+			release, err := l.Acquire(t.Context(), "robots.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+		}
+		testutil.AssertEqual(t, time.Since(start), 10*time.Second)
+
+		// RobotsTxt is off for hosts using the default limits.
+		if _, err := l.Acquire(t.Context(), "example.com"); err != nil {
+			t.Fatal(err)
+		}
+		testutil.AssertEqual(t, calls.Load(), int32(1))
+	})
+}
+
+func TestLimiterNil(t *testing.T) {
+	t.Parallel()
+
+	var l *Limiter
+	for range 3 {
+		if _, err := l.Acquire(t.Context(), "example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLimiterCanceled(t *testing.T) {
+	t.Parallel()
+
+	l := New(Config{Default: Limits{MaxConcurrency: 1}})
+	release, err := l.Acquire(t.Context(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := l.Acquire(ctx, "example.com"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		l := New(Config{
+			Default: Limits{MaxConcurrency: 1},
+			Hosts: map[string]Limits{
+				"fast.example.com": {MaxConcurrency: 2},
+			},
+		})
+
+		var (
+			mu  sync.Mutex
+			log []string
+		)
+		task := func(host string) Task {
+			return Task{Host: host, Run: func() {
+				release, err := l.Acquire(t.Context(), host)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer release()
+				mu.Lock()
+				log = append(log, host)
+				mu.Unlock()
+				time.Sleep(time.Second)
+			}}
+		}
+
+		var tasks []Task
+		for range 4 {
+			tasks = append(tasks, task("slow.example.com"))
+		}
+		for range 4 {
+			tasks = append(tasks, task("fast.example.com"))
+		}
+		tasks = append(tasks, task("other.example.com"))
+
+		start := time.Now()
+		l.Run(t.Context(), 4, tasks)
+
+		// The slow host allows one request at a time, so its 4 tasks bound the
+		// run to 4 seconds. Blocking workers on it would take longer.
+		testutil.AssertEqual(t, time.Since(start), 4*time.Second)
+		testutil.AssertEqual(t, len(log), len(tasks))
+	})
+}
+
+func TestRunMinDelay(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		l := New(Config{Default: Limits{MinDelay: 5 * time.Second}})
+
+		var done atomic.Int32
+		var tasks []Task
+		for _, host := range []string{"a.example.com", "a.example.com", "b.example.com", "b.example.com"} {
+			tasks = append(tasks, Task{Host: host, Run: func() {
+				release, err := l.Acquire(t.Context(), host)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				release()
+				done.Add(1)
+			}})
+		}
+
+		start := time.Now()
+		l.Run(t.Context(), 1, tasks)
+
+		// A single worker alternates hosts instead of sleeping on one of them.
+		testutil.AssertEqual(t, time.Since(start), 5*time.Second)
+		testutil.AssertEqual(t, done.Load(), int32(4))
+	})
+}
+
+func TestRunCanceled(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		l := New(Config{Default: Limits{MinDelay: time.Hour}})
+		ctx, cancel := context.WithTimeout(t.Context(), time.Minute)
+		defer cancel()
+
+		var ran atomic.Int32
+		tasks := make([]Task, 3)
+		for i := range tasks {
+			tasks[i] = Task{Host: "example.com", Run: func() {
+				if release, err := l.Acquire(ctx, "example.com"); err == nil {
+					release()
+				}
+				ran.Add(1)
+			}}
+		}
+		l.Run(ctx, 2, tasks)
+
+		testutil.AssertEqual(t, ran.Load(), int32(1))
+	})
+}
+
+func TestParseCrawlDelay(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		robots string
+		want   time.Duration
+		ok     bool
+	}{
+		"none": {
+			robots: "User-agent: *\nDisallow: /private\n",
+		},
+		"wildcard": {
+			robots: "User-agent: *\nCrawl-delay: 2\n",
+			want:   2 * time.Second,
+			ok:     true,
+		},
+		"specific wins": {
+			robots: "User-agent: *\nCrawl-delay: 2\n\nUser-agent: TGFeed\nCrawl-delay: 0.5\n",
+			want:   500 * time.Millisecond,
+			ok:     true,
+		},
+		"grouped agents": {
+			robots: "User-agent: googlebot\nUser-agent: tgfeed\nDisallow: /x\nCrawl-delay: 4 # be nice\n",
+			want:   4 * time.Second,
+			ok:     true,
+		},
+		"other agent": {
+			robots: "User-agent: googlebot\nCrawl-delay: 10\n",
+		},
+		"capped": {
+			robots: "User-agent: *\nCrawl-delay: 86400\n",
+			want:   MaxCrawlDelay,
+			ok:     true,
+		},
+		"invalid": {
+			robots: "User-agent: *\nCrawl-delay: soon\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, ok := ParseCrawlDelay(strings.NewReader(tc.robots), "tgfeed")
+			testutil.AssertEqual(t, ok, tc.ok)
+			testutil.AssertEqual(t, got, tc.want)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package hostlimit
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseCrawlDelay returns the Crawl-delay that a robots.txt file read from r
+// sets for agent. Groups naming the agent take precedence over the wildcard
+// group. Agent names are matched case-insensitively.
+func ParseCrawlDelay(r io.Reader, agent string) (delay time.Duration, ok bool) {
+	agent = strings.ToLower(agent)
+
+	var (
+		wildcard, specific   time.Duration
+		hasWildcard, hasSpec bool
+
+		groupAgents []string
+		inRules     bool // seen a rule line since the last User-agent line
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "crawl-delay":
+			inRules = true
+			d, valid := parseDelay(value)
+			if !valid {
+				continue
+			}
+			for _, a := range groupAgents {
+				switch a {
+				case "*":
+					wildcard, hasWildcard = d, true
+				case agent:
+					specific, hasSpec = d, true
+				}
+			}
+		default:
+			inRules = true
+		}
+	}
+
+	switch {
+	case hasSpec:
+		return specific, true
+	case hasWildcard:
+		return wildcard, true
+	}
+	return 0, false
+}
+
+func parseDelay(s string) (time.Duration, bool) {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || secs < 0 || math.IsInf(secs, 0) || math.IsNaN(secs) {
+		return 0, false
+	}
+	return time.Duration(min(secs, MaxCrawlDelay.Seconds()) * float64(time.Second)), true
+}
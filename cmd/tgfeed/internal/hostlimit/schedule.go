@@ -0,0 +1,133 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package hostlimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Task is a unit of work that makes requests to a single host.
+type Task struct {
+	Host string
+	Run  func()
+}
+
+// Run runs tasks on at most workers goroutines and returns when all of them
+// are done or ctx is done, in which case tasks that haven't started are
+// dropped.
+//
+// A task is started only when its host has a free slot and its minimum delay
+// has passed, so workers are never parked on a busy host while tasks for
+// other hosts wait. Among ready hosts, the one with the most queued tasks
+// goes first, because it bounds how long the whole run takes. Tasks for the
+// same host start in the order they were given.
+//
+// Tasks still have to call [Limiter.Acquire] around each request: Run only
+// decides when to start them.
+func (l *Limiter) Run(ctx context.Context, workers int, tasks []Task) {
+	if l == nil {
+		l = New(Config{})
+	}
+
+	s := &scheduler{
+		l:       l,
+		queues:  make(map[string][]func()),
+		running: make(map[string]int),
+	}
+	for _, t := range tasks {
+		if _, ok := s.queues[t.Host]; !ok {
+			s.order = append(s.order, t.Host)
+		}
+		s.queues[t.Host] = append(s.queues[t.Host], t.Run)
+		s.pending++
+	}
+
+	var wg sync.WaitGroup
+	for range min(workers, len(tasks)) {
+		wg.Go(func() { s.work(ctx) })
+	}
+	wg.Wait()
+}
+
+type scheduler struct {
+	l *Limiter
+
+	// Guarded by l.mu.
+	order   []string // hosts in order of appearance
+	queues  map[string][]func()
+	running map[string]int // tasks in progress by host
+	pending int            // queued tasks
+}
+
+func (s *scheduler) work(ctx context.Context) {
+	for {
+		s.l.mu.Lock()
+		if s.pending == 0 {
+			s.l.mu.Unlock()
+			return
+		}
+		host, task, wait := s.pickLocked(time.Now())
+		if task == nil {
+			changed := s.l.changed
+			s.l.mu.Unlock()
+			if err := s.l.wait(ctx, changed, wait); err != nil {
+				return
+			}
+			continue
+		}
+		s.running[host]++
+		s.l.mu.Unlock()
+
+		task()
+
+		s.l.mu.Lock()
+		s.running[host]--
+		s.l.broadcastLocked()
+		s.l.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// pickLocked dequeues the next task to run. If no host is ready, it returns a
+// nil task and the time until a host becomes ready by its delay alone, or zero
+// if only a finishing task can unblock one.
+func (s *scheduler) pickLocked(now time.Time) (host string, task func(), wait time.Duration) {
+	var (
+		best  string
+		found bool
+	)
+	for _, h := range s.order {
+		q := s.queues[h]
+		if len(q) == 0 {
+			continue
+		}
+		st := s.l.hostLocked(h)
+		if limit := st.limits.MaxConcurrency; limit > 0 && s.running[h] >= limit {
+			continue
+		}
+		ok, w := st.ready(now)
+		if !ok {
+			if w > 0 && (wait == 0 || w < wait) {
+				wait = w
+			}
+			continue
+		}
+		if !found || len(q) > len(s.queues[best]) {
+			best, found = h, true
+		}
+	}
+	if !found {
+		return "", nil, wait
+	}
+	task = s.queues[best][0]
+	s.queues[best] = s.queues[best][1:]
+	s.pending--
+	return best, task, 0
+}
@@ -0,0 +1,33 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package jsonfeed defines the subset of the JSON Feed format produced by
+// tgfeed special feeds.
+//
+// See https://www.jsonfeed.org/version/1.1/ for the specification.
+package jsonfeed
+
+import "time"
+
+// Version is the JSON Feed version URL written to [Feed.Version].
+const Version = "https://jsonfeed.org/version/1.1"
+
+// Feed is a JSON Feed document.
+type Feed struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	FeedURL     string `json:"feed_url"`
+	Items       []Item `json:"items"`
+}
+
+// Item is a single JSON Feed item.
+type Item struct {
+	ID            string    `json:"id"`
+	URL           string    `json:"url"`
+	Title         string    `json:"title"`
+	ContentText   string    `json:"content_text"`
+	DatePublished time.Time `json:"date_published"`
+	ExternalURL   string    `json:"external_url"`
+}
@@ -0,0 +1,177 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package langdetect guesses the language of short texts, such as feed item
+// titles and summaries.
+//
+// Detection is heuristic: the dominant Unicode script decides the language
+// for most non-Latin scripts, and texts in the Latin script are scored by the
+// frequency of common function words. It is meant to be good enough to route
+// and filter feed items, not to be a general-purpose language identifier.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalize returns the lowercase primary subtag of a language tag, so that
+// "en-US", "en_GB" and "EN" all become "en". It returns an empty string for
+// tags that don't start with a two or three letter code.
+func Normalize(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if len(tag) < 2 || len(tag) > 3 {
+		return ""
+	}
+	for _, r := range tag {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return ""
+		}
+	}
+	return strings.ToLower(tag)
+}
+
+// minLetters is the minimum number of letters needed to make a guess.
+const minLetters = 8
+
+// scripts maps Unicode scripts that are (mostly) used by a single language
+// to that language.
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Hangul, "ko"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Armenian, "hy"},
+	{unicode.Georgian, "ka"},
+}
+
+// Detect returns the ISO 639-1 code of the language text is most likely
+// written in, or an empty string if it can't tell.
+func Detect(text string) string {
+	var (
+		letters, latin, cyrillic, han, kana int
+		byScript                            = make([]int, len(scripts))
+		ukrainian, belarusian               bool
+	)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			switch unicode.ToLower(r) {
+			case 'і', 'ї', 'є', 'ґ':
+				ukrainian = true
+			case 'ў':
+				belarusian = true
+			}
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for i, s := range scripts {
+				if unicode.Is(s.table, r) {
+					byScript[i]++
+					break
+				}
+			}
+		}
+	}
+	// CJK texts carry a lot of meaning per character.
+	if han+kana > 0 && (han+kana)*2 >= letters {
+		if kana > 0 {
+			return "ja"
+		}
+		return "zh"
+	}
+	if letters < minLetters {
+		return ""
+	}
+	if cyrillic*2 > letters {
+		switch {
+		case belarusian:
+			return "be"
+		case ukrainian:
+			return "uk"
+		}
+		return "ru"
+	}
+	for i, n := range byScript {
+		if n*2 > letters {
+			return scripts[i].lang
+		}
+	}
+	if latin*2 > letters {
+		return detectLatin(text)
+	}
+	return ""
+}
+
+// stopwords lists frequent function words of languages written in the Latin
+// script. Words shared by several languages count towards each of them.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "for", "with", "it", "on", "this", "are", "was", "you", "be", "by", "from", "have", "not", "new"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "sich", "auf", "ein", "eine", "für", "von", "dem", "den", "zu", "auch", "wird", "bei", "noch"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "du", "pour", "dans", "que", "qui", "sur", "pas", "au", "avec", "ce", "sont", "aux", "nous"},
+	"es": {"el", "los", "las", "y", "es", "una", "del", "por", "para", "con", "que", "se", "su", "como", "más", "pero", "lo", "al", "muy", "fue"},
+	"it": {"il", "gli", "e", "è", "della", "di", "che", "per", "non", "una", "sono", "con", "del", "alla", "anche", "nel", "questo", "ma", "più", "dei"},
+	"pt": {"o", "os", "as", "e", "é", "um", "uma", "do", "da", "não", "com", "para", "que", "em", "dos", "das", "mais", "por", "como", "foi"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "op", "te", "zijn", "voor", "met", "ook", "maar", "wordt", "deze", "bij", "naar", "heeft"},
+	"pl": {"i", "w", "nie", "się", "na", "jest", "że", "do", "to", "z", "jak", "ale", "od", "po", "dla", "tak", "czy", "są", "przez", "już"},
+}
+
+var stopwordIndex = func() map[string][]string {
+	idx := make(map[string][]string)
+	for lang, words := range stopwords {
+		for _, w := range words {
+			idx[w] = append(idx[w], lang)
+		}
+	}
+	return idx
+}()
+
+// minStopwords is the minimum number of function words needed to make a
+// guess about a text in the Latin script.
+const minStopwords = 2
+
+func detectLatin(text string) string {
+	scores := make(map[string]int)
+	for word := range strings.FieldsFuncSeq(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for _, lang := range stopwordIndex[word] {
+			scores[lang]++
+		}
+	}
+	var (
+		best      string
+		bestScore int
+		tie       bool
+	)
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tie = lang, score, false
+		case score == bestScore:
+			tie = true
+		}
+	}
+	if bestScore < minStopwords || tie {
+		return ""
+	}
+	return best
+}
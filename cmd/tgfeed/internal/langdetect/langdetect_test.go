@@ -0,0 +1,63 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package langdetect
+
+import (
+	"testing"
+
+	"go.astrophena.name/base/testutil"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		in   string
+		want string
+	}{
+		"english":    {in: "The new release of the toolchain is available for download", want: "en"},
+		"german":     {in: "Die neue Version ist ab sofort verfügbar und bringt auch viele Verbesserungen mit sich", want: "de"},
+		"french":     {in: "La nouvelle version est disponible pour tous les utilisateurs dans le monde", want: "fr"},
+		"spanish":    {in: "La nueva versión ya está disponible para los usuarios y es muy rápida", want: "es"},
+		"italian":    {in: "La nuova versione è disponibile per gli utenti e non richiede aggiornamenti", want: "it"},
+		"dutch":      {in: "De nieuwe versie is nu beschikbaar en het is ook sneller dan de vorige", want: "nl"},
+		"polish":     {in: "Nowa wersja jest już dostępna i nie wymaga aktualizacji", want: "pl"},
+		"russian":    {in: "Вышла новая версия компилятора", want: "ru"},
+		"ukrainian":  {in: "Вийшла нова версія компілятора з підтримкою їхніх платформ", want: "uk"},
+		"greek":      {in: "Η νέα έκδοση είναι διαθέσιμη", want: "el"},
+		"japanese":   {in: "新しいバージョンが公開されました", want: "ja"},
+		"chinese":    {in: "新版本已经发布", want: "zh"},
+		"korean":     {in: "새로운 버전이 출시되었습니다", want: "ko"},
+		"too short":  {in: "Go 1.27", want: ""},
+		"no words":   {in: "Xyzzy plugh frobnicate quux", want: ""},
+		"empty":      {in: "", want: ""},
+		"only links": {in: "https://example.com/", want: ""},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			testutil.AssertEqual(t, Detect(tc.in), tc.want)
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"en":      "en",
+		"en-US":   "en",
+		"pt_BR":   "pt",
+		" RU ":    "ru",
+		"fil":     "fil",
+		"":        "",
+		"x":       "",
+		"english": "",
+		"12-34":   "",
+		"zh-Hant": "zh",
+	}
+	for in, want := range cases {
+		testutil.AssertEqual(t, Normalize(in), want)
+	}
+}
@@ -0,0 +1,171 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+// Package republish renders items delivered by tgfeed as Atom and JSON feeds,
+// so the filtered stream can be followed in feed readers.
+package republish
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.astrophena.name/tools/cmd/tgfeed/internal/jsonfeed"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+)
+
+// Feed is a republished feed.
+type Feed struct {
+	// Title is the feed title.
+	Title string
+	// URL is the absolute URL the feed is served from.
+	URL string
+	// Items contains archived items, newest first.
+	Items []stats.Item
+}
+
+// Updated returns the time the newest item was delivered, or the zero time
+// for an empty feed.
+func (f Feed) Updated() time.Time {
+	var updated time.Time
+	for _, item := range f.Items {
+		if item.Delivered.After(updated) {
+			updated = item.Delivered
+		}
+	}
+	return updated
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published,omitempty"`
+	Link      *atomLink   `xml:"link"`
+	Summary   *atomText   `xml:"summary"`
+	Content   *atomText   `xml:"content"`
+	Source    *atomSource `xml:"source"`
+}
+
+type atomSource struct {
+	Title string `xml:"title,omitempty"`
+	ID    string `xml:"id"`
+}
+
+// Atom renders f as an Atom 1.0 document. The content of an entry is the
+// message text the item was delivered as.
+func Atom(f Feed) ([]byte, error) {
+	doc := atomFeed{
+		Title:   f.Title,
+		ID:      f.URL,
+		Updated: atomTime(f.Updated()),
+		Link:    atomLink{Rel: "self", Href: f.URL},
+		Author:  atomPerson{Name: "tgfeed"},
+		Entries: make([]atomEntry, 0, len(f.Items)),
+	}
+	for _, item := range f.Items {
+		entry := atomEntry{
+			Title:   itemTitle(item),
+			ID:      itemID(item),
+			Updated: atomTime(item.Delivered),
+			Content: &atomText{Type: "text", Body: cmp.Or(item.Rendered, item.Content)},
+			Source:  &atomSource{Title: item.FeedTitle, ID: item.FeedURL},
+		}
+		if !item.Published.IsZero() {
+			entry.Published = atomTime(item.Published)
+		}
+		if item.Link != "" {
+			entry.Link = &atomLink{Href: item.Link}
+		}
+		if item.Rendered != "" && item.Content != "" {
+			entry.Summary = &atomText{Type: "text", Body: item.Content}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// JSON renders f as a JSON Feed 1.1 document. The content of an item is the
+// message text the item was delivered as.
+func JSON(f Feed) ([]byte, error) {
+	doc := jsonfeed.Feed{
+		Version: jsonfeed.Version,
+		Title:   f.Title,
+		FeedURL: f.URL,
+		Items:   make([]jsonfeed.Item, 0, len(f.Items)),
+	}
+	for _, item := range f.Items {
+		doc.Items = append(doc.Items, jsonfeed.Item{
+			ID:            itemID(item),
+			URL:           item.Link,
+			Title:         itemTitle(item),
+			ContentText:   cmp.Or(item.Rendered, item.Content),
+			DatePublished: item.Delivered,
+			ExternalURL:   item.Link,
+		})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// ETag returns a strong entity tag for a rendered feed.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// itemID returns the GUID of an item if it can be used as an Atom ID, which
+// must be an absolute IRI, and an URN derived from the archive ID otherwise.
+func itemID(item stats.Item) string {
+	if u, err := url.Parse(item.GUID); err == nil && u.Scheme != "" {
+		return item.GUID
+	}
+	return "urn:tgfeed:item:" + strconv.FormatInt(item.ID, 10)
+}
+
+func itemTitle(item stats.Item) string {
+	return cmp.Or(item.Title, item.Link, item.GUID)
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,89 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package republish
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+var testFeed = Feed{
+	Title: "tgfeed: Go Blog",
+	URL:   "https://tgfeed.example.com/feeds/atom?feed=https%3A%2F%2Fgo.dev%2Fblog%2Ffeed.atom",
+	Items: []stats.Item{
+		{
+			ID:        2,
+			FeedURL:   "https://go.dev/blog/feed.atom",
+			FeedTitle: "Go Blog",
+			GUID:      "tag:blog.golang.org,2013:blog.golang.org/range-functions",
+			Title:     "Range Over Function Types",
+			Link:      "https://go.dev/blog/range-functions",
+			Content:   "A description of range over function types & iterators.",
+			Published: time.Date(2024, time.August, 20, 0, 0, 0, 0, time.UTC),
+			Delivered: time.Date(2024, time.August, 20, 12, 0, 0, 0, time.UTC),
+			Rendered:  "**Range Over Function Types**\nhttps://go.dev/blog/range-functions",
+		},
+		{
+			ID:        1,
+			FeedURL:   "https://go.dev/blog/feed.atom",
+			FeedTitle: "Go Blog",
+			GUID:      "1234",
+			Link:      "https://go.dev/blog/untitled",
+			Content:   "An item without a title and a usable GUID.",
+			Delivered: time.Date(2024, time.August, 19, 12, 0, 0, 0, time.UTC),
+		},
+	},
+}
+
+func TestRender(t *testing.T) {
+	cases := map[string]func(Feed) ([]byte, error){
+		"atom": Atom,
+		"json": JSON,
+	}
+	for name, render := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := render(testFeed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenFile := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(goldenFile, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testutil.AssertEqual(t, string(got), string(want))
+		})
+	}
+}
+
+func TestUpdated(t *testing.T) {
+	testutil.AssertEqual(t, testFeed.Updated(), time.Date(2024, time.August, 20, 12, 0, 0, 0, time.UTC))
+	testutil.AssertEqual(t, Feed{}.Updated(), time.Time{})
+}
+
+func TestETag(t *testing.T) {
+	a, b := ETag([]byte("a")), ETag([]byte("b"))
+	if a == b {
+		t.Fatalf("ETag of different bodies is the same: %s", a)
+	}
+	testutil.AssertEqual(t, ETag([]byte("a")), a)
+	testutil.AssertEqual(t, len(a), 34)
+}
@@ -0,0 +1,178 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package retry
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Defaults used by [DefaultPolicy].
+const (
+	DefaultMaxRetries  = 3
+	DefaultInitialWait = 5 * time.Second
+	DefaultMaxWait     = 5 * time.Minute
+)
+
+// Curve selects how the wait time grows between retries.
+type Curve int
+
+// Supported backoff curves.
+const (
+	Constant Curve = iota
+	Linear
+	Exponential
+)
+
+var curveNames = map[string]Curve{
+	"constant":    Constant,
+	"linear":      Linear,
+	"exponential": Exponential,
+}
+
+// ParseCurve parses a backoff curve name: "constant", "linear" or
+// "exponential".
+func ParseCurve(name string) (Curve, error) {
+	c, ok := curveNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown backoff curve %q, want constant, linear or exponential", name)
+	}
+	return c, nil
+}
+
+// Reason explains why a retry decision was made.
+type Reason string
+
+// Retry decision reasons.
+const (
+	// ReasonHostHandler means a built-in handler for the host parsed the wait
+	// time from the response body.
+	ReasonHostHandler Reason = "host_handler"
+	// ReasonWaitPattern means [Policy.WaitPattern] matched the response body.
+	ReasonWaitPattern Reason = "wait_pattern"
+	// ReasonRetryAfter means the server sent a Retry-After header.
+	ReasonRetryAfter Reason = "retry_after"
+	// ReasonStatus means the response status is considered transient.
+	ReasonStatus Reason = "status"
+	// ReasonNetwork means the request failed with a transient network error.
+	ReasonNetwork Reason = "network"
+)
+
+// Policy describes how failed requests to a single host are retried.
+type Policy struct {
+	// MaxRetries is the number of retries allowed after the first attempt.
+	MaxRetries int
+	// Curve selects how the backoff grows between retries.
+	Curve Curve
+	// InitialWait is the backoff before the first retry.
+	InitialWait time.Duration
+	// MaxWait caps the backoff. A server asking to wait longer than MaxWait
+	// makes the request fail instead.
+	MaxWait time.Duration
+	// WaitPattern, if set, is matched against error response bodies. Its first
+	// submatch is the wait time, either in seconds or as a Go duration.
+	WaitPattern *regexp.Regexp
+	// TransientStatus lists status codes retried with backoff. If empty, all
+	// 5xx status codes are.
+	TransientStatus []int
+}
+
+// DefaultPolicy returns the policy used for hosts without explicit
+// configuration.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MaxRetries:  DefaultMaxRetries,
+		Curve:       Constant,
+		InitialWait: DefaultInitialWait,
+		MaxWait:     DefaultMaxWait,
+	}
+}
+
+// Backoff returns the wait before retry number attempt, counting from zero.
+func (p *Policy) Backoff(attempt int) time.Duration {
+	wait := p.InitialWait
+	switch p.Curve {
+	case Linear:
+		wait *= time.Duration(attempt + 1)
+	case Exponential:
+		// Stop doubling early so large attempt numbers can't overflow.
+		for range min(attempt, 32) {
+			wait *= 2
+			if wait >= p.MaxWait {
+				break
+			}
+		}
+	}
+	if p.MaxWait > 0 {
+		wait = min(wait, p.MaxWait)
+	}
+	return wait
+}
+
+// Decision describes whether and when a failed request should be retried.
+type Decision struct {
+	// Retry reports whether the request should be retried.
+	Retry bool
+	// Wait is the wait requested by the server. Zero means the policy backoff
+	// applies.
+	Wait time.Duration
+	// Reason explains the decision.
+	Reason Reason
+}
+
+// Decide inspects a failed response from host and reports whether it should
+// be retried.
+func (p *Policy) Decide(host string, status int, header http.Header, body []byte) Decision {
+	if body != nil {
+		if wait, ok := Retryable(host, body); ok {
+			return Decision{Retry: true, Wait: wait, Reason: ReasonHostHandler}
+		}
+		if wait, ok := p.matchWait(body); ok {
+			return Decision{Retry: true, Wait: wait, Reason: ReasonWaitPattern}
+		}
+	}
+
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		// A Retry-After longer than MaxWait would block a fetch worker for too
+		// long, so fall back to the transient status handling below.
+		if wait, ok := RetryAfter(header.Get("Retry-After")); ok && wait <= p.MaxWait {
+			return Decision{Retry: true, Wait: wait, Reason: ReasonRetryAfter}
+		}
+	}
+
+	if p.isTransient(status) {
+		return Decision{Retry: true, Reason: ReasonStatus}
+	}
+	return Decision{}
+}
+
+func (p *Policy) isTransient(status int) bool {
+	if len(p.TransientStatus) == 0 {
+		return status >= 500 && status < 600
+	}
+	return slices.Contains(p.TransientStatus, status)
+}
+
+func (p *Policy) matchWait(body []byte) (time.Duration, bool) {
+	if p.WaitPattern == nil {
+		return 0, false
+	}
+	m := p.WaitPattern.FindSubmatch(body)
+	if len(m) < 2 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(string(m[1])); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if d, err := time.ParseDuration(string(m[1])); err == nil && d >= 0 {
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,148 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package retry
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		curve Curve
+		want  []time.Duration
+	}{
+		"constant":    {Constant, []time.Duration{time.Second, time.Second, time.Second, time.Second}},
+		"linear":      {Linear, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second}},
+		"exponential": {Exponential, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := &Policy{Curve: tc.curve, InitialWait: time.Second, MaxWait: 5 * time.Second}
+			var got []time.Duration
+			for attempt := range len(tc.want) {
+				got = append(got, p.Backoff(attempt))
+			}
+			testutil.AssertEqual(t, got, tc.want)
+		})
+	}
+}
+
+func TestBackoffLargeAttempt(t *testing.T) {
+	t.Parallel()
+
+	p := &Policy{Curve: Exponential, InitialWait: time.Second, MaxWait: time.Hour}
+	testutil.AssertEqual(t, p.Backoff(1000), time.Hour)
+}
+
+func TestParseCurve(t *testing.T) {
+	t.Parallel()
+
+	c, err := ParseCurve("linear")
+	testutil.AssertEqual(t, err, nil)
+	testutil.AssertEqual(t, c, Linear)
+
+	if _, err := ParseCurve("random"); err == nil {
+		t.Fatal("ParseCurve(\"random\") error = nil, want non-nil")
+	}
+}
+
+func TestDecide(t *testing.T) {
+	t.Parallel()
+
+	custom := &Policy{
+		MaxWait:         time.Minute,
+		WaitPattern:     regexp.MustCompile(`wait (\S+)`),
+		TransientStatus: []int{http.StatusTooManyRequests},
+	}
+
+	cases := map[string]struct {
+		policy     *Policy
+		host       string
+		status     int
+		retryAfter string
+		body       string
+		want       Decision
+	}{
+		"host handler": {
+			policy: DefaultPolicy(),
+			host:   "tg.i-c-a.su",
+			status: http.StatusBadRequest,
+			body:   `{"errors":["FLOOD_WAIT_15"]}`,
+			want:   Decision{Retry: true, Wait: 15 * time.Second, Reason: ReasonHostHandler},
+		},
+		"retry after": {
+			policy:     DefaultPolicy(),
+			status:     http.StatusTooManyRequests,
+			retryAfter: "30",
+			want:       Decision{Retry: true, Wait: 30 * time.Second, Reason: ReasonRetryAfter},
+		},
+		"retry after too long for 503": {
+			policy:     DefaultPolicy(),
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "3600",
+			want:       Decision{Retry: true, Reason: ReasonStatus},
+		},
+		"retry after too long for 429": {
+			policy:     DefaultPolicy(),
+			status:     http.StatusTooManyRequests,
+			retryAfter: "3600",
+			want:       Decision{},
+		},
+		"default 5xx": {
+			policy: DefaultPolicy(),
+			status: http.StatusInternalServerError,
+			want:   Decision{Retry: true, Reason: ReasonStatus},
+		},
+		"default 4xx": {
+			policy: DefaultPolicy(),
+			status: http.StatusNotFound,
+			want:   Decision{},
+		},
+		"wait pattern seconds": {
+			policy: custom,
+			status: http.StatusBadRequest,
+			body:   "please wait 12",
+			want:   Decision{Retry: true, Wait: 12 * time.Second, Reason: ReasonWaitPattern},
+		},
+		"wait pattern duration": {
+			policy: custom,
+			status: http.StatusBadRequest,
+			body:   "please wait 1m30s",
+			want:   Decision{Retry: true, Wait: 90 * time.Second, Reason: ReasonWaitPattern},
+		},
+		"custom transient status": {
+			policy: custom,
+			status: http.StatusTooManyRequests,
+			want:   Decision{Retry: true, Reason: ReasonStatus},
+		},
+		"custom status list excludes 5xx": {
+			policy: custom,
+			status: http.StatusInternalServerError,
+			want:   Decision{},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			header := make(http.Header)
+			if tc.retryAfter != "" {
+				header.Set("Retry-After", tc.retryAfter)
+			}
+			var body []byte
+			if tc.body != "" {
+				body = []byte(tc.body)
+			}
+			testutil.AssertEqual(t, tc.policy.Decide(tc.host, tc.status, header, body), tc.want)
+		})
+	}
+}
@@ -4,6 +4,10 @@
 
 // Package retry implements logic for parsing feed source errors to determine
 // whether a request should be retried later, and if so, what backoff to use.
+//
+// Built-in handlers recognize rate limiting responses of known hosts. A
+// [Policy] layers configurable limits, backoff curves and status handling on
+// top of them.
 package retry
 
 import (
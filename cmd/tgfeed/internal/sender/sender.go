@@ -5,11 +5,34 @@
 // Package sender defines a transport-agnostic message delivery interface.
 package sender
 
-import "context"
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrThreadNotFound is returned by [Sender.Send] when the target thread
+// doesn't exist, for example because a forum topic was deleted.
+var ErrThreadNotFound = errors.New("message thread not found")
 
 // Sender delivers messages to a configured destination.
 type Sender interface {
-	Send(ctx context.Context, msg Message) error
+	Send(ctx context.Context, msg Message) (Receipt, error)
+}
+
+// TopicCreator is implemented by senders that can create named threads, such
+// as Telegram forum topics.
+type TopicCreator interface {
+	// CreateTopic creates a thread named name and returns its identifier,
+	// usable as [Target.Thread].
+	CreateTopic(ctx context.Context, name string) (thread string, err error)
+}
+
+// Receipt describes a delivered message.
+type Receipt struct {
+	// MessageIDs identifies delivered messages in send order. A long message
+	// or a media album can be delivered as several messages.
+	MessageIDs []string
 }
 
 // Message is a transport-agnostic outgoing message.
@@ -19,6 +42,11 @@ type Message struct {
 	Options Options
 	Actions []ActionRow
 	Media   []Media
+
+	// FetchMedia, if set, downloads media by URL for senders that have to
+	// upload it, so that it is fetched with the same HTTP settings as the
+	// source of the message. Otherwise, a plain GET request is made.
+	FetchMedia func(ctx context.Context, url string) (*http.Response, error)
 }
 
 // Media is an optional media attachment.
@@ -2,12 +2,13 @@
 // Use of this source code is governed by the ISC
 // license that can be found in the LICENSE.md file.
 
-// Package state persists tgfeed configuration, per-feed runtime state, and
-// error templates.
+// Package state persists tgfeed configuration, per-feed runtime state, forum
+// topics, message templates, and error templates.
 //
 // Use [NewStore] with [Options] to select where data is stored:
 //
-//   - local files in [Options.StateDir] (config.star, state.json, error.tmpl)
+//   - local files in [Options.StateDir] (config.star, state.json,
+//     topics.json, error.tmpl, and message templates in templates)
 //   - a remote admin API at [Options.RemoteURL]
 //
 // A typical flow is:
@@ -32,12 +33,14 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"go.astrophena.name/base/request"
 	"go.astrophena.name/base/safefile"
 	"go.astrophena.name/base/version"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/doctor"
 )
 
 // Feed stores persisted runtime information for a single feed.
@@ -71,6 +74,10 @@ type Snapshot struct {
 	State map[string]*Feed
 	// ErrorTemplate is the template used for fetch failure notifications.
 	ErrorTemplate string
+	// Topics maps forum topic name to its message thread ID.
+	Topics map[string]int64
+	// Templates maps message template name to its content.
+	Templates map[string]string
 }
 
 // Options configures [NewStore].
@@ -113,7 +120,15 @@ func (s *Store) LoadSnapshot(ctx context.Context) (*Snapshot, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Snapshot{Config: config, State: stateMap, ErrorTemplate: errorTemplate}, nil
+	topics, err := s.LoadTopics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := s.LoadTemplates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Config: config, State: stateMap, ErrorTemplate: errorTemplate, Topics: topics, Templates: templates}, nil
 }
 
 func (s *Store) LoadConfig(ctx context.Context) (string, error) {
@@ -165,6 +180,120 @@ func (s *Store) LoadErrorTemplate(ctx context.Context) (string, error) {
 	return string(b), nil
 }
 
+func (s *Store) LoadTopics(ctx context.Context) (map[string]int64, error) {
+	if s.opts.RemoteURL == "" {
+		topicsBytes, err := os.ReadFile(filepath.Join(s.opts.StateDir, "topics.json"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return UnmarshalTopics(topicsBytes)
+	}
+	b, err := s.fetch(ctx, "/api/topics")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch topics from remote: %w", err)
+	}
+	topics, err := UnmarshalTopics(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse topics JSON: %w", err)
+	}
+	return topics, nil
+}
+
+var templateNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*\.tmpl$`)
+
+// ValidateTemplateName reports whether name can be used as a message template
+// file name: a plain file name with the .tmpl extension.
+func ValidateTemplateName(name string) error {
+	if !templateNameRe.MatchString(name) {
+		return fmt.Errorf("invalid template name %q: want a file name ending with .tmpl", name)
+	}
+	return nil
+}
+
+func (s *Store) LoadTemplates(ctx context.Context) (map[string]string, error) {
+	if s.opts.RemoteURL == "" {
+		templates := make(map[string]string)
+		entries, err := os.ReadDir(filepath.Join(s.opts.StateDir, "templates"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return templates, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || ValidateTemplateName(entry.Name()) != nil {
+				continue
+			}
+			b, err := os.ReadFile(filepath.Join(s.opts.StateDir, "templates", entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			templates[entry.Name()] = string(b)
+		}
+		return templates, nil
+	}
+	b, err := s.fetch(ctx, "/api/templates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch templates from remote: %w", err)
+	}
+	templates := make(map[string]string)
+	if err := json.Unmarshal(b, &templates); err != nil {
+		return nil, fmt.Errorf("failed to parse templates JSON: %w", err)
+	}
+	return templates, nil
+}
+
+// LoadHostChecks runs the host checks of the doctor command on the remote
+// admin API. It is only supported in remote mode, as local callers can run
+// [doctor.HostChecks] directly.
+func (s *Store) LoadHostChecks(ctx context.Context) ([]doctor.Check, error) {
+	if s.opts.RemoteURL == "" {
+		return nil, errors.New("host checks can only be loaded from a remote admin API")
+	}
+	b, err := s.fetch(ctx, "/api/doctor")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch host checks from remote: %w", err)
+	}
+	var checks []doctor.Check
+	if err := json.Unmarshal(b, &checks); err != nil {
+		return nil, fmt.Errorf("failed to parse host checks JSON: %w", err)
+	}
+	return checks, nil
+}
+
+// LoadBackup downloads a backup archive of the state directory from the
+// remote admin API. It is only supported in remote mode, as local callers can
+// create archives directly.
+func (s *Store) LoadBackup(ctx context.Context) ([]byte, error) {
+	if s.opts.RemoteURL == "" {
+		return nil, errors.New("backups can only be loaded from a remote admin API")
+	}
+	b, err := s.fetch(ctx, "/api/backup")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch backup from remote: %w", err)
+	}
+	return b, nil
+}
+
+// RestoreBackup uploads a backup archive to the remote admin API, replacing
+// the remote state directory. It is only supported in remote mode.
+func (s *Store) RestoreBackup(ctx context.Context, archive []byte) error {
+	if s.opts.RemoteURL == "" {
+		return errors.New("backups can only be restored to a remote admin API")
+	}
+	_, err := request.Make[request.IgnoreResponse](ctx, request.Params{Method: http.MethodPut, URL: s.apiURL("/api/backup"), Body: archive, Headers: map[string]string{"Content-Type": "application/gzip", "User-Agent": version.UserAgent()}, WantStatusCode: http.StatusNoContent, HTTPClient: s.httpClient()})
+	if err != nil {
+		if statusErr, ok := errors.AsType[*request.StatusError](err); ok {
+			var errResp *errorResponse
+			if jsonErr := json.Unmarshal(statusErr.Body, &errResp); jsonErr == nil {
+				err = errors.New(errResp.Error)
+			}
+		}
+		return fmt.Errorf("failed to restore backup to remote: %w", err)
+	}
+	return nil
+}
+
 func (s *Store) fetch(ctx context.Context, url string) ([]byte, error) {
 	b, err := request.Make[request.Bytes](ctx, request.Params{Method: http.MethodGet, Headers: map[string]string{"User-Agent": version.UserAgent()}, URL: s.apiURL(url), HTTPClient: s.httpClient()})
 	if err != nil {
@@ -198,6 +327,55 @@ func (s *Store) SaveStateJSON(ctx context.Context, content []byte) error {
 	return nil
 }
 
+func (s *Store) SaveTopics(ctx context.Context, topics map[string]int64) error {
+	content, err := json.MarshalIndent(topics, "", "  ")
+	if err != nil {
+		return err
+	}
+	if s.opts.RemoteURL == "" {
+		return safefile.WriteFile(filepath.Join(s.opts.StateDir, "topics.json"), content, 0o644)
+	}
+	_, err = request.Make[request.IgnoreResponse](ctx, request.Params{Method: http.MethodPut, URL: s.apiURL("/api/topics"), Body: content, Headers: map[string]string{"Content-Type": "application/json", "User-Agent": version.UserAgent()}, WantStatusCode: http.StatusNoContent, HTTPClient: s.httpClient()})
+	if err != nil {
+		return fmt.Errorf("failed to save topics to remote: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) SaveTemplate(ctx context.Context, name, content string) error {
+	if err := ValidateTemplateName(name); err != nil {
+		return err
+	}
+	if s.opts.RemoteURL == "" {
+		dir := filepath.Join(s.opts.StateDir, "templates")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		return safefile.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+	}
+	_, err := request.Make[request.IgnoreResponse](ctx, request.Params{Method: http.MethodPut, URL: s.apiURL("/api/templates/" + name), Body: []byte(content), Headers: map[string]string{"Content-Type": "text/plain", "User-Agent": version.UserAgent()}, WantStatusCode: http.StatusNoContent, HTTPClient: s.httpClient()})
+	if err != nil {
+		return fmt.Errorf("failed to save template to remote: %w", err)
+	}
+	return nil
+}
+
+// DeleteTemplate removes a message template. It returns an error wrapping
+// [fs.ErrNotExist] if the template doesn't exist locally.
+func (s *Store) DeleteTemplate(ctx context.Context, name string) error {
+	if err := ValidateTemplateName(name); err != nil {
+		return err
+	}
+	if s.opts.RemoteURL == "" {
+		return os.Remove(filepath.Join(s.opts.StateDir, "templates", name))
+	}
+	_, err := request.Make[request.IgnoreResponse](ctx, request.Params{Method: http.MethodDelete, URL: s.apiURL("/api/templates/" + name), Headers: map[string]string{"User-Agent": version.UserAgent()}, WantStatusCode: http.StatusNoContent, HTTPClient: s.httpClient()})
+	if err != nil {
+		return fmt.Errorf("failed to delete template from remote: %w", err)
+	}
+	return nil
+}
+
 func (s *Store) SaveConfig(ctx context.Context, config string) error {
 	if s.opts.RemoteURL == "" {
 		return safefile.WriteFile(filepath.Join(s.opts.StateDir, "config.star"), []byte(config), 0o644)
@@ -239,6 +417,20 @@ func UnmarshalStateMap(b []byte) (map[string]*Feed, error) {
 	return stateMap, nil
 }
 
+// UnmarshalTopics decodes the forum topic map.
+//
+// Empty input returns an empty map.
+func UnmarshalTopics(b []byte) (map[string]int64, error) {
+	topics := make(map[string]int64)
+	if len(b) == 0 {
+		return topics, nil
+	}
+	if err := json.Unmarshal(b, &topics); err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
 func (s *Store) httpClient() *http.Client {
 	if strings.HasPrefix(s.opts.RemoteURL, "/") {
 		return &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
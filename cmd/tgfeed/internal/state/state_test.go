@@ -5,6 +5,8 @@
 package state
 
 import (
+	"errors"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -47,6 +49,59 @@ func TestStateMapRoundtrip(t *testing.T) {
 	testutil.AssertEqual(t, got, input)
 }
 
+func TestStoreTopicsRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	store := NewStore(Options{StateDir: t.TempDir()})
+	topics, err := store.LoadTopics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, topics, map[string]int64{})
+
+	want := map[string]int64{"Releases": 42, "Errors": 7}
+	if err := store.SaveTopics(t.Context(), want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.LoadTopics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, got, want)
+}
+
+func TestStoreTemplates(t *testing.T) {
+	t.Parallel()
+
+	store := NewStore(Options{StateDir: t.TempDir()})
+	templates, err := store.LoadTemplates(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, templates, map[string]string{})
+
+	if err := store.SaveTemplate(t.Context(), "release.tmpl", "{{.Item.Title}}"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../config.star", "release", ".tmpl", "sub/release.tmpl"} {
+		if err := store.SaveTemplate(t.Context(), name, ""); err == nil {
+			t.Errorf("SaveTemplate(%q) succeeded, want error", name)
+		}
+	}
+	templates, err = store.LoadTemplates(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, templates, map[string]string{"release.tmpl": "{{.Item.Title}}"})
+
+	if err := store.DeleteTemplate(t.Context(), "release.tmpl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteTemplate(t.Context(), "release.tmpl"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("DeleteTemplate() error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
 func TestStoreRemoteErrorPropagation(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,230 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Item is a feed item archived after it was delivered.
+type Item struct {
+	ID        int64     `json:"id"`
+	FeedURL   string    `json:"feed_url"`
+	FeedTitle string    `json:"feed_title,omitempty"`
+	GUID      string    `json:"guid"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link,omitempty"`
+	Content   string    `json:"content,omitempty"`
+	Published time.Time `json:"published,omitzero"`
+	Delivered time.Time `json:"delivered"`
+	// MessageID identifies the first message the item was delivered in.
+	MessageID string `json:"message_id,omitempty"`
+	// ThreadID is the message thread (topic) the item was delivered to, or
+	// zero for the main chat.
+	ThreadID int64 `json:"message_thread_id,omitempty"`
+	// Rendered is the message text the item was delivered as. In digest
+	// mode, it is shared by all items of the digest.
+	Rendered string `json:"rendered,omitempty"`
+	// Snippet is an excerpt of the content around search matches, with
+	// matches wrapped in ** markers. It is set only by search queries.
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// ItemQuery selects archived items returned by [Store.SearchItems].
+type ItemQuery struct {
+	// Query is a full-text search query. Terms are matched as whole words,
+	// or as prefixes when followed by '*'. An empty query lists the latest
+	// items.
+	Query string
+	// FeedURL limits results to a single feed when non-empty.
+	FeedURL string
+	// ThreadID limits results to a single message thread when non-nil.
+	ThreadID *int64
+	// Before limits results to items delivered before this Unix time when
+	// non-zero.
+	Before int64
+	// Limit is the maximum number of items returned.
+	Limit int
+}
+
+// ArchiveItems stores delivered items. Items that are already archived, for
+// example after a retried delivery, are replaced.
+func (s *Store) ArchiveItems(ctx context.Context, items []Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	db, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, item := range items {
+		var published sql.NullInt64
+		if !item.Published.IsZero() {
+			published = sql.NullInt64{Int64: item.Published.Unix(), Valid: true}
+		}
+		var id int64
+		if err := tx.QueryRowContext(ctx, `INSERT INTO items(feed_url, feed_title, guid, title, link, content, published_at_unix, delivered_at_unix, message_id, message_thread_id, rendered)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(feed_url, guid) DO UPDATE SET
+  feed_title = excluded.feed_title,
+  title = excluded.title,
+  link = excluded.link,
+  content = excluded.content,
+  published_at_unix = excluded.published_at_unix,
+  delivered_at_unix = excluded.delivered_at_unix,
+  message_id = excluded.message_id,
+  message_thread_id = excluded.message_thread_id,
+  rendered = excluded.rendered
+RETURNING id;`,
+			item.FeedURL, item.FeedTitle, item.GUID, item.Title, item.Link, item.Content,
+			published, item.Delivered.Unix(), item.MessageID, item.ThreadID, item.Rendered,
+		).Scan(&id); err != nil {
+			return fmt.Errorf("archiving item %q: %w", item.GUID, err)
+		}
+		// The full-text index is maintained here rather than with triggers so
+		// that migrations stay plain semicolon-separated statements.
+		if _, err := tx.ExecContext(ctx, `DELETE FROM items_fts WHERE rowid = ?;`, id); err != nil {
+			return fmt.Errorf("indexing item %q: %w", item.GUID, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO items_fts(rowid, title, content, feed_title) VALUES(?, ?, ?, ?);`,
+			id, item.Title, item.Content, item.FeedTitle,
+		); err != nil {
+			return fmt.Errorf("indexing item %q: %w", item.GUID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SearchItems returns archived items matching q. Search results are ordered
+// by relevance, and listings without a query by delivery time, newest first.
+func (s *Store) SearchItems(ctx context.Context, q ItemQuery) ([]Item, error) {
+	db, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	match := ftsQuery(q.Query)
+	var (
+		query string
+		args  []any
+		where []string
+	)
+	if match != "" {
+		query = `SELECT items.id, feed_url, items.feed_title, guid, items.title, link, items.content, published_at_unix, delivered_at_unix, message_id, message_thread_id, rendered,
+  snippet(items_fts, 1, '**', '**', '…', 24)
+FROM items_fts JOIN items ON items.id = items_fts.rowid`
+		where = append(where, `items_fts MATCH ?`)
+		args = append(args, match)
+	} else {
+		query = `SELECT id, feed_url, feed_title, guid, title, link, content, published_at_unix, delivered_at_unix, message_id, message_thread_id, rendered, ''
+FROM items`
+	}
+	if q.FeedURL != "" {
+		where = append(where, `feed_url = ?`)
+		args = append(args, q.FeedURL)
+	}
+	if q.ThreadID != nil {
+		where = append(where, `message_thread_id = ?`)
+		args = append(args, *q.ThreadID)
+	}
+	if q.Before != 0 {
+		where = append(where, `delivered_at_unix < ?`)
+		args = append(args, q.Before)
+	}
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	if match != "" {
+		query += ` ORDER BY rank, delivered_at_unix DESC`
+	} else {
+		query += ` ORDER BY delivered_at_unix DESC, id DESC`
+	}
+	query += ` LIMIT ?;`
+	args = append(args, normalizeLimit(q.Limit))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Item
+	for rows.Next() {
+		var (
+			item      Item
+			published sql.NullInt64
+			delivered int64
+		)
+		if err := rows.Scan(
+			&item.ID,
+			&item.FeedURL,
+			&item.FeedTitle,
+			&item.GUID,
+			&item.Title,
+			&item.Link,
+			&item.Content,
+			&published,
+			&delivered,
+			&item.MessageID,
+			&item.ThreadID,
+			&item.Rendered,
+			&item.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		if published.Valid {
+			item.Published = time.Unix(published.Int64, 0).UTC()
+		}
+		item.Delivered = time.Unix(delivered, 0).UTC()
+		res = append(res, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// pruneItems deletes items delivered before cutoff.
+func pruneItems(ctx context.Context, tx *sql.Tx, cutoff int64) (int64, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM items_fts WHERE rowid IN (SELECT id FROM items WHERE delivered_at_unix < ?);`, cutoff); err != nil {
+		return 0, err
+	}
+	del, err := tx.ExecContext(ctx, `DELETE FROM items WHERE delivered_at_unix < ?;`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return del.RowsAffected()
+}
+
+// ftsQuery converts a user search query into an FTS5 query that can't fail
+// to parse: every term is quoted, so operators and punctuation are matched
+// literally, except for a trailing '*' that makes the term a prefix query.
+func ftsQuery(q string) string {
+	var terms []string
+	for term := range strings.FieldsSeq(q) {
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.TrimRight(term, "*")
+		if term == "" {
+			continue
+		}
+		term = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,144 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+)
+
+func TestStoreSearchItems(t *testing.T) {
+	t.Parallel()
+
+	store := OpenMemory(t.Name())
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Fatalf("closing stats store: %v", err)
+		}
+	})
+	if err := store.Bootstrap(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, time.March, 31, 12, 0, 0, 0, time.UTC)
+	items := []Item{
+		{FeedURL: "https://a.example/feed", FeedTitle: "Go Blog", GUID: "1", Title: "Range over functions", Content: "Iterators arrive in Go, and range over iterators.", Delivered: now.Add(-3 * time.Hour), MessageID: "10"},
+		{FeedURL: "https://a.example/feed", FeedTitle: "Go Blog", GUID: "2", Title: "Generic aliases", Content: "Type parameters for aliases.", Delivered: now.Add(-2 * time.Hour), MessageID: "11"},
+		{FeedURL: "https://b.example/feed", FeedTitle: "Café", GUID: "1", Title: "Espresso", Content: "About iterators of coffee beans.", Published: now.Add(-48 * time.Hour), Delivered: now.Add(-time.Hour), ThreadID: 7, Rendered: "*Espresso*"},
+	}
+	if err := store.ArchiveItems(t.Context(), items); err != nil {
+		t.Fatal(err)
+	}
+	// Archiving an item again replaces it.
+	items[1].Title = "Generic type aliases"
+	if err := store.ArchiveItems(t.Context(), items[1:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	guids := func(items []Item) []string {
+		var res []string
+		for _, item := range items {
+			res = append(res, item.FeedURL+"#"+item.GUID)
+		}
+		return res
+	}
+
+	cases := map[string]struct {
+		q    ItemQuery
+		want []string
+	}{
+		"latest": {
+			want: []string{"https://b.example/feed#1", "https://a.example/feed#2", "https://a.example/feed#1"},
+		},
+		"word": {
+			q:    ItemQuery{Query: "iterators"},
+			want: []string{"https://a.example/feed#1", "https://b.example/feed#1"},
+		},
+		"prefix": {
+			q:    ItemQuery{Query: "alia*"},
+			want: []string{"https://a.example/feed#2"},
+		},
+		"replaced title": {
+			q:    ItemQuery{Query: "type aliases"},
+			want: []string{"https://a.example/feed#2"},
+		},
+		"feed title without diacritics": {
+			q:    ItemQuery{Query: "cafe"},
+			want: []string{"https://b.example/feed#1"},
+		},
+		"feed filter": {
+			q:    ItemQuery{Query: "iterators", FeedURL: "https://b.example/feed"},
+			want: []string{"https://b.example/feed#1"},
+		},
+		"thread": {
+			q:    ItemQuery{ThreadID: new(int64(7))},
+			want: []string{"https://b.example/feed#1"},
+		},
+		"main chat": {
+			q:    ItemQuery{ThreadID: new(int64(0))},
+			want: []string{"https://a.example/feed#2", "https://a.example/feed#1"},
+		},
+		"before": {
+			q:    ItemQuery{Before: now.Add(-90 * time.Minute).Unix()},
+			want: []string{"https://a.example/feed#2", "https://a.example/feed#1"},
+		},
+		"limit": {
+			q:    ItemQuery{Limit: 1},
+			want: []string{"https://b.example/feed#1"},
+		},
+		"operators are literal": {
+			q: ItemQuery{Query: `"NEAR( OR -`},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := store.SearchItems(t.Context(), tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, guids(got), tc.want)
+		})
+	}
+
+	got, err := store.SearchItems(t.Context(), ItemQuery{Query: "coffee"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, len(got), 1)
+	testutil.AssertEqual(t, got[0].Snippet, "About iterators of **coffee** beans.")
+	testutil.AssertEqual(t, got[0].Published, now.Add(-48*time.Hour))
+	testutil.AssertEqual(t, got[0].ThreadID, int64(7))
+	testutil.AssertEqual(t, got[0].Rendered, "*Espresso*")
+
+	res, err := store.ApplyRetention(t.Context(), Retention{Items: 150 * time.Minute}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, res, RetentionResult{ItemsPruned: 1})
+	got, err = store.SearchItems(t.Context(), ItemQuery{Query: "iterators"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, guids(got), []string{"https://b.example/feed#1"})
+}
+
+func TestFTSQuery(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"":                "",
+		"go iterators":    `"go" "iterators"`,
+		"iter*":           `"iter"*`,
+		`say "hi"`:        `"say" """hi"""`,
+		"*":               "",
+		"a OR b":          `"a" "OR" "b"`,
+		"  spaced   out ": `"spaced" "out"`,
+	}
+	for in, want := range cases {
+		testutil.AssertEqual(t, ftsQuery(in), want)
+	}
+}
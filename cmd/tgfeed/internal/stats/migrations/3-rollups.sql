@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS rollups (
+  period TEXT NOT NULL CHECK (period IN ('hour', 'day')),
+  bucket_start_unix INTEGER NOT NULL,
+  run_count INTEGER NOT NULL,
+  duration_ms_total INTEGER NOT NULL,
+  duration_ms_max INTEGER NOT NULL,
+  total_feeds_max INTEGER NOT NULL,
+  success_feeds INTEGER NOT NULL,
+  failed_feeds INTEGER NOT NULL,
+  not_modified_feeds INTEGER NOT NULL,
+  items_enqueued INTEGER NOT NULL,
+  messages_sent INTEGER NOT NULL,
+  messages_failed INTEGER NOT NULL,
+  fetch_retries INTEGER NOT NULL,
+  fetch_latency_p90_max INTEGER NOT NULL,
+  memory_usage_max INTEGER NOT NULL,
+  PRIMARY KEY (period, bucket_start_unix)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS rollups_period_started_desc_idx ON rollups(period, bucket_start_unix DESC)
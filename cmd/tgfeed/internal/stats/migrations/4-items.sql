@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS items (
+  id INTEGER PRIMARY KEY,
+  feed_url TEXT NOT NULL,
+  feed_title TEXT NOT NULL,
+  guid TEXT NOT NULL,
+  title TEXT NOT NULL,
+  link TEXT NOT NULL,
+  content TEXT NOT NULL,
+  published_at_unix INTEGER,
+  delivered_at_unix INTEGER NOT NULL,
+  message_id TEXT NOT NULL,
+  UNIQUE (feed_url, guid)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS items_delivered_desc_idx ON items(delivered_at_unix DESC);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS items_fts USING fts5(
+  title,
+  content,
+  feed_title,
+  tokenize = 'unicode61 remove_diacritics 2'
+)
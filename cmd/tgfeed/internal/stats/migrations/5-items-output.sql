@@ -0,0 +1,7 @@
+ALTER TABLE items ADD COLUMN message_thread_id INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE items ADD COLUMN rendered TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS items_thread_delivered_desc_idx ON items(message_thread_id, delivered_at_unix DESC);
+
+CREATE INDEX IF NOT EXISTS items_feed_delivered_desc_idx ON items(feed_url, delivered_at_unix DESC)
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS translations (
+  feed_url TEXT NOT NULL,
+  guid TEXT NOT NULL,
+  language TEXT NOT NULL,
+  title TEXT NOT NULL,
+  summary TEXT NOT NULL,
+  created_at_unix INTEGER NOT NULL,
+  PRIMARY KEY (feed_url, guid, language)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS translations_created_idx ON translations(created_at_unix)
@@ -54,6 +54,12 @@ type Run struct {
 	MessagesFailed           int `json:"messages_failed"`
 	MessagesFormattingFailed int `json:"messages_formatting_failed"`
 
+	ItemsTranslated      int   `json:"items_translated"`
+	TranslationCacheHits int   `json:"translation_cache_hits"`
+	TranslationsFailed   int   `json:"translations_failed"`
+	LLMInputTokens       int64 `json:"llm_input_tokens"`
+	LLMOutputTokens      int64 `json:"llm_output_tokens"`
+
 	FetchRetriesTotal       int           `json:"fetch_retries_total"`
 	FeedsRetriedCount       int           `json:"feeds_retried_count"`
 	BackoffSleepTotal       time.Duration `json:"backoff_sleep_total"`
@@ -157,16 +163,44 @@ type FeedStats struct {
 	ItemsEnqueued   int
 	Retries         int
 	LastStatusClass int
+	RetryDecisions  []RetryDecision
+}
+
+// RetryDecision records one decision to retry or give up on a failed fetch.
+type RetryDecision struct {
+	URL     string        `json:"url"`
+	Host    string        `json:"host"`
+	Attempt int           `json:"attempt"`
+	Reason  string        `json:"reason"`
+	Wait    time.Duration `json:"wait"`
+	Outcome RetryOutcome  `json:"outcome"`
+}
+
+// RetryOutcome describes what happened after a retry was requested.
+type RetryOutcome string
+
+// Retry outcomes.
+const (
+	RetryOutcomeRetried    RetryOutcome = "retried"
+	RetryOutcomeRetryLimit RetryOutcome = "retry_limit"
+	RetryOutcomeMaxWait    RetryOutcome = "max_wait"
+)
+
+// RecordRetryDecision stores d in the statistics of its feed.
+func (r *Run) RecordRetryDecision(d RetryDecision) {
+	fs := r.FeedStats(d.URL)
+	fs.RetryDecisions = append(fs.RetryDecisions, d)
 }
 
 // FeedStatsSummary stores feed metrics exposed in the public JSON payload.
 type FeedStatsSummary struct {
-	URL             string        `json:"url"`
-	FetchDuration   time.Duration `json:"fetch_duration"`
-	Failures        int           `json:"failures"`
-	ItemsEnqueued   int           `json:"items_enqueued"`
-	Retries         int           `json:"retries"`
-	LastStatusClass int           `json:"last_status_class"`
+	URL             string          `json:"url"`
+	FetchDuration   time.Duration   `json:"fetch_duration"`
+	Failures        int             `json:"failures"`
+	ItemsEnqueued   int             `json:"items_enqueued"`
+	Retries         int             `json:"retries"`
+	LastStatusClass int             `json:"last_status_class"`
+	RetryDecisions  []RetryDecision `json:"retry_decisions,omitempty"`
 }
 
 // FeedItemDecisionReason classifies why an item was skipped.
@@ -230,6 +264,7 @@ func TopFeedStats(input map[string]*FeedStats, less func(a *FeedStats, b *FeedSt
 			ItemsEnqueued:   item.ItemsEnqueued,
 			Retries:         item.Retries,
 			LastStatusClass: item.LastStatusClass,
+			RetryDecisions:  item.RetryDecisions,
 		})
 	}
 	return result
@@ -46,3 +46,23 @@ func TestRunFinalizeRequestTimingStats(t *testing.T) {
 	testutil.AssertEqual(t, run.RequestTiming.Total.TotalMS, int64(300))
 	testutil.AssertEqual(t, run.RequestTiming.Total.AvgMS, int64(150))
 }
+
+func TestRunRecordRetryDecision(t *testing.T) {
+	t.Parallel()
+
+	run := &Run{}
+	d := RetryDecision{
+		URL:     "https://example.com/feed.xml",
+		Host:    "example.com",
+		Attempt: 1,
+		Reason:  "status",
+		Wait:    5 * time.Second,
+		Outcome: RetryOutcomeRetried,
+	}
+	run.RecordRetryDecision(d)
+
+	testutil.AssertEqual(t, run.FeedStats(d.URL).RetryDecisions, []RetryDecision{d})
+
+	top := TopFeedStats(run.FeedStatsByURL, func(a, b *FeedStats) int { return 0 })
+	testutil.AssertEqual(t, top[0].RetryDecisions, []RetryDecision{d})
+}
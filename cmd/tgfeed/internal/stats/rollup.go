@@ -0,0 +1,267 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package stats
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Period is the length of a rollup bucket.
+type Period string
+
+// Rollup periods.
+const (
+	PeriodHour Period = "hour"
+	PeriodDay  Period = "day"
+)
+
+// ParsePeriod parses a rollup period name.
+func ParsePeriod(s string) (Period, error) {
+	switch p := Period(s); p {
+	case PeriodHour, PeriodDay:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown stats period %q, want %q or %q", s, PeriodHour, PeriodDay)
+}
+
+func (p Period) seconds() int64 {
+	if p == PeriodDay {
+		return 24 * 60 * 60
+	}
+	return 60 * 60
+}
+
+// Rollup aggregates runs that started within one bucket. Counters are summed
+// over the runs, and fields suffixed with Max hold the maximum.
+type Rollup struct {
+	Period          Period    `json:"period"`
+	BucketStartUnix int64     `json:"bucket_start_unix"`
+	BucketStart     time.Time `json:"bucket_start"`
+	RunCount        int       `json:"run_count"`
+
+	DurationMSTotal int64 `json:"duration_ms_total"`
+	DurationMSMax   int64 `json:"duration_ms_max"`
+
+	TotalFeedsMax    int `json:"total_feeds_max"`
+	SuccessFeeds     int `json:"success_feeds"`
+	FailedFeeds      int `json:"failed_feeds"`
+	NotModifiedFeeds int `json:"not_modified_feeds"`
+	ItemsEnqueued    int `json:"items_enqueued"`
+	MessagesSent     int `json:"messages_sent"`
+	MessagesFailed   int `json:"messages_failed"`
+	FetchRetries     int `json:"fetch_retries"`
+
+	FetchLatencyP90MSMax int64  `json:"fetch_latency_p90_ms_max"`
+	MemoryUsageMax       uint64 `json:"memory_usage_max"`
+}
+
+// Retention controls how long stats are kept at each resolution.
+type Retention struct {
+	// Raw is how long individual runs are kept before being rolled up into
+	// hourly buckets. Zero keeps them forever.
+	Raw time.Duration
+	// Hourly is how long hourly buckets are kept before being rolled up into
+	// daily ones. Daily buckets are kept forever. Zero keeps hourly buckets
+	// forever.
+	Hourly time.Duration
+	// Items is how long archived items and cached translations are kept.
+	// Zero keeps them forever.
+	Items time.Duration
+}
+
+// DefaultRetention is the retention used unless configured otherwise.
+var DefaultRetention = Retention{
+	Raw:    30 * 24 * time.Hour,
+	Hourly: 180 * 24 * time.Hour,
+	Items:  365 * 24 * time.Hour,
+}
+
+// RetentionResult reports what [Store.ApplyRetention] did.
+type RetentionResult struct {
+	RunsRolledUp       int64
+	HourlyRolledUp     int64
+	ItemsPruned        int64
+	TranslationsPruned int64
+}
+
+// Columns merged when rows land in an existing bucket.
+const rollupUpsert = `
+ON CONFLICT(period, bucket_start_unix) DO UPDATE SET
+  run_count = run_count + excluded.run_count,
+  duration_ms_total = duration_ms_total + excluded.duration_ms_total,
+  duration_ms_max = max(duration_ms_max, excluded.duration_ms_max),
+  total_feeds_max = max(total_feeds_max, excluded.total_feeds_max),
+  success_feeds = success_feeds + excluded.success_feeds,
+  failed_feeds = failed_feeds + excluded.failed_feeds,
+  not_modified_feeds = not_modified_feeds + excluded.not_modified_feeds,
+  items_enqueued = items_enqueued + excluded.items_enqueued,
+  messages_sent = messages_sent + excluded.messages_sent,
+  messages_failed = messages_failed + excluded.messages_failed,
+  fetch_retries = fetch_retries + excluded.fetch_retries,
+  fetch_latency_p90_max = max(fetch_latency_p90_max, excluded.fetch_latency_p90_max),
+  memory_usage_max = max(memory_usage_max, excluded.memory_usage_max);`
+
+const rollupColumns = `period, bucket_start_unix, run_count, duration_ms_total, duration_ms_max,
+  total_feeds_max, success_feeds, failed_feeds, not_modified_feeds, items_enqueued,
+  messages_sent, messages_failed, fetch_retries, fetch_latency_p90_max, memory_usage_max`
+
+// ApplyRetention rolls runs and hourly buckets that are older than r allows
+// up into coarser buckets and deletes them, as of now. Archived items older
+// than r allows are deleted, along with translations cached as long ago.
+func (s *Store) ApplyRetention(ctx context.Context, r Retention, now time.Time) (RetentionResult, error) {
+	var res RetentionResult
+
+	db, err := s.open(ctx)
+	if err != nil {
+		return res, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	if r.Raw > 0 {
+		cutoff := now.Add(-r.Raw).Unix()
+		hour := PeriodHour.seconds()
+		if _, err := tx.ExecContext(ctx, `INSERT INTO rollups(`+rollupColumns+`)
+SELECT
+  'hour',
+  started_at_unix - (started_at_unix % `+strconv.FormatInt(hour, 10)+`) AS bucket,
+  count(*),
+  sum(duration_ms),
+  max(duration_ms),
+  max(COALESCE(total_feeds, 0)),
+  sum(COALESCE(success_feeds, 0)),
+  sum(COALESCE(failed_feeds, 0)),
+  sum(COALESCE(CAST(json_extract(payload_json, '$.not_modified_feeds') AS INTEGER), 0)),
+  sum(COALESCE(CAST(json_extract(payload_json, '$.items_enqueued_total') AS INTEGER), 0)),
+  sum(COALESCE(CAST(json_extract(payload_json, '$.messages_sent') AS INTEGER), 0)),
+  sum(COALESCE(messages_failed, 0)),
+  sum(COALESCE(CAST(json_extract(payload_json, '$.fetch_retries_total') AS INTEGER), 0)),
+  max(COALESCE(CAST(json_extract(payload_json, '$.fetch_latency_ms.p90') AS INTEGER), 0)),
+  max(COALESCE(CAST(json_extract(payload_json, '$.memory_usage') AS INTEGER), 0))
+FROM runs
+WHERE started_at_unix < ?
+GROUP BY bucket`+rollupUpsert, cutoff); err != nil {
+			return res, fmt.Errorf("rolling up runs: %w", err)
+		}
+		del, err := tx.ExecContext(ctx, `DELETE FROM runs WHERE started_at_unix < ?;`, cutoff)
+		if err != nil {
+			return res, fmt.Errorf("deleting rolled up runs: %w", err)
+		}
+		if res.RunsRolledUp, err = del.RowsAffected(); err != nil {
+			return res, err
+		}
+	}
+
+	if r.Hourly > 0 {
+		cutoff := now.Add(-r.Hourly).Unix()
+		day := PeriodDay.seconds()
+		if _, err := tx.ExecContext(ctx, `INSERT INTO rollups(`+rollupColumns+`)
+SELECT
+  'day',
+  bucket_start_unix - (bucket_start_unix % `+strconv.FormatInt(day, 10)+`) AS bucket,
+  sum(run_count),
+  sum(duration_ms_total),
+  max(duration_ms_max),
+  max(total_feeds_max),
+  sum(success_feeds),
+  sum(failed_feeds),
+  sum(not_modified_feeds),
+  sum(items_enqueued),
+  sum(messages_sent),
+  sum(messages_failed),
+  sum(fetch_retries),
+  max(fetch_latency_p90_max),
+  max(memory_usage_max)
+FROM rollups
+WHERE period = 'hour' AND bucket_start_unix < ?
+GROUP BY bucket`+rollupUpsert, cutoff); err != nil {
+			return res, fmt.Errorf("rolling up hourly stats: %w", err)
+		}
+		del, err := tx.ExecContext(ctx, `DELETE FROM rollups WHERE period = 'hour' AND bucket_start_unix < ?;`, cutoff)
+		if err != nil {
+			return res, fmt.Errorf("deleting rolled up hourly stats: %w", err)
+		}
+		if res.HourlyRolledUp, err = del.RowsAffected(); err != nil {
+			return res, err
+		}
+	}
+
+	if r.Items > 0 {
+		if res.ItemsPruned, err = pruneItems(ctx, tx, now.Add(-r.Items).Unix()); err != nil {
+			return res, fmt.Errorf("pruning archived items: %w", err)
+		}
+		if res.TranslationsPruned, err = pruneTranslations(ctx, tx, now.Add(-r.Items).Unix()); err != nil {
+			return res, fmt.Errorf("pruning cached translations: %w", err)
+		}
+	}
+
+	return res, tx.Commit()
+}
+
+// ListRollups returns the latest rollups of period, newest first, optionally
+// older than beforeStartedAt.
+func (s *Store) ListRollups(ctx context.Context, period Period, limit int, beforeStartedAt *int64) ([]Rollup, error) {
+	db, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + rollupColumns + ` FROM rollups WHERE period = ?`
+	args := []any{string(period)}
+	if beforeStartedAt != nil {
+		query += ` AND bucket_start_unix < ?`
+		args = append(args, *beforeStartedAt)
+	}
+	query += ` ORDER BY bucket_start_unix DESC LIMIT ?;`
+	args = append(args, normalizeLimit(limit))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Rollup
+	for rows.Next() {
+		var (
+			item   Rollup
+			period string
+			memory int64
+		)
+		if err := rows.Scan(
+			&period,
+			&item.BucketStartUnix,
+			&item.RunCount,
+			&item.DurationMSTotal,
+			&item.DurationMSMax,
+			&item.TotalFeedsMax,
+			&item.SuccessFeeds,
+			&item.FailedFeeds,
+			&item.NotModifiedFeeds,
+			&item.ItemsEnqueued,
+			&item.MessagesSent,
+			&item.MessagesFailed,
+			&item.FetchRetries,
+			&item.FetchLatencyP90MSMax,
+			&memory,
+		); err != nil {
+			return nil, err
+		}
+		item.Period = Period(period)
+		item.BucketStart = time.Unix(item.BucketStartUnix, 0).UTC()
+		item.MemoryUsageMax = uint64(max(memory, 0))
+		res = append(res, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
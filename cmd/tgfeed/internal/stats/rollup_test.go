@@ -0,0 +1,144 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+)
+
+func TestStoreApplyRetention(t *testing.T) {
+	t.Parallel()
+
+	store := OpenMemory(t.Name())
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Fatalf("closing stats store: %v", err)
+		}
+	})
+	if err := store.Bootstrap(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, time.March, 31, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	runs := []*Run{
+		// Two runs within one hour, 50 days ago.
+		{StartTime: now.Add(-50*day + 5*time.Minute), Duration: 2 * time.Second, TotalFeeds: 10, SuccessFeeds: 9, FailedFeeds: 1, MessagesSent: 3, MemoryUsage: 100},
+		{StartTime: now.Add(-50*day + 35*time.Minute), Duration: 4 * time.Second, TotalFeeds: 12, SuccessFeeds: 12, MessagesSent: 1, MemoryUsage: 300},
+		// Another hour of the same day.
+		{StartTime: now.Add(-50*day + 3*time.Hour), Duration: time.Second, TotalFeeds: 12, SuccessFeeds: 12, FetchRetriesTotal: 2},
+		// A recent run is kept as is.
+		{StartTime: now.Add(-time.Hour), Duration: time.Second, TotalFeeds: 12, SuccessFeeds: 12},
+	}
+	for _, r := range runs {
+		if err := store.SaveRun(t.Context(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := store.ApplyRetention(t.Context(), Retention{Raw: 30 * day}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, res, RetentionResult{RunsRolledUp: 3})
+
+	left, err := store.ListRunSummaries(t.Context(), 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, len(left), 1)
+
+	hourly, err := store.ListRollups(t.Context(), PeriodHour, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := now.Add(-50 * day)
+	testutil.AssertEqual(t, hourly, []Rollup{
+		{
+			Period:          PeriodHour,
+			BucketStartUnix: first.Add(3 * time.Hour).Unix(),
+			BucketStart:     first.Add(3 * time.Hour),
+			RunCount:        1,
+			DurationMSTotal: 1000,
+			DurationMSMax:   1000,
+			TotalFeedsMax:   12,
+			SuccessFeeds:    12,
+			FetchRetries:    2,
+		},
+		{
+			Period:          PeriodHour,
+			BucketStartUnix: first.Unix(),
+			BucketStart:     first,
+			RunCount:        2,
+			DurationMSTotal: 6000,
+			DurationMSMax:   4000,
+			TotalFeedsMax:   12,
+			SuccessFeeds:    21,
+			FailedFeeds:     1,
+			MessagesSent:    4,
+			MemoryUsageMax:  300,
+		},
+	})
+
+	// Applying retention again is a no-op, and hourly buckets are folded into
+	// days.
+	res, err = store.ApplyRetention(t.Context(), Retention{Raw: 30 * day, Hourly: 40 * day}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, res, RetentionResult{HourlyRolledUp: 2})
+
+	daily, err := store.ListRollups(t.Context(), PeriodDay, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dayStart := first.Truncate(day)
+	testutil.AssertEqual(t, daily, []Rollup{{
+		Period:          PeriodDay,
+		BucketStartUnix: dayStart.Unix(),
+		BucketStart:     dayStart,
+		RunCount:        3,
+		DurationMSTotal: 7000,
+		DurationMSMax:   4000,
+		TotalFeedsMax:   12,
+		SuccessFeeds:    33,
+		FailedFeeds:     1,
+		MessagesSent:    4,
+		FetchRetries:    2,
+		MemoryUsageMax:  300,
+	}})
+
+	hourly, err = store.ListRollups(t.Context(), PeriodHour, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, len(hourly), 0)
+}
+
+func TestRollupTable(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, time.January, 2, 0, 0, 0, 0, time.UTC)
+	table := RollupTable([]Rollup{{Period: PeriodDay, BucketStart: start, RunCount: 3, MemoryUsageMax: 42}})
+	testutil.AssertEqual(t, len(table.Rows), 1)
+	testutil.AssertEqual(t, len(table.Rows[0]), len(table.Header))
+	testutil.AssertEqual(t, table.Rows[0][:3], []string{"2026-01-02T00:00:00Z", "day", "3"})
+	testutil.AssertEqual(t, table.Rows[0][len(table.Header)-1], "42")
+}
+
+func TestParsePeriod(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParsePeriod("day")
+	testutil.AssertEqual(t, err, nil)
+	testutil.AssertEqual(t, p, PeriodDay)
+
+	if _, err := ParsePeriod("week"); err == nil {
+		t.Fatal("ParsePeriod(\"week\") error = nil, want non-nil")
+	}
+}
@@ -27,7 +27,7 @@ import (
 const dbFileName = "stats.sqlite3"
 const defaultListLimit = 100
 
-const currentSchemaVersion = 2
+const currentSchemaVersion = 6
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
@@ -357,6 +357,82 @@ func (s *Store) bootstrapMigrations(ctx context.Context, db *sql.DB) error {
 	return nil
 }
 
+// Backup writes a consistent copy of the database to path, which must not
+// exist. The database stays available to other readers and writers while it's
+// copied.
+//
+// The SQLite driver doesn't expose the online backup API (sqlite3_backup_*),
+// so Backup uses VACUUM INTO, which gives the same guarantees here: it copies
+// the database within a single read transaction, so the copy is a snapshot
+// that includes commits still in the write-ahead log, and in WAL mode it
+// doesn't block writers. Unlike the backup API, it doesn't restart when the
+// database changes during the copy, and the copy is also compacted.
+func (s *Store) Backup(ctx context.Context, path string) error {
+	db, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?;`, path); err != nil {
+		return fmt.Errorf("backing up stats database: %w", err)
+	}
+	return nil
+}
+
+// SchemaStatus describes the schema of a stats database, as reported by
+// [Store.CheckSchema].
+type SchemaStatus struct {
+	// Version is the schema version of the database.
+	Version int `json:"version"`
+	// Supported is the newest schema version known to this program.
+	Supported int `json:"supported"`
+	// Pending lists migrations that [Store.Bootstrap] would apply.
+	Pending []string `json:"pending,omitempty"`
+	// Integrity is the result of SQLite's quick_check, "ok" unless the
+	// database is damaged.
+	Integrity string `json:"integrity"`
+}
+
+// CheckSchema reports the schema version of the database and migrations that
+// are pending, without applying them, and checks the database for damage.
+func (s *Store) CheckSchema(ctx context.Context) (SchemaStatus, error) {
+	status := SchemaStatus{Supported: currentSchemaVersion}
+	db, err := s.open(ctx)
+	if err != nil {
+		return status, err
+	}
+	if status.Version, err = schemaVersion(ctx, db); err != nil {
+		return status, err
+	}
+	migrations, err := migrationFiles()
+	if err != nil {
+		return status, err
+	}
+	for _, migration := range migrations {
+		if migration.version > status.Version {
+			status.Pending = append(status.Pending, filepath.Base(migration.path))
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `PRAGMA quick_check;`)
+	if err != nil {
+		return status, fmt.Errorf("checking stats database integrity: %w", err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return status, err
+		}
+		problems = append(problems, problem)
+	}
+	if err := rows.Err(); err != nil {
+		return status, err
+	}
+	status.Integrity = strings.Join(problems, "; ")
+	return status, nil
+}
+
 type migrationFile struct {
 	version int
 	path    string
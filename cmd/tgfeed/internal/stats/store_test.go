@@ -6,6 +6,7 @@ package stats
 
 import (
 	"encoding/json"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -155,3 +156,71 @@ func TestStoreSaveRunUsesJSONB(t *testing.T) {
 	testutil.AssertEqual(t, got[1].StartTime, time.Date(2023, time.January, 1, 12, 0, 0, 0, time.UTC))
 	testutil.AssertEqual(t, got[1].TotalFeeds, 1)
 }
+
+func TestStoreCheckSchema(t *testing.T) {
+	t.Parallel()
+
+	store := OpenMemory(t.Name())
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Fatalf("closing stats store: %v", err)
+		}
+	})
+
+	status, err := store.CheckSchema(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, status.Version, 0)
+	testutil.AssertEqual(t, len(status.Pending), currentSchemaVersion)
+	testutil.AssertEqual(t, status.Pending[0], "1-initial.sql")
+
+	if err := store.Bootstrap(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	status, err = store.CheckSchema(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, status, SchemaStatus{Version: currentSchemaVersion, Supported: currentSchemaVersion, Integrity: "ok"})
+}
+
+func TestStoreBackup(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := OpenWriter(dir)
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Fatalf("closing stats store: %v", err)
+		}
+	})
+	if err := store.Bootstrap(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveRun(t.Context(), &Run{StartTime: time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := t.TempDir()
+	if err := store.Backup(t.Context(), filepath.Join(backupDir, dbFileName)); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := OpenReader(backupDir)
+	t.Cleanup(func() {
+		if err := backup.Close(); err != nil {
+			t.Fatalf("closing backup store: %v", err)
+		}
+	})
+	status, err := backup.CheckSchema(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, status.Version, currentSchemaVersion)
+	runs, err := backup.ListRuns(t.Context(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, len(runs), 1)
+}
@@ -0,0 +1,74 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package stats
+
+import (
+	"strconv"
+	"time"
+)
+
+// Table is a tabular view of stats rows, used for CSV export and terminal
+// output.
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// RunSummaryTable returns a table with one row per run.
+func RunSummaryTable(runs []RunSummary) Table {
+	t := Table{Header: []string{
+		"start_time", "duration_ms", "total_feeds", "success_feeds", "failed_feeds",
+		"not_modified_feeds", "messages_sent", "messages_failed", "fetch_retries",
+		"fetch_latency_p90_ms", "memory_usage",
+	}}
+	for _, r := range runs {
+		t.Rows = append(t.Rows, []string{
+			r.StartTime.UTC().Format(time.RFC3339),
+			itoa(r.Duration.Milliseconds()),
+			itoa(r.TotalFeeds),
+			itoa(r.SuccessFeeds),
+			itoa(r.FailedFeeds),
+			itoa(r.NotModifiedFeeds),
+			itoa(r.MessagesSent),
+			itoa(r.MessagesFailed),
+			itoa(r.FetchRetriesTotal),
+			itoa(r.FetchLatencyMS.P90),
+			strconv.FormatUint(r.MemoryUsage, 10),
+		})
+	}
+	return t
+}
+
+// RollupTable returns a table with one row per rollup bucket.
+func RollupTable(rollups []Rollup) Table {
+	t := Table{Header: []string{
+		"bucket_start", "period", "run_count", "duration_ms_total", "duration_ms_max",
+		"total_feeds_max", "success_feeds", "failed_feeds", "not_modified_feeds",
+		"items_enqueued", "messages_sent", "messages_failed", "fetch_retries",
+		"fetch_latency_p90_ms_max", "memory_usage_max",
+	}}
+	for _, r := range rollups {
+		t.Rows = append(t.Rows, []string{
+			r.BucketStart.UTC().Format(time.RFC3339),
+			string(r.Period),
+			itoa(r.RunCount),
+			itoa(r.DurationMSTotal),
+			itoa(r.DurationMSMax),
+			itoa(r.TotalFeedsMax),
+			itoa(r.SuccessFeeds),
+			itoa(r.FailedFeeds),
+			itoa(r.NotModifiedFeeds),
+			itoa(r.ItemsEnqueued),
+			itoa(r.MessagesSent),
+			itoa(r.MessagesFailed),
+			itoa(r.FetchRetries),
+			itoa(r.FetchLatencyP90MSMax),
+			strconv.FormatUint(r.MemoryUsageMax, 10),
+		})
+	}
+	return t
+}
+
+func itoa[T int | int64](v T) string { return strconv.FormatInt(int64(v), 10) }
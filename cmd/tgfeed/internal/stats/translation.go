@@ -0,0 +1,71 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Translation is a feed item title and summary translated into Language.
+type Translation struct {
+	FeedURL  string
+	GUID     string
+	Language string
+	Title    string
+	Summary  string
+}
+
+// LookupTranslation returns the cached translation of an item into language.
+// The boolean result reports whether it was found.
+func (s *Store) LookupTranslation(ctx context.Context, feedURL, guid, language string) (Translation, bool, error) {
+	tr := Translation{FeedURL: feedURL, GUID: guid, Language: language}
+	db, err := s.open(ctx)
+	if err != nil {
+		return tr, false, err
+	}
+	err = db.QueryRowContext(ctx, `SELECT title, summary FROM translations WHERE feed_url = ? AND guid = ? AND language = ?;`,
+		feedURL, guid, language,
+	).Scan(&tr.Title, &tr.Summary)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tr, false, nil
+	}
+	if err != nil {
+		return tr, false, err
+	}
+	return tr, true, nil
+}
+
+// SaveTranslation caches tr, replacing a previous translation of the same
+// item into the same language.
+func (s *Store) SaveTranslation(ctx context.Context, tr Translation, now time.Time) error {
+	db, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO translations(feed_url, guid, language, title, summary, created_at_unix)
+VALUES(?, ?, ?, ?, ?, ?)
+ON CONFLICT(feed_url, guid, language) DO UPDATE SET
+  title = excluded.title,
+  summary = excluded.summary,
+  created_at_unix = excluded.created_at_unix;`,
+		tr.FeedURL, tr.GUID, tr.Language, tr.Title, tr.Summary, now.Unix(),
+	); err != nil {
+		return fmt.Errorf("saving translation of %q: %w", tr.GUID, err)
+	}
+	return nil
+}
+
+// pruneTranslations deletes translations cached before cutoff.
+func pruneTranslations(ctx context.Context, tx *sql.Tx, cutoff int64) (int64, error) {
+	del, err := tx.ExecContext(ctx, `DELETE FROM translations WHERE created_at_unix < ?;`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return del.RowsAffected()
+}
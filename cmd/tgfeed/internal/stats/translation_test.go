@@ -0,0 +1,68 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+)
+
+func TestStoreTranslations(t *testing.T) {
+	t.Parallel()
+
+	store := OpenMemory(t.Name())
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Fatalf("closing stats store: %v", err)
+		}
+	})
+	if err := store.Bootstrap(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, time.March, 31, 12, 0, 0, 0, time.UTC)
+	lookup := func(guid, language string) (Translation, bool) {
+		t.Helper()
+		tr, ok, err := store.LookupTranslation(t.Context(), "https://a.example/feed", guid, language)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr, ok
+	}
+
+	if _, ok := lookup("1", "en"); ok {
+		t.Fatal("found translation before saving it")
+	}
+
+	old := Translation{FeedURL: "https://a.example/feed", GUID: "1", Language: "en", Title: "Hello", Summary: "World"}
+	if err := store.SaveTranslation(t.Context(), old, now.Add(-3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	tr, ok := lookup("1", "en")
+	testutil.AssertEqual(t, ok, true)
+	testutil.AssertEqual(t, tr, old)
+	if _, ok := lookup("1", "de"); ok {
+		t.Fatal("found translation into another language")
+	}
+
+	fresh := Translation{FeedURL: "https://a.example/feed", GUID: "2", Language: "en", Title: "Bye", Summary: ""}
+	if err := store.SaveTranslation(t.Context(), fresh, now); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := store.ApplyRetention(t.Context(), Retention{Items: time.Hour}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, res, RetentionResult{TranslationsPruned: 1})
+	if _, ok := lookup("1", "en"); ok {
+		t.Fatal("found pruned translation")
+	}
+	tr, ok = lookup("2", "en")
+	testutil.AssertEqual(t, ok, true)
+	testutil.AssertEqual(t, tr, fresh)
+}
@@ -0,0 +1,83 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Bot describes the bot messages are sent as.
+type Bot struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+}
+
+// Chat describes the chat messages are sent to.
+type Chat struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Username string `json:"username"`
+	IsForum  bool   `json:"is_forum"`
+}
+
+type chatRequest struct {
+	ChatID string `json:"chat_id"`
+}
+
+type chatActionRequest struct {
+	ChatID          string `json:"chat_id"`
+	MessageThreadID int64  `json:"message_thread_id,omitempty"`
+	Action          string `json:"action"`
+}
+
+// GetMe returns the bot the token belongs to.
+func (s *Sender) GetMe(ctx context.Context) (Bot, error) {
+	var bot Bot
+	result, err := s.doRequest(ctx, "getMe", struct{}{})
+	if err != nil {
+		return bot, fmt.Errorf("getting bot: %w", err)
+	}
+	if err := json.Unmarshal(result, &bot); err != nil {
+		return bot, fmt.Errorf("getting bot: parsing response: %w", err)
+	}
+	return bot, nil
+}
+
+// GetChat returns the configured chat. It fails if the bot is not a member
+// of the chat.
+func (s *Sender) GetChat(ctx context.Context) (Chat, error) {
+	var chat Chat
+	result, err := s.doRequest(ctx, "getChat", &chatRequest{ChatID: s.chatID})
+	if err != nil {
+		return chat, fmt.Errorf("getting chat: %w", err)
+	}
+	if err := json.Unmarshal(result, &chat); err != nil {
+		return chat, fmt.Errorf("getting chat: parsing response: %w", err)
+	}
+	return chat, nil
+}
+
+// Probe checks that the bot can post to the configured chat, or to a message
+// thread of it when threadID is not zero, without sending a message. Members
+// of the chat may briefly see the bot "typing".
+//
+// Errors wrap [sender.ErrThreadNotFound] if the thread doesn't exist.
+func (s *Sender) Probe(ctx context.Context, threadID int64) error {
+	if _, err := s.doRequest(ctx, "sendChatAction", &chatActionRequest{
+		ChatID:          s.chatID,
+		MessageThreadID: threadID,
+		Action:          "typing",
+	}); err != nil {
+		if threadID != 0 {
+			return fmt.Errorf("posting to thread %d: %w", threadID, err)
+		}
+		return fmt.Errorf("posting to chat: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
+)
+
+func TestGetMeAndChat(t *testing.T) {
+	t.Parallel()
+
+	s := New(Config{ChatID: "-100123", Token: "token"})
+	s.makeRequest = func(_ context.Context, method string, args any) (json.RawMessage, error) {
+		switch method {
+		case "getMe":
+			return json.RawMessage(`{"id":42,"is_bot":true,"first_name":"Feeds","username":"feeds_bot"}`), nil
+		case "getChat":
+			testutil.AssertEqual(t, args, any(&chatRequest{ChatID: "-100123"}))
+			return json.RawMessage(`{"id":-100123,"type":"supergroup","title":"News","is_forum":true}`), nil
+		}
+		t.Fatalf("unexpected method %q", method)
+		return nil, nil
+	}
+
+	bot, err := s.GetMe(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, bot, Bot{ID: 42, Username: "feeds_bot", FirstName: "Feeds"})
+
+	chat, err := s.GetChat(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, chat, Chat{ID: -100123, Type: "supergroup", Title: "News", IsForum: true})
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	s := New(Config{ChatID: "chat", Token: "token"})
+	var got []*chatActionRequest
+	s.makeRequest = func(_ context.Context, method string, args any) (json.RawMessage, error) {
+		testutil.AssertEqual(t, method, "sendChatAction")
+		req := args.(*chatActionRequest)
+		got = append(got, req)
+		if req.MessageThreadID == 7 {
+			return nil, &request.StatusError{StatusCode: 400, Body: []byte(`{"ok":false,"error_code":400,"description":"Bad Request: message thread not found"}`)}
+		}
+		return json.RawMessage(`true`), nil
+	}
+
+	if err := s.Probe(t.Context(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Probe(t.Context(), 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Probe(t.Context(), 7); !errors.Is(err, sender.ErrThreadNotFound) {
+		t.Fatalf("Probe() error = %v, want ErrThreadNotFound", err)
+	}
+	testutil.AssertEqual(t, got, []*chatActionRequest{
+		{ChatID: "chat", Action: "typing"},
+		{ChatID: "chat", MessageThreadID: 42, Action: "typing"},
+		{ChatID: "chat", MessageThreadID: 7, Action: "typing"},
+	})
+}
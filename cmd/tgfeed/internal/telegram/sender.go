@@ -45,7 +45,7 @@ type Sender struct {
 	httpc       *http.Client
 	scrubber    *strings.Replacer
 	slog        *slog.Logger
-	makeRequest func(context.Context, string, any) error
+	makeRequest func(context.Context, string, any) (json.RawMessage, error)
 	sleep       func(context.Context, time.Duration) bool
 }
 
@@ -128,7 +128,8 @@ type inlineKeyboardButton struct {
 }
 
 // Send sends a message to Telegram, retrying requests when rate limited.
-func (s *Sender) Send(ctx context.Context, msg sender.Message) error {
+func (s *Sender) Send(ctx context.Context, msg sender.Message) (sender.Receipt, error) {
+	var receipt sender.Receipt
 	chatID := s.chatID
 	if msg.Target.Channel != "" {
 		chatID = msg.Target.Channel
@@ -137,7 +138,7 @@ func (s *Sender) Send(ctx context.Context, msg sender.Message) error {
 	if msg.Target.Thread != "" {
 		tid, err := strconv.ParseInt(msg.Target.Thread, 10, 64)
 		if err != nil {
-			return fmt.Errorf("parsing target thread as thread id: %w", err)
+			return receipt, fmt.Errorf("parsing target thread as thread id: %w", err)
 		}
 		threadID = tid
 	}
@@ -177,9 +178,15 @@ func (s *Sender) Send(ctx context.Context, msg sender.Message) error {
 				}
 				req.Media = append(req.Media, im)
 			}
-			if err := s.doRequest(ctx, "sendMediaGroup", req); err != nil {
-				return err
+			result, err := s.doRequest(ctx, "sendMediaGroup", req)
+			if isRemoteMediaError(err) {
+				s.slog.Debug("media URL rejected, uploading", slog.Any("error", err))
+				result, err = s.uploadMediaGroup(ctx, req, msg.FetchMedia)
 			}
+			if err != nil {
+				return receipt, err
+			}
+			receipt.MessageIDs = append(receipt.MessageIDs, messageIDs(result)...)
 		}
 	} else if len(msg.Media) == 1 {
 		req := &sendMediaRequest{
@@ -205,9 +212,15 @@ func (s *Sender) Send(ctx context.Context, msg sender.Message) error {
 			req.captionPayload = parseCaption(chunks[0])
 			chunks = chunks[1:]
 		}
-		if err := s.doRequest(ctx, method, req); err != nil {
-			return err
+		result, err := s.doRequest(ctx, method, req)
+		if isRemoteMediaError(err) {
+			s.slog.Debug("media URL rejected, uploading", slog.Any("error", err))
+			result, err = s.uploadMedia(ctx, req, m.URL, msg.FetchMedia)
+		}
+		if err != nil {
+			return receipt, err
 		}
+		receipt.MessageIDs = append(receipt.MessageIDs, messageIDs(result)...)
 	}
 
 	// Send remaining text chunks or standard text.
@@ -219,20 +232,29 @@ func (s *Sender) Send(ctx context.Context, msg sender.Message) error {
 		}
 		tgmsg.LinkPreviewOptions.IsDisabled = msg.Options.SuppressLinkPreview
 		tgmsg.Message = tgmarkup.FromMarkdown(chunk)
-		if err := s.doRequest(ctx, "sendMessage", tgmsg); err != nil {
-			return err
+		result, err := s.doRequest(ctx, "sendMessage", tgmsg)
+		if err != nil {
+			return receipt, err
 		}
+		receipt.MessageIDs = append(receipt.MessageIDs, messageIDs(result)...)
 	}
 
-	return nil
+	return receipt, nil
 }
 
-func (s *Sender) doRequest(ctx context.Context, method string, req any) error {
-	var err error
+func (s *Sender) doRequest(ctx context.Context, method string, req any) (json.RawMessage, error) {
+	var (
+		result json.RawMessage
+		err    error
+	)
 	for range sendRetryLimit {
-		err = s.makeRequest(ctx, method, req)
+		result, err = s.makeRequest(ctx, method, req)
 		if err == nil {
-			return nil
+			return result, nil
+		}
+
+		if isThreadNotFound(err) {
+			return nil, fmt.Errorf("%w: %w", sender.ErrThreadNotFound, err)
 		}
 
 		retryable, wait := isRateLimited(err)
@@ -242,10 +264,32 @@ func (s *Sender) doRequest(ctx context.Context, method string, req any) error {
 
 		s.slog.Warn("sending rate limited, waiting", slog.String("method", method), slog.Duration("wait", wait))
 		if !s.sleep(ctx, wait) {
-			return ctx.Err()
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
+
+type sentMessage struct {
+	MessageID int64 `json:"message_id"`
+}
+
+// messageIDs extracts IDs of sent messages from a result of a send method,
+// which is a single message or, for sendMediaGroup, a list of them.
+func messageIDs(result json.RawMessage) []string {
+	var msgs []sentMessage
+	if err := json.Unmarshal(result, &msgs); err != nil {
+		var msg sentMessage
+		if err := json.Unmarshal(result, &msg); err != nil || msg.MessageID == 0 {
+			return nil
 		}
+		msgs = []sentMessage{msg}
 	}
-	return err
+	ids := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		ids = append(ids, strconv.FormatInt(msg.MessageID, 10))
+	}
+	return ids
 }
 
 func toInlineKeyboard(rows []sender.ActionRow) *inlineKeyboard {
@@ -268,8 +312,13 @@ func toInlineKeyboard(rows []sender.ActionRow) *inlineKeyboard {
 	return &out
 }
 
-func (s *Sender) makeTelegramRequest(ctx context.Context, method string, args any) error {
-	if _, err := request.Make[request.IgnoreResponse](ctx, request.Params{
+func (s *Sender) makeTelegramRequest(ctx context.Context, method string, args any) (json.RawMessage, error) {
+	if r, ok := args.(*multipartRequest); ok {
+		return s.makeMultipartRequest(ctx, method, r)
+	}
+	resp, err := request.Make[struct {
+		Result json.RawMessage `json:"result"`
+	}](ctx, request.Params{
 		Method: http.MethodPost,
 		URL:    tgAPI + "/bot" + s.token + "/" + method,
 		Body:   args,
@@ -278,10 +327,11 @@ func (s *Sender) makeTelegramRequest(ctx context.Context, method string, args an
 		},
 		HTTPClient: s.httpc,
 		Scrubber:   s.scrubber,
-	}); err != nil {
-		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return resp.Result, nil
 }
 
 func splitMessage(text string) []string {
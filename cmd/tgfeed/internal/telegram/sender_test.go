@@ -6,6 +6,7 @@ package telegram
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -79,12 +80,12 @@ func TestSendRateLimitRetry(t *testing.T) {
 
 	s := New(Config{ChatID: "chat", Token: "token", Logger: logger})
 	var calls int
-	s.makeRequest = func(context.Context, string, any) error {
+	s.makeRequest = func(context.Context, string, any) (json.RawMessage, error) {
 		calls++
 		if calls == 1 {
-			return &request.StatusError{StatusCode: 429, Body: []byte(`{"parameters":{"retry_after":1}}`)}
+			return nil, &request.StatusError{StatusCode: 429, Body: []byte(`{"parameters":{"retry_after":1}}`)}
 		}
-		return nil
+		return json.RawMessage(`{"message_id":42}`), nil
 	}
 	waits := make([]time.Duration, 0, 1)
 	s.sleep = func(_ context.Context, d time.Duration) bool {
@@ -92,8 +93,9 @@ func TestSendRateLimitRetry(t *testing.T) {
 		return true
 	}
 
-	err := s.Send(t.Context(), sender.Message{Body: "hello"})
+	receipt, err := s.Send(t.Context(), sender.Message{Body: "hello"})
 	testutil.AssertEqual(t, err, nil)
+	testutil.AssertEqual(t, receipt.MessageIDs, []string{"42"})
 	testutil.AssertEqual(t, calls, 2)
 	testutil.AssertEqual(t, waits, []time.Duration{time.Second})
 }
@@ -103,18 +105,45 @@ func TestSendNonRetryableError(t *testing.T) {
 
 	s := New(Config{ChatID: "chat", Token: "token"})
 	wantErr := errors.New("boom")
-	s.makeRequest = func(context.Context, string, any) error { return wantErr }
+	s.makeRequest = func(context.Context, string, any) (json.RawMessage, error) { return nil, wantErr }
 	s.sleep = func(context.Context, time.Duration) bool {
 		t.Fatal("sleep should not be called for non-retryable errors")
 		return false
 	}
 
-	err := s.Send(t.Context(), sender.Message{Body: "hello"})
+	_, err := s.Send(t.Context(), sender.Message{Body: "hello"})
 	if !errors.Is(err, wantErr) {
 		t.Fatalf("Send() error = %v, want %v", err, wantErr)
 	}
 }
 
+func TestSendReceipt(t *testing.T) {
+	t.Parallel()
+
+	s := New(Config{ChatID: "chat", Token: "token"})
+	var methods []string
+	s.makeRequest = func(_ context.Context, method string, _ any) (json.RawMessage, error) {
+		methods = append(methods, method)
+		if method == "sendMediaGroup" {
+			return json.RawMessage(`[{"message_id":1},{"message_id":2}]`), nil
+		}
+		return json.RawMessage(`{"message_id":3}`), nil
+	}
+
+	receipt, err := s.Send(t.Context(), sender.Message{
+		Body: strings.Repeat("a", 1024) + "\n" + "tail",
+		Media: []sender.Media{
+			{Type: "photo", URL: "https://example.com/1.jpg"},
+			{Type: "photo", URL: "https://example.com/2.jpg"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, methods, []string{"sendMediaGroup", "sendMessage"})
+	testutil.AssertEqual(t, receipt.MessageIDs, []string{"1", "2", "3"})
+}
+
 func TestIsRateLimited(t *testing.T) {
 	t.Parallel()
 
@@ -155,7 +184,7 @@ func TestSendInvalidThread(t *testing.T) {
 	t.Parallel()
 
 	s := New(Config{ChatID: "chat", Token: "token"})
-	err := s.Send(t.Context(), sender.Message{Body: "hello", Target: sender.Target{Thread: "not-a-number"}})
+	_, err := s.Send(t.Context(), sender.Message{Body: "hello", Target: sender.Target{Thread: "not-a-number"}})
 	if err == nil {
 		t.Fatal("Send() error = nil, want non-nil")
 	}
@@ -0,0 +1,63 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
+)
+
+type createForumTopicRequest struct {
+	ChatID string `json:"chat_id"`
+	Name   string `json:"name"`
+}
+
+// CreateTopic creates a forum topic in the configured chat and returns its
+// message thread ID.
+func (s *Sender) CreateTopic(ctx context.Context, name string) (string, error) {
+	result, err := s.doRequest(ctx, "createForumTopic", &createForumTopicRequest{
+		ChatID: s.chatID,
+		Name:   name,
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating topic %q: %w", name, err)
+	}
+	var topic struct {
+		MessageThreadID int64 `json:"message_thread_id"`
+	}
+	if err := json.Unmarshal(result, &topic); err != nil {
+		return "", fmt.Errorf("creating topic %q: parsing response: %w", name, err)
+	}
+	if topic.MessageThreadID == 0 {
+		return "", fmt.Errorf("creating topic %q: response has no message thread ID", name)
+	}
+	return strconv.FormatInt(topic.MessageThreadID, 10), nil
+}
+
+// isThreadNotFound reports whether err means the message thread a message
+// was sent to doesn't exist.
+func isThreadNotFound(err error) bool {
+	statusErr, ok := errors.AsType[*request.StatusError](err)
+	if !ok || statusErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	var errorResponse struct {
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(statusErr.Body, &errorResponse); err != nil {
+		return false
+	}
+	return strings.Contains(errorResponse.Description, "message thread not found")
+}
+
+var _ sender.TopicCreator = (*Sender)(nil)
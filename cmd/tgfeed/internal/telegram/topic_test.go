@@ -0,0 +1,65 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
+)
+
+func TestCreateTopic(t *testing.T) {
+	t.Parallel()
+
+	s := New(Config{ChatID: "chat", Token: "token"})
+	var got *createForumTopicRequest
+	s.makeRequest = func(_ context.Context, method string, args any) (json.RawMessage, error) {
+		testutil.AssertEqual(t, method, "createForumTopic")
+		got = args.(*createForumTopicRequest)
+		return json.RawMessage(`{"message_thread_id":42,"name":"Releases","icon_color":7322096}`), nil
+	}
+
+	thread, err := s.CreateTopic(t.Context(), "Releases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, thread, "42")
+	testutil.AssertEqual(t, got, &createForumTopicRequest{ChatID: "chat", Name: "Releases"})
+}
+
+func TestCreateTopicNotForum(t *testing.T) {
+	t.Parallel()
+
+	s := New(Config{ChatID: "chat", Token: "token"})
+	s.makeRequest = func(context.Context, string, any) (json.RawMessage, error) {
+		return nil, &request.StatusError{StatusCode: 400, Body: []byte(`{"ok":false,"error_code":400,"description":"Bad Request: the chat is not a forum"}`)}
+	}
+
+	if _, err := s.CreateTopic(t.Context(), "Releases"); err == nil {
+		t.Fatal("CreateTopic() succeeded, want error")
+	}
+}
+
+func TestSendThreadNotFound(t *testing.T) {
+	t.Parallel()
+
+	s := New(Config{ChatID: "chat", Token: "token"})
+	calls := 0
+	s.makeRequest = func(context.Context, string, any) (json.RawMessage, error) {
+		calls++
+		return nil, &request.StatusError{StatusCode: 400, Body: []byte(`{"ok":false,"error_code":400,"description":"Bad Request: message thread not found"}`)}
+	}
+
+	_, err := s.Send(t.Context(), sender.Message{Body: "hello", Target: sender.Target{Thread: "42"}})
+	if !errors.Is(err, sender.ErrThreadNotFound) {
+		t.Fatalf("Send() error = %v, want %v", err, sender.ErrThreadNotFound)
+	}
+	testutil.AssertEqual(t, calls, 1)
+}
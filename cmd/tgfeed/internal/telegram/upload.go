@@ -0,0 +1,342 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/base/version"
+)
+
+// Limits of files uploaded to the Bot API. Telegram fetches media by URL
+// only up to 5 MB for photos and 20 MB for other files, and not at all from
+// hosts that block it, so uploading is a fallback for these cases.
+const (
+	maxPhotoUploadSize = 10 << 20
+	maxFileUploadSize  = 50 << 20
+)
+
+// remoteMediaErrors are substrings of Bot API error descriptions reported
+// when Telegram can't use media passed by URL.
+var remoteMediaErrors = []string{
+	"failed to get HTTP URL content",
+	"wrong file identifier/HTTP URL specified",
+	"wrong type of the web page content",
+	"WEBPAGE_CURL_FAILED",
+	"WEBPAGE_MEDIA_EMPTY",
+}
+
+// isRemoteMediaError reports whether err means Telegram couldn't fetch media
+// passed by URL.
+func isRemoteMediaError(err error) bool {
+	statusErr, ok := errors.AsType[*request.StatusError](err)
+	if !ok || statusErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	var errorResponse struct {
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(statusErr.Body, &errorResponse); err != nil {
+		return false
+	}
+	return slices.ContainsFunc(remoteMediaErrors, func(s string) bool {
+		return strings.Contains(errorResponse.Description, s)
+	})
+}
+
+// upload is a file sent as a part of a multipart/form-data request. Its
+// contents are kept in a temporary file, so that large media isn't held in
+// memory.
+type upload struct {
+	field    string
+	filename string
+	mimeType string
+	file     *os.File
+	size     int64
+}
+
+// close removes the temporary file of u.
+func (u *upload) close() {
+	u.file.Close()
+	os.Remove(u.file.Name())
+}
+
+// kind returns the Telegram media type the file should be sent as, based on
+// its sniffed MIME type and size.
+func (u *upload) kind() string {
+	switch u.mimeType {
+	case "image/jpeg", "image/png", "image/webp":
+		if u.size <= maxPhotoUploadSize {
+			return "photo"
+		}
+	case "video/mp4":
+		return "video"
+	}
+	return "document"
+}
+
+// multipartRequest is a Bot API request with uploaded files. Non-string
+// field values are encoded as JSON.
+type multipartRequest struct {
+	fields map[string]any
+	files  []*upload
+}
+
+// writeTo encodes r with mw and closes it. Files are read from the start
+// each time, so a request can be encoded again when it's retried.
+func (r *multipartRequest) writeTo(mw *multipart.Writer) error {
+	keys := make([]string, 0, len(r.fields))
+	for k := range r.fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		var value string
+		switch v := r.fields[k].(type) {
+		case string:
+			value = v
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("encoding %q: %w", k, err)
+			}
+			value = string(b)
+		}
+		if err := mw.WriteField(k, value); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range r.files {
+		h := make(map[string][]string)
+		h["Content-Disposition"] = []string{mime.FormatMediaType("form-data", map[string]string{
+			"name":     f.field,
+			"filename": f.filename,
+		})}
+		h["Content-Type"] = []string{f.mimeType}
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, io.NewSectionReader(f.file, 0, f.size)); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+// makeMultipartRequest sends r, streaming uploaded files from disk. It fails
+// with a [request.StatusError] on unexpected status like [request.Make].
+func (s *Sender) makeMultipartRequest(ctx context.Context, method string, r *multipartRequest) (json.RawMessage, error) {
+	pr, pw := io.Pipe()
+	defer pr.Close() // stops the encoder if the request fails early
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(r.writeTo(mw))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tgAPI+"/bot"+s.token+"/"+method, pr)
+	if err != nil {
+		return nil, s.scrubErr(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	res, err := s.httpc.Do(req)
+	if err != nil {
+		return nil, s.scrubErr(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, s.scrubErr(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, s.scrubErr(fmt.Errorf("POST %q: %w", req.URL, &request.StatusError{
+			WantedStatusCode: http.StatusOK,
+			StatusCode:       res.StatusCode,
+			Headers:          res.Header,
+			Body:             body,
+		}))
+	}
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, s.scrubErr(err)
+	}
+	return resp.Result, nil
+}
+
+func (s *Sender) scrubErr(err error) error {
+	if s.scrubber == nil {
+		return err
+	}
+	return &scrubbedError{err: err, scrubber: s.scrubber}
+}
+
+type scrubbedError struct {
+	err      error
+	scrubber *strings.Replacer
+}
+
+func (e *scrubbedError) Error() string { return e.scrubber.Replace(e.err.Error()) }
+func (e *scrubbedError) Unwrap() error { return e.err }
+
+// download fetches media from rawURL into a temporary file so it can be
+// uploaded to Telegram. If fetch is nil, a plain GET request is made. The
+// caller should close the returned upload.
+func (s *Sender) download(ctx context.Context, rawURL string, fetch func(context.Context, string) (*http.Response, error)) (_ *upload, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if fetch == nil {
+		fetch = s.get
+	}
+	res, err := fetch(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %q: %w", rawURL, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %q: want 200, got %d", rawURL, res.StatusCode)
+	}
+	if res.ContentLength > maxFileUploadSize {
+		return nil, fmt.Errorf("downloading %q: size of %d bytes exceeds the upload limit of %d bytes", rawURL, res.ContentLength, maxFileUploadSize)
+	}
+
+	tmp, err := os.CreateTemp("", "tgfeed-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	file := &upload{file: tmp}
+	defer func() {
+		if err != nil {
+			file.close()
+		}
+	}()
+	file.size, err = io.Copy(tmp, io.LimitReader(res.Body, maxFileUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("downloading %q: %w", rawURL, err)
+	}
+	if file.size > maxFileUploadSize {
+		return nil, fmt.Errorf("downloading %q: size exceeds the upload limit of %d bytes", rawURL, maxFileUploadSize)
+	}
+
+	head := make([]byte, 512) // http.DetectContentType considers at most 512 bytes
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	file.mimeType, _, _ = mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if file.mimeType == "application/octet-stream" || file.mimeType == "text/plain" {
+		if declared, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil {
+			file.mimeType = declared
+		}
+	}
+
+	file.filename = path.Base(u.Path)
+	if file.filename == "/" || file.filename == "." {
+		file.filename = "file"
+	}
+	return file, nil
+}
+
+// get fetches url with a plain GET request.
+func (s *Sender) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	return s.httpc.Do(req)
+}
+
+// uploadMedia sends a single media item by uploading its contents.
+func (s *Sender) uploadMedia(ctx context.Context, req *sendMediaRequest, url string, fetch func(context.Context, string) (*http.Response, error)) (json.RawMessage, error) {
+	file, err := s.download(ctx, url, fetch)
+	if err != nil {
+		return nil, err
+	}
+	defer file.close()
+	kind := file.kind()
+	file.field = kind
+
+	fields := map[string]any{"chat_id": req.ChatID}
+	if req.MessageThreadID != 0 {
+		fields["message_thread_id"] = strconv.FormatInt(req.MessageThreadID, 10)
+	}
+	if req.Caption != "" {
+		fields["caption"] = req.Caption
+	}
+	if len(req.CaptionEntities) > 0 {
+		fields["caption_entities"] = req.CaptionEntities
+	}
+	if req.ReplyMarkup != nil {
+		fields["reply_markup"] = req.ReplyMarkup
+	}
+	return s.doRequest(ctx, "send"+strings.ToUpper(kind[:1])+kind[1:], &multipartRequest{
+		fields: fields,
+		files:  []*upload{file},
+	})
+}
+
+// uploadMediaGroup sends a media group by uploading contents of its items.
+// Telegram doesn't allow mixing documents with other media in a group, so
+// if any item can only be sent as a document, all of them are.
+func (s *Sender) uploadMediaGroup(ctx context.Context, req *sendMediaGroupRequest, fetch func(context.Context, string) (*http.Response, error)) (json.RawMessage, error) {
+	files := make([]*upload, 0, len(req.Media))
+	defer func() {
+		for _, file := range files {
+			file.close()
+		}
+	}()
+	hasDocuments := false
+	for i, m := range req.Media {
+		file, err := s.download(ctx, m.Media, fetch)
+		if err != nil {
+			return nil, err
+		}
+		file.field = "file" + strconv.Itoa(i)
+		hasDocuments = hasDocuments || file.kind() == "document"
+		files = append(files, file)
+	}
+
+	media := make([]inputMedia, 0, len(req.Media))
+	for i, m := range req.Media {
+		m.Media = "attach://" + files[i].field
+		m.Type = files[i].kind()
+		if hasDocuments {
+			m.Type = "document"
+		}
+		media = append(media, m)
+	}
+
+	fields := map[string]any{
+		"chat_id": req.ChatID,
+		"media":   media,
+	}
+	if req.MessageThreadID != 0 {
+		fields["message_thread_id"] = strconv.FormatInt(req.MessageThreadID, 10)
+	}
+	return s.doRequest(ctx, "sendMediaGroup", &multipartRequest{fields: fields, files: files})
+}
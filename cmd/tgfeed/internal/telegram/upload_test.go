@@ -0,0 +1,306 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.astrophena.name/base/request"
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
+)
+
+// botAPI is a local stand-in for the Telegram Bot API that rejects media
+// passed by URL, as it does for hosts blocking Telegram.
+type botAPI struct {
+	mu    sync.Mutex
+	calls []botAPICall
+}
+
+type botAPICall struct {
+	method string
+	fields map[string]string
+	// files maps form field names to MIME types of uploaded files.
+	files map[string]string
+}
+
+func (b *botAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.PathValue("method")
+	call := botAPICall{method: method, fields: map[string]string{}, files: map[string]string{}}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		b.record(call)
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"ok":false,"error_code":400,"description":"Bad Request: failed to get HTTP URL content"}`)
+		return
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(part)
+		if part.FileName() != "" {
+			call.files[part.FormName()] = part.Header.Get("Content-Type")
+		} else {
+			call.fields[part.FormName()] = string(data)
+		}
+	}
+	b.record(call)
+
+	if method == "sendMediaGroup" {
+		io.WriteString(w, `{"ok":true,"result":[{"message_id":1},{"message_id":2}]}`)
+		return
+	}
+	io.WriteString(w, `{"ok":true,"result":{"message_id":1}}`)
+}
+
+func (b *botAPI) record(call botAPICall) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, call)
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newUploadTestSender(t *testing.T, api *botAPI, files map[string][]byte) *Sender {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("POST api.telegram.org/{token}/{method}", api)
+	for p, data := range files {
+		mux.HandleFunc("GET example.com/"+p, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+	}
+	return New(Config{ChatID: "chat", Token: "token", HTTPClient: testutil.MockHTTPClient(mux)})
+}
+
+func TestSendUploadsRejectedMedia(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		media      sender.Media
+		file       []byte
+		wantMethod string
+		wantField  string
+		wantMIME   string
+	}{
+		"photo": {
+			media:      sender.Media{Type: "photo", URL: "https://example.com/image.png"},
+			file:       testPNG(t),
+			wantMethod: "sendPhoto",
+			wantField:  "photo",
+			wantMIME:   "image/png",
+		},
+		"photo that is a document": {
+			media:      sender.Media{Type: "photo", URL: "https://example.com/image.png"},
+			file:       []byte("%PDF-1.7\n"),
+			wantMethod: "sendDocument",
+			wantField:  "document",
+			wantMIME:   "application/pdf",
+		},
+		"video": {
+			media:      sender.Media{Type: "video", URL: "https://example.com/image.png"},
+			file:       append([]byte("\x00\x00\x00\x18ftypmp42"), make([]byte, 16)...),
+			wantMethod: "sendVideo",
+			wantField:  "video",
+			wantMIME:   "video/mp4",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			api := new(botAPI)
+			s := newUploadTestSender(t, api, map[string][]byte{"image.png": tc.file})
+
+			receipt, err := s.Send(t.Context(), sender.Message{
+				Body:    "*caption*",
+				Target:  sender.Target{Thread: "7"},
+				Media:   []sender.Media{tc.media},
+				Actions: []sender.ActionRow{{{Label: "Open", URL: "https://example.com"}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, receipt.MessageIDs, []string{"1"})
+			testutil.AssertEqual(t, len(api.calls), 2)
+
+			upload := api.calls[1]
+			testutil.AssertEqual(t, upload.method, tc.wantMethod)
+			testutil.AssertEqual(t, upload.files, map[string]string{tc.wantField: tc.wantMIME})
+			testutil.AssertEqual(t, upload.fields["chat_id"], "chat")
+			testutil.AssertEqual(t, upload.fields["message_thread_id"], "7")
+			testutil.AssertEqual(t, strings.TrimSpace(upload.fields["caption"]), "caption")
+			if !strings.Contains(upload.fields["caption_entities"], `"italic"`) {
+				t.Errorf("caption_entities = %q, want an italic entity", upload.fields["caption_entities"])
+			}
+			if !strings.Contains(upload.fields["reply_markup"], `"https://example.com"`) {
+				t.Errorf("reply_markup = %q, want the keyboard", upload.fields["reply_markup"])
+			}
+		})
+	}
+}
+
+func TestSendUploadsRejectedMediaGroup(t *testing.T) {
+	t.Parallel()
+
+	api := new(botAPI)
+	s := newUploadTestSender(t, api, map[string][]byte{
+		"1.png":      testPNG(t),
+		"2.png":      testPNG(t),
+		"report.pdf": []byte("%PDF-1.7\n"),
+	})
+
+	send := func(urls ...string) botAPICall {
+		t.Helper()
+		api.calls = nil
+		var media []sender.Media
+		for _, u := range urls {
+			media = append(media, sender.Media{Type: "photo", URL: u})
+		}
+		receipt, err := s.Send(t.Context(), sender.Message{Body: "album", Media: media})
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.AssertEqual(t, receipt.MessageIDs, []string{"1", "2"})
+		testutil.AssertEqual(t, len(api.calls), 2)
+		testutil.AssertEqual(t, api.calls[1].method, "sendMediaGroup")
+		return api.calls[1]
+	}
+
+	call := send("https://example.com/1.png", "https://example.com/2.png")
+	testutil.AssertEqual(t, call.files, map[string]string{"file0": "image/png", "file1": "image/png"})
+	media := testutil.UnmarshalJSON[[]inputMedia](t, []byte(call.fields["media"]))
+	testutil.AssertEqual(t, len(media), 2)
+	testutil.AssertEqual(t, media[0].Type, "photo")
+	testutil.AssertEqual(t, media[0].Media, "attach://file0")
+	testutil.AssertEqual(t, strings.TrimSpace(media[0].Caption), "album")
+	testutil.AssertEqual(t, media[1].Media, "attach://file1")
+
+	// Documents can't be mixed with photos, so all items become documents.
+	call = send("https://example.com/1.png", "https://example.com/report.pdf")
+	media = testutil.UnmarshalJSON[[]inputMedia](t, []byte(call.fields["media"]))
+	testutil.AssertEqual(t, media[0].Type, "document")
+	testutil.AssertEqual(t, media[1].Type, "document")
+}
+
+func TestSendUploadUsesFetchMedia(t *testing.T) {
+	t.Parallel()
+
+	api := new(botAPI)
+	s := newUploadTestSender(t, api, nil)
+
+	var fetched []string
+	_, err := s.Send(t.Context(), sender.Message{
+		Media: []sender.Media{{Type: "photo", URL: "https://example.com/private.png"}},
+		FetchMedia: func(ctx context.Context, url string) (*http.Response, error) {
+			fetched = append(fetched, url)
+			w := httptest.NewRecorder()
+			w.Write(testPNG(t))
+			return w.Result(), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, fetched, []string{"https://example.com/private.png"})
+	testutil.AssertEqual(t, api.calls[1].files, map[string]string{"photo": "image/png"})
+}
+
+func TestSendUploadTooLarge(t *testing.T) {
+	t.Parallel()
+
+	api := new(botAPI)
+	mux := http.NewServeMux()
+	mux.Handle("POST api.telegram.org/{token}/{method}", api)
+	mux.HandleFunc("GET example.com/huge.mp4", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(maxFileUploadSize+1))
+		w.Write(make([]byte, maxFileUploadSize+1))
+	})
+	s := New(Config{ChatID: "chat", Token: "token", HTTPClient: testutil.MockHTTPClient(mux)})
+
+	_, err := s.Send(t.Context(), sender.Message{Media: []sender.Media{{Type: "video", URL: "https://example.com/huge.mp4"}}})
+	if err == nil || !strings.Contains(err.Error(), "exceeds the upload limit") {
+		t.Fatalf("Send() error = %v, want upload limit error", err)
+	}
+	testutil.AssertEqual(t, len(api.calls), 1)
+}
+
+func TestUploadKind(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		upload upload
+		want   string
+	}{
+		"jpeg":        {upload: upload{mimeType: "image/jpeg"}, want: "photo"},
+		"large photo": {upload: upload{mimeType: "image/png", size: maxPhotoUploadSize + 1}, want: "document"},
+		"gif":         {upload: upload{mimeType: "image/gif"}, want: "document"},
+		"mp4":         {upload: upload{mimeType: "video/mp4"}, want: "video"},
+		"webm":        {upload: upload{mimeType: "video/webm"}, want: "document"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			testutil.AssertEqual(t, tc.upload.kind(), tc.want)
+		})
+	}
+}
+
+func TestIsRemoteMediaError(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		err  error
+		want bool
+	}{
+		"failed to fetch": {
+			err:  &request.StatusError{StatusCode: 400, Body: []byte(`{"description":"Bad Request: failed to get HTTP URL content"}`)},
+			want: true,
+		},
+		"media group": {
+			err:  &request.StatusError{StatusCode: 400, Body: []byte(`{"description":"Bad Request: failed to send message #1 with the error message \"WEBPAGE_CURL_FAILED\""}`)},
+			want: true,
+		},
+		"other bad request": {
+			err: &request.StatusError{StatusCode: 400, Body: []byte(`{"description":"Bad Request: can't parse entities"}`)},
+		},
+		"rate limited": {
+			err: &request.StatusError{StatusCode: 429, Body: []byte(`{"description":"Too Many Requests"}`)},
+		},
+		"nil": {},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			testutil.AssertEqual(t, isRemoteMediaError(tc.err), tc.want)
+		})
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"text/tabwriter"
 	"time"
 
 	"go.astrophena.name/base/cli"
@@ -34,10 +35,16 @@ import (
 	"go.astrophena.name/tools/cmd/tgfeed/internal/admin"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/ctxsleep"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/diff"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/format"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/giteanotify"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/gltodo"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/hostlimit"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/retry"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/telegram"
+	"go.astrophena.name/tools/internal/api/llm"
 	"go.astrophena.name/tools/internal/filelock"
 
 	"github.com/mmcdole/gofeed"
@@ -71,14 +78,26 @@ type fetcher struct {
 	chatID        string
 	dry           bool
 	errorThreadID int64
+	errorTopic    string
+	forgejoToken  string
+	forgejoURL    string
 	ghToken       string
+	giteaToken    string
+	giteaURL      string
+	gitlabToken   string
+	gitlabURL     string
+	llmAPIKey     string
+	llmAPIURL     string
+	llmModel      string
 	remoteURL     string
 	stateDir      string
 	tgToken       string
 
 	// initialized by doInit
 	fp        *gofeed.Parser
+	getenv    func(string) string
 	httpc     *http.Client
+	llm       *llm.Client
 	logf      func(string, ...any)
 	scrubber  *strings.Replacer
 	slog      *slog.Logger
@@ -87,14 +106,26 @@ type fetcher struct {
 	// loaded from state
 	config        string
 	feeds         []*feed
-	errorTemplate string
-	stateMu       sync.RWMutex
-	state         map[string]*state.Feed
-
-	stats      syncx.Protected[*stats.Run]
-	statsStore *stats.Store
-	sender     sender.Sender
-	store      *state.Store
+	retryPolicies map[string]*retry.Policy
+	hostLimits    map[string]hostlimit.Limits
+	// secretScrubber hides secrets of feed HTTP settings.
+	secretScrubber *strings.Replacer
+	errorTemplate  string
+	templates      *format.Templates
+	stateMu        sync.RWMutex
+	state          map[string]*state.Feed
+	// topics maps forum topic names to message thread IDs.
+	topicsMu sync.Mutex
+	topics   map[string]int64
+
+	hostLimiter     *hostlimit.Limiter
+	proxyMu         sync.Mutex
+	proxyTransports map[string]*http.Transport
+	stats           syncx.Protected[*stats.Run]
+	statsStore      *stats.Store
+	statsRetention  stats.Retention
+	sender          sender.Sender
+	store           *state.Store
 
 	runLock filelock.Lock
 }
@@ -113,7 +144,17 @@ func (f *fetcher) Run(ctx context.Context) error {
 	f.adminAddr = cmp.Or(f.adminAddr, env.Getenv("ADMIN_ADDR"), "localhost:3000")
 	f.chatID = cmp.Or(f.chatID, env.Getenv("CHAT_ID"))
 	f.errorThreadID = cmp.Or(f.errorThreadID, parseInt(env.Getenv("ERROR_THREAD_ID")))
+	f.errorTopic = cmp.Or(f.errorTopic, env.Getenv("ERROR_TOPIC"))
+	f.forgejoToken = cmp.Or(f.forgejoToken, env.Getenv("FORGEJO_TOKEN"))
+	f.forgejoURL = cmp.Or(f.forgejoURL, env.Getenv("FORGEJO_URL"), "https://codeberg.org")
 	f.ghToken = cmp.Or(f.ghToken, env.Getenv("GITHUB_TOKEN"))
+	f.giteaToken = cmp.Or(f.giteaToken, env.Getenv("GITEA_TOKEN"))
+	f.giteaURL = cmp.Or(f.giteaURL, env.Getenv("GITEA_URL"), giteanotify.DefaultURL)
+	f.gitlabToken = cmp.Or(f.gitlabToken, env.Getenv("GITLAB_TOKEN"))
+	f.gitlabURL = cmp.Or(f.gitlabURL, env.Getenv("GITLAB_URL"), gltodo.DefaultURL)
+	f.llmAPIKey = cmp.Or(f.llmAPIKey, env.Getenv("LLM_API_KEY"))
+	f.llmAPIURL = cmp.Or(f.llmAPIURL, env.Getenv("LLM_API_URL"))
+	f.llmModel = cmp.Or(f.llmModel, env.Getenv("LLM_MODEL"), defaultLLMModel)
 	f.stateDir = cmp.Or(f.stateDir, env.Getenv("STATE_DIRECTORY"))
 	if f.stateDir == "" {
 		stateDir, err := defaultStateDir(env)
@@ -153,10 +194,22 @@ func (f *fetcher) Run(ctx context.Context) error {
 			Store:      f.store,
 			StatsStore: reader,
 			ValidateConfig: func(ctx context.Context, content string) error {
-				_, err := f.parseConfig(ctx, content)
-				return err
+				templates, err := f.store.LoadTemplates(ctx)
+				if err != nil {
+					return err
+				}
+				return f.validateConfig(ctx, content, templates)
+			},
+			ValidateTemplates: func(ctx context.Context, templates map[string]string) error {
+				config, err := f.store.LoadConfig(ctx)
+				if err != nil {
+					return err
+				}
+				return f.validateConfig(ctx, config, templates)
 			},
-			IsRunLocked: f.isRunLocked,
+			IsRunLocked:    f.isRunLocked,
+			LockRun:        f.lockRun,
+			ValidateBackup: f.validateConfig,
 		})
 	case "feeds":
 		return f.listFeeds(ctx, env.Stdout)
@@ -173,6 +226,31 @@ func (f *fetcher) Run(ctx context.Context) error {
 			return errors.Join(err, f.errNotify(ctx, err))
 		}
 		return nil
+	case "doctor":
+		return f.diagnose(ctx, env.Stdout)
+	case "stats":
+		return f.printStats(ctx, env.Stdout, env.Args[1:])
+	case "backup":
+		switch len(env.Args) {
+		case 1:
+			return f.backup(ctx, env.Stdout)
+		case 2:
+			return f.backupToFile(ctx, env.Stdout, env.Args[1])
+		}
+		return fmt.Errorf("%w: backup command expects at most one file", cli.ErrInvalidArgs)
+	case "restore":
+		if len(env.Args) != 2 {
+			return fmt.Errorf("%w: restore command expects a backup file", cli.ErrInvalidArgs)
+		}
+		if env.Args[1] == "-" {
+			return f.restore(ctx, env.Stdin)
+		}
+		file, err := os.Open(env.Args[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return f.restore(ctx, file)
 	case "reenable":
 		if len(env.Args) != 2 {
 			return fmt.Errorf("%w: reenable command expects a feed URL", cli.ErrInvalidArgs)
@@ -196,7 +274,7 @@ func defaultStateDir(env *cli.Env) (string, error) {
 }
 
 func (f *fetcher) needsLocalStateDir(command string) bool {
-	return f.remoteURL == "" || slices.Contains([]string{"admin", "run"}, command)
+	return f.remoteURL == "" || slices.Contains([]string{"admin", "run", "stats"}, command)
 }
 
 // Run orchestration.
@@ -208,6 +286,12 @@ func (f *fetcher) run(ctx context.Context) error {
 	f.running.Store(true)
 	defer f.running.Store(false)
 
+	retention, err := f.loadRetention()
+	if err != nil {
+		return err
+	}
+	f.statsRetention = retention
+
 	if err := f.acquireRunLock(); err != nil {
 		return err
 	}
@@ -252,15 +336,36 @@ func (f *fetcher) run(ctx context.Context) error {
 		}
 	}
 
-	fetchWg := syncx.NewLimitedWaitGroup(fetchConcurrencyLimit)
+	// robots.txt of a host is fetched like the first of its feeds.
+	hostFeeds := make(map[string]*feed)
+	for _, feed := range f.feeds {
+		if host := feedHost(feed.url); hostFeeds[host] == nil {
+			hostFeeds[host] = feed
+		}
+	}
+	f.hostLimiter = hostlimit.New(hostlimit.Config{
+		Default: hostlimit.Limits{MaxConcurrency: defaultHostConcurrency},
+		Hosts:   f.hostLimits,
+		CrawlDelay: func(ctx context.Context, host string) time.Duration {
+			fd, ok := hostFeeds[host]
+			if !ok {
+				return 0
+			}
+			return f.robotsCrawlDelay(ctx, fd)
+		},
+	})
+
+	tasks := make([]hostlimit.Task, 0, len(f.feeds))
 	for _, feed := range shuffle(f.feeds) {
-		fetchWg.Go(func() {
-			defer fetchedFeeds.Add(1)
-			f.runFeedFetch(ctx, feed, updates)
+		tasks = append(tasks, hostlimit.Task{
+			Host: feedHost(feed.url),
+			Run: func() {
+				defer fetchedFeeds.Add(1)
+				f.runFeedFetch(ctx, feed, updates)
+			},
 		})
 	}
-
-	fetchWg.Wait()
+	f.hostLimiter.Run(ctx, fetchConcurrencyLimit, tasks)
 	close(updates)
 	baseWg.Wait()
 
@@ -339,6 +444,11 @@ func (f *fetcher) run(ctx context.Context) error {
 			f.slog.Warn("failed to upload stats", "error", err)
 		}
 	})
+	if res, err := f.statsStore.ApplyRetention(saveCtx, f.statsRetention, time.Now()); err != nil {
+		f.slog.Warn("failed to apply stats retention", "error", err)
+	} else if res.RunsRolledUp > 0 || res.HourlyRolledUp > 0 || res.ItemsPruned > 0 {
+		f.slog.Debug("rolled up old stats", "runs", res.RunsRolledUp, "hourly", res.HourlyRolledUp, "items", res.ItemsPruned)
+	}
 
 	return runErr
 }
@@ -378,12 +488,14 @@ func (f *fetcher) runFeedFetch(ctx context.Context, fd *feed, updates chan *upda
 	var retries int
 	var feedRetried bool
 
+	host := feedHost(fd.url)
+	policy := f.retryPolicy(host)
 	for {
-		retry, retryIn := f.fetch(ctx, fd, updates)
-		if !retry {
+		decision := f.fetch(ctx, fd, updates)
+		if !decision.Retry {
 			break
 		}
-		if !f.retryFeedFetch(ctx, fd, retries, retryIn) {
+		if !f.retryFeedFetch(ctx, fd, host, policy, retries, decision) {
 			break
 		}
 		feedRetried = true
@@ -397,32 +509,57 @@ func (f *fetcher) runFeedFetch(ctx context.Context, fd *feed, updates chan *upda
 	}
 }
 
-func (f *fetcher) retryFeedFetch(ctx context.Context, fd *feed, retries int, retryIn time.Duration) bool {
-	if retries >= retryLimit {
+func (f *fetcher) retryFeedFetch(ctx context.Context, fd *feed, host string, policy *retry.Policy, retries int, decision retry.Decision) bool {
+	retryIn := decision.Wait
+	if retryIn == 0 {
+		retryIn = policy.Backoff(retries)
+	}
+	record := func(outcome stats.RetryOutcome) {
+		f.stats.WriteAccess(func(s *stats.Run) {
+			s.RecordRetryDecision(stats.RetryDecision{
+				URL:     fd.url,
+				Host:    host,
+				Attempt: retries + 1,
+				Reason:  string(decision.Reason),
+				Wait:    retryIn,
+				Outcome: outcome,
+			})
+		})
+	}
+
+	if retries >= policy.MaxRetries {
+		record(stats.RetryOutcomeRetryLimit)
 		f.handleFetchFailure(ctx, fd.url, fmt.Errorf("retry limit exceeded after %d retries", retries))
 		return false
 	}
-	if retryIn > maxRetryTime {
+	if retryIn > policy.MaxWait {
 		f.slog.Warn("feed retry time is too long, not retrying at all",
 			"feed", fd.url,
 			"retry_in", retryIn.String(),
-			"max_retry_time", maxRetryTime.String(),
+			"max_retry_time", policy.MaxWait.String(),
 		)
-		f.handleFetchFailure(ctx, fd.url, fmt.Errorf("retry wait %s exceeds max retry time %s", retryIn, maxRetryTime))
+		record(stats.RetryOutcomeMaxWait)
+		f.handleFetchFailure(ctx, fd.url, fmt.Errorf("retry wait %s exceeds max retry time %s", retryIn, policy.MaxWait))
 		return false
 	}
 
+	record(stats.RetryOutcomeRetried)
 	f.stats.WriteAccess(func(s *stats.Run) {
 		s.FetchRetriesTotal += 1
 		s.BackoffSleepTotal += retryIn
 		s.FeedStats(fd.url).Retries += 1
-		s.SpecialRateLimitRetries += 1
+		switch decision.Reason {
+		case retry.ReasonHostHandler, retry.ReasonWaitPattern, retry.ReasonRetryAfter:
+			// The server asked us to slow down.
+			s.SpecialRateLimitRetries += 1
+		}
 	})
 	f.slog.Warn("retrying feed",
 		"feed", fd.url,
+		"reason", decision.Reason,
 		"retry_in", retryIn.String(),
 		"retries", retries+1,
-		"retry_limit", retryLimit,
+		"retry_limit", policy.MaxRetries,
 	)
 	return ctxsleep.Sleep(ctx, retryIn)
 }
@@ -476,6 +613,64 @@ func (f *fetcher) listFeeds(ctx context.Context, w io.Writer) error {
 	return nil
 }
 
+// printStats prints the latest run summaries or rollups as a table.
+//
+// Usage: tgfeed stats [run|hour|day] [limit]
+func (f *fetcher) printStats(ctx context.Context, w io.Writer, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("%w: stats command expects at most a period and a limit", cli.ErrInvalidArgs)
+	}
+	if f.remoteURL != "" {
+		return fmt.Errorf("%w: stats command reads the local stats database, use /api/stats/export of the admin API instead", cli.ErrInvalidArgs)
+	}
+
+	period := "run"
+	if len(args) > 0 {
+		period = args[0]
+	}
+	limit := 20
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%w: limit must be a positive number, got %q", cli.ErrInvalidArgs, args[1])
+		}
+		limit = n
+	}
+
+	store := stats.OpenReader(f.stateDir)
+	defer store.Close()
+
+	var table stats.Table
+	if period == "run" {
+		runs, err := store.ListRunSummaries(ctx, limit, nil)
+		if err != nil {
+			return fmt.Errorf("reading stats: %w", err)
+		}
+		table = stats.RunSummaryTable(runs)
+	} else {
+		p, err := stats.ParsePeriod(period)
+		if err != nil {
+			return fmt.Errorf("%w: %v", cli.ErrInvalidArgs, err)
+		}
+		rollups, err := store.ListRollups(ctx, p, limit, nil)
+		if err != nil {
+			return fmt.Errorf("reading stats: %w", err)
+		}
+		table = stats.RollupTable(rollups)
+	}
+
+	if len(table.Rows) == 0 {
+		fmt.Fprintln(w, "No stats available.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(table.Header, "\t"))
+	for _, row := range table.Rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
 func pluralize(n int64) string {
 	if n > 1 {
 		return fmt.Sprintf("%d times", n)
@@ -592,6 +787,40 @@ func (f *fetcher) ask(prompt string, stdin io.Reader) bool {
 	}
 }
 
+// loadRetention reads stats and archive retention periods from the
+// environment.
+func (f *fetcher) loadRetention() (stats.Retention, error) {
+	r := stats.DefaultRetention
+	for _, v := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"STATS_RAW_RETENTION_DAYS", &r.Raw},
+		{"STATS_HOURLY_RETENTION_DAYS", &r.Hourly},
+		{"ARCHIVE_RETENTION_DAYS", &r.Items},
+	} {
+		if err := parseDays(v.name, f.getenv(v.name), v.dst); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// parseDays parses s, the value of the environment variable name, as a
+// number of days into dst, leaving it unchanged if s is empty. Zero is valid
+// and means forever for retention periods.
+func parseDays(name, s string, dst *time.Duration) error {
+	if s == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%s should be a non-negative number of days, got %q", name, s)
+	}
+	*dst = time.Duration(n) * 24 * time.Hour
+	return nil
+}
+
 func parseInt(s string) int64 {
 	i, err := strconv.ParseInt(s, 10, 64)
 	if err == nil {
@@ -611,6 +840,9 @@ func shuffle[S any](s []S) []S {
 func (f *fetcher) doInit(ctx context.Context) {
 	env := cli.GetEnv(ctx)
 	f.logf = log.New(env.Stderr, "", 0).Printf
+	if f.getenv == nil {
+		f.getenv = env.Getenv
+	}
 
 	if f.httpc == nil {
 		f.httpc = &http.Client{
@@ -619,8 +851,14 @@ func (f *fetcher) doInit(ctx context.Context) {
 	}
 	f.fp = gofeed.NewParser()
 
-	if f.tgToken != "" {
-		f.scrubber = strings.NewReplacer(f.tgToken, "[EXPUNGED]")
+	var secrets []string
+	for _, secret := range []string{f.tgToken, f.ghToken, f.gitlabToken, f.giteaToken, f.forgejoToken, f.llmAPIKey} {
+		if secret != "" {
+			secrets = append(secrets, secret, "[EXPUNGED]")
+		}
+	}
+	if len(secrets) > 0 {
+		f.scrubber = strings.NewReplacer(secrets...)
 	}
 
 	l := logger.Get(ctx)
@@ -637,6 +875,15 @@ func (f *fetcher) doInit(ctx context.Context) {
 		})
 	}
 
+	if f.llm == nil && f.llmAPIURL != "" && f.llmAPIKey != "" {
+		f.llm = &llm.Client{
+			APIURL:     f.llmAPIURL,
+			APIKey:     f.llmAPIKey,
+			HTTPClient: f.httpc,
+			Scrubber:   f.scrubber,
+		}
+	}
+
 	if f.store == nil {
 		f.store = state.NewStore(state.Options{
 			StateDir:             f.stateDir,
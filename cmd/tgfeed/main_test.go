@@ -9,6 +9,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
@@ -20,6 +21,7 @@ import (
 	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"go.astrophena.name/base/cli"
 	"go.astrophena.name/base/cli/clitest"
@@ -90,6 +92,14 @@ func TestFetcherMain(t *testing.T) {
 				testutil.AssertEqual(t, st.Disabled, false)
 			},
 		},
+		"stats with invalid period": {
+			Args:    []string{"stats", "week"},
+			WantErr: cli.ErrInvalidArgs,
+		},
+		"stats with invalid limit": {
+			Args:    []string{"stats", "day", "-1"},
+			WantErr: cli.ErrInvalidArgs,
+		},
 		"reenable non-existent feed": {
 			Args:    []string{"reenable", "https://example.com/non-existent.xml"},
 			WantErr: errNoFeed,
@@ -98,6 +108,66 @@ func TestFetcherMain(t *testing.T) {
 	)
 }
 
+func TestStatsCommand(t *testing.T) {
+	t.Parallel()
+
+	env := newDefaultTestEnv(t, map[string]http.HandlerFunc{
+		atomFeedRoute: func(w http.ResponseWriter, r *http.Request) {
+			w.Write(atomFeed)
+		},
+	})
+	f := newTestFetcher(t, env)
+	if err := f.run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.statsStore.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := f.printStats(t.Context(), &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	testutil.AssertEqual(t, len(lines), 2)
+	if !strings.HasPrefix(lines[0], "start_time ") {
+		t.Fatalf("unexpected header: %q", lines[0])
+	}
+
+	out.Reset()
+	if err := f.printStats(t.Context(), &out, []string{"day", "5"}); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, out.String(), "No stats available.\n")
+}
+
+func TestParseDays(t *testing.T) {
+	t.Parallel()
+
+	const def = 30 * 24 * time.Hour
+	cases := map[string]struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		"unset":    {in: "", want: def},
+		"zero":     {in: "0", want: 0},
+		"days":     {in: "7", want: 7 * 24 * time.Hour},
+		"negative": {in: "-1", wantErr: true},
+		"invalid":  {in: "week", wantErr: true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := def
+			err := parseDays("STATS_RAW_RETENTION_DAYS", tc.in, &got)
+			testutil.AssertEqual(t, err != nil, tc.wantErr)
+			if !tc.wantErr {
+				testutil.AssertEqual(t, got, tc.want)
+			}
+		})
+	}
+}
+
 func TestRemoteClientDoesNotCreateStateDir(t *testing.T) {
 	t.Parallel()
 
@@ -111,6 +181,12 @@ func TestRemoteClientDoesNotCreateStateDir(t *testing.T) {
 	mux.HandleFunc("/api/error-template", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("test"))
 	})
+	mux.HandleFunc("/api/topics", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/api/templates", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
 	server := httptest.NewServer(mux)
 	t.Cleanup(server.Close)
 
@@ -259,7 +335,7 @@ func newTestEnv(t *testing.T, baseState fs.FS, overrides map[string]http.Handler
 		defer env.mu.Unlock()
 		sentMessage := read(t, r.Body)
 		env.sentMessages = append(env.sentMessages, testutil.UnmarshalJSON[map[string]any](t, sentMessage))
-		w.Write([]byte("{}"))
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, len(env.sentMessages))
 	}))
 	for pat, h := range overrides {
 		if slices.Contains([]string{sendTelegram}, pat) {
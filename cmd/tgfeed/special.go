@@ -10,9 +10,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 
 	"go.astrophena.name/tools/cmd/tgfeed/internal/ghnotify"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/ghrelease"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/giteanotify"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/gltodo"
 )
 
 // Special feed support.
@@ -32,6 +36,14 @@ func (f *fetcher) handleSpecialFeed(req *http.Request) (*http.Response, error) {
 	switch typ := req.URL.Host; typ {
 	case "github-notifications":
 		h = ghnotify.Handler(f.ghToken, f.slog, f.httpc)
+	case "github-releases":
+		h = ghrelease.Handler(f.ghToken, f.slog, f.httpc)
+	case "gitlab-todos":
+		h = gltodo.Handler(f.gitlabURL, f.gitlabToken, f.slog, f.httpc)
+	case "gitea-notifications":
+		h = giteanotify.Handler(f.giteaURL, f.giteaToken, f.slog, f.httpc)
+	case "forgejo-notifications":
+		h = giteanotify.Handler(f.forgejoURL, f.forgejoToken, f.slog, f.httpc)
 	default:
 		return nil, fmt.Errorf("unknown special feed type %s", typ)
 	}
@@ -40,11 +52,34 @@ func (f *fetcher) handleSpecialFeed(req *http.Request) (*http.Response, error) {
 	return rec.Result(), nil
 }
 
-func (f *fetcher) specialFeedAcknowledger(url string) func(context.Context, []string) error {
-	if url != "tgfeed://github-notifications" {
+// specialFeedAcknowledger returns a function that marks delivered items as
+// done at their source, or nil if the special feed has no such concept.
+func (f *fetcher) specialFeedAcknowledger(feedURL string) func(context.Context, []string) error {
+	if !isSpecialFeed(feedURL) {
 		return nil
 	}
-	return func(ctx context.Context, ids []string) error {
-		return ghnotify.MarkAsDone(ctx, f.ghToken, f.httpc, ids)
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil
+	}
+
+	switch u.Host {
+	case "github-notifications":
+		return func(ctx context.Context, ids []string) error {
+			return ghnotify.MarkAsDone(ctx, f.ghToken, f.httpc, ids)
+		}
+	case "gitlab-todos":
+		return func(ctx context.Context, ids []string) error {
+			return gltodo.MarkAsDone(ctx, f.gitlabURL, f.gitlabToken, f.httpc, ids)
+		}
+	case "gitea-notifications":
+		return func(ctx context.Context, ids []string) error {
+			return giteanotify.MarkAsRead(ctx, f.giteaURL, f.giteaToken, f.httpc, ids)
+		}
+	case "forgejo-notifications":
+		return func(ctx context.Context, ids []string) error {
+			return giteanotify.MarkAsRead(ctx, f.forgejoURL, f.forgejoToken, f.httpc, ids)
+		}
 	}
+	return nil
 }
@@ -7,12 +7,16 @@ package main
 import (
 	"net/http"
 	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 
 	"go.astrophena.name/base/cli"
 	"go.astrophena.name/base/rr"
 	"go.astrophena.name/base/testutil"
 	"go.astrophena.name/base/txtar"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/gltodo"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
 )
 
 func TestGitHubNotificationsFeed(t *testing.T) {
@@ -43,6 +47,65 @@ func TestGitHubNotificationsFeed(t *testing.T) {
 	testutil.AssertEqual(t, len(env.sentMessages), 4)
 }
 
+func TestGitLabTodosFeed(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		done []string
+	)
+	config := []byte(`feed(url = "tgfeed://gitlab-todos")`)
+	env := newTestEnv(t, stateArchive(t, config, map[string]*state.Feed{
+		"tgfeed://gitlab-todos": {},
+	}), map[string]http.HandlerFunc{
+		"GET gitlab.com/api/v4/todos": func(w http.ResponseWriter, r *http.Request) {
+			testutil.AssertEqual(t, r.Header.Get("PRIVATE-TOKEN"), "gitlabsecret")
+			w.Write([]byte(`[
+				{"id": 1, "action_name": "mentioned", "target_url": "https://gitlab.com/a/b/-/issues/1", "created_at": "2026-01-01T00:00:00Z", "target": {"title": "First"}, "author": {"username": "alice"}},
+				{"id": 2, "action_name": "assigned", "target_url": "https://gitlab.com/a/b/-/issues/2", "created_at": "2026-01-02T00:00:00Z", "target": {"title": "Second"}, "author": {"username": "bob"}}
+			]`))
+		},
+		"POST gitlab.com/api/v4/todos/{id}/mark_as_done": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			done = append(done, r.PathValue("id"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		},
+	})
+	f := newTestFetcher(t, env)
+	f.gitlabToken = "gitlabsecret"
+	f.gitlabURL = gltodo.DefaultURL
+
+	if err := f.run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	state := env.state(t)["tgfeed://gitlab-todos"]
+	testutil.AssertEqual(t, state.ErrorCount, 0)
+	testutil.AssertEqual(t, len(state.SeenItems), 2)
+	testutil.AssertEqual(t, len(env.sentMessages), 2)
+	slices.Sort(done)
+	testutil.AssertEqual(t, done, []string{"1", "2"})
+}
+
+func TestSpecialFeedAcknowledger(t *testing.T) {
+	t.Parallel()
+
+	f := new(fetcher)
+	cases := map[string]bool{
+		"tgfeed://github-notifications":                  true,
+		"tgfeed://gitlab-todos":                          true,
+		"tgfeed://gitea-notifications":                   true,
+		"tgfeed://forgejo-notifications":                 true,
+		"tgfeed://github-releases?repo=golang/go":        false,
+		"https://example.com/feed.xml":                   false,
+		"https://github-notifications/tgfeed://feed.xml": false,
+	}
+	for url, want := range cases {
+		testutil.AssertEqual(t, f.specialFeedAcknowledger(url) != nil, want)
+	}
+}
+
 type roundTripper struct{ main, notifications http.RoundTripper }
 
 func (rt *roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
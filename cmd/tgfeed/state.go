@@ -11,9 +11,12 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"time"
 
 	"go.astrophena.name/tools/cmd/tgfeed/internal/format"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/hostlimit"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/retry"
 	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
 	"go.astrophena.name/tools/internal/filelock"
 	"go.astrophena.name/tools/internal/starlark/interpreter"
@@ -28,11 +31,18 @@ type feed struct {
 	url                string
 	title              string
 	messageThreadID    int64
+	topic              string
 	blockRule          *starlark.Function
 	keepRule           *starlark.Function
 	digest             bool
 	format             *starlark.Function
+	template           string
+	translateTo        string
 	alwaysSendNewItems bool
+	headers            map[string]string
+	auth               *feedAuth
+	proxy              string
+	timeout            time.Duration
 }
 
 func newFeedBuiltin(feeds *[]*feed) *starlark.Builtin {
@@ -41,32 +51,219 @@ func newFeedBuiltin(feeds *[]*feed) *starlark.Builtin {
 			return nil, fmt.Errorf("unexpected positional arguments")
 		}
 
-		f := new(feed)
+		var (
+			f       = new(feed)
+			headers *starlark.Dict
+			auth    starlark.Value
+			timeout string
+		)
 		if err := starlark.UnpackArgs("feed", args, kwargs,
 			"url", &f.url,
 			"title?", &f.title,
 			"message_thread_id?", &f.messageThreadID,
+			"topic?", &f.topic,
 			"block_rule?", &f.blockRule,
 			"keep_rule?", &f.keepRule,
 			"digest?", &f.digest,
 			"format?", &f.format,
+			"template?", &f.template,
+			"translate_to?", &f.translateTo,
 			"always_send_new_items?", &f.alwaysSendNewItems,
+			"headers?", &headers,
+			"auth?", &auth,
+			"proxy?", &f.proxy,
+			"timeout?", &timeout,
 		); err != nil {
 			return nil, err
 		}
 
+		if err := validateTopic(f.topic); err != nil {
+			return nil, fmt.Errorf("feed %q: %w", f.url, err)
+		}
+		if f.format != nil && f.template != "" {
+			return nil, fmt.Errorf("feed %q: format and template are mutually exclusive", f.url)
+		}
+		if f.topic != "" && f.messageThreadID != 0 {
+			return nil, fmt.Errorf("feed %q: topic and message_thread_id are mutually exclusive", f.url)
+		}
+
+		var err error
+		if f.headers, err = unpackHeaders(headers); err != nil {
+			return nil, fmt.Errorf("feed %q: %w", f.url, err)
+		}
+		if f.auth, err = unpackAuth(auth); err != nil {
+			return nil, fmt.Errorf("feed %q: %w", f.url, err)
+		}
+		if err := validateProxy(f.proxy); err != nil {
+			return nil, fmt.Errorf("feed %q: %w", f.url, err)
+		}
+		if f.translateTo, err = validateTranslateTo(f.translateTo); err != nil {
+			return nil, fmt.Errorf("feed %q: %w", f.url, err)
+		}
+		if f.timeout, err = parseTimeout(timeout); err != nil {
+			return nil, fmt.Errorf("feed %q: %w", f.url, err)
+		}
+
 		*feeds = append(*feeds, f)
 		return starlark.None, nil
 	})
 }
 
+func newRetryPolicyBuiltin(policies map[string]*retry.Policy) *starlark.Builtin {
+	return starlark.NewBuiltin("retry_policy", func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("unexpected positional arguments")
+		}
+
+		var (
+			p = retry.DefaultPolicy()
+
+			host, backoff, initialWait, maxWait, waitPattern string
+			transientStatus                                  *starlark.List
+		)
+		if err := starlark.UnpackArgs("retry_policy", args, kwargs,
+			"host", &host,
+			"max_retries?", &p.MaxRetries,
+			"backoff?", &backoff,
+			"initial_wait?", &initialWait,
+			"max_wait?", &maxWait,
+			"wait_pattern?", &waitPattern,
+			"transient_status?", &transientStatus,
+		); err != nil {
+			return nil, err
+		}
+
+		if host == "" {
+			return nil, errors.New("retry_policy: host must not be empty")
+		}
+		if _, dup := policies[host]; dup {
+			return nil, fmt.Errorf("retry_policy: duplicate policy for host %q", host)
+		}
+		if p.MaxRetries < 0 {
+			return nil, fmt.Errorf("retry_policy: max_retries must not be negative")
+		}
+		if backoff != "" {
+			curve, err := retry.ParseCurve(backoff)
+			if err != nil {
+				return nil, fmt.Errorf("retry_policy: %w", err)
+			}
+			p.Curve = curve
+		}
+		if err := parseDurationArg("retry_policy", "initial_wait", initialWait, &p.InitialWait); err != nil {
+			return nil, err
+		}
+		if err := parseDurationArg("retry_policy", "max_wait", maxWait, &p.MaxWait); err != nil {
+			return nil, err
+		}
+		if waitPattern != "" {
+			re, err := regexp.Compile(waitPattern)
+			if err != nil {
+				return nil, fmt.Errorf("retry_policy: invalid wait_pattern: %w", err)
+			}
+			if re.NumSubexp() < 1 {
+				return nil, errors.New("retry_policy: wait_pattern must have a capture group for the wait time")
+			}
+			p.WaitPattern = re
+		}
+		if transientStatus != nil {
+			for v := range transientStatus.Elements() {
+				code, err := starlark.AsInt32(v)
+				if err != nil {
+					return nil, fmt.Errorf("retry_policy: transient_status: %w", err)
+				}
+				if code < 100 || code > 599 {
+					return nil, fmt.Errorf("retry_policy: transient_status: invalid HTTP status %d", code)
+				}
+				p.TransientStatus = append(p.TransientStatus, code)
+			}
+		}
+
+		policies[host] = p
+		return starlark.None, nil
+	})
+}
+
+func newHostLimitsBuiltin(limits map[string]hostlimit.Limits) *starlark.Builtin {
+	return starlark.NewBuiltin("host_limits", func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("unexpected positional arguments")
+		}
+
+		var (
+			l = hostlimit.Limits{MaxConcurrency: defaultHostConcurrency}
+
+			host, minDelay string
+		)
+		if err := starlark.UnpackArgs("host_limits", args, kwargs,
+			"host", &host,
+			"max_concurrency?", &l.MaxConcurrency,
+			"min_delay?", &minDelay,
+			"robots_txt?", &l.RobotsTxt,
+		); err != nil {
+			return nil, err
+		}
+
+		if host == "" {
+			return nil, errors.New("host_limits: host must not be empty")
+		}
+		if _, dup := limits[host]; dup {
+			return nil, fmt.Errorf("host_limits: duplicate limits for host %q", host)
+		}
+		if l.MaxConcurrency < 0 {
+			return nil, errors.New("host_limits: max_concurrency must not be negative")
+		}
+		if err := parseDurationArg("host_limits", "min_delay", minDelay, &l.MinDelay); err != nil {
+			return nil, err
+		}
+
+		limits[host] = l
+		return starlark.None, nil
+	})
+}
+
+// parseDurationArg parses a non-negative duration argument name of builtin fn
+// into dst, leaving it unchanged if s is empty.
+func parseDurationArg(fn, name, s string, dst *time.Duration) error {
+	if s == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%s: invalid %s: %w", fn, name, err)
+	}
+	if d < 0 {
+		return fmt.Errorf("%s: %s must not be negative", fn, name)
+	}
+	*dst = d
+	return nil
+}
+
 // Configuration parsing and validation.
 
-func (f *fetcher) parseConfig(ctx context.Context, config string) ([]*feed, error) {
-	var feeds []*feed
+// parsedConfig is the result of evaluating config.star.
+type parsedConfig struct {
+	feeds         []*feed
+	retryPolicies map[string]*retry.Policy
+	hostLimits    map[string]hostlimit.Limits
+}
+
+func (f *fetcher) parseConfig(ctx context.Context, config string) (*parsedConfig, error) {
+	return f.parseConfigTemplates(ctx, config, f.templates)
+}
+
+// parseConfigTemplates is like parseConfig, but validates feed templates
+// against templates instead of the loaded ones.
+func (f *fetcher) parseConfigTemplates(ctx context.Context, config string, templates *format.Templates) (*parsedConfig, error) {
+	var (
+		feeds      []*feed
+		policies   = make(map[string]*retry.Policy)
+		hostLimits = make(map[string]hostlimit.Limits)
+	)
 	intr := &interpreter.Interpreter{
 		Predeclared: starlark.StringDict{
-			"feed": newFeedBuiltin(&feeds),
+			"feed":         newFeedBuiltin(&feeds),
+			"retry_policy": newRetryPolicyBuiltin(policies),
+			"host_limits":  newHostLimitsBuiltin(hostLimits),
 		},
 		Packages: map[string]interpreter.Loader{
 			interpreter.MainPkg: interpreter.MemoryLoader(map[string]string{
@@ -100,16 +297,31 @@ func (f *fetcher) parseConfig(ctx context.Context, config string) ([]*feed, erro
 	}
 
 	for _, feed := range feeds {
-		if err := f.validateFeedFormat(feed); err != nil {
+		if err := f.validateFeedFormat(feed, templates); err != nil {
 			return nil, err
 		}
 	}
 
-	return feeds, nil
+	return &parsedConfig{
+		feeds:         feeds,
+		retryPolicies: policies,
+		hostLimits:    hostLimits,
+	}, nil
+}
+
+// validateConfig checks that config and message templates, keyed by name,
+// are valid together.
+func (f *fetcher) validateConfig(ctx context.Context, config string, templates map[string]string) error {
+	parsedTemplates, err := format.ParseTemplates(templates)
+	if err != nil {
+		return fmt.Errorf("parsing templates: %w", err)
+	}
+	_, err = f.parseConfigTemplates(ctx, config, parsedTemplates)
+	return err
 }
 
-func (f *fetcher) validateFeedFormat(fd *feed) error {
-	if fd.format == nil {
+func (f *fetcher) validateFeedFormat(fd *feed, templates *format.Templates) error {
+	if fd.format == nil && fd.template == "" {
 		return nil
 	}
 
@@ -134,6 +346,17 @@ func (f *fetcher) validateFeedFormat(fd *feed) error {
 			Published: time.Now().Format(time.RFC3339),
 		}},
 	}
+
+	if fd.template != "" {
+		if !templates.Has(fd.template) {
+			return fmt.Errorf("template %q of feed %q is not defined in the templates directory", fd.template, fd.url)
+		}
+		if _, err := templates.Render(fd.template, update); err != nil {
+			return fmt.Errorf("template %q for feed %q failed: %w", fd.template, fd.url, err)
+		}
+		return nil
+	}
+
 	items, _ := format.BuildFormatInput(update)
 
 	value, err := format.CallStarlarkFormatter(fd.format, items, func(msg string) { f.slog.Info(msg) })
@@ -155,6 +378,11 @@ func (f *fetcher) loadState(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	templates, err := format.ParseTemplates(snapshot.Templates)
+	if err != nil {
+		return fmt.Errorf("parsing templates: %w", err)
+	}
+	f.templates = templates
 	if err := f.loadConfig(ctx, snapshot.Config); err != nil {
 		return err
 	}
@@ -167,17 +395,23 @@ func (f *fetcher) loadState(ctx context.Context) error {
 	f.stateMu.Lock()
 	f.state = snapshot.State
 	f.stateMu.Unlock()
+	f.topicsMu.Lock()
+	f.topics = snapshot.Topics
+	f.topicsMu.Unlock()
 	return nil
 }
 
 func (f *fetcher) loadConfig(ctx context.Context, config string) error {
-	feeds, err := f.parseConfig(ctx, config)
+	parsed, err := f.parseConfig(ctx, config)
 	if err != nil {
 		return err
 	}
 
 	f.config = config
-	f.feeds = feeds
+	f.feeds = parsed.feeds
+	f.retryPolicies = parsed.retryPolicies
+	f.hostLimits = parsed.hostLimits
+	f.secretScrubber = newSecretScrubber(parsed.feeds, f.getenv)
 	return nil
 }
 
@@ -253,18 +487,23 @@ func (f *fetcher) pruneFeedState(keep map[string]struct{}) {
 // Run locking.
 
 func (f *fetcher) acquireRunLock() error {
-	lockPath := filepath.Join(f.stateDir, ".run.lock")
-	lock, err := filelock.Acquire(lockPath, fmt.Sprintf("pid=%d\n", os.Getpid()))
+	lock, err := f.lockRun()
 	if err != nil {
 		if errors.Is(err, filelock.ErrAlreadyLocked) {
 			err = errAlreadyRunning
 		}
-		return fmt.Errorf("%w: lock file exists at %s", err, lockPath)
+		return fmt.Errorf("%w: lock file exists at %s", err, f.runLockPath())
 	}
 	f.runLock = lock
 	return nil
 }
 
+// lockRun acquires the run lock without recording it in f, for commands and
+// admin API handlers that must not overlap with a run.
+func (f *fetcher) lockRun() (filelock.Lock, error) {
+	return filelock.Acquire(f.runLockPath(), fmt.Sprintf("pid=%d\n", os.Getpid()))
+}
+
 func (f *fetcher) releaseRunLock() error {
 	err := f.runLock.Release()
 	f.runLock = nil
@@ -272,5 +511,9 @@ func (f *fetcher) releaseRunLock() error {
 }
 
 func (f *fetcher) isRunLocked() bool {
-	return filelock.IsLocked(filepath.Join(f.stateDir, ".run.lock"))
+	return filelock.IsLocked(f.runLockPath())
+}
+
+func (f *fetcher) runLockPath() string {
+	return filepath.Join(f.stateDir, ".run.lock")
 }
@@ -0,0 +1,107 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
+)
+
+// maxTopicNameLen is the maximum length of a Telegram forum topic name.
+const maxTopicNameLen = 128
+
+func validateTopic(name string) error {
+	if name == "" {
+		return nil
+	}
+	if strings.TrimSpace(name) == "" {
+		return errors.New("topic: name must not be blank")
+	}
+	if n := utf8.RuneCountInString(name); n > maxTopicNameLen {
+		return fmt.Errorf("topic: name is %d characters long, want at most %d", n, maxTopicNameLen)
+	}
+	return nil
+}
+
+// topicThread returns the message thread ID of the named forum topic,
+// creating the topic if it's not known yet. Created topics are persisted
+// right away, so a failed run doesn't leave duplicates behind.
+func (f *fetcher) topicThread(ctx context.Context, name string) (int64, error) {
+	f.topicsMu.Lock()
+	defer f.topicsMu.Unlock()
+
+	if threadID, ok := f.topics[name]; ok {
+		return threadID, nil
+	}
+
+	creator, ok := f.sender.(sender.TopicCreator)
+	if !ok {
+		return 0, fmt.Errorf("topic %q: sender doesn't support creating topics", name)
+	}
+	thread, err := creator.CreateTopic(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	threadID, err := strconv.ParseInt(thread, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("topic %q: parsing thread ID: %w", name, err)
+	}
+
+	if f.topics == nil {
+		f.topics = make(map[string]int64)
+	}
+	f.topics[name] = threadID
+	f.slog.Info("created forum topic", "topic", name, "message_thread_id", threadID)
+
+	if f.store != nil {
+		if err := f.store.SaveTopics(ctx, maps.Clone(f.topics)); err != nil {
+			f.slog.Warn("failed to save topics", "error", err)
+		}
+	}
+	return threadID, nil
+}
+
+// forgetTopic drops the cached thread ID of the named topic, unless it was
+// already replaced by a concurrent send.
+func (f *fetcher) forgetTopic(name string, threadID int64) {
+	f.topicsMu.Lock()
+	defer f.topicsMu.Unlock()
+	if f.topics[name] == threadID {
+		delete(f.topics, name)
+	}
+}
+
+// sendToThread sends msg to the named forum topic, or to the message thread
+// threadID if topic is empty. A topic that was deleted is created again and
+// the message is resent once. It returns the thread ID msg was delivered to.
+func (f *fetcher) sendToThread(ctx context.Context, topic string, threadID int64, msg sender.Message) (sender.Receipt, int64, error) {
+	if topic == "" {
+		msg.Target.Thread = strconv.FormatInt(threadID, 10)
+		receipt, err := f.sender.Send(ctx, msg)
+		return receipt, threadID, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		threadID, err := f.topicThread(ctx, topic)
+		if err != nil {
+			return sender.Receipt{}, 0, err
+		}
+		msg.Target.Thread = strconv.FormatInt(threadID, 10)
+		receipt, err := f.sender.Send(ctx, msg)
+		if attempt == 0 && errors.Is(err, sender.ErrThreadNotFound) {
+			f.slog.Warn("forum topic not found, creating it again", "topic", topic, "message_thread_id", threadID)
+			f.forgetTopic(topic, threadID)
+			continue
+		}
+		return receipt, threadID, err
+	}
+}
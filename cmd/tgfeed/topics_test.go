@@ -0,0 +1,190 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/base/txtar"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/sender"
+)
+
+func TestFeedTopic(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		topics string
+	}{
+		"new topic":     {},
+		"deleted topic": {topics: `{"Releases":7}`},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ar := &txtar.Archive{Files: []txtar.File{
+				{Name: "config.star", Data: []byte(`feed(url = "https://example.com/feed.xml", topic = "Releases")`)},
+				{Name: "state.json", Data: []byte(`{"https://example.com/feed.xml": {"last_updated": "0001-01-01T00:00:00Z"}}`)},
+			}}
+			if tc.topics != "" {
+				ar.Files = append(ar.Files, txtar.File{Name: "topics.json", Data: []byte(tc.topics)})
+			}
+
+			var (
+				mu       sync.Mutex
+				created  []string
+				threads  []float64
+				notFound int
+			)
+			env := newTestEnv(t, txtarToFS(ar), map[string]http.HandlerFunc{
+				atomFeedRoute: func(w http.ResponseWriter, r *http.Request) {
+					w.Write(atomFeed)
+				},
+				"POST api.telegram.org/{token}/createForumTopic": func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					defer mu.Unlock()
+					req := testutil.UnmarshalJSON[map[string]any](t, read(t, r.Body))
+					created = append(created, req["name"].(string))
+					w.Write([]byte(`{"ok":true,"result":{"message_thread_id":42,"name":"Releases"}}`))
+				},
+				sendTelegram: func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					defer mu.Unlock()
+					req := testutil.UnmarshalJSON[map[string]any](t, read(t, r.Body))
+					thread, _ := req["message_thread_id"].(float64)
+					if thread == 7 {
+						notFound++
+						w.WriteHeader(http.StatusBadRequest)
+						w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message thread not found"}`))
+						return
+					}
+					threads = append(threads, thread)
+					fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, len(threads))
+				},
+			})
+			f := newTestFetcher(t, env)
+			if err := f.run(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+
+			testutil.AssertEqual(t, created, []string{"Releases"})
+			if len(threads) == 0 {
+				t.Fatal("no messages were sent")
+			}
+			for i, thread := range threads {
+				if thread != 42 {
+					t.Errorf("message %d was sent to thread %v, want 42", i, thread)
+				}
+			}
+			if tc.topics != "" {
+				testutil.AssertEqual(t, notFound, 1)
+			}
+
+			topics, err := os.ReadFile(filepath.Join(env.stateDir, "topics.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, testutil.UnmarshalJSON[map[string]int64](t, topics), map[string]int64{"Releases": 42})
+		})
+	}
+}
+
+func TestTopicConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		config  string
+		wantErr string
+	}{
+		"blank topic": {
+			config:  `feed(url = "https://example.com/feed.xml", topic = "  ")`,
+			wantErr: "must not be blank",
+		},
+		"long topic": {
+			config:  `feed(url = "https://example.com/feed.xml", topic = "` + strings.Repeat("a", maxTopicNameLen+1) + `")`,
+			wantErr: "want at most 128",
+		},
+		"topic and thread": {
+			config:  `feed(url = "https://example.com/feed.xml", topic = "Releases", message_thread_id = 7)`,
+			wantErr: "mutually exclusive",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newTestFetcher(t, newTestEnv(t, nil, nil))
+			_, err := f.parseConfig(t.Context(), tc.config)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("parseConfig() error = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// topicSender is a sender that supports creating topics and reports threads
+// in deleted as not found.
+type topicSender struct {
+	captureSender
+	created []string
+	deleted map[string]bool
+}
+
+func (s *topicSender) CreateTopic(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created = append(s.created, name)
+	return strconv.Itoa(100 + len(s.created)), nil
+}
+
+func (s *topicSender) Send(ctx context.Context, msg sender.Message) (sender.Receipt, error) {
+	if s.deleted[msg.Target.Thread] {
+		return sender.Receipt{}, fmt.Errorf("sending: %w", sender.ErrThreadNotFound)
+	}
+	return s.captureSender.Send(ctx, msg)
+}
+
+func TestErrNotifyTopic(t *testing.T) {
+	t.Parallel()
+
+	s := &topicSender{}
+	f := &fetcher{slog: slog.Default(), sender: s, errorTopic: "Errors", errorThreadID: 7}
+
+	for range 2 {
+		if err := f.errNotify(t.Context(), errors.New("boom")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testutil.AssertEqual(t, s.created, []string{"Errors"})
+	testutil.AssertEqual(t, len(s.messages), 2)
+	for _, msg := range s.messages {
+		testutil.AssertEqual(t, msg.Target.Thread, "101")
+	}
+
+	// A deleted topic is created again once.
+	s.deleted = map[string]bool{"101": true}
+	if err := f.errNotify(t.Context(), errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, s.created, []string{"Errors", "Errors"})
+	testutil.AssertEqual(t, s.messages[2].Target.Thread, "102")
+	testutil.AssertEqual(t, f.topics, map[string]int64{"Errors": 102})
+
+	// Resending to a topic that was just created doesn't loop.
+	s.deleted["102"], s.deleted["103"] = true, true
+	if err := f.errNotify(t.Context(), errors.New("boom")); !errors.Is(err, sender.ErrThreadNotFound) {
+		t.Fatalf("errNotify() error = %v, want %v", err, sender.ErrThreadNotFound)
+	}
+	testutil.AssertEqual(t, len(s.created), 3)
+}
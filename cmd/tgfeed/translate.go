@@ -0,0 +1,199 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.astrophena.name/tools/cmd/tgfeed/internal/format"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/langdetect"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+	"go.astrophena.name/tools/internal/api/llm"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+const (
+	defaultLLMModel = "gpt-4.1-mini"
+	// maxSummaryLen caps the length of summaries sent for translation, so a
+	// feed that puts whole articles into descriptions doesn't burn tokens.
+	maxSummaryLen = 2000
+)
+
+const translateInstructions = `You translate feed items for a news reader.
+Translate the title and summary of the item given as JSON into the language with ISO 639-1 code %q.
+Keep names, code, URLs and numbers as they are.
+Reply with a JSON object with "title" and "summary" string fields and nothing else.`
+
+// translation is the title and summary of a feed item, as sent to and
+// received from the LLM.
+type translation struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+func validateTranslateTo(lang string) (string, error) {
+	if lang == "" {
+		return "", nil
+	}
+	norm := langdetect.Normalize(lang)
+	if norm == "" {
+		return "", fmt.Errorf("translate_to: %q is not a language code", lang)
+	}
+	return norm, nil
+}
+
+// translateItems returns items with titles and summaries translated into the
+// translate_to language of fd. Items already in that language are returned as
+// is, and so are items that fail to translate, as an untranslated item is
+// better than none. Translated items are copies, leaving the originals to be
+// archived.
+func (f *fetcher) translateItems(ctx context.Context, fd *feed, items []*gofeed.Item) []*gofeed.Item {
+	if fd.translateTo == "" {
+		return items
+	}
+	translated := make([]*gofeed.Item, 0, len(items))
+	for _, item := range items {
+		tr, err := f.translateItem(ctx, fd, item)
+		if err != nil {
+			f.stats.WriteAccess(func(s *stats.Run) {
+				s.TranslationsFailed += 1
+			})
+			f.slog.Warn("failed to translate item", "feed", fd.url, "item", item.Link, "error", err)
+			translated = append(translated, item)
+			continue
+		}
+		translated = append(translated, tr)
+	}
+	return translated
+}
+
+func (f *fetcher) translateItem(ctx context.Context, fd *feed, item *gofeed.Item) (*gofeed.Item, error) {
+	source := format.ItemLanguage(item)
+	if source == fd.translateTo {
+		return item, nil
+	}
+
+	guid := cmp.Or(item.GUID, item.Link)
+	if f.statsStore != nil && guid != "" {
+		cached, ok, err := f.statsStore.LookupTranslation(ctx, fd.url, guid, fd.translateTo)
+		if err != nil {
+			f.slog.Warn("failed to look up cached translation", "feed", fd.url, "item", guid, "error", err)
+		} else if ok {
+			f.stats.WriteAccess(func(s *stats.Run) {
+				s.TranslationCacheHits += 1
+			})
+			return translatedItem(item, fd.translateTo, translation{Title: cached.Title, Summary: cached.Summary}), nil
+		}
+	}
+
+	tr, err := f.translate(ctx, fd.translateTo, translation{
+		Title:   item.Title,
+		Summary: summarize(cmp.Or(item.Description, item.Content)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.stats.WriteAccess(func(s *stats.Run) {
+		s.ItemsTranslated += 1
+	})
+
+	if f.statsStore != nil && guid != "" {
+		if err := f.statsStore.SaveTranslation(ctx, stats.Translation{
+			FeedURL:  fd.url,
+			GUID:     guid,
+			Language: fd.translateTo,
+			Title:    tr.Title,
+			Summary:  tr.Summary,
+		}, time.Now()); err != nil {
+			f.slog.Warn("failed to cache translation", "feed", fd.url, "item", guid, "error", err)
+		}
+	}
+	return translatedItem(item, fd.translateTo, tr), nil
+}
+
+func (f *fetcher) translate(ctx context.Context, lang string, in translation) (translation, error) {
+	if f.llm == nil {
+		return translation{}, errors.New("translation is not configured, set LLM_API_URL and LLM_API_KEY")
+	}
+	input, err := json.Marshal(in)
+	if err != nil {
+		return translation{}, err
+	}
+	resp, err := f.llm.CreateResponse(ctx, llm.ResponseParams{
+		Model:        f.llmModel,
+		Instructions: fmt.Sprintf(translateInstructions, lang),
+		Input: []llm.Message{{
+			Role:    "user",
+			Content: []llm.ContentPart{{Type: "input_text", Text: string(input)}},
+		}},
+	})
+	if err != nil {
+		return translation{}, err
+	}
+	f.stats.WriteAccess(func(s *stats.Run) {
+		s.LLMInputTokens += resp.Usage.InputTokens
+		s.LLMOutputTokens += resp.Usage.OutputTokens
+	})
+
+	var out translation
+	if err := json.Unmarshal([]byte(trimCodeFence(resp.OutputText)), &out); err != nil {
+		return translation{}, fmt.Errorf("parsing translation: %w", err)
+	}
+	if out.Title == "" && in.Title != "" {
+		return translation{}, errors.New("translation has no title")
+	}
+	return out, nil
+}
+
+// translatedItem returns a copy of item with its title replaced by tr, and
+// its description and content by the translated summary, so that none of
+// them is left in the original language.
+func translatedItem(item *gofeed.Item, lang string, tr translation) *gofeed.Item {
+	cp := *item
+	cp.Title = tr.Title
+	if tr.Summary != "" {
+		cp.Description = html.EscapeString(tr.Summary)
+		cp.Content = cp.Description
+	}
+	dc := ext.DublinCoreExtension{}
+	if item.DublinCoreExt != nil {
+		dc = *item.DublinCoreExt
+	}
+	dc.Language = []string{lang}
+	cp.DublinCoreExt = &dc
+	return &cp
+}
+
+// summarize returns the text of an HTML summary, shortened to
+// maxSummaryLen characters.
+func summarize(s string) string {
+	s = strings.TrimSpace(html.UnescapeString(bmStripper.Sanitize(s)))
+	if utf8.RuneCountInString(s) <= maxSummaryLen {
+		return s
+	}
+	return string([]rune(s)[:maxSummaryLen]) + "…"
+}
+
+// trimCodeFence removes a Markdown code fence that models sometimes wrap
+// JSON replies in.
+func trimCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimPrefix(s, "json")
+	return strings.TrimSpace(strings.TrimSuffix(s, "```"))
+}
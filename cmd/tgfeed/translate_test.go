@@ -0,0 +1,199 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/cmd/tgfeed/internal/state"
+	tgstats "go.astrophena.name/tools/cmd/tgfeed/internal/stats"
+	"go.astrophena.name/tools/internal/api/llm"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const mixedLanguageFeed = `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0">
+<channel>
+<title>Mixed</title>
+<link>https://example.com/</link>
+<item>
+<title>Die neue Version ist da</title>
+<link>https://example.com/de</link>
+<guid>de</guid>
+<description>&lt;p&gt;Die neue Version bringt auch viele Verbesserungen mit sich und ist schneller.&lt;/p&gt;</description>
+</item>
+<item>
+<title>The new version is out</title>
+<link>https://example.com/en</link>
+<guid>en</guid>
+<description>The new version of the tool is faster and has many fixes.</description>
+</item>
+<item>
+<title>La nouvelle version est disponible</title>
+<link>https://example.com/fr</link>
+<guid>fr</guid>
+<description>La nouvelle version est plus rapide pour tous les utilisateurs.</description>
+</item>
+</channel>
+</rss>`
+
+const llmResponsesRoute = "POST llm.example.com/v1/responses"
+
+func TestFeedTranslate(t *testing.T) {
+	t.Parallel()
+
+	config := []byte(`feed(
+    url = "https://example.com/feed.xml",
+    translate_to = "en-US",
+    keep_rule = lambda item: item.language != "fr",
+)`)
+
+	cases := map[string]struct {
+		llmStatus  int
+		wantTitles []string
+		wantStats  func(t *testing.T, s *tgstats.Run)
+	}{
+		"translated": {
+			llmStatus:  http.StatusOK,
+			wantTitles: []string{"The new version is here", "The new version is out"},
+			wantStats: func(t *testing.T, s *tgstats.Run) {
+				testutil.AssertEqual(t, s.ItemsFilteredTotal, 1)
+				testutil.AssertEqual(t, s.ItemsTranslated, 1)
+				testutil.AssertEqual(t, s.TranslationsFailed, 0)
+				testutil.AssertEqual(t, s.LLMInputTokens, int64(50))
+				testutil.AssertEqual(t, s.LLMOutputTokens, int64(20))
+			},
+		},
+		"llm failure": {
+			llmStatus:  http.StatusInternalServerError,
+			wantTitles: []string{"Die neue Version ist da", "The new version is out"},
+			wantStats: func(t *testing.T, s *tgstats.Run) {
+				testutil.AssertEqual(t, s.ItemsTranslated, 0)
+				testutil.AssertEqual(t, s.TranslationsFailed, 1)
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var llmCalls atomic.Int32
+			env := newTestEnv(t, stateArchive(t, config, map[string]*state.Feed{
+				atomFeedURL: {},
+			}), map[string]http.HandlerFunc{
+				atomFeedRoute: func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(mixedLanguageFeed))
+				},
+				llmResponsesRoute: func(w http.ResponseWriter, r *http.Request) {
+					llmCalls.Add(1)
+					params := testutil.UnmarshalJSON[llm.ResponseParams](t, read(t, r.Body))
+					testutil.AssertEqual(t, params.Model, "test-model")
+					if !strings.Contains(params.Instructions, `"en"`) {
+						t.Errorf("instructions don't name the target language: %q", params.Instructions)
+					}
+					in := testutil.UnmarshalJSON[translation](t, []byte(params.Input[0].Content[0].Text))
+					testutil.AssertEqual(t, in, translation{
+						Title:   "Die neue Version ist da",
+						Summary: "Die neue Version bringt auch viele Verbesserungen mit sich und ist schneller.",
+					})
+					if tc.llmStatus != http.StatusOK {
+						http.Error(w, "overloaded", tc.llmStatus)
+						return
+					}
+					w.Write([]byte("{\"output_text\":\"```json\\n{\\\"title\\\":\\\"The new version is here\\\",\\\"summary\\\":\\\"It brings many improvements & is faster.\\\"}\\n```\",\"usage\":{\"input_tokens\":50,\"output_tokens\":20}}"))
+				},
+			})
+			f := newTestFetcher(t, env)
+			f.llmModel = "test-model"
+			f.llm = &llm.Client{APIURL: "https://llm.example.com/v1", APIKey: "test", HTTPClient: f.httpc}
+
+			if err := f.run(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				if err := f.statsStore.Close(); err != nil {
+					t.Error(err)
+				}
+			})
+
+			var got []string
+			for i := range env.sentMessages {
+				got = append(got, env.sentText(t, i))
+			}
+			testutil.AssertEqual(t, len(got), len(tc.wantTitles))
+			for _, title := range tc.wantTitles {
+				if !strings.Contains(strings.Join(got, "\n"), title) {
+					t.Errorf("no message contains %q, sent: %q", title, got)
+				}
+			}
+			f.stats.ReadAccess(func(s *tgstats.Run) { tc.wantStats(t, s) })
+
+			archived, err := f.statsStore.SearchItems(t.Context(), tgstats.ItemQuery{Query: "Verbesserungen"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, len(archived), 1)
+			testutil.AssertEqual(t, archived[0].Title, "Die neue Version ist da")
+
+			if tc.llmStatus != http.StatusOK {
+				return
+			}
+
+			// Translations are cached per item.
+			calls := llmCalls.Load()
+			items := f.translateItems(t.Context(), f.feeds[0], []*gofeed.Item{{
+				Title: "Die neue Version ist da",
+				Link:  "https://example.com/de",
+				GUID:  "de",
+			}})
+			testutil.AssertEqual(t, llmCalls.Load(), calls)
+			testutil.AssertEqual(t, items[0].Title, "The new version is here")
+			testutil.AssertEqual(t, items[0].Description, "It brings many improvements &amp; is faster.")
+			f.stats.ReadAccess(func(s *tgstats.Run) {
+				testutil.AssertEqual(t, s.TranslationCacheHits, 1)
+			})
+		})
+	}
+}
+
+func TestTranslatedItemReplacesContent(t *testing.T) {
+	t.Parallel()
+
+	item := &gofeed.Item{
+		Title:   "Die neue Version ist da",
+		Content: "<p>Die neue Version bringt viele Verbesserungen.</p>",
+	}
+	got := translatedItem(item, "en", translation{
+		Title:   "The new version is here",
+		Summary: "The new version brings <many> improvements.",
+	})
+	testutil.AssertEqual(t, got.Title, "The new version is here")
+	testutil.AssertEqual(t, got.Description, "The new version brings &lt;many&gt; improvements.")
+	testutil.AssertEqual(t, got.Content, got.Description)
+	testutil.AssertEqual(t, got.DublinCoreExt.Language, []string{"en"})
+	testutil.AssertEqual(t, item.Content, "<p>Die neue Version bringt viele Verbesserungen.</p>")
+}
+
+func TestTranslateConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	f := newTestFetcher(t, newTestEnv(t, nil, nil))
+	_, err := f.parseConfig(t.Context(), `feed(url = "https://example.com/feed.xml", translate_to = "english")`)
+	if err == nil || !strings.Contains(err.Error(), "not a language code") {
+		t.Fatalf("parseConfig() error = %v, want invalid language", err)
+	}
+
+	config, err := f.parseConfig(t.Context(), `feed(url = "https://example.com/feed.xml", translate_to = "pt_BR")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, config.feeds[0].translateTo, "pt")
+}
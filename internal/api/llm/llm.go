@@ -7,11 +7,18 @@
 package llm
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strings"
+	"time"
 
 	"go.astrophena.name/base/request"
 	"go.astrophena.name/base/version"
@@ -29,41 +36,119 @@ type Client struct {
 	// Scrubber is an optional strings.Replacer that scrubs unwanted data from
 	// error messages.
 	Scrubber *strings.Replacer
+	// StreamIdleTimeout limits how long StreamResponse waits for the response
+	// and then for each chunk of the stream. Defaults to the Timeout of
+	// HTTPClient, or to defaultStreamIdleTimeout if it has none.
+	StreamIdleTimeout time.Duration
 }
 
+// defaultStreamIdleTimeout is the default of Client.StreamIdleTimeout.
+const defaultStreamIdleTimeout = time.Minute
+
+// errStreamIdle is the cause of canceling a stream that went idle.
+var errStreamIdle = errors.New("stream went idle")
+
 // ContentPart is a single item inside a message content.
 type ContentPart struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// ImageURL is a URL or a data URL of an input_image part.
 	ImageURL string `json:"image_url,omitempty"`
+	// FileData is a data URL of an input_file part.
+	FileData string `json:"file_data,omitempty"`
+	// Filename is the name of the file of an input_file part.
+	Filename string `json:"filename,omitempty"`
 }
 
-// Message is an input message.
+// Message is an input item. Usually it's a message with Role and Content, but
+// with Type set to "function_call" it's a call of a function made by the model
+// in a previous response, and with Type set to "function_call_output" it's the
+// output of such a call.
 type Message struct {
-	Role    string        `json:"role"`
-	Content []ContentPart `json:"content"`
+	Type    string        `json:"type,omitempty"`
+	Role    string        `json:"role,omitempty"`
+	Content []ContentPart `json:"content,omitempty"`
+
+	// CallID, Name and Arguments are set for function calls, and CallID and
+	// Output are set for function call outputs.
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// Tool is a function the model can call.
+type Tool struct {
+	// Type is the type of the tool. Only "function" is supported.
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is a JSON schema of function arguments.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// TextConfig configures the text output.
+type TextConfig struct {
+	Format TextFormat `json:"format"`
+}
+
+// TextFormat is the format of the text output.
+type TextFormat struct {
+	// Type is "text" or "json_schema".
+	Type string `json:"type"`
+	// Name and Schema are set for the json_schema type.
+	Name   string          `json:"name,omitempty"`
+	Schema json.RawMessage `json:"schema,omitempty"`
 }
 
 // ResponseParams defines the request body for POST /responses.
 type ResponseParams struct {
-	Model        string    `json:"model"`
-	Input        []Message `json:"input"`
-	Instructions string    `json:"instructions,omitempty"`
+	Model        string      `json:"model"`
+	Input        []Message   `json:"input"`
+	Instructions string      `json:"instructions,omitempty"`
+	Tools        []Tool      `json:"tools,omitempty"`
+	Text         *TextConfig `json:"text,omitempty"`
+	// Stream is set by StreamResponse.
+	Stream bool `json:"stream,omitempty"`
 }
 
 // Response is a subset of the OpenAI Responses API response.
 type Response struct {
 	OutputText string `json:"output_text"`
-	output     []responseOutputItem
-	Usage      struct {
+	// Error is set for failed responses.
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+	// FunctionCalls are calls of functions requested by the model. Their
+	// outputs should be sent in the next request, along with the calls
+	// themselves.
+	FunctionCalls []FunctionCall `json:"-"`
+	output        []responseOutputItem
+	Usage         struct {
 		InputTokens  int64 `json:"input_tokens"`
 		OutputTokens int64 `json:"output_tokens"`
 	} `json:"usage"`
 }
 
+// FunctionCall is a call of a function requested by the model.
+type FunctionCall struct {
+	CallID string
+	Name   string
+	// Arguments are JSON-encoded arguments.
+	Arguments string
+}
+
+// Message returns the input item that represents the call.
+func (c FunctionCall) Message() Message {
+	return Message{Type: "function_call", CallID: c.CallID, Name: c.Name, Arguments: c.Arguments}
+}
+
 type responseOutputItem struct {
-	Type    string                  `json:"type"`
-	Content []responseOutputContent `json:"content"`
+	Type      string                  `json:"type"`
+	Content   []responseOutputContent `json:"content"`
+	CallID    string                  `json:"call_id"`
+	Name      string                  `json:"name"`
+	Arguments string                  `json:"arguments"`
 }
 
 type responseOutputContent struct {
@@ -72,7 +157,8 @@ type responseOutputContent struct {
 }
 
 // UnmarshalJSON fills OutputText from the Responses API output array when the
-// gateway does not provide the SDK-style output_text convenience field.
+// gateway does not provide the SDK-style output_text convenience field, and
+// FunctionCalls from function calls in the output array.
 func (r *Response) UnmarshalJSON(data []byte) error {
 	type response Response
 	var resp struct {
@@ -87,6 +173,15 @@ func (r *Response) UnmarshalJSON(data []byte) error {
 	if r.OutputText == "" {
 		r.OutputText = r.outputText()
 	}
+	for _, output := range r.output {
+		if output.Type == "function_call" {
+			r.FunctionCalls = append(r.FunctionCalls, FunctionCall{
+				CallID:    output.CallID,
+				Name:      output.Name,
+				Arguments: output.Arguments,
+			})
+		}
+	}
 	return nil
 }
 
@@ -108,26 +203,233 @@ func (r *Response) outputText() string {
 
 // CreateResponse sends a POST /responses request.
 func (c *Client) CreateResponse(ctx context.Context, params ResponseParams) (*Response, error) {
-	if c.APIURL == "" {
-		return nil, errors.New("APIURL shouldn't be empty")
-	}
-	if c.APIKey == "" {
-		return nil, errors.New("APIKey shouldn't be empty")
-	}
-	if params.Model == "" {
-		return nil, errors.New("model shouldn't be empty")
+	if err := c.validate(params); err != nil {
+		return nil, err
 	}
+	params.Stream = false
 
 	return request.Make[*Response](ctx, request.Params{
-		Method: http.MethodPost,
-		URL:    strings.TrimRight(c.APIURL, "/") + "/responses",
-		Headers: map[string]string{
-			"Authorization": "Bearer " + c.APIKey,
-			"Content-Type":  "application/json",
-			"User-Agent":    version.UserAgent(),
-		},
+		Method:     http.MethodPost,
+		URL:        c.responsesURL(),
+		Headers:    c.headers(),
 		Body:       params,
 		HTTPClient: c.HTTPClient,
 		Scrubber:   c.Scrubber,
 	})
 }
+
+// StreamResponse sends a POST /responses request that asks for a stream of
+// server-sent events, and calls onDelta with each chunk of output text as it
+// arrives. It returns the complete response after the stream ends.
+//
+// If onDelta returns an error, the stream is closed and the error is returned.
+//
+// Gateways that ignore the stream parameter and reply with a complete response
+// are also supported: onDelta is then called once with all output text.
+//
+// The Timeout of HTTPClient doesn't apply, since it would cut long streams.
+// Instead, the stream is canceled if no data arrives within StreamIdleTimeout.
+func (c *Client) StreamResponse(ctx context.Context, params ResponseParams, onDelta func(delta string) error) (*Response, error) {
+	if err := c.validate(params); err != nil {
+		return nil, err
+	}
+	params.Stream = true
+
+	streamc := *cmp.Or(c.HTTPClient, request.DefaultClient)
+	idle := cmp.Or(c.StreamIdleTimeout, streamc.Timeout, defaultStreamIdleTimeout)
+	streamc.Timeout = 0
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timer := time.AfterFunc(idle, func() { cancel(errStreamIdle) })
+	defer timer.Stop()
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.responsesURL(), bytes.NewReader(body))
+	if err != nil {
+		return nil, c.scrubErr(err)
+	}
+	for k, v := range c.headers() {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := streamc.Do(req)
+	if err != nil {
+		return nil, c.scrubErr(idleErr(ctx, err))
+	}
+	defer res.Body.Close()
+	stream := &idleReader{r: res.Body, timer: timer, idle: idle}
+
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(stream)
+		return nil, c.scrubErr(fmt.Errorf("%s %q: %w", req.Method, req.URL, &request.StatusError{
+			WantedStatusCode: http.StatusOK,
+			StatusCode:       res.StatusCode,
+			Headers:          res.Header,
+			Body:             b,
+		}))
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		var resp *Response
+		if err := json.NewDecoder(stream).Decode(&resp); err != nil {
+			return nil, c.scrubErr(idleErr(ctx, err))
+		}
+		if resp.OutputText != "" {
+			if err := onDelta(resp.OutputText); err != nil {
+				return nil, err
+			}
+		}
+		return resp, nil
+	}
+
+	var (
+		text strings.Builder
+		resp *Response
+	)
+	err = readEvents(stream, func(data []byte) error {
+		var ev streamEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return err
+		}
+		switch ev.Type {
+		case "response.output_text.delta":
+			text.WriteString(ev.Delta)
+			return onDelta(ev.Delta)
+		case "response.completed", "response.incomplete":
+			resp = ev.Response
+		case "response.failed":
+			if ev.Response != nil && ev.Response.Error != nil {
+				return fmt.Errorf("response failed: %s", ev.Response.Error.Message)
+			}
+			return errors.New("response failed")
+		case "error":
+			return fmt.Errorf("stream error: %s", cmp.Or(ev.Message, string(data)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, c.scrubErr(idleErr(ctx, err))
+	}
+	if resp == nil {
+		return nil, c.scrubErr(errors.New("stream ended before the response was completed"))
+	}
+	if resp.OutputText == "" {
+		resp.OutputText = text.String()
+	}
+	return resp, nil
+}
+
+// idleReader postpones the idle timeout of a stream each time data arrives.
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+	idle  time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.idle)
+	}
+	return n, err
+}
+
+// idleErr reports err as a timeout if the stream was canceled for going idle.
+func idleErr(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), errStreamIdle) {
+		return fmt.Errorf("%w: no data for too long: %w", errStreamIdle, err)
+	}
+	return err
+}
+
+// streamEvent is a server-sent event of a streamed response.
+type streamEvent struct {
+	Type     string    `json:"type"`
+	Delta    string    `json:"delta"`
+	Message  string    `json:"message"`
+	Response *Response `json:"response"`
+}
+
+// readEvents reads server-sent events from r and calls fn with data of each
+// event.
+func readEvents(r io.Reader, fn func(data []byte) error) error {
+	br := bufio.NewReader(r)
+	var data []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		eof := err != nil
+		line = bytes.TrimRight(line, "\r\n")
+
+		switch {
+		case len(line) == 0:
+			// A blank line dispatches the event.
+			if len(data) > 0 {
+				if err := fn(data); err != nil {
+					return err
+				}
+				data = nil
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))...)
+		}
+		// Other fields, such as event and id, and comments are ignored: the
+		// event type is in the data.
+
+		if eof {
+			if len(data) > 0 {
+				return fn(data)
+			}
+			return nil
+		}
+	}
+}
+
+func (c *Client) validate(params ResponseParams) error {
+	if c.APIURL == "" {
+		return errors.New("APIURL shouldn't be empty")
+	}
+	if c.APIKey == "" {
+		return errors.New("APIKey shouldn't be empty")
+	}
+	if params.Model == "" {
+		return errors.New("model shouldn't be empty")
+	}
+	return nil
+}
+
+func (c *Client) responsesURL() string {
+	return strings.TrimRight(c.APIURL, "/") + "/responses"
+}
+
+func (c *Client) headers() map[string]string {
+	return map[string]string{
+		"Authorization": "Bearer " + c.APIKey,
+		"Content-Type":  "application/json",
+		"User-Agent":    version.UserAgent(),
+	}
+}
+
+func (c *Client) scrubErr(err error) error {
+	if c.Scrubber == nil {
+		return err
+	}
+	return &scrubbedError{err: err, scrubber: c.Scrubber}
+}
+
+type scrubbedError struct {
+	err      error
+	scrubber *strings.Replacer
+}
+
+func (e *scrubbedError) Error() string { return e.scrubber.Replace(e.err.Error()) }
+func (e *scrubbedError) Unwrap() error { return e.err }
@@ -12,11 +12,13 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"go.astrophena.name/base/rr"
 	"go.astrophena.name/base/testutil"
@@ -193,3 +195,235 @@ func TestResponseOutputText(t *testing.T) {
 		})
 	}
 }
+
+func TestResponseFunctionCalls(t *testing.T) {
+	var resp Response
+	if err := json.Unmarshal([]byte(`{
+		"output": [
+			{"type": "reasoning", "summary": []},
+			{
+				"type": "function_call",
+				"id": "fc_1",
+				"call_id": "call_1",
+				"name": "get_weather",
+				"arguments": "{\"city\":\"Paris\"}"
+			},
+			{
+				"type": "function_call",
+				"id": "fc_2",
+				"call_id": "call_2",
+				"name": "get_time",
+				"arguments": "{}"
+			}
+		]
+	}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, resp.OutputText, "")
+	testutil.AssertEqual(t, resp.FunctionCalls, []FunctionCall{
+		{CallID: "call_1", Name: "get_weather", Arguments: `{"city":"Paris"}`},
+		{CallID: "call_2", Name: "get_time", Arguments: `{}`},
+	})
+
+	b, err := json.Marshal(resp.FunctionCalls[0].Message())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertEqual(t, string(b), `{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"}`)
+}
+
+func TestStreamResponse(t *testing.T) {
+	cases := map[string]struct {
+		contentType string
+		status      int
+		body        string
+		wantDeltas  []string
+		wantText    string
+		wantTokens  int64
+		wantErr     string
+	}{
+		"stream": {
+			contentType: "text/event-stream",
+			body: `event: response.created
+data: {"type":"response.created","response":{"status":"in_progress"}}
+
+: keep-alive
+
+event: response.output_text.delta
+data: {"type":"response.output_text.delta","delta":"Hello"}
+
+event: response.output_text.delta
+data: {"type":"response.output_text.delta","delta":", world"}
+
+event: response.completed
+data: {"type":"response.completed","response":{"output":[{"type":"message","content":[{"type":"output_text","text":"Hello, world"}]}],"usage":{"input_tokens":5,"output_tokens":4}}}
+
+`,
+			wantDeltas: []string{"Hello", ", world"},
+			wantText:   "Hello, world",
+			wantTokens: 9,
+		},
+		"stream without trailing blank line": {
+			contentType: "text/event-stream; charset=utf-8",
+			body: "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Hi\"}\r\n\r\n" +
+				"data: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":1,\"output_tokens\":1}}}",
+			wantDeltas: []string{"Hi"},
+			wantText:   "Hi",
+			wantTokens: 2,
+		},
+		"complete response": {
+			contentType: "application/json",
+			body:        `{"output_text": "not streamed", "usage": {"input_tokens": 1, "output_tokens": 2}}`,
+			wantDeltas:  []string{"not streamed"},
+			wantText:    "not streamed",
+			wantTokens:  3,
+		},
+		"failed": {
+			contentType: "text/event-stream",
+			body: `data: {"type":"response.output_text.delta","delta":"Hi"}
+
+data: {"type":"response.failed","response":{"error":{"message":"out of tokens"}}}
+
+`,
+			wantErr: "response failed: out of tokens",
+		},
+		"error event": {
+			contentType: "text/event-stream",
+			body:        "data: {\"type\":\"error\",\"message\":\"rate limited\"}\n\n",
+			wantErr:     "stream error: rate limited",
+		},
+		"incomplete stream": {
+			contentType: "text/event-stream",
+			body:        "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Hi\"}\n\n",
+			wantErr:     "stream ended before the response was completed",
+		},
+		"bad status": {
+			status:  http.StatusUnauthorized,
+			body:    `{"error": {"message": "bad key secret"}}`,
+			wantErr: "want 200, got 401",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST llm.example/v1/responses", func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				params := testutil.UnmarshalJSON[ResponseParams](t, b)
+				testutil.AssertEqual(t, params.Stream, true)
+				testutil.AssertEqual(t, r.Header.Get("Accept"), "text/event-stream")
+				w.Header().Set("Content-Type", tc.contentType)
+				w.WriteHeader(cmp.Or(tc.status, http.StatusOK))
+				io.WriteString(w, tc.body)
+			})
+			c := &Client{
+				APIURL:     "https://llm.example/v1",
+				APIKey:     "secret",
+				HTTPClient: testutil.MockHTTPClient(mux),
+				Scrubber:   strings.NewReplacer("secret", "[EXPUNGED]"),
+			}
+
+			var deltas []string
+			resp, err := c.StreamResponse(t.Context(), ResponseParams{Model: "test-model"}, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if tc.wantErr != "" {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				if !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: got %q, want to contain %q", err, tc.wantErr)
+				}
+				if strings.Contains(err.Error(), "secret") {
+					t.Fatalf("error isn't scrubbed: %q", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertEqual(t, deltas, tc.wantDeltas)
+			testutil.AssertEqual(t, resp.OutputText, tc.wantText)
+			testutil.AssertEqual(t, resp.Usage.InputTokens+resp.Usage.OutputTokens, tc.wantTokens)
+		})
+	}
+}
+
+func TestStreamResponseStop(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST llm.example/v1/responses", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for range 3 {
+			io.WriteString(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"x\"}\n\n")
+		}
+	})
+	c := &Client{
+		APIURL:     "https://llm.example/v1",
+		APIKey:     "test",
+		HTTPClient: testutil.MockHTTPClient(mux),
+	}
+
+	errStop := errors.New("stop")
+	var n int
+	_, err := c.StreamResponse(t.Context(), ResponseParams{Model: "test-model"}, func(string) error {
+		n++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("got error %v, want %v", err, errStop)
+	}
+	testutil.AssertEqual(t, n, 1)
+}
+
+func TestStreamResponseTimeouts(t *testing.T) {
+	const delta = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"x\"}\n\n"
+
+	t.Run("long stream", func(t *testing.T) {
+		// The stream takes longer than the client timeout, but data keeps
+		// arriving.
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for range 6 {
+				io.WriteString(w, delta)
+				w.(http.Flusher).Flush()
+				time.Sleep(50 * time.Millisecond)
+			}
+			io.WriteString(w, "data: {\"type\":\"response.completed\",\"response\":{}}\n\n")
+		}))
+		defer srv.Close()
+		c := &Client{
+			APIURL:     srv.URL,
+			APIKey:     "test",
+			HTTPClient: &http.Client{Timeout: 200 * time.Millisecond},
+		}
+		resp, err := c.StreamResponse(t.Context(), ResponseParams{Model: "test-model"}, func(string) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.AssertEqual(t, resp.OutputText, "xxxxxx")
+	})
+
+	t.Run("idle stream", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, delta)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+		c := &Client{
+			APIURL:            srv.URL,
+			APIKey:            "test",
+			HTTPClient:        srv.Client(),
+			StreamIdleTimeout: 50 * time.Millisecond,
+		}
+		_, err := c.StreamResponse(t.Context(), ResponseParams{Model: "test-model"}, func(string) error { return nil })
+		if !errors.Is(err, errStreamIdle) {
+			t.Fatalf("got error %v, want %v", err, errStreamIdle)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+/*
+Package http contains a Starlark module for making outbound HTTP requests.
+
+This module provides two functions for making HTTP requests: get and post.
+Requests can only be made to hosts allowed by the operator. Responses are
+limited in size, and requests time out.
+
+The get function takes the following arguments:
+
+  - url (str): The URL to request.
+  - params (dict, optional): Query parameters added to the URL.
+  - headers (dict, optional): Request headers.
+  - timeout (float, optional): Timeout in seconds. It can't exceed the
+    timeout configured by the operator.
+
+The post function takes the same arguments, and one of the following to set
+the request body:
+
+  - body (str or bytes, optional): The raw request body.
+  - json (any, optional): A value encoded as the JSON request body.
+  - form (dict, optional): Form values encoded as the request body.
+
+Both functions return a struct with the following fields:
+
+  - status (int): The HTTP status code. Unlike telegram.call, unsuccessful
+    status codes aren't errors.
+  - headers (dict): Response headers, with lowercase names.
+  - body (str): The response body.
+  - json (function): Decodes the response body as JSON.
+
+Secrets configured by the operator, such as API keys, are referenced by name
+with {secret:NAME} in header and query parameter values, so they never appear
+in bot code. They are scrubbed from responses and errors. The operator can
+bind a secret to hosts, and then requests to other hosts that reference it
+fail. Headers with secrets are dropped when a request is redirected to
+another host. For example:
+
+	resp = http.get(
+	    "https://api.example.com/v1/weather",
+	    params={"city": "Paris", "key": "{secret:WEATHER_KEY}"},
+	)
+	if resp.status == 200:
+	    weather = resp.json()
+
+	resp = http.post(
+	    "https://api.example.com/v1/notes",
+	    headers={"Authorization": "Bearer {secret:NOTES_TOKEN}"},
+	    json={"text": "Hello, world!"},
+	)
+*/
+package http
+
+import (
+	_ "embed"
+	"sync"
+
+	"go.astrophena.name/tools/internal/starlark/internal"
+)
+
+//go:embed doc.go
+var doc []byte
+
+var Documentation = sync.OnceValue(func() string {
+	return internal.ParseDocComment(doc)
+})
@@ -0,0 +1,435 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.astrophena.name/base/version"
+	"go.astrophena.name/tools/internal/starlark/interpreter"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const (
+	// DefaultMaxResponseSize is the default limit of the response body size.
+	DefaultMaxResponseSize = 1 << 20 // 1 MiB
+	// DefaultTimeout is the default timeout of requests.
+	DefaultTimeout = 10 * time.Second
+
+	maxRedirects = 10
+)
+
+// DryRunLocal is the name of a thread local that, if set to true, makes
+// http.post fail instead of making a request, so a dry run doesn't change
+// anything outside. http.get works as usual.
+const DryRunLocal = "http.dry_run"
+
+// Config configures the http module.
+type Config struct {
+	// HTTPClient is the HTTP client to make requests with. Its CheckRedirect
+	// function is replaced to check redirects against the allowlist.
+	HTTPClient *http.Client
+	// Allow is the list of hosts requests can be made to. A host starting with
+	// "*." also matches any subdomain. If empty, no requests are allowed.
+	Allow []string
+	// Secrets maps names of secrets that can be referenced in requests to
+	// their values.
+	Secrets map[string]string
+	// SecretHosts optionally binds secrets, by name, to hosts they can be
+	// sent to, in the same format as Allow. Secrets without an entry can be
+	// sent to any allowed host.
+	SecretHosts map[string][]string
+	// Scrubber is used to scrub sensitive information from responses and
+	// errors, in addition to secrets.
+	Scrubber *strings.Replacer
+	// MaxResponseSize is the limit of the response body size in bytes. It
+	// defaults to DefaultMaxResponseSize.
+	MaxResponseSize int64
+	// Timeout is the maximum timeout of a request. It defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Module returns a Starlark module that makes HTTP requests to allowed hosts.
+func Module(cfg Config) *starlarkstruct.Module {
+	m := &module{
+		allow:           cfg.Allow,
+		secrets:         cfg.Secrets,
+		secretHosts:     cfg.SecretHosts,
+		scrubber:        cfg.Scrubber,
+		maxResponseSize: cfg.MaxResponseSize,
+		timeout:         cfg.Timeout,
+	}
+	if m.maxResponseSize <= 0 {
+		m.maxResponseSize = DefaultMaxResponseSize
+	}
+	if m.timeout <= 0 {
+		m.timeout = DefaultTimeout
+	}
+	var secretPairs []string
+	for _, val := range cfg.Secrets {
+		if val != "" {
+			secretPairs = append(secretPairs, val, "[EXPUNGED]")
+		}
+	}
+	if len(secretPairs) > 0 {
+		m.secretScrubber = strings.NewReplacer(secretPairs...)
+	}
+
+	httpc := cfg.HTTPClient
+	if httpc == nil {
+		httpc = http.DefaultClient
+	}
+	m.httpc = &http.Client{
+		Transport: httpc.Transport,
+		Jar:       httpc.Jar,
+		Timeout:   httpc.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if err := m.checkURL(req.URL); err != nil {
+				return err
+			}
+			// Headers of the original request are copied to redirects.
+			// Go drops only a few well-known credential headers when the
+			// host changes, so drop any header carrying a secret.
+			if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+				m.stripSecrets(req.Header)
+			}
+			return nil
+		},
+	}
+
+	return &starlarkstruct.Module{
+		Name: "http",
+		Members: starlark.StringDict{
+			"get":  starlark.NewBuiltin("http.get", m.get),
+			"post": starlark.NewBuiltin("http.post", m.post),
+		},
+	}
+}
+
+type module struct {
+	httpc           *http.Client
+	allow           []string
+	secrets         map[string]string
+	secretHosts     map[string][]string
+	scrubber        *strings.Replacer
+	secretScrubber  *strings.Replacer
+	maxResponseSize int64
+	timeout         time.Duration
+}
+
+func (m *module) get(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		rawURL  string
+		params  *starlark.Dict
+		headers *starlark.Dict
+		timeout float64
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+		"url", &rawURL,
+		"params?", &params,
+		"headers?", &headers,
+		"timeout?", &timeout,
+	); err != nil {
+		return nil, err
+	}
+	resp, err := m.do(interpreter.Context(thread), http.MethodGet, rawURL, params, headers, timeout, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), m.scrub(err.Error()))
+	}
+	return resp, nil
+}
+
+func (m *module) post(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if dry, _ := thread.Local(DryRunLocal).(bool); dry {
+		return nil, fmt.Errorf("%s: can't make requests in a dry run", b.Name())
+	}
+	var (
+		rawURL  string
+		params  *starlark.Dict
+		headers *starlark.Dict
+		timeout float64
+		body    starlark.Value
+		jsonVal starlark.Value
+		form    *starlark.Dict
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+		"url", &rawURL,
+		"params?", &params,
+		"headers?", &headers,
+		"timeout?", &timeout,
+		"body?", &body,
+		"json?", &jsonVal,
+		"form?", &form,
+	); err != nil {
+		return nil, err
+	}
+
+	var (
+		reqBody     []byte
+		contentType string
+		bodies      int
+	)
+	if body != nil && body != starlark.None {
+		bodies++
+		switch v := body.(type) {
+		case starlark.String:
+			reqBody = []byte(v)
+		case starlark.Bytes:
+			reqBody = []byte(v)
+		default:
+			return nil, fmt.Errorf("%s: body must be str or bytes, got %s", b.Name(), body.Type())
+		}
+	}
+	if jsonVal != nil && jsonVal != starlark.None {
+		bodies++
+		encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{jsonVal}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to encode json to JSON: %v", b.Name(), err)
+		}
+		reqBody = []byte(encoded.(starlark.String))
+		contentType = "application/json"
+	}
+	if form != nil {
+		bodies++
+		values, err := m.values(form, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: form: %w", b.Name(), err)
+		}
+		reqBody = []byte(values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+	if bodies > 1 {
+		return nil, fmt.Errorf("%s: only one of body, json and form can be set", b.Name())
+	}
+
+	resp, err := m.do(interpreter.Context(thread), http.MethodPost, rawURL, params, headers, timeout, reqBody, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), m.scrub(err.Error()))
+	}
+	return resp, nil
+}
+
+func (m *module) do(ctx context.Context, method, rawURL string, params, headers *starlark.Dict, timeout float64, body []byte, contentType string) (starlark.Value, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkURL(u); err != nil {
+		return nil, err
+	}
+	if params != nil {
+		values, err := m.values(params, u.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("params: %w", err)
+		}
+		q := u.Query()
+		for k, vv := range values {
+			for _, v := range vv {
+				q.Add(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	d := m.timeout
+	if timeout < 0 {
+		return nil, errors.New("timeout should not be negative")
+	}
+	if timeout > 0 {
+		d = min(d, time.Duration(timeout*float64(time.Second)))
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if headers != nil {
+		for _, item := range headers.Items() {
+			k, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("headers: key %s is not a string", item[0])
+			}
+			v, ok := starlark.AsString(item[1])
+			if !ok {
+				return nil, fmt.Errorf("headers: value of %q is not a string", k)
+			}
+			v, err := m.expandSecrets(v, u.Hostname())
+			if err != nil {
+				return nil, fmt.Errorf("headers: %q: %w", k, err)
+			}
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := m.httpc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, m.maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > m.maxResponseSize {
+		return nil, fmt.Errorf("response is larger than %d bytes", m.maxResponseSize)
+	}
+
+	respBody := m.scrub(string(b))
+	respHeaders := starlark.NewDict(len(resp.Header))
+	for k, vv := range resp.Header {
+		if err := respHeaders.SetKey(starlark.String(strings.ToLower(k)), starlark.String(m.scrub(strings.Join(vv, ", ")))); err != nil {
+			return nil, err
+		}
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"status":  starlark.MakeInt(resp.StatusCode),
+		"headers": respHeaders,
+		"body":    starlark.String(respBody),
+		"json": starlark.NewBuiltin("json", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+				return nil, err
+			}
+			return starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(respBody)}, nil)
+		}),
+	}), nil
+}
+
+// checkURL checks that a request to u is allowed.
+func (m *module) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if !matchHost(host, m.allow) {
+		return fmt.Errorf("host %q is not allowed", host)
+	}
+	return nil
+}
+
+// matchHost reports whether host matches any of patterns. A pattern
+// starting with "*." also matches any subdomain.
+func matchHost(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if host == p {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(p, "*."); ok && strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// values converts a Starlark dict to URL values. If host is not empty,
+// secrets are expanded for a request to it.
+func (m *module) values(d *starlark.Dict, host string) (url.Values, error) {
+	values := make(url.Values)
+	for _, item := range d.Items() {
+		k, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("key %s is not a string", item[0])
+		}
+		var v string
+		switch val := item[1].(type) {
+		case starlark.String:
+			v = string(val)
+		case starlark.Int, starlark.Float, starlark.Bool:
+			v = val.String()
+		default:
+			return nil, fmt.Errorf("value of %q must be str, int, float or bool, got %s", k, val.Type())
+		}
+		if host != "" {
+			var err error
+			if v, err = m.expandSecrets(v, host); err != nil {
+				return nil, fmt.Errorf("%q: %w", k, err)
+			}
+		}
+		values.Add(k, v)
+	}
+	return values, nil
+}
+
+var secretRe = regexp.MustCompile(`\{secret:([A-Za-z0-9_]+)\}`)
+
+// expandSecrets replaces references to secrets with their values for a
+// request to host.
+func (m *module) expandSecrets(s, host string) (string, error) {
+	var err error
+	s = secretRe.ReplaceAllStringFunc(s, func(ref string) string {
+		name := secretRe.FindStringSubmatch(ref)[1]
+		val, ok := m.secrets[name]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("unknown secret %q", name)
+			}
+			return ""
+		}
+		if hosts, bound := m.secretHosts[name]; bound && !matchHost(host, hosts) {
+			if err == nil {
+				err = fmt.Errorf("secret %q can't be sent to host %q", name, host)
+			}
+			return ""
+		}
+		return val
+	})
+	return s, err
+}
+
+// stripSecrets removes headers with values containing secrets.
+func (m *module) stripSecrets(h http.Header) {
+	for k, vv := range h {
+		for _, v := range vv {
+			if m.hasSecret(v) {
+				h.Del(k)
+				break
+			}
+		}
+	}
+}
+
+// hasSecret reports whether s contains a value of any secret.
+func (m *module) hasSecret(s string) bool {
+	for _, val := range m.secrets {
+		if val != "" && strings.Contains(s, val) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *module) scrub(s string) string {
+	if m.secretScrubber != nil {
+		s = m.secretScrubber.Replace(s)
+	}
+	if m.scrubber != nil {
+		s = m.scrubber.Replace(s)
+	}
+	return s
+}
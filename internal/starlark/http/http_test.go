@@ -0,0 +1,217 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/internal/starlark/interpreter"
+)
+
+func TestHTTPModule(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET api.example.com/weather", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "s3cr3t" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Key", "s3cr3t")
+		fmt.Fprintf(w, `{"city": %q, "temp": 21, "echo": "s3cr3t"}`, r.URL.Query().Get("city"))
+	})
+	mux.HandleFunc("POST api.example.com/echo", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Header.Get("Authorization"), r.Header.Get("Content-Type"), b)
+	})
+	mux.HandleFunc("GET sub.example.org/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("GET api.example.com/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://evil.example.net/", http.StatusFound)
+	})
+	mux.HandleFunc("GET api.example.com/to-sub", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://sub.example.org/key", http.StatusFound)
+	})
+	mux.HandleFunc("GET api.example.com/to-key", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/key", http.StatusFound)
+	})
+	// Redirected requests have an empty Host, so they don't match host
+	// patterns.
+	mux.HandleFunc("GET /key", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s X-Key=%s", r.URL.Host, r.Header.Get("X-Key"))
+	})
+	mux.HandleFunc("GET api.example.com/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 101))
+	})
+
+	cases := map[string]struct {
+		script     string
+		wantErr    string
+		wantOutput string
+	}{
+		"get with secret": {
+			script: `
+resp = http.get("https://api.example.com/weather", params = {"city": "Paris", "key": "{secret:WEATHER_KEY}"})
+print(resp.status, resp.json()["temp"], resp.json()["echo"], resp.headers["x-key"])
+`,
+			wantOutput: "200 21 [EXPUNGED] [EXPUNGED]",
+		},
+		"unsuccessful status": {
+			script: `
+resp = http.get("https://api.example.com/weather")
+print(resp.status, resp.body.strip())
+`,
+			wantOutput: "401 unauthorized",
+		},
+		"post json": {
+			script: `
+resp = http.post("https://api.example.com/echo", headers = {"Authorization": "Bearer {secret:TOKEN}"}, json = {"a": 1})
+print(resp.body)
+`,
+			wantOutput: `Bearer [EXPUNGED] application/json {"a":1}`,
+		},
+		"post form": {
+			script: `
+resp = http.post("https://api.example.com/echo", form = {"a": 1, "b": "x y"})
+print(resp.body)
+`,
+			wantOutput: ` application/x-www-form-urlencoded a=1&b=x+y`,
+		},
+		"wildcard host": {
+			script: `
+print(http.get("https://sub.example.org/").body)
+`,
+			wantOutput: "ok",
+		},
+		"host not allowed": {
+			script:  `http.get("https://example.net/")`,
+			wantErr: `http.get: host "example.net" is not allowed`,
+		},
+		"wildcard doesn't match the domain itself": {
+			script:  `http.get("https://example.org/")`,
+			wantErr: `host "example.org" is not allowed`,
+		},
+		"scheme not allowed": {
+			script:  `http.get("file:///etc/passwd")`,
+			wantErr: `unsupported URL scheme "file"`,
+		},
+		"redirect not allowed": {
+			script:  `http.get("https://api.example.com/redirect")`,
+			wantErr: `host "evil.example.net" is not allowed`,
+		},
+		"secret headers dropped on redirect to another host": {
+			script: `
+print(http.get("https://api.example.com/to-sub", headers = {"X-Key": "{secret:WEATHER_KEY}"}).body)
+`,
+			wantOutput: "sub.example.org X-Key=",
+		},
+		"secret headers kept on redirect to the same host": {
+			script: `
+print(http.get("https://api.example.com/to-key", headers = {"X-Key": "{secret:WEATHER_KEY}"}).body)
+`,
+			wantOutput: "api.example.com X-Key=[EXPUNGED]",
+		},
+		"secret bound to another host": {
+			script:  `http.get("https://sub.example.org/key", headers = {"X-Key": "{secret:TOKEN}"})`,
+			wantErr: `secret "TOKEN" can't be sent to host "sub.example.org"`,
+		},
+		"secret bound to another host in params": {
+			script:  `http.get("https://sub.example.org/key", params = {"key": "{secret:TOKEN}"})`,
+			wantErr: `secret "TOKEN" can't be sent to host "sub.example.org"`,
+		},
+		"unknown secret": {
+			script:  `http.get("https://api.example.com/weather", headers = {"X-Key": "{secret:MISSING}"})`,
+			wantErr: `unknown secret "MISSING"`,
+		},
+		"response too large": {
+			script:  `http.get("https://api.example.com/large")`,
+			wantErr: "response is larger than 100 bytes",
+		},
+		"multiple bodies": {
+			script:  `http.post("https://api.example.com/echo", body = "x", json = {})`,
+			wantErr: "only one of body, json and form can be set",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			intr := &interpreter.Interpreter{
+				Predeclared: starlark.StringDict{
+					"http": Module(Config{
+						HTTPClient: testutil.MockHTTPClient(mux),
+						Allow:      []string{"api.example.com", "*.example.org"},
+						Secrets: map[string]string{
+							"WEATHER_KEY": "s3cr3t",
+							"TOKEN":       "t0k3n",
+						},
+						SecretHosts: map[string][]string{
+							"TOKEN": {"api.example.com"},
+						},
+						MaxResponseSize: 100,
+					}),
+				},
+				Packages: map[string]interpreter.Loader{
+					interpreter.MainPkg: interpreter.MemoryLoader(map[string]string{
+						"test.star": tc.script,
+					}),
+				},
+				Logger: func(file string, line int, message string) {
+					fmt.Fprint(&buf, message)
+				},
+			}
+			if err := intr.Init(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := intr.ExecModule(t.Context(), interpreter.MainPkg, "test.star")
+
+			if tc.wantErr != "" {
+				if err == nil {
+					t.Errorf("expected error, but got nil")
+				} else if !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("unexpected error: got %q, want to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to execute script: %v", err)
+			}
+			testutil.AssertEqual(t, buf.String(), tc.wantOutput)
+		})
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	cases := map[string]struct {
+		host     string
+		patterns []string
+		want     bool
+	}{
+		"exact":                {"api.example.com", []string{"api.example.com"}, true},
+		"case insensitive":     {"API.Example.com", []string{"api.example.COM"}, true},
+		"subdomain":            {"a.b.example.org", []string{"*.example.org"}, true},
+		"apex of wildcard":     {"example.org", []string{"*.example.org"}, false},
+		"wildcard without dot": {"evilexample.com", []string{"*example.com"}, false},
+		"suffix without dot":   {"evilexample.org", []string{"*.example.org"}, false},
+		"bare wildcard":        {"anything.example.net", []string{"*"}, false},
+		"other host":           {"example.net", []string{"api.example.com", "*.example.org"}, false},
+		"second pattern":       {"x.example.org", []string{"api.example.com", "*.example.org"}, true},
+		"no patterns":          {"example.com", nil, false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			testutil.AssertEqual(t, matchHost(tc.host, tc.patterns), tc.want)
+		})
+	}
+}
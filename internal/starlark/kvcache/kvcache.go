@@ -15,6 +15,11 @@ import (
 	"go.starlark.net/starlarkstruct"
 )
 
+// DryRunLocal is the name of a thread local that, if set to true, makes
+// kvcache.set discard values instead of storing them, so a dry run doesn't
+// change the cache.
+const DryRunLocal = "kvcache.dry_run"
+
 // Module returns a Starlark module that exposes key-value caching functionality.
 func Module(ctx context.Context, s store.Store) *starlarkstruct.Module {
 	m := &module{
@@ -66,6 +71,9 @@ func (m *module) set(thread *starlark.Thread, b *starlark.Builtin, args starlark
 	if err != nil {
 		return nil, err
 	}
+	if dry, _ := thread.Local(DryRunLocal).(bool); dry {
+		return starlark.None, nil
+	}
 
 	return starlark.None, m.store.Set(m.ctx, key, data)
 }
@@ -0,0 +1,245 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"time"
+)
+
+// Config configures accounting of LLM usage.
+type Config struct {
+	// Prices maps model names to their prices, used to calculate cost of
+	// requests. Models without a price are free as far as cost budgets are
+	// concerned.
+	Prices map[string]Price `json:"prices"`
+	// Budgets limit usage. A request is allowed only if none of the budgets
+	// matching its usage key is exhausted.
+	Budgets []Budget `json:"budgets"`
+}
+
+// Price is a price of a model in US dollars per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+func (p Price) cost(input, output int64) float64 {
+	return (float64(input)*p.Input + float64(output)*p.Output) / 1e6
+}
+
+// Budget limits usage of keys matching a pattern during a UTC day or month.
+// Zero limits aren't enforced.
+type Budget struct {
+	// Key is a pattern of usage keys, in the syntax of path.Match. For
+	// example, "chat:*" matches all keys starting with "chat:" and without
+	// "/". As an exception, "*" matches all keys, including ones with "/".
+	Key string `json:"key"`
+	// Shared makes the budget limit the total usage of all matching keys
+	// instead of usage of each matching key.
+	Shared bool `json:"shared,omitempty"`
+
+	DailyTokens   int64   `json:"daily_tokens,omitempty"`
+	MonthlyTokens int64   `json:"monthly_tokens,omitempty"`
+	DailyCost     float64 `json:"daily_cost,omitempty"`
+	MonthlyCost   float64 `json:"monthly_cost,omitempty"`
+}
+
+// matches reports whether the budget applies to a usage key.
+func (b Budget) matches(key string) bool {
+	if b.Key == "*" {
+		return true
+	}
+	ok, _ := path.Match(b.Key, key)
+	return ok
+}
+
+// LoadConfig reads the configuration from a JSON file.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg Config) validate() error {
+	for i, b := range cfg.Budgets {
+		if _, err := path.Match(b.Key, ""); err != nil || b.Key == "" {
+			return fmt.Errorf("budgets[%d]: invalid key pattern %q", i, b.Key)
+		}
+		if b.DailyTokens < 0 || b.MonthlyTokens < 0 || b.DailyCost < 0 || b.MonthlyCost < 0 {
+			return fmt.Errorf("budgets[%d]: limits can't be negative", i)
+		}
+	}
+	return nil
+}
+
+// BudgetError is returned when a request is refused because a budget is
+// exhausted.
+type BudgetError struct {
+	// Key is the usage key of the refused request.
+	Key string
+	// Budget is the exhausted budget.
+	Budget Budget
+	// Period is "day" or "month".
+	Period string
+	// Resource is "tokens" or "cost".
+	Resource string
+	// Used and Limit are the usage and the limit of the resource.
+	Used, Limit float64
+	// Reset is when the period ends and the budget is replenished.
+	Reset time.Time
+}
+
+func (e *BudgetError) Error() string {
+	period := "monthly"
+	if e.Period == "day" {
+		period = "daily"
+	}
+	return fmt.Sprintf("%s budget of %s for %q is exhausted: used %s of %s; it resets at %s",
+		period,
+		e.Resource,
+		e.Budget.Key,
+		formatAmount(e.Resource, e.Used),
+		formatAmount(e.Resource, e.Limit),
+		e.Reset.Format(time.DateTime+" MST"),
+	)
+}
+
+func formatAmount(resource string, v float64) string {
+	if resource == "cost" {
+		return fmt.Sprintf("$%.4f", v)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+// BudgetStatus is the current usage of a budget by a key, or by all matching
+// keys if the budget is shared.
+type BudgetStatus struct {
+	Budget Budget
+	// Key is the usage key, or the pattern if the budget is shared.
+	Key      string
+	Period   string
+	Resource string
+	Used     float64
+	Limit    float64
+	Reset    time.Time
+}
+
+// Exhausted reports whether usage reached the limit.
+func (s BudgetStatus) Exhausted() bool { return s.Used >= s.Limit }
+
+// budgetPeriods returns the prefixes of days of the current day and month in
+// the YYYY-MM-DD format, and when they end.
+func budgetPeriods(now time.Time) (day, month string, dayReset, monthReset time.Time) {
+	now = now.UTC()
+	y, m, d := now.Date()
+	return now.Format(time.DateOnly), now.Format("2006-01"),
+		time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC),
+		time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// status returns statuses of limits of a budget for a key, which is the
+// pattern for shared budgets.
+func (u *Usage) status(b Budget, key string) []BudgetStatus {
+	match := func(k string) bool { return k == key }
+	if b.Shared {
+		match = b.matches
+	}
+	day, month, dayReset, monthReset := budgetPeriods(u.now())
+
+	var statuses []BudgetStatus
+	add := func(period, resource string, limit, used float64, reset time.Time) {
+		if limit <= 0 {
+			return
+		}
+		statuses = append(statuses, BudgetStatus{
+			Budget:   b,
+			Key:      key,
+			Period:   period,
+			Resource: resource,
+			Used:     used,
+			Limit:    limit,
+			Reset:    reset,
+		})
+	}
+	daily, monthly := u.sum(match, day), u.sum(match, month)
+	add("day", "tokens", float64(b.DailyTokens), float64(daily.totalTokens()), dayReset)
+	add("day", "cost", b.DailyCost, daily.Cost, dayReset)
+	add("month", "tokens", float64(b.MonthlyTokens), float64(monthly.totalTokens()), monthReset)
+	add("month", "cost", b.MonthlyCost, monthly.Cost, monthReset)
+	return statuses
+}
+
+// check returns a *BudgetError if a budget matching the key is exhausted.
+func (u *Usage) check(key string) error {
+	for _, b := range u.cfg.Budgets {
+		if !b.matches(key) {
+			continue
+		}
+		scope := key
+		if b.Shared {
+			scope = b.Key
+		}
+		for _, s := range u.status(b, scope) {
+			if s.Exhausted() {
+				return &BudgetError{
+					Key:      key,
+					Budget:   b,
+					Period:   s.Period,
+					Resource: s.Resource,
+					Used:     s.Used,
+					Limit:    s.Limit,
+					Reset:    s.Reset,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Budgets returns current statuses of configured budgets: for each shared
+// budget and for each key matching other budgets that was used this month.
+func (u *Usage) Budgets() []BudgetStatus {
+	_, month, _, _ := budgetPeriods(u.now())
+	var keys []string
+	u.f.Read(func(d *usageData) {
+		for key, v := range d.ByKey {
+			for day := range v.ByDay {
+				if day >= month {
+					keys = append(keys, key)
+					break
+				}
+			}
+		}
+	})
+	slices.Sort(keys)
+
+	var statuses []BudgetStatus
+	for _, b := range u.cfg.Budgets {
+		if b.Shared {
+			statuses = append(statuses, u.status(b, b.Key)...)
+			continue
+		}
+		for _, key := range keys {
+			if b.matches(key) {
+				statuses = append(statuses, u.status(b, key)...)
+			}
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,175 @@
+// © 2026 Ilya Mateyko. All rights reserved.
+// Use of this source code is governed by the ISC
+// license that can be found in the LICENSE.md file.
+
+package llm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.astrophena.name/base/testutil"
+)
+
+func TestBudgets(t *testing.T) {
+	u := testUsage(t, Config{
+		Prices: map[string]Price{
+			"expensive": {Input: 2, Output: 8},
+		},
+		Budgets: []Budget{
+			{Key: "chat:*", DailyTokens: 100},
+			{Key: "*", Shared: true, MonthlyCost: 1},
+		},
+	})
+	now := time.Date(2026, time.March, 31, 12, 0, 0, 0, time.UTC)
+	u.now = func() time.Time { return now }
+
+	mustAdd := func(key, model string, input, output int64) {
+		t.Helper()
+		if err := u.add(key, model, input, output); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkErr := func(key, want string) {
+		t.Helper()
+		err := u.check(key)
+		if want == "" {
+			if err != nil {
+				t.Fatalf("check(%q) = %v, want nil", key, err)
+			}
+			return
+		}
+		if _, ok := errors.AsType[*BudgetError](err); !ok {
+			t.Fatalf("check(%q) = %v, want *BudgetError", key, err)
+		}
+		testutil.AssertEqual(t, err.Error(), want)
+	}
+
+	mustAdd("chat:1", "cheap", 60, 40)
+	checkErr("chat:1", `daily budget of tokens for "chat:*" is exhausted: used 100 of 100; it resets at 2026-04-01 00:00:00 UTC`)
+	checkErr("chat:2", "")
+	checkErr("cron", "")
+	checkErr("", "")
+
+	// Daily budgets reset the next day.
+	now = now.Add(24 * time.Hour)
+	checkErr("chat:1", "")
+
+	// Shared budgets sum usage of all matching keys.
+	mustAdd("cron", "expensive", 250_000, 0)
+	checkErr("chat:2", "")
+	mustAdd("chat:2", "expensive", 0, 70_000)
+	checkErr("chat:3", `monthly budget of cost for "*" is exhausted: used $1.0600 of $1.0000; it resets at 2026-05-01 00:00:00 UTC`)
+	// "*" matches keys with "/" and the empty key too.
+	checkErr("group/1", `monthly budget of cost for "*" is exhausted: used $1.0600 of $1.0000; it resets at 2026-05-01 00:00:00 UTC`)
+	checkErr("", `monthly budget of cost for "*" is exhausted: used $1.0600 of $1.0000; it resets at 2026-05-01 00:00:00 UTC`)
+
+	testutil.AssertEqual(t, u.Budgets(), []BudgetStatus{
+		{
+			Budget:   Budget{Key: "chat:*", DailyTokens: 100},
+			Key:      "chat:2",
+			Period:   "day",
+			Resource: "tokens",
+			Used:     70_000,
+			Limit:    100,
+			Reset:    time.Date(2026, time.April, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Budget:   Budget{Key: "*", Shared: true, MonthlyCost: 1},
+			Key:      "*",
+			Period:   "month",
+			Resource: "cost",
+			Used:     1.06,
+			Limit:    1,
+			Reset:    time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC),
+		},
+	})
+}
+
+func TestUsageRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	// Usage recorded before models were tracked.
+	if err := os.WriteFile(path, []byte(`{"by_key": {"old": {
+		"total": {"input_tokens": 10, "output_tokens": 5},
+		"by_day": {"2026-01-01": {"input_tokens": 10, "output_tokens": 5}}
+	}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u, err := OpenUsage(path, Config{Prices: map[string]Price{"a": {Input: 1, Output: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.now = func() time.Time { return time.Date(2026, time.January, 2, 0, 0, 0, 0, time.UTC) }
+
+	for _, rec := range []struct {
+		key, model string
+	}{
+		{"new", "b"},
+		{"new", "a"},
+		{"old", "a"},
+		{"", "a"}, // not recorded
+	} {
+		if err := u.add(rec.key, rec.model, 1_000, 1_000); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testutil.AssertEqual(t, u.Records(""), []UsageRecord{
+		{Day: "2026-01-01", Key: "old", InputTokens: 10, OutputTokens: 5},
+		{Day: "2026-01-02", Key: "new", Model: "a", InputTokens: 1_000, OutputTokens: 1_000, Cost: 0.002},
+		{Day: "2026-01-02", Key: "new", Model: "b", InputTokens: 1_000, OutputTokens: 1_000},
+		{Day: "2026-01-02", Key: "old", Model: "a", InputTokens: 1_000, OutputTokens: 1_000, Cost: 0.002},
+	})
+	testutil.AssertEqual(t, len(u.Records("2026-01-02")), 3)
+	testutil.AssertEqual(t, u.get("old", ""), usageStats{InputTokens: 1_010, OutputTokens: 1_005, Cost: 0.002})
+}
+
+func TestLoadConfig(t *testing.T) {
+	cases := map[string]struct {
+		config  string
+		wantErr string
+	}{
+		"valid": {
+			config: `{"prices": {"m": {"input": 0.4, "output": 1.6}}, "budgets": [{"key": "chat:*", "daily_tokens": 1000}]}`,
+		},
+		"invalid JSON": {
+			config:  `{`,
+			wantErr: "parsing",
+		},
+		"invalid pattern": {
+			config:  `{"budgets": [{"key": "chat:["}]}`,
+			wantErr: `budgets[0]: invalid key pattern "chat:["`,
+		},
+		"empty pattern": {
+			config:  `{"budgets": [{"daily_cost": 1}]}`,
+			wantErr: `budgets[0]: invalid key pattern ""`,
+		},
+		"negative limit": {
+			config:  `{"budgets": [{"key": "*", "monthly_cost": -1}]}`,
+			wantErr: "budgets[0]: limits can't be negative",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "llm.json")
+			if err := os.WriteFile(path, []byte(tc.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(path)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("got error %v, want to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@
 Package llm contains a Starlark module for generating text with the configured
 LLM provider.
 
-The module sends chat-style contents, optional image bytes, and optional
+The module sends chat-style contents, optional images and files, and optional
 instructions to the configured OpenAI Responses-compatible /responses endpoint.
 It returns the response's text output as a single string and records token usage
 under a caller-provided usage key.
@@ -14,18 +14,28 @@ under a caller-provided usage key.
 This is useful with the OpenAI API and with other AI providers that expose a
 compatible endpoint, such as OpenRouter.
 
-This module provides two functions: generate and usage.
+This module provides six functions: generate, stream, usage, tool, image and
+file.
 
-usage(key, date?) returns cumulative token usage for the key.
-If date is provided (YYYY-MM-DD), it returns usage only for that exact UTC day.
+usage(key, date?) returns cumulative token usage for the key as a struct with
+input_tokens, output_tokens, total_tokens and cost (in US dollars, if prices of
+models are configured) fields. If date is provided (YYYY-MM-DD), it returns
+usage only for that exact UTC day.
 
 generate accepts the following keyword arguments:
 
   - model (str): Model name to generate with.
-  - contents (list of (str, str) tuples): A list of (role, content) messages.
-  - usage_key (str): Arbitrary key used to accumulate persistent token usage stats.
+  - contents (list of (str, str | list) tuples): A list of (role, content)
+    messages. Content is either a string or a list of strings, images made
+    with image and files made with file.
+  - usage_key (str): Arbitrary non-empty key used to accumulate persistent
+    token usage stats.
   - image (bytes, optional): Optional raw image bytes to upload as input_image.
   - instructions (str, optional): Optional high-level instructions for the model.
+  - tools (list, optional): Tools made with tool that the model can call.
+  - schema (dict, optional): JSON schema the output must conform to.
+  - on_budget_exceeded (callable, optional): Called if a budget of the usage
+    key configured by the operator is exhausted.
 
 For example:
 
@@ -40,6 +50,103 @@ For example:
 	)
 
 The return value is a single string from the response output message text.
+If schema is passed, the output is decoded from JSON and returned as a dict
+instead.
+
+Budgets are checked before each request. If one is exhausted, generate fails,
+unless on_budget_exceeded is passed: then it's called with a struct describing
+the budget, and its result is returned instead. The struct has key, pattern
+(the key pattern of the budget), period ("day" or "month"), resource ("tokens"
+or "cost"), used, limit, reset (time when the budget is replenished) and
+message fields. For example:
+
+	def over_budget(err):
+	    return "I'm out of tokens for today, try again after {}.".format(err.reset)
+
+	text = llm.generate(
+	    model="gpt-4.1-mini",
+	    contents=[("user", "Hi!")],
+	    usage_key="chat:123",
+	    on_budget_exceeded=over_budget,
+	)
+
+stream accepts the same model, contents, usage_key, image, instructions and
+on_budget_exceeded arguments as generate, and also:
+
+  - on_update (callable): Called with the text generated so far while it's
+    being generated.
+  - interval (float, optional): Minimal number of seconds between calls of
+    on_update. Defaults to 2, which keeps edits of a Telegram message with
+    the text within rate limits.
+
+It returns the complete generated text when generation finishes. The complete
+text isn't passed to on_update, so the last call may miss the end of it.
+Generation can take as long as the call of bot code allows, but fails if the
+gateway sends nothing for too long. For example:
+
+	def show(text):
+	    print(len(text), "characters so far")
+
+	text = llm.stream(
+	    model="gpt-4.1-mini",
+	    contents=[("user", "Write a long poem.")],
+	    usage_key="chat:123",
+	    on_update=show,
+	)
+
+tg.stream_reply from the tg.star library uses it to reply with a message that
+is edited as the text is generated.
+
+tool(fn, description?, parameters?, name?) makes a tool the model can call.
+The name defaults to the name of fn, and parameters is a JSON schema of an
+object with arguments of fn, which defaults to no arguments. When the model
+calls a tool, generate calls fn with arguments as keyword arguments and sends
+its result back to the model, which is repeated until the model answers with
+text, up to 10 times. Results that aren't strings are encoded as JSON.
+Token usage of all rounds is recorded.
+
+For example:
+
+	def get_weather(city):
+	    return {"city": city, "forecast": "sunny"}
+
+	text = llm.generate(
+	    model="gpt-4.1-mini",
+	    contents=[("user", "What's the weather in Paris?")],
+	    usage_key="chat:123",
+	    tools=[
+	        llm.tool(get_weather, description="Returns weather forecast for a city.", parameters={
+	            "type": "object",
+	            "properties": {"city": {"type": "string"}},
+	            "required": ["city"],
+	        }),
+	    ],
+	)
+
+image(data, mime?) makes an image from raw bytes to put into content.
+The MIME type is detected from data if not passed.
+
+file(data, filename) makes a file, such as a PDF document, from raw bytes to put
+into content. The MIME type is guessed from the filename extension.
+
+For example:
+
+	answer = llm.generate(
+	    model="gpt-4.1-mini",
+	    contents=[("user", [
+	        "Which of these matches the report?",
+	        llm.image(files.read("a.png")),
+	        llm.image(files.read("b.png")),
+	        llm.file(files.read("report.pdf"), "report.pdf"),
+	    ])],
+	    usage_key="chat:123",
+	    schema={
+	        "type": "object",
+	        "properties": {"image": {"type": "integer"}},
+	        "required": ["image"],
+	    },
+	)
+	print(answer["image"])
 */
 package llm
 
@@ -5,29 +5,60 @@
 package llm
 
 import (
+	"cmp"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"path"
+	"strings"
 	"time"
 
 	"go.astrophena.name/tools/internal/api/llm"
 	"go.astrophena.name/tools/internal/starlark/interpreter"
 
+	starlarkjson "go.starlark.net/lib/json"
+	starlarktime "go.starlark.net/lib/time"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 )
 
+// maxToolRounds limits the number of requests with function call outputs that
+// generate makes.
+const maxToolRounds = 10
+
+// defaultStreamInterval is the default minimal interval between calls of the
+// on_update callback passed to stream. Telegram limits how often a bot can edit
+// messages, so updating a message with each chunk of text would quickly hit
+// the limit.
+const defaultStreamInterval = 2 * time.Second
+
+// DryRunLocal is the name of a thread local that, if set to true, makes
+// generate and stream fail instead of calling the LLM API, so a dry run
+// doesn't spend budgets.
+const DryRunLocal = "llm.dry_run"
+
+// Constructors of values returned by tool, image and file.
+const (
+	toolConstructor  = starlark.String("llm.tool")
+	imageConstructor = starlark.String("llm.image")
+	fileConstructor  = starlark.String("llm.file")
+)
+
 // Module returns a Starlark module that exposes a minimal Responses API call.
-func Module(client *llm.Client, usagePath string) *starlarkstruct.Module {
-	usage, err := newUsageStore(usagePath)
-	if err != nil {
-		usage = nil
-	}
+// If usage is nil, usage isn't tracked and budgets aren't enforced.
+func Module(client *llm.Client, usage *Usage) *starlarkstruct.Module {
 	m := &module{client: client, usage: usage}
 	return &starlarkstruct.Module{
 		Name: "llm",
 		Members: starlark.StringDict{
+			"file":     starlark.NewBuiltin("llm.file", makeFile),
 			"generate": starlark.NewBuiltin("llm.generate", m.generate),
+			"image":    starlark.NewBuiltin("llm.image", makeImage),
+			"stream":   starlark.NewBuiltin("llm.stream", m.stream),
+			"tool":     starlark.NewBuiltin("llm.tool", makeTool),
 			"usage":    starlark.NewBuiltin("llm.usage", m.getUsage),
 		},
 	}
@@ -35,7 +66,7 @@ func Module(client *llm.Client, usagePath string) *starlarkstruct.Module {
 
 type module struct {
 	client *llm.Client
-	usage  *usageStore
+	usage  *Usage
 }
 
 func (m *module) generate(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -44,6 +75,9 @@ func (m *module) generate(thread *starlark.Thread, b *starlark.Builtin, args sta
 	if m.client == nil {
 		return starlark.None, fmt.Errorf("%s: LLM API is not available", b.Name())
 	}
+	if dry, _ := thread.Local(DryRunLocal).(bool); dry {
+		return starlark.None, fmt.Errorf("%s: can't call the LLM API in a dry run", b.Name())
+	}
 
 	var (
 		model        string
@@ -51,6 +85,9 @@ func (m *module) generate(thread *starlark.Thread, b *starlark.Builtin, args sta
 		instructions string
 		usageKey     string
 		image        starlark.Bytes
+		toolsList    *starlark.List
+		schema       starlark.Value
+		onBudget     starlark.Callable
 	)
 
 	if err := starlark.UnpackArgs(
@@ -60,46 +97,390 @@ func (m *module) generate(thread *starlark.Thread, b *starlark.Builtin, args sta
 		"usage_key", &usageKey,
 		"image?", &image,
 		"instructions?", &instructions,
+		"tools?", &toolsList,
+		"schema?", &schema,
+		"on_budget_exceeded?", &onBudget,
 	); err != nil {
 		return nil, err
 	}
+	if usageKey == "" {
+		return nil, fmt.Errorf("%s: usage_key must not be empty", b.Name())
+	}
+
+	messages, err := input(contentsList, image)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+
+	params := llm.ResponseParams{Model: model, Instructions: instructions}
+	tools := make(map[string]starlark.Callable)
+	if toolsList != nil {
+		for i := range toolsList.Len() {
+			tool, ok := toolsList.Index(i).(*starlarkstruct.Struct)
+			if !ok || tool.Constructor() != toolConstructor {
+				return nil, fmt.Errorf("%s: tools[%d] is not a tool created with llm.tool", b.Name(), i)
+			}
+			name, _ := tool.Attr("name")
+			desc, _ := tool.Attr("description")
+			fn, _ := tool.Attr("fn")
+			parameters, _ := tool.Attr("parameters")
+			enc, err := encodeJSON(thread, parameters)
+			if err != nil {
+				return nil, fmt.Errorf("%s: tools[%d] parameters: %w", b.Name(), i, err)
+			}
+			params.Tools = append(params.Tools, llm.Tool{
+				Type:        "function",
+				Name:        string(name.(starlark.String)),
+				Description: string(desc.(starlark.String)),
+				Parameters:  json.RawMessage(enc),
+			})
+			tools[string(name.(starlark.String))] = fn.(starlark.Callable)
+		}
+	}
+	if schema != nil && schema != starlark.None {
+		enc, err := encodeJSON(thread, schema)
+		if err != nil {
+			return nil, fmt.Errorf("%s: schema: %w", b.Name(), err)
+		}
+		params.Text = &llm.TextConfig{Format: llm.TextFormat{
+			Type:   "json_schema",
+			Name:   "output",
+			Schema: json.RawMessage(enc),
+		}}
+	}
 
+	var resp *llm.Response
+	for round := 0; ; round++ {
+		if v, err := m.checkBudget(thread, b, usageKey, onBudget); v != nil || err != nil {
+			return v, err
+		}
+		params.Input = messages
+		resp, err = m.client.CreateResponse(ctx, params)
+		if err != nil {
+			return starlark.None, fmt.Errorf("%s: failed to generate text: %w", b.Name(), err)
+		}
+		if err := m.addUsage(usageKey, model, resp); err != nil {
+			return starlark.None, fmt.Errorf("%s: failed to persist usage: %w", b.Name(), err)
+		}
+		if len(resp.FunctionCalls) == 0 {
+			break
+		}
+		if round == maxToolRounds {
+			return starlark.None, fmt.Errorf("%s: model kept calling tools after %d rounds", b.Name(), maxToolRounds)
+		}
+		for _, call := range resp.FunctionCalls {
+			output, err := callTool(thread, tools, call)
+			if err != nil {
+				return starlark.None, fmt.Errorf("%s: %w", b.Name(), err)
+			}
+			messages = append(messages, call.Message(), llm.Message{
+				Type:   "function_call_output",
+				CallID: call.CallID,
+				Output: output,
+			})
+		}
+	}
+
+	if params.Text != nil {
+		v, err := starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(resp.OutputText)}, nil)
+		if err != nil {
+			return starlark.None, fmt.Errorf("%s: model returned invalid JSON: %w", b.Name(), err)
+		}
+		return v, nil
+	}
+	return starlark.String(resp.OutputText), nil
+}
+
+// input converts contents and an optional image passed to generate or stream
+// to input messages.
+func input(contentsList *starlark.List, image starlark.Bytes) ([]llm.Message, error) {
 	messages := make([]llm.Message, 0, contentsList.Len()+1)
 	for i := range contentsList.Len() {
 		item, ok := contentsList.Index(i).(starlark.Tuple)
 		if !ok {
-			return nil, fmt.Errorf("%s: contents[%d] is not a tuple", b.Name(), i)
+			return nil, fmt.Errorf("contents[%d] is not a tuple", i)
 		}
 		if len(item) != 2 {
-			return nil, fmt.Errorf("%s: contents[%d] must have exactly two elements: role and content", b.Name(), i)
+			return nil, fmt.Errorf("contents[%d] must have exactly two elements: role and content", i)
 		}
 		role, ok := item.Index(0).(starlark.String)
 		if !ok {
-			return nil, fmt.Errorf("%s: in contents[%d] role must be a string", b.Name(), i)
+			return nil, fmt.Errorf("in contents[%d] role must be a string", i)
 		}
-		content, ok := item.Index(1).(starlark.String)
-		if !ok {
-			return nil, fmt.Errorf("%s: in contents[%d] content must be a string", b.Name(), i)
+		parts, err := contentParts(string(role), item.Index(1))
+		if err != nil {
+			return nil, fmt.Errorf("in contents[%d] %w", i, err)
 		}
-		messages = append(messages, llm.Message{Role: string(role), Content: []llm.ContentPart{{Type: contentPartType(string(role)), Text: string(content)}}})
+		messages = append(messages, llm.Message{Role: string(role), Content: parts})
 	}
 	if image.Len() > 0 {
-		mime := http.DetectContentType([]byte(image))
-		imageURL := "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString([]byte(image))
-		messages = append(messages, llm.Message{Role: "user", Content: []llm.ContentPart{{Type: "input_image", ImageURL: imageURL}}})
+		messages = append(messages, llm.Message{Role: "user", Content: []llm.ContentPart{imagePart(string(image), "")}})
+	}
+	return messages, nil
+}
+
+func (m *module) stream(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	ctx := interpreter.Context(thread)
+
+	if m.client == nil {
+		return starlark.None, fmt.Errorf("%s: LLM API is not available", b.Name())
+	}
+	if dry, _ := thread.Local(DryRunLocal).(bool); dry {
+		return starlark.None, fmt.Errorf("%s: can't call the LLM API in a dry run", b.Name())
+	}
+
+	var (
+		model        string
+		contentsList *starlark.List
+		instructions string
+		usageKey     string
+		image        starlark.Bytes
+		onUpdate     starlark.Callable
+		interval     starlark.Value = starlark.Float(defaultStreamInterval.Seconds())
+		onBudget     starlark.Callable
+	)
+
+	if err := starlark.UnpackArgs(
+		b.Name(), args, kwargs,
+		"model", &model,
+		"contents", &contentsList,
+		"usage_key", &usageKey,
+		"on_update", &onUpdate,
+		"image?", &image,
+		"instructions?", &instructions,
+		"interval?", &interval,
+		"on_budget_exceeded?", &onBudget,
+	); err != nil {
+		return nil, err
+	}
+	if usageKey == "" {
+		return nil, fmt.Errorf("%s: usage_key must not be empty", b.Name())
+	}
+	secs, ok := starlark.AsFloat(interval)
+	if !ok || secs < 0 {
+		return nil, fmt.Errorf("%s: interval must be a non-negative number of seconds", b.Name())
+	}
+	every := time.Duration(secs * float64(time.Second))
+
+	messages, err := input(contentsList, image)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+
+	if v, err := m.checkBudget(thread, b, usageKey, onBudget); v != nil || err != nil {
+		return v, err
 	}
 
-	resp, err := m.client.CreateResponse(ctx, llm.ResponseParams{Model: model, Input: messages, Instructions: instructions})
+	var (
+		text       strings.Builder
+		lastUpdate time.Time
+	)
+	resp, err := m.client.StreamResponse(ctx, llm.ResponseParams{
+		Model:        model,
+		Input:        messages,
+		Instructions: instructions,
+	}, func(delta string) error {
+		text.WriteString(delta)
+		if strings.TrimSpace(text.String()) == "" || time.Since(lastUpdate) < every {
+			return nil
+		}
+		lastUpdate = time.Now()
+		_, err := starlark.Call(thread, onUpdate, starlark.Tuple{starlark.String(text.String())}, nil)
+		return err
+	})
 	if err != nil {
+		if _, ok := errors.AsType[*starlark.EvalError](err); ok {
+			return starlark.None, err
+		}
 		return starlark.None, fmt.Errorf("%s: failed to generate text: %w", b.Name(), err)
 	}
-	if m.usage != nil {
-		if err := m.usage.add(usageKey, time.Now(), resp.Usage.InputTokens, resp.Usage.OutputTokens); err != nil {
-			return starlark.None, fmt.Errorf("%s: failed to persist usage: %w", b.Name(), err)
+	if err := m.addUsage(usageKey, model, resp); err != nil {
+		return starlark.None, fmt.Errorf("%s: failed to persist usage: %w", b.Name(), err)
+	}
+	return starlark.String(resp.OutputText), nil
+}
+
+func (m *module) addUsage(key, model string, resp *llm.Response) error {
+	if m.usage == nil {
+		return nil
+	}
+	return m.usage.add(key, model, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+}
+
+// checkBudget checks budgets of the usage key. If one is exhausted, it returns
+// the result of onBudget called with a struct describing the exhausted budget,
+// or the *BudgetError if onBudget is nil. Otherwise, it returns nil and nil.
+func (m *module) checkBudget(thread *starlark.Thread, b *starlark.Builtin, key string, onBudget starlark.Callable) (starlark.Value, error) {
+	if m.usage == nil {
+		return nil, nil
+	}
+	err := m.usage.check(key)
+	if err == nil {
+		return nil, nil
+	}
+	budgetErr, ok := errors.AsType[*BudgetError](err)
+	if !ok || onBudget == nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlark.Call(thread, onBudget, starlark.Tuple{starlarkstruct.FromStringDict(starlark.String("budget_error"), starlark.StringDict{
+		"key":      starlark.String(budgetErr.Key),
+		"pattern":  starlark.String(budgetErr.Budget.Key),
+		"period":   starlark.String(budgetErr.Period),
+		"resource": starlark.String(budgetErr.Resource),
+		"used":     starlark.Float(budgetErr.Used),
+		"limit":    starlark.Float(budgetErr.Limit),
+		"reset":    starlarktime.Time(budgetErr.Reset),
+		"message":  starlark.String(budgetErr.Error()),
+	})}, nil)
+}
+
+// callTool calls the function of a tool requested by the model and returns
+// its result, encoded as JSON unless it's a string.
+func callTool(thread *starlark.Thread, tools map[string]starlark.Callable, call llm.FunctionCall) (string, error) {
+	fn, ok := tools[call.Name]
+	if !ok {
+		return "", fmt.Errorf("model called unknown tool %q", call.Name)
+	}
+	args, err := starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(cmp.Or(call.Arguments, "{}"))}, nil)
+	if err != nil {
+		return "", fmt.Errorf("model called tool %q with invalid arguments: %w", call.Name, err)
+	}
+	argsDict, ok := args.(*starlark.Dict)
+	if !ok {
+		return "", fmt.Errorf("model called tool %q with arguments that aren't an object", call.Name)
+	}
+	kwargs := make([]starlark.Tuple, 0, argsDict.Len())
+	for _, item := range argsDict.Items() {
+		kwargs = append(kwargs, item)
+	}
+	result, err := starlark.Call(thread, fn, nil, kwargs)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := result.(starlark.String); ok {
+		return string(s), nil
+	}
+	out, err := encodeJSON(thread, result)
+	if err != nil {
+		return "", fmt.Errorf("tool %q returned a value that can't be encoded to JSON: %w", call.Name, err)
+	}
+	return out, nil
+}
+
+func encodeJSON(thread *starlark.Thread, v starlark.Value) (string, error) {
+	enc, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{v}, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(enc.(starlark.String)), nil
+}
+
+// contentParts converts content of a message, which is either a string or a
+// list of strings, images and files, to content parts.
+func contentParts(role string, content starlark.Value) ([]llm.ContentPart, error) {
+	switch content := content.(type) {
+	case starlark.String:
+		return []llm.ContentPart{{Type: contentPartType(role), Text: string(content)}}, nil
+	case *starlark.List:
+		parts := make([]llm.ContentPart, 0, content.Len())
+		for i := range content.Len() {
+			switch part := content.Index(i).(type) {
+			case starlark.String:
+				parts = append(parts, llm.ContentPart{Type: contentPartType(role), Text: string(part)})
+			case *starlarkstruct.Struct:
+				data, _ := part.Attr("data")
+				switch part.Constructor() {
+				case imageConstructor:
+					mime, _ := part.Attr("mime")
+					parts = append(parts, imagePart(string(data.(starlark.Bytes)), string(mime.(starlark.String))))
+					continue
+				case fileConstructor:
+					name, _ := part.Attr("filename")
+					parts = append(parts, filePart(string(data.(starlark.Bytes)), string(name.(starlark.String))))
+					continue
+				}
+				return nil, fmt.Errorf("content[%d] must be a string, an image or a file", i)
+			default:
+				return nil, fmt.Errorf("content[%d] must be a string, an image or a file", i)
+			}
 		}
+		return parts, nil
+	default:
+		return nil, errors.New("content must be a string or a list")
 	}
+}
 
-	return starlark.String(resp.OutputText), nil
+func imagePart(data, mime string) llm.ContentPart {
+	mime = cmp.Or(mime, http.DetectContentType([]byte(data)))
+	return llm.ContentPart{Type: "input_image", ImageURL: dataURL(mime, data)}
+}
+
+func filePart(data, filename string) llm.ContentPart {
+	typ := mime.TypeByExtension(path.Ext(filename))
+	if typ == "" {
+		typ = http.DetectContentType([]byte(data))
+	}
+	return llm.ContentPart{Type: "input_file", Filename: filename, FileData: dataURL(typ, data)}
+}
+
+func dataURL(mime, data string) string {
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString([]byte(data))
+}
+
+func makeTool(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		fn          starlark.Callable
+		name        string
+		description string
+		parameters  starlark.Value = starlark.None
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "fn", &fn, "description?", &description, "parameters?", &parameters, "name?", &name); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = fn.Name()
+	}
+	if parameters == starlark.None {
+		// Functions without parameters still need a schema.
+		noParams := starlark.NewDict(2)
+		noParams.SetKey(starlark.String("type"), starlark.String("object"))
+		noParams.SetKey(starlark.String("properties"), starlark.NewDict(0))
+		parameters = noParams
+	}
+	return starlarkstruct.FromStringDict(toolConstructor, starlark.StringDict{
+		"name":        starlark.String(name),
+		"description": starlark.String(description),
+		"parameters":  parameters,
+		"fn":          fn,
+	}), nil
+}
+
+func makeImage(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		data starlark.Bytes
+		mime string
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "data", &data, "mime?", &mime); err != nil {
+		return nil, err
+	}
+	return starlarkstruct.FromStringDict(imageConstructor, starlark.StringDict{
+		"data": data,
+		"mime": starlark.String(mime),
+	}), nil
+}
+
+func makeFile(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		data     starlark.Bytes
+		filename string
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "data", &data, "filename", &filename); err != nil {
+		return nil, err
+	}
+	return starlarkstruct.FromStringDict(fileConstructor, starlark.StringDict{
+		"data":     data,
+		"filename": starlark.String(filename),
+	}), nil
 }
 
 func contentPartType(role string) string {
@@ -127,5 +508,6 @@ func (m *module) getUsage(_ *starlark.Thread, b *starlark.Builtin, args starlark
 		"input_tokens":  starlark.MakeInt64(u.InputTokens),
 		"output_tokens": starlark.MakeInt64(u.OutputTokens),
 		"total_tokens":  starlark.MakeInt64(u.InputTokens + u.OutputTokens),
+		"cost":          starlark.Float(u.Cost),
 	}), nil
 }
@@ -5,9 +5,19 @@
 package llm
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"go.astrophena.name/base/testutil"
+	"go.astrophena.name/tools/internal/api/llm"
+	"go.astrophena.name/tools/internal/starlark/interpreter"
+
+	"go.starlark.net/starlark"
 )
 
 func TestContentPartType(t *testing.T) {
@@ -27,3 +37,332 @@ func TestContentPartType(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerate(t *testing.T) {
+	cases := map[string]struct {
+		script string
+		// respond returns the response body to the nth request.
+		respond    func(n int, params llm.ResponseParams) string
+		config     Config
+		wantOutput string
+		wantErr    string
+		check      func(t *testing.T, requests []llm.ResponseParams)
+	}{
+		"text": {
+			script: `print(llm.generate(model = "m", contents = [("user", "hi")], usage_key = "k"))`,
+			respond: func(int, llm.ResponseParams) string {
+				return `{"output_text": "hello", "usage": {"input_tokens": 1, "output_tokens": 2}}`
+			},
+			wantOutput: "hello",
+		},
+		"tools": {
+			script: `
+def get_weather(city):
+    return {"city": city, "temp": 21}
+
+def get_time():
+    return "noon"
+
+print(llm.generate(
+    model = "m",
+    contents = [("user", "weather?")],
+    usage_key = "k",
+    tools = [
+        llm.tool(get_weather, description = "Returns weather.", parameters = {
+            "type": "object",
+            "properties": {"city": {"type": "string"}},
+            "required": ["city"],
+        }),
+        llm.tool(get_time, name = "time"),
+    ],
+))
+print(llm.usage("k").total_tokens)
+`,
+			respond: func(n int, params llm.ResponseParams) string {
+				if n == 0 {
+					return `{"output": [
+						{"type": "function_call", "call_id": "c1", "name": "get_weather", "arguments": "{\"city\":\"Paris\"}"},
+						{"type": "function_call", "call_id": "c2", "name": "time", "arguments": ""}
+					], "usage": {"input_tokens": 10, "output_tokens": 5}}`
+				}
+				return `{"output_text": "Sunny at noon.", "usage": {"input_tokens": 20, "output_tokens": 3}}`
+			},
+			wantOutput: "Sunny at noon.38",
+			check: func(t *testing.T, requests []llm.ResponseParams) {
+				testutil.AssertEqual(t, len(requests), 2)
+				testutil.AssertEqual(t, requests[0].Tools[0].Name, "get_weather")
+				testutil.AssertEqual(t, requests[0].Tools[0].Description, "Returns weather.")
+				testutil.AssertEqual(t, string(requests[0].Tools[1].Parameters), `{"properties":{},"type":"object"}`)
+				testutil.AssertEqual(t, requests[1].Input[1:], []llm.Message{
+					{Type: "function_call", CallID: "c1", Name: "get_weather", Arguments: `{"city":"Paris"}`},
+					{Type: "function_call_output", CallID: "c1", Output: `{"city":"Paris","temp":21}`},
+					{Type: "function_call", CallID: "c2", Name: "time"},
+					{Type: "function_call_output", CallID: "c2", Output: "noon"},
+				})
+			},
+		},
+		"empty usage key": {
+			script:  `llm.generate(model = "m", contents = [("user", "hi")], usage_key = "")`,
+			wantErr: "llm.generate: usage_key must not be empty",
+		},
+		"unknown tool": {
+			script: `llm.generate(model = "m", contents = [("user", "hi")], usage_key = "k")`,
+			respond: func(int, llm.ResponseParams) string {
+				return `{"output": [{"type": "function_call", "call_id": "c1", "name": "rm_rf", "arguments": "{}"}]}`
+			},
+			wantErr: `llm.generate: model called unknown tool "rm_rf"`,
+		},
+		"too many tool rounds": {
+			script: `
+def noop():
+    return None
+
+llm.generate(model = "m", contents = [("user", "hi")], usage_key = "k", tools = [llm.tool(noop)])
+`,
+			respond: func(int, llm.ResponseParams) string {
+				return `{"output": [{"type": "function_call", "call_id": "c1", "name": "noop", "arguments": "{}"}]}`
+			},
+			wantErr: "model kept calling tools after 10 rounds",
+		},
+		"structured output": {
+			script: `
+result = llm.generate(
+    model = "m",
+    contents = [("user", "meaning of life?")],
+    usage_key = "k",
+    schema = {"type": "object", "properties": {"answer": {"type": "integer"}}},
+)
+print(result["answer"] + 1)
+`,
+			respond: func(int, llm.ResponseParams) string {
+				return `{"output_text": "{\"answer\": 42}"}`
+			},
+			wantOutput: "43",
+			check: func(t *testing.T, requests []llm.ResponseParams) {
+				testutil.AssertEqual(t, requests[0].Text.Format.Type, "json_schema")
+				testutil.AssertEqual(t, string(requests[0].Text.Format.Schema), `{"properties":{"answer":{"type":"integer"}},"type":"object"}`)
+			},
+		},
+		"images and files": {
+			script: `
+print(llm.generate(
+    model = "m",
+    contents = [("user", [
+        "Compare these.",
+        llm.image(b"\x89PNG\r\n\x1a\n"),
+        llm.image(b"raw", mime = "image/webp"),
+        llm.file(b"%PDF-1.4", "report.pdf"),
+    ])],
+    usage_key = "k",
+))
+`,
+			respond: func(int, llm.ResponseParams) string {
+				return `{"output_text": "ok"}`
+			},
+			wantOutput: "ok",
+			check: func(t *testing.T, requests []llm.ResponseParams) {
+				testutil.AssertEqual(t, requests[0].Input[0].Content, []llm.ContentPart{
+					{Type: "input_text", Text: "Compare these."},
+					{Type: "input_image", ImageURL: "data:image/png;base64,iVBORw0KGgo="},
+					{Type: "input_image", ImageURL: "data:image/webp;base64,cmF3"},
+					{Type: "input_file", Filename: "report.pdf", FileData: "data:application/pdf;base64,JVBERi0xLjQ="},
+				})
+			},
+		},
+		"budget exceeded": {
+			script: `
+print(llm.generate(model = "m", contents = [("user", "hi")], usage_key = "chat:1"))
+llm.generate(model = "m", contents = [("user", "hi")], usage_key = "chat:1")
+`,
+			respond: func(int, llm.ResponseParams) string {
+				return `{"output_text": "hello", "usage": {"input_tokens": 1, "output_tokens": 2}}`
+			},
+			config:  Config{Budgets: []Budget{{Key: "chat:*", DailyTokens: 3}}},
+			wantErr: `llm.generate: daily budget of tokens for "chat:*" is exhausted: used 3 of 3`,
+		},
+		"budget exceeded callback": {
+			script: `
+def over_budget(err):
+    return "over %s %s budget of %s for %s: %s" % (err.period, err.resource, err.pattern, err.key, err.used)
+
+print(llm.generate(model = "m", contents = [("user", "hi")], usage_key = "chat:1", on_budget_exceeded = over_budget))
+print(llm.generate(model = "m", contents = [("user", "hi")], usage_key = "chat:1", on_budget_exceeded = over_budget))
+print(llm.usage("chat:1").cost)
+`,
+			respond: func(int, llm.ResponseParams) string {
+				return `{"output_text": "hello", "usage": {"input_tokens": 500000, "output_tokens": 0}}`
+			},
+			config: Config{
+				Prices:  map[string]Price{"m": {Input: 2}},
+				Budgets: []Budget{{Key: "*", Shared: true, MonthlyCost: 1}},
+			},
+			wantOutput: "helloover month cost budget of * for chat:1: 1.01.0",
+		},
+		"invalid content": {
+			script:  `llm.generate(model = "m", contents = [("user", [1])], usage_key = "k")`,
+			wantErr: "llm.generate: in contents[0] content[0] must be a string, an image or a file",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var requests []llm.ResponseParams
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST llm.example/v1/responses", func(w http.ResponseWriter, r *http.Request) {
+				params := testutil.UnmarshalJSON[llm.ResponseParams](t, mustReadAll(t, r.Body))
+				w.Write([]byte(tc.respond(len(requests), params)))
+				requests = append(requests, params)
+			})
+
+			var buf bytes.Buffer
+			intr := &interpreter.Interpreter{
+				Predeclared: starlark.StringDict{
+					"llm": Module(&llm.Client{
+						APIURL:     "https://llm.example/v1",
+						APIKey:     "test",
+						HTTPClient: testutil.MockHTTPClient(mux),
+					}, testUsage(t, tc.config)),
+				},
+				Packages: map[string]interpreter.Loader{
+					interpreter.MainPkg: interpreter.MemoryLoader(map[string]string{
+						"test.star": tc.script,
+					}),
+				},
+				Logger: func(file string, line int, message string) {
+					fmt.Fprint(&buf, message)
+				},
+			}
+			if err := intr.Init(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := intr.ExecModule(t.Context(), interpreter.MainPkg, "test.star")
+			if tc.wantErr != "" {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				if !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: got %q, want to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to execute script: %v", err)
+			}
+			testutil.AssertEqual(t, buf.String(), tc.wantOutput)
+			if tc.check != nil {
+				tc.check(t, requests)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST llm.example/v1/responses", func(w http.ResponseWriter, r *http.Request) {
+		params := testutil.UnmarshalJSON[llm.ResponseParams](t, mustReadAll(t, r.Body))
+		testutil.AssertEqual(t, params.Stream, true)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{" ", "Hello", ",", " world"} {
+			fmt.Fprintf(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":%q}\n\n", delta)
+		}
+		io.WriteString(w, "data: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":3,\"output_tokens\":4}}}\n\n")
+	})
+
+	cases := map[string]struct {
+		script     string
+		wantOutput string
+		wantErr    string
+	}{
+		"every chunk": {
+			script: `
+updates = []
+text = llm.stream(model = "m", contents = [("user", "hi")], usage_key = "k", on_update = updates.append, interval = 0)
+print(updates)
+print(text)
+print(llm.usage("k").total_tokens)
+`,
+			wantOutput: `[" Hello", " Hello,", " Hello, world"]` + "\n Hello, world\n7",
+		},
+		"throttled": {
+			script: `
+updates = []
+print(llm.stream(model = "m", contents = [("user", "hi")], usage_key = "k", on_update = updates.append, interval = 60))
+print(updates)
+`,
+			wantOutput: " Hello, world\n[\" Hello\"]",
+		},
+		"failing callback": {
+			script: `
+def on_update(text):
+    fail("oops")
+
+llm.stream(model = "m", contents = [("user", "hi")], usage_key = "k", on_update = on_update)
+`,
+			wantErr: "oops",
+		},
+		"negative interval": {
+			script:  `llm.stream(model = "m", contents = [("user", "hi")], usage_key = "k", on_update = print, interval = -1)`,
+			wantErr: "interval must be a non-negative number of seconds",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var lines []string
+			intr := &interpreter.Interpreter{
+				Predeclared: starlark.StringDict{
+					"llm": Module(&llm.Client{
+						APIURL:     "https://llm.example/v1",
+						APIKey:     "test",
+						HTTPClient: testutil.MockHTTPClient(mux),
+					}, testUsage(t, Config{})),
+				},
+				Packages: map[string]interpreter.Loader{
+					interpreter.MainPkg: interpreter.MemoryLoader(map[string]string{
+						"test.star": tc.script,
+					}),
+				},
+				Logger: func(file string, line int, message string) {
+					lines = append(lines, message)
+				},
+			}
+			if err := intr.Init(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := intr.ExecModule(t.Context(), interpreter.MainPkg, "test.star")
+			if tc.wantErr != "" {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				if !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("unexpected error: got %q, want to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to execute script: %v", err)
+			}
+			testutil.AssertEqual(t, strings.Join(lines, "\n"), tc.wantOutput)
+		})
+	}
+}
+
+func mustReadAll(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testUsage(t *testing.T, cfg Config) *Usage {
+	t.Helper()
+	u, err := OpenUsage(filepath.Join(t.TempDir(), "usage.json"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -5,8 +5,11 @@
 package llm
 
 import (
+	"cmp"
 	"errors"
 	"io/fs"
+	"slices"
+	"strings"
 	"time"
 
 	"crawshaw.dev/jsonfile"
@@ -15,8 +18,18 @@ import (
 type usageStats struct {
 	InputTokens  int64 `json:"input_tokens"`
 	OutputTokens int64 `json:"output_tokens"`
+	// Cost is in US dollars, according to prices at the time of the request.
+	Cost float64 `json:"cost,omitempty"`
 }
 
+func (s *usageStats) add(o usageStats) {
+	s.InputTokens += o.InputTokens
+	s.OutputTokens += o.OutputTokens
+	s.Cost += o.Cost
+}
+
+func (s usageStats) totalTokens() int64 { return s.InputTokens + s.OutputTokens }
+
 type usageData struct {
 	ByKey map[string]usageKeyStats `json:"by_key"`
 }
@@ -24,15 +37,24 @@ type usageData struct {
 type usageKeyStats struct {
 	Total usageStats            `json:"total"`
 	ByDay map[string]usageStats `json:"by_day"`
+	// ByDayModel breaks down daily usage by model. It's missing for usage
+	// recorded before models were tracked.
+	ByDayModel map[string]map[string]usageStats `json:"by_day_model,omitempty"`
 }
 
-type usageStore struct {
-	f *jsonfile.JSONFile[usageData]
+// Usage keeps persistent token usage stats of the llm module and enforces
+// budgets.
+type Usage struct {
+	f   *jsonfile.JSONFile[usageData]
+	cfg Config
+	now func() time.Time
 }
 
-func newUsageStore(path string) (*usageStore, error) {
-	if path == "" {
-		return nil, nil
+// OpenUsage opens usage stats stored in a JSON file at path, creating it if it
+// doesn't exist, and checks the configuration.
+func OpenUsage(path string, cfg Config) (*Usage, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
 
 	f, err := jsonfile.Load[usageData](path)
@@ -55,17 +77,22 @@ func newUsageStore(path string) (*usageStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &usageStore{f: f}, nil
+	return &Usage{f: f, cfg: cfg, now: time.Now}, nil
 }
 
 func isNotExist(err error) bool { return errors.Is(err, fs.ErrNotExist) }
 
-func (s *usageStore) add(key string, now time.Time, input, output int64) error {
+func (u *Usage) add(key, model string, input, output int64) error {
 	if key == "" {
 		return nil
 	}
-	day := now.UTC().Format(time.DateOnly)
-	return s.f.Write(func(d *usageData) error {
+	stats := usageStats{
+		InputTokens:  input,
+		OutputTokens: output,
+		Cost:         u.cfg.Prices[model].cost(input, output),
+	}
+	day := u.now().UTC().Format(time.DateOnly)
+	return u.f.Write(func(d *usageData) error {
 		if d.ByKey == nil {
 			d.ByKey = make(map[string]usageKeyStats)
 		}
@@ -73,20 +100,27 @@ func (s *usageStore) add(key string, now time.Time, input, output int64) error {
 		if v.ByDay == nil {
 			v.ByDay = make(map[string]usageStats)
 		}
-		v.Total.InputTokens += input
-		v.Total.OutputTokens += output
+		if v.ByDayModel == nil {
+			v.ByDayModel = make(map[string]map[string]usageStats)
+		}
+		if v.ByDayModel[day] == nil {
+			v.ByDayModel[day] = make(map[string]usageStats)
+		}
+		v.Total.add(stats)
 		daily := v.ByDay[day]
-		daily.InputTokens += input
-		daily.OutputTokens += output
+		daily.add(stats)
 		v.ByDay[day] = daily
+		byModel := v.ByDayModel[day][model]
+		byModel.add(stats)
+		v.ByDayModel[day][model] = byModel
 		d.ByKey[key] = v
 		return nil
 	})
 }
 
-func (s *usageStore) get(key string, date string) usageStats {
+func (u *Usage) get(key string, date string) usageStats {
 	var out usageStats
-	s.f.Read(func(d *usageData) {
+	u.f.Read(func(d *usageData) {
 		v, ok := d.ByKey[key]
 		if !ok {
 			return
@@ -99,3 +133,89 @@ func (s *usageStore) get(key string, date string) usageStats {
 	})
 	return out
 }
+
+// UsageRecord is token usage of a key with a model during a day.
+type UsageRecord struct {
+	// Day is the UTC day in the YYYY-MM-DD format.
+	Day string
+	Key string
+	// Model is the name of the model, or empty for usage recorded before
+	// models were tracked.
+	Model        string
+	InputTokens  int64
+	OutputTokens int64
+	// Cost is in US dollars, according to prices at the time of requests.
+	Cost float64
+}
+
+// TotalTokens returns the sum of input and output tokens.
+func (r UsageRecord) TotalTokens() int64 { return r.InputTokens + r.OutputTokens }
+
+// Records returns usage records of days starting from since, in the YYYY-MM-DD
+// format, or all of them if since is empty, ordered by day, key and model.
+func (u *Usage) Records(since string) []UsageRecord {
+	var records []UsageRecord
+	u.f.Read(func(d *usageData) {
+		for key, v := range d.ByKey {
+			for day, daily := range v.ByDay {
+				if day < since {
+					continue
+				}
+				// Attribute usage that isn't broken down by model to an
+				// unknown one.
+				rest := daily
+				for model, s := range v.ByDayModel[day] {
+					records = append(records, record(day, key, model, s))
+					rest.InputTokens -= s.InputTokens
+					rest.OutputTokens -= s.OutputTokens
+					rest.Cost -= s.Cost
+				}
+				if rest.totalTokens() > 0 {
+					records = append(records, record(day, key, "", rest))
+				}
+			}
+		}
+	})
+	sortRecords(records)
+	return records
+}
+
+func sortRecords(records []UsageRecord) {
+	slices.SortFunc(records, func(a, b UsageRecord) int {
+		return cmp.Or(
+			cmp.Compare(a.Day, b.Day),
+			cmp.Compare(a.Key, b.Key),
+			cmp.Compare(a.Model, b.Model),
+		)
+	})
+}
+
+func record(day, key, model string, s usageStats) UsageRecord {
+	return UsageRecord{
+		Day:          day,
+		Key:          key,
+		Model:        model,
+		InputTokens:  s.InputTokens,
+		OutputTokens: s.OutputTokens,
+		Cost:         s.Cost,
+	}
+}
+
+// sum returns total usage of keys for which match returns true during days
+// with the prefix, which is either a day or a month.
+func (u *Usage) sum(match func(key string) bool, prefix string) usageStats {
+	var out usageStats
+	u.f.Read(func(d *usageData) {
+		for key, v := range d.ByKey {
+			if !match(key) {
+				continue
+			}
+			for day, daily := range v.ByDay {
+				if strings.HasPrefix(day, prefix) {
+					out.add(daily)
+				}
+			}
+		}
+	})
+	return out
+}
@@ -24,6 +24,15 @@ const (
 	tgFileURL = "https://api.telegram.org/file/bot"
 )
 
+// InterceptLocal is the name of a thread local that, if set to an
+// [Interceptor], makes telegram.call pass calls to it instead of sending them to
+// the Telegram Bot API.
+const InterceptLocal = "telegram.intercept"
+
+// Interceptor receives a call of a Telegram Bot API method with JSON-encoded
+// arguments and returns a JSON-encoded response.
+type Interceptor func(method string, args json.RawMessage) (json.RawMessage, error)
+
 // Module returns a Starlark module that exposes the Telegram Bot API.
 func Module(token string, client *http.Client) *starlarkstruct.Module {
 	m := &module{
@@ -67,6 +76,14 @@ func (m *module) call(thread *starlark.Thread, b *starlark.Builtin, args starlar
 		return nil, fmt.Errorf("%s: unexpected return type of json.encode Starlark function", b.Name())
 	}
 
+	if intercept, ok := thread.Local(InterceptLocal).(Interceptor); ok {
+		rawResp, err := intercept(string(method), json.RawMessage(rawReq))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+		return starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(rawResp)}, []starlark.Tuple{})
+	}
+
 	ctx := interpreter.Context(thread)
 	rawResp, err := request.Make[json.RawMessage](ctx, request.Params{
 		Method: http.MethodPost,
@@ -79,7 +96,7 @@ func (m *module) call(thread *starlark.Thread, b *starlark.Builtin, args starlar
 		Scrubber:   m.scrubber,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("%s: failed to make request: %s", b.Name(), err)
+		return nil, fmt.Errorf("%s: failed to make request: %w", b.Name(), err)
 	}
 
 	return starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(rawResp)}, []starlark.Tuple{})
@@ -6,6 +6,7 @@ package telegram
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
@@ -22,6 +23,7 @@ func TestTelegramModule(t *testing.T) {
 		script         string
 		mockStatusCode int
 		mockResponse   string
+		intercept      Interceptor
 		wantErr        string
 		wantOutput     string
 	}{
@@ -57,6 +59,22 @@ print(response)
 			mockResponse:   `{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`,
 			wantErr:        "telegram.call: failed to make request",
 		},
+		"intercepted": {
+			script: `
+response = telegram.call(
+    method="sendMessage",
+    args={"chat_id": 123456789, "text": "Hello, world!"}
+)
+
+print(response)
+`,
+			// Requests fail if they are made.
+			mockStatusCode: http.StatusInternalServerError,
+			intercept: func(method string, args json.RawMessage) (json.RawMessage, error) {
+				return fmt.Appendf(nil, `{"ok":true,"result":{"method":%q,"args":%s}}`, method, args), nil
+			},
+			wantOutput: `{"ok": True, "result": {"method": "sendMessage", "args": {"chat_id": 123456789, "text": "Hello, world!"}}}`,
+		},
 		"invalid args": {
 			script: `
 response = telegram.call(
@@ -110,6 +128,11 @@ print(response)
 					fmt.Fprint(&buf, message)
 				},
 			}
+			if tc.intercept != nil {
+				intr.ThreadModifier = func(thread *starlark.Thread) {
+					thread.SetLocal(InterceptLocal, tc.intercept)
+				}
+			}
 			if err := intr.Init(t.Context()); err != nil {
 				t.Fatal(err)
 			}
@@ -80,6 +80,7 @@ type persistedStats struct {
 }
 
 // NewJSONFile creates a new [JSONFile] backed by the file at path with the given TTL.
+// If ttl isn't positive, entries never expire.
 func NewJSONFile(ctx context.Context, path string, ttl time.Duration) (*JSONFile, error) {
 	f, err := jsonfile.Load[jsonStore](path)
 	if errors.Is(err, fs.ErrNotExist) {
@@ -115,6 +116,9 @@ func NewJSONFile(ctx context.Context, path string, ttl time.Duration) (*JSONFile
 }
 
 func (s *JSONFile) cleanup(ctx context.Context, firstRun bool) {
+	if s.ttl <= 0 {
+		return
+	}
 	if firstRun {
 		s.performCleanup()
 		return
@@ -136,7 +140,7 @@ func (s *JSONFile) performCleanup() {
 	var deleted uint64
 	err := s.f.Write(func(js *jsonStore) error {
 		for key, e := range js.Data {
-			if time.Since(e.LastAccessed) > s.ttl {
+			if s.isExpired(e.LastAccessed) {
 				delete(js.Data, key)
 				deleted++
 			}
@@ -149,6 +153,10 @@ func (s *JSONFile) performCleanup() {
 	}
 }
 
+func (s *JSONFile) isExpired(lastAccessed time.Time) bool {
+	return s.ttl > 0 && time.Since(lastAccessed) > s.ttl
+}
+
 // Get retrieves a value for a given key.
 func (s *JSONFile) Get(_ context.Context, key string) ([]byte, error) {
 	s.gets.Add(1)
@@ -164,7 +172,7 @@ func (s *JSONFile) Get(_ context.Context, key string) ([]byte, error) {
 		}
 
 		hit = true
-		if time.Since(e.LastAccessed) > s.ttl {
+		if s.isExpired(e.LastAccessed) {
 			delete(js.Data, key)
 			mutated = true
 			return nil
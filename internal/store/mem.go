@@ -17,7 +17,8 @@ type MemStore struct {
 	cache syncx.Map[string, cacheEntry]
 }
 
-// NewMemStore creates a new [MemStore] with the given TTL.
+// NewMemStore creates a new [MemStore] with the given TTL. If ttl isn't
+// positive, entries never expire.
 func NewMemStore(ctx context.Context, ttl time.Duration) *MemStore {
 	s := &MemStore{
 		ttl: ttl,
@@ -33,6 +34,9 @@ type cacheEntry struct {
 }
 
 func (s *MemStore) cleanup(ctx context.Context, firstRun bool) {
+	if s.ttl <= 0 {
+		return
+	}
 	if firstRun {
 		s.performCleanup()
 		return
@@ -52,13 +56,17 @@ func (s *MemStore) cleanup(ctx context.Context, firstRun bool) {
 
 func (s *MemStore) performCleanup() {
 	s.cache.Range(func(key string, entry cacheEntry) bool {
-		if time.Since(entry.lastAccessed) > s.ttl {
+		if s.isExpired(entry.lastAccessed) {
 			s.cache.Delete(key)
 		}
 		return true
 	})
 }
 
+func (s *MemStore) isExpired(lastAccessed time.Time) bool {
+	return s.ttl > 0 && time.Since(lastAccessed) > s.ttl
+}
+
 // Get retrieves a value for a given key.
 func (s *MemStore) Get(_ context.Context, key string) ([]byte, error) {
 	entry, ok := s.cache.Load(key)
@@ -66,7 +74,7 @@ func (s *MemStore) Get(_ context.Context, key string) ([]byte, error) {
 		return nil, nil
 	}
 
-	if time.Since(entry.lastAccessed) > s.ttl {
+	if s.isExpired(entry.lastAccessed) {
 		s.cache.Delete(key)
 		return nil, nil
 	}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"path/filepath"
 	"testing"
+	"testing/synctest"
 	"time"
 )
 
@@ -64,3 +65,30 @@ func testStore(t *testing.T, s Store) {
 		t.Errorf("got %q, want nil", v)
 	}
 }
+
+func TestNoTTL(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		stores := map[string]Store{
+			"mem": NewMemStore(t.Context(), 0),
+		}
+		s, err := NewJSONFile(t.Context(), filepath.Join(t.TempDir(), "store.json"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores["json"] = s
+
+		for name, s := range stores {
+			if err := s.Set(t.Context(), "key", []byte(`"value"`)); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(365 * 24 * time.Hour)
+			v, err := s.Get(t.Context(), "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(v) != `"value"` {
+				t.Errorf("%s: got %q, want the value to never expire", name, v)
+			}
+		}
+	})
+}